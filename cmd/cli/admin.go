@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Manage users, roles and the audit log as an operator",
+	Long: "Manage users, roles and the audit log through the server's admin RPCs. These commands send the server's " +
+		"admin token, or else an API key or access token holding the permission each command needs.",
+}
+
+func init() {
+	flags := adminCmd.PersistentFlags()
+	flags.StringVar(&adminToken, "admin-token", os.Getenv("AUTH_CLI_ADMIN_TOKEN"), "Admin token of the server (env AUTH_CLI_ADMIN_TOKEN)")
+	flags.StringVar(&apiKey, "api-key", os.Getenv("AUTH_CLI_API_KEY"), "API key or access token to use instead of the admin token (env AUTH_CLI_API_KEY)")
+
+	adminCmd.AddCommand(usersCmd, rolesCmd, auditCmd)
+	rootCmd.AddCommand(adminCmd)
+
+	// Earlier releases had these groups at the top level
+	for _, cmd := range []*cobra.Command{usersCmd, rolesCmd, auditCmd} {
+		rootCmd.AddCommand(deprecatedAdminAlias(cmd.Name()))
+	}
+}
+
+// deprecatedAdminAlias returns a hidden top-level command that runs "admin NAME" with the same
+// arguments and flags, so scripts written before the group moved under admin keep working
+func deprecatedAdminAlias(name string) *cobra.Command {
+	return &cobra.Command{
+		Use:                name,
+		Deprecated:         fmt.Sprintf("use \"admin %s\" instead", name),
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			rootCmd.SetArgs(append([]string{adminCmd.Name(), name}, args...))
+			if err := rootCmd.Execute(); err != nil {
+				log.Fatalf("Error executing command: %v", err)
+			}
+		},
+	}
+}
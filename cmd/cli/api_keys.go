@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+)
+
+var apiKeysCmd = &cobra.Command{
+	Use:   "api-keys",
+	Short: "Manage API keys",
+	Long: "Create, list and revoke API keys. API keys act as the user who created them and are sent as bearer tokens " +
+		"wherever access tokens are accepted. --token is your access token; the admin token, or an access token with " +
+		"the apikeys:manage permission, manages the keys of any user.",
+}
+
+var apiKeysCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create an API key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		expiresIn, _ := cmd.Flags().GetDuration("expires-in")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.CreateAPIKey(ctx, &pb.CreateAPIKeyRequest{
+			Name:      args[0],
+			Scopes:    scopes,
+			ExpiresIn: int64(expiresIn / time.Second),
+		})
+		if err != nil {
+			log.Fatalf("Failed to create API key: %v", err)
+		}
+
+		key := res.GetApiKey()
+		fmt.Printf("ID: %s\n", key.GetId())
+		fmt.Printf("Key: %s\n", res.GetKey())
+		if key.GetExpiresAt() != "" {
+			fmt.Printf("Expires at: %s\n", key.GetExpiresAt())
+		}
+		fmt.Println("Store the key now; it cannot be shown again.")
+	},
+}
+
+var apiKeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your API keys, or another user's",
+	Run: func(cmd *cobra.Command, args []string) {
+		userID, _ := cmd.Flags().GetString("user")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.ListAPIKeys(ctx, &pb.ListAPIKeysRequest{UserId: userID})
+		if err != nil {
+			log.Fatalf("Failed to list API keys: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES AT\tLAST USED AT")
+		for _, key := range res.GetApiKeys() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.GetId(), key.GetName(), key.GetPrefix(),
+				strings.Join(key.GetScopes(), ","), key.GetExpiresAt(), key.GetLastUsedAt())
+		}
+		w.Flush()
+	},
+}
+
+var apiKeysRevokeCmd = &cobra.Command{
+	Use:   "revoke ID",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		if _, err := client.RevokeAPIKey(ctx, &pb.RevokeAPIKeyRequest{Id: args[0]}); err != nil {
+			log.Fatalf("Failed to revoke API key: %v", err)
+		}
+
+		fmt.Printf("API key %s revoked\n", args[0])
+	},
+}
+
+var apiKeysIntrospectCmd = &cobra.Command{
+	Use:   "introspect TOKEN",
+	Short: "Show whether an access token or API key is valid and what it grants",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(false)
+		defer cancel()
+
+		res, err := client.IntrospectToken(ctx, &pb.IntrospectTokenRequest{Token: args[0]})
+		if err != nil {
+			log.Fatalf("Failed to introspect token: %v", err)
+		}
+
+		fmt.Printf("Active: %t\n", res.GetActive())
+		if !res.GetActive() {
+			return
+		}
+		fmt.Printf("Type: %s\n", res.GetTokenType())
+		fmt.Printf("User ID: %s\n", res.GetUserId())
+		fmt.Printf("Client ID: %s\n", res.GetClientId())
+		fmt.Printf("Organization ID: %s\n", res.GetOrgId())
+		fmt.Printf("Roles: %s\n", strings.Join(res.GetRoles(), ", "))
+		fmt.Printf("Permissions: %s\n", strings.Join(res.GetPermissions(), ", "))
+		fmt.Printf("Expires at: %s\n", res.GetExpiresAt())
+	},
+}
+
+func init() {
+	apiKeysCmd.PersistentFlags().StringVar(&userToken, "token", os.Getenv("AUTH_CLI_TOKEN"), "Admin token or access token (env AUTH_CLI_TOKEN)")
+
+	apiKeysCreateCmd.Flags().StringSlice("scope", nil, "Permission to limit the key to (repeatable); all of your permissions when omitted")
+	apiKeysCreateCmd.Flags().Duration("expires-in", 0, "Lifetime of the key, such as 720h; the key does not expire when omitted")
+	apiKeysListCmd.Flags().String("user", "", "List another user's keys (administrators only)")
+
+	apiKeysCmd.AddCommand(apiKeysCreateCmd, apiKeysListCmd, apiKeysRevokeCmd, apiKeysIntrospectCmd)
+	rootCmd.AddCommand(apiKeysCmd)
+}
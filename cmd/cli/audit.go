@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Search and verify the audit log",
+	Long: "Search and verify the audit log of security events. These commands need the server's admin token, " +
+		"or an access token or API key with audit:read.",
+}
+
+var auditQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "List audit events matching filters, a page at a time",
+	Run: func(cmd *cobra.Command, args []string) {
+		pageSize, _ := cmd.Flags().GetInt32("page-size")
+		pageToken, _ := cmd.Flags().GetString("page-token")
+		eventType, _ := cmd.Flags().GetString("type")
+		actorID, _ := cmd.Flags().GetString("actor")
+		subjectID, _ := cmd.Flags().GetString("subject")
+		createdAfter, _ := cmd.Flags().GetString("created-after")
+		createdBefore, _ := cmd.Flags().GetString("created-before")
+		ascending, _ := cmd.Flags().GetBool("asc")
+		output, _ := cmd.Flags().GetString("output")
+		if output != "table" && output != "json" {
+			log.Fatalf("--output must be table or json")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.QueryAuditLog(ctx, &pb.QueryAuditLogRequest{
+			PageSize:      pageSize,
+			PageToken:     pageToken,
+			Type:          eventType,
+			ActorId:       actorID,
+			SubjectId:     subjectID,
+			CreatedAfter:  createdAfter,
+			CreatedBefore: createdBefore,
+			Ascending:     ascending,
+		})
+		if err != nil {
+			log.Fatalf("Failed to query audit log: %v", err)
+		}
+
+		if output == "json" {
+			data, err := protojson.MarshalOptions{Multiline: true, UseProtoNames: true}.Marshal(res)
+			if err != nil {
+				log.Fatalf("Failed to encode audit events: %v", err)
+			}
+			fmt.Println(string(data))
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED AT\tTYPE\tACTOR\tSUBJECT\tIP\tDETAILS")
+		for _, event := range res.GetEvents() {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", event.GetId(), event.GetCreatedAt(), event.GetType(),
+				event.GetActorId(), event.GetSubjectId(), event.GetIp(), formatMetadata(event.GetMetadata()))
+		}
+		w.Flush()
+		if res.GetNextPageToken() != "" {
+			fmt.Printf("\nNext page: --page-token %s\n", res.GetNextPageToken())
+		}
+	},
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the hash chain of the audit log for tampering",
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.VerifyAuditLog(ctx, &pb.VerifyAuditLogRequest{})
+		if err != nil {
+			log.Fatalf("Failed to verify audit log: %v", err)
+		}
+
+		if !res.GetValid() {
+			fmt.Printf("Audit log is broken at event %d: %s\n", res.GetFirstInvalidId(), res.GetProblem())
+			fmt.Printf("Events verified before it: %d\n", res.GetEventsChecked())
+			fmt.Printf("Last valid hash: %s\n", res.GetHeadHash())
+			os.Exit(1)
+		}
+		fmt.Printf("Audit log is intact (%d events)\n", res.GetEventsChecked())
+		fmt.Printf("Head hash: %s\n", res.GetHeadHash())
+	},
+}
+
+// formatMetadata renders event metadata as sorted key=value pairs
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+metadata[key])
+	}
+	return strings.Join(pairs, " ")
+}
+
+func init() {
+	auditQueryCmd.Flags().Int32("page-size", 0, "Events per page, up to 1000 (default 100)")
+	auditQueryCmd.Flags().String("page-token", "", "Token of the page to fetch, printed after the previous page")
+	auditQueryCmd.Flags().String("type", "", "Only events of this type, such as login.failed")
+	auditQueryCmd.Flags().String("actor", "", "Only events caused by this actor: a user ID, client:<id> or admin")
+	auditQueryCmd.Flags().String("subject", "", "Only events about this user ID")
+	auditQueryCmd.Flags().String("created-after", "", "Only events at or after this RFC 3339 time")
+	auditQueryCmd.Flags().String("created-before", "", "Only events before this RFC 3339 time")
+	auditQueryCmd.Flags().Bool("asc", false, "Oldest events first")
+	auditQueryCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+
+	auditCmd.AddCommand(auditQueryCmd, auditVerifyCmd)
+}
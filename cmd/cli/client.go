@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"crypto/tls"
+	"os"
+
+	"github.com/kraftzpepe/auth-service/internal/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Connection security flags shared by every command
+var (
+	useTLS     bool
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+)
+
+// tlsEnabled reports whether TLS was requested, or any TLS option is set
+func tlsEnabled() bool {
+	return useTLS || caFile != "" || certFile != "" || keyFile != "" || serverName != ""
+}
+
+// clientTLSConfig returns the TLS configuration of connections to the server
+func clientTLSConfig() (*tls.Config, error) {
+	return tlsconfig.ClientConfig(tlsconfig.ClientOptions{
+		CAFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: serverName,
+	})
+}
+
+// dial connects to the AuthService, using TLS when requested or when any TLS option is set
+func dial() (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if tlsEnabled() {
+		config, err := clientTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(config)
+	}
+	return grpc.NewClient(serverAddress(), grpc.WithTransportCredentials(creds))
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.BoolVar(&useTLS, "tls", os.Getenv("AUTH_CLI_TLS") == "true", "Connect using TLS (env AUTH_CLI_TLS)")
+	flags.StringVar(&caFile, "ca-file", os.Getenv("AUTH_CLI_CA_FILE"), "CA bundle used to verify the server (env AUTH_CLI_CA_FILE)")
+	flags.StringVar(&certFile, "cert-file", os.Getenv("AUTH_CLI_CERT_FILE"), "Client certificate for mutual TLS (env AUTH_CLI_CERT_FILE)")
+	flags.StringVar(&keyFile, "key-file", os.Getenv("AUTH_CLI_KEY_FILE"), "Client private key for mutual TLS (env AUTH_CLI_KEY_FILE)")
+	flags.StringVar(&serverName, "server-name", os.Getenv("AUTH_CLI_SERVER_NAME"), "Override the server name verified in its certificate (env AUTH_CLI_SERVER_NAME)")
+}
@@ -0,0 +1,319 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/metadata"
+)
+
+// Credentials of the admin commands
+var (
+	adminToken string
+	apiKey     string
+)
+
+// adminContext returns a request context carrying the admin token, or else the API key
+func adminContext() (context.Context, context.CancelFunc) {
+	token := adminToken
+	if token == "" {
+		token = apiKey
+	}
+	if token == "" {
+		log.Fatalf("An admin token or API key is required: pass --admin-token or --api-key, or set AUTH_CLI_ADMIN_TOKEN or AUTH_CLI_API_KEY")
+	}
+	return bearerContext(token)
+}
+
+var userToken string
+
+// tokenContext returns a request context carrying the token passed as --token to commands that
+// act for a user, or else the access token saved by login for the current profile
+func tokenContext(required bool) (context.Context, context.CancelFunc) {
+	token := userToken
+	if token == "" {
+		token = storedAccessToken()
+	}
+	if required && token == "" {
+		log.Fatalf("A token is required: run login, pass --token or set AUTH_CLI_TOKEN")
+	}
+	return bearerContext(token)
+}
+
+// bearerContext returns a request context carrying token as a bearer token, if it is set
+func bearerContext(token string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout())
+	if token == "" {
+		return ctx, cancel
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), cancel
+}
+
+var clientsCmd = &cobra.Command{
+	Use:   "clients",
+	Short: "Manage OAuth clients",
+	Long:  "Register, list, update and delete OAuth clients. Requires the server's admin token.",
+}
+
+var clientsCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Register an OAuth client",
+	Long:  "Register an OAuth client. The client secret is printed once and cannot be retrieved later.",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		redirectURIs, _ := cmd.Flags().GetStringSlice("redirect-uri")
+		grantTypes, _ := cmd.Flags().GetStringSlice("grant-type")
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		accessTTL, _ := cmd.Flags().GetDuration("access-token-ttl")
+		refreshTTL, _ := cmd.Flags().GetDuration("refresh-token-ttl")
+		public, _ := cmd.Flags().GetBool("public")
+		publicKey := readPublicKeyFlag(cmd)
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.CreateOAuthClient(ctx, &pb.CreateOAuthClientRequest{
+			Name:                   name,
+			RedirectUris:           redirectURIs,
+			GrantTypes:             grantTypes,
+			Scopes:                 scopes,
+			AccessTokenTtlSeconds:  int64(accessTTL.Seconds()),
+			RefreshTokenTtlSeconds: int64(refreshTTL.Seconds()),
+			Public:                 public,
+			PublicKeyPem:           publicKey,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create client: %v", err)
+		}
+
+		printOAuthClient(res.GetClient())
+		if res.GetClientSecret() != "" {
+			fmt.Printf("Client Secret: %s\n", res.GetClientSecret())
+			fmt.Println("Store the secret now, it will not be shown again.")
+		}
+	},
+}
+
+var clientsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List OAuth clients",
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ListOAuthClients(ctx, &pb.ListOAuthClientsRequest{})
+		if err != nil {
+			log.Fatalf("Failed to list clients: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CLIENT ID\tNAME\tAUTHENTICATION\tGRANTS\tSCOPES")
+		for _, c := range res.GetClients() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.GetClientId(), c.GetName(), clientAuthType(c),
+				strings.Join(c.GetGrantTypes(), ","), strings.Join(c.GetScopes(), ","))
+		}
+		w.Flush()
+	},
+}
+
+var clientsUpdateCmd = &cobra.Command{
+	Use:   "update CLIENT_ID",
+	Short: "Update an OAuth client",
+	Long:  "Update an OAuth client. Only the settings passed as flags are changed; list flags replace the existing list.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		redirectURIs, _ := cmd.Flags().GetStringSlice("redirect-uri")
+		grantTypes, _ := cmd.Flags().GetStringSlice("grant-type")
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		accessTTL, _ := cmd.Flags().GetDuration("access-token-ttl")
+		refreshTTL, _ := cmd.Flags().GetDuration("refresh-token-ttl")
+		publicKey := readPublicKeyFlag(cmd)
+
+		// Map the flags that were set onto the fields of the update mask
+		var mask []string
+		for flag, field := range map[string]string{
+			"name":              "name",
+			"redirect-uri":      "redirect_uris",
+			"grant-type":        "grant_types",
+			"scope":             "scopes",
+			"access-token-ttl":  "access_token_ttl_seconds",
+			"refresh-token-ttl": "refresh_token_ttl_seconds",
+			"public-key-file":   "public_key_pem",
+		} {
+			if cmd.Flags().Changed(flag) {
+				mask = append(mask, field)
+			}
+		}
+		if len(mask) == 0 {
+			log.Fatalf("Nothing to update: pass at least one setting")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.UpdateOAuthClient(ctx, &pb.UpdateOAuthClientRequest{
+			ClientId:               args[0],
+			Name:                   name,
+			RedirectUris:           redirectURIs,
+			GrantTypes:             grantTypes,
+			Scopes:                 scopes,
+			AccessTokenTtlSeconds:  int64(accessTTL.Seconds()),
+			RefreshTokenTtlSeconds: int64(refreshTTL.Seconds()),
+			UpdateMask:             mask,
+			PublicKeyPem:           publicKey,
+		})
+		if err != nil {
+			log.Fatalf("Failed to update client: %v", err)
+		}
+
+		printOAuthClient(res.GetClient())
+	},
+}
+
+var clientsRotateSecretCmd = &cobra.Command{
+	Use:   "rotate-secret CLIENT_ID",
+	Short: "Replace the secret of an OAuth client",
+	Long:  "Generate a new secret for a confidential client. The old secret stops working immediately.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.RotateOAuthClientSecret(ctx, &pb.RotateOAuthClientSecretRequest{ClientId: args[0]})
+		if err != nil {
+			log.Fatalf("Failed to rotate client secret: %v", err)
+		}
+
+		fmt.Printf("Client Secret: %s\n", res.GetClientSecret())
+		fmt.Println("Store the secret now, it will not be shown again.")
+	},
+}
+
+var clientsDeleteCmd = &cobra.Command{
+	Use:   "delete CLIENT_ID",
+	Short: "Delete an OAuth client",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.DeleteOAuthClient(ctx, &pb.DeleteOAuthClientRequest{ClientId: args[0]}); err != nil {
+			log.Fatalf("Failed to delete client: %v", err)
+		}
+
+		fmt.Printf("Client %s deleted\n", args[0])
+	},
+}
+
+func printOAuthClient(c *pb.OAuthClient) {
+	fmt.Printf("Client ID: %s\n", c.GetClientId())
+	fmt.Printf("Name: %s\n", c.GetName())
+	fmt.Printf("Authentication: %s\n", clientAuthType(c))
+	fmt.Printf("Redirect URIs: %s\n", strings.Join(c.GetRedirectUris(), ", "))
+	fmt.Printf("Grant Types: %s\n", strings.Join(c.GetGrantTypes(), ", "))
+	fmt.Printf("Scopes: %s\n", strings.Join(c.GetScopes(), ", "))
+	fmt.Printf("Access Token TTL: %s\n", ttlString(c.GetAccessTokenTtlSeconds()))
+	fmt.Printf("Refresh Token TTL: %s\n", ttlString(c.GetRefreshTokenTtlSeconds()))
+}
+
+// clientAuthType describes how a client authenticates at the token endpoint
+func clientAuthType(c *pb.OAuthClient) string {
+	switch {
+	case c.GetPublic():
+		return "public"
+	case c.GetPublicKeyPem() != "":
+		return "private_key_jwt"
+	}
+	return "client_secret"
+}
+
+// readPublicKeyFlag returns the contents of the file named by --public-key-file, if set
+func readPublicKeyFlag(cmd *cobra.Command) string {
+	path, _ := cmd.Flags().GetString("public-key-file")
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read public key: %v", err)
+	}
+	return string(data)
+}
+
+func ttlString(seconds int64) string {
+	if seconds == 0 {
+		return "server default"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// addClientSettingFlags registers the flags shared by clients create and clients update
+func addClientSettingFlags(cmd *cobra.Command) {
+	cmd.Flags().String("name", "", "Display name shown on the consent page")
+	cmd.Flags().StringSlice("redirect-uri", nil, "Allowed redirect URI (repeatable)")
+	cmd.Flags().StringSlice("grant-type", nil, "Allowed grant type: authorization_code, refresh_token, client_credentials or urn:ietf:params:oauth:grant-type:device_code (repeatable)")
+	cmd.Flags().StringSlice("scope", nil, "Allowed scope (repeatable)")
+	cmd.Flags().Duration("access-token-ttl", 0, "Access token lifetime, e.g. 1h (0 uses the server default)")
+	cmd.Flags().Duration("refresh-token-ttl", 0, "Refresh token lifetime, e.g. 720h (0 uses the server default)")
+	cmd.Flags().String("public-key-file", "", "PEM public key for private_key_jwt client authentication")
+}
+
+func init() {
+	clientsCmd.PersistentFlags().StringVar(&adminToken, "admin-token", os.Getenv("AUTH_CLI_ADMIN_TOKEN"), "Admin token of the server (env AUTH_CLI_ADMIN_TOKEN)")
+
+	addClientSettingFlags(clientsCreateCmd)
+	clientsCreateCmd.Flags().Bool("public", false, "Create a public client without a secret (browser and native apps)")
+	clientsCreateCmd.MarkFlagRequired("name")
+	addClientSettingFlags(clientsUpdateCmd)
+
+	clientsCmd.AddCommand(clientsCreateCmd, clientsListCmd, clientsUpdateCmd, clientsRotateSecretCmd, clientsDeleteCmd)
+	rootCmd.AddCommand(clientsCmd)
+}
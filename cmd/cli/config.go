@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Defaults used when neither a flag, an environment variable nor the profile sets a value
+const (
+	defaultServer     = "localhost:50051"
+	defaultIssuerHost = "localhost:8080" // Reached over https when TLS is configured, and http otherwise
+	defaultTimeout    = 5 * time.Second
+)
+
+// Global flags selecting the profile and overriding its settings
+var (
+	profileName    string
+	serverFlag     string
+	requestTimeout time.Duration
+)
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// cliConfig is the config file of the CLI, holding the settings of each profile
+type cliConfig struct {
+	Profiles map[string]*profileConfig `json:"profiles"`
+}
+
+// profileConfig holds the settings of a profile. Empty settings use the defaults.
+type profileConfig struct {
+	Server   string `json:"server,omitempty"`    // gRPC address of the AuthService
+	Issuer   string `json:"issuer,omitempty"`    // Base URL of the OAuth endpoints
+	ClientID string `json:"client_id,omitempty"` // OAuth client used by device login
+	Timeout  string `json:"timeout,omitempty"`   // Request timeout, such as 10s
+}
+
+// configDir returns the directory holding the config file and credentials
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "auth-cli"), nil
+}
+
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// loadConfig reads the config file, which may not exist yet
+func loadConfig() (*cliConfig, error) {
+	config := &cliConfig{Profiles: map[string]*profileConfig{}}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]*profileConfig{}
+	}
+	return config, nil
+}
+
+// currentProfile returns the name of the profile selected with --profile, exiting if it is invalid
+func currentProfile() string {
+	if !profileNamePattern.MatchString(profileName) {
+		log.Fatalf("Invalid profile name %q: use letters, digits, - and _", profileName)
+	}
+	return profileName
+}
+
+// profileSettings returns the settings of the current profile, exiting if the config file cannot be read
+func profileSettings() *profileConfig {
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to read config: %v", err)
+	}
+	if profile, ok := config.Profiles[currentProfile()]; ok {
+		return profile
+	}
+	return &profileConfig{}
+}
+
+// serverAddress returns the address from --server, or else the profile's server
+func serverAddress() string {
+	if serverFlag != "" {
+		return serverFlag
+	}
+	if server := profileSettings().Server; server != "" {
+		return server
+	}
+	return defaultServer
+}
+
+// timeout returns the request timeout from --timeout, or else the profile's timeout
+func timeout() time.Duration {
+	if requestTimeout > 0 {
+		return requestTimeout
+	}
+	if value := profileSettings().Timeout; value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid timeout %q in profile %s", value, currentProfile())
+		}
+		return d
+	}
+	return defaultTimeout
+}
+
+// writePrivateFile replaces the file at path with data readable by the current user only
+func writePrivateFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Write to a temporary file first, which is created with 0600 permissions, so the file is never
+	// readable by others or left half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change the settings of a profile",
+	Long: "Show and change the settings of the profile selected with --profile. Settings are kept in auth-cli/config.json " +
+		"in your config directory; flags and environment variables take precedence over them.",
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Change a setting: server, issuer, client-id or timeout",
+	Long:  "Change a setting of the profile: server, issuer, client-id or timeout. An empty VALUE restores the default.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, value := args[0], args[1]
+		name := currentProfile()
+
+		config, err := loadConfig()
+		if err != nil {
+			log.Fatalf("Failed to read config: %v", err)
+		}
+		profile := config.Profiles[name]
+		if profile == nil {
+			profile = &profileConfig{}
+			config.Profiles[name] = profile
+		}
+
+		switch key {
+		case "server":
+			profile.Server = value
+		case "issuer":
+			profile.Issuer = value
+		case "client-id":
+			profile.ClientID = value
+		case "timeout":
+			if d, err := time.ParseDuration(value); value != "" && (err != nil || d <= 0) {
+				log.Fatalf("timeout must be a positive duration, such as 10s")
+			}
+			profile.Timeout = value
+		default:
+			log.Fatalf("Unknown setting %q: use server, issuer, client-id or timeout", key)
+		}
+
+		path, err := configPath()
+		if err != nil {
+			log.Fatalf("Failed to locate config: %v", err)
+		}
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode config: %v", err)
+		}
+		if err := writePrivateFile(path, data); err != nil {
+			log.Fatalf("Failed to save config: %v", err)
+		}
+		fmt.Printf("Profile %s: %s set\n", name, key)
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the settings in effect for a profile",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Profile: %s\n", currentProfile())
+		fmt.Printf("Server: %s\n", serverAddress())
+		fmt.Printf("Issuer: %s\n", oauthIssuer())
+		fmt.Printf("Client ID: %s\n", deviceClientID())
+		fmt.Printf("Timeout: %s\n", timeout())
+	},
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&profileName, "profile", envOr("AUTH_CLI_PROFILE", "default"), "Profile whose settings and credentials to use (env AUTH_CLI_PROFILE)")
+	flags.StringVar(&serverFlag, "server", os.Getenv("AUTH_CLI_SERVER"), "Address of the AuthService, default localhost:50051 (env AUTH_CLI_SERVER)")
+	flags.DurationVar(&requestTimeout, "timeout", envDuration("AUTH_CLI_TIMEOUT"), "Timeout of each request, default 5s (env AUTH_CLI_TIMEOUT)")
+
+	configCmd.AddCommand(configSetCmd, configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// envOr returns the value of an environment variable, or fallback when it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envDuration parses a duration from an environment variable, exiting if it is malformed
+func envDuration(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s must be a duration, such as 10s", name)
+	}
+	return d
+}
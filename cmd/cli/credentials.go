@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// refreshMargin refreshes access tokens this long before they expire, so they do not expire in flight
+const refreshMargin = 30 * time.Second
+
+// storedCredentials are the tokens saved by login and signup, which commands use when no --token is passed
+type storedCredentials struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// newCredentials returns credentials for a token pair, taking the expiry from the access token
+func newCredentials(accessToken, refreshToken string) *storedCredentials {
+	creds := &storedCredentials{AccessToken: accessToken, RefreshToken: refreshToken}
+	// The CLI only reads the expiry; the server verifies the token
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, &claims); err == nil && claims.ExpiresAt != nil {
+		creds.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return creds
+}
+
+// credentialsPath returns the credential file of the current profile
+func credentialsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials", currentProfile()+".json"), nil
+}
+
+// loadCredentials reads the credentials of the current profile, or returns nil if there are none
+func loadCredentials() (*storedCredentials, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var creds storedCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// saveCredentials stores the credentials of the current profile, readable by the current user
+// only, and returns the file path
+func saveCredentials(creds *storedCredentials) (string, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, writePrivateFile(path, data)
+}
+
+// mustSaveCredentials saves credentials and reports where, exiting if they cannot be saved
+func mustSaveCredentials(creds *storedCredentials) {
+	path, err := saveCredentials(creds)
+	if err != nil {
+		log.Fatalf("Failed to save credentials: %v", err)
+	}
+	fmt.Printf("Credentials saved to %s\n", path)
+}
+
+// storedAccessToken returns the saved access token of the current profile, refreshing it with the
+// saved refresh token when it has expired. It returns an empty token if there is none.
+func storedAccessToken() string {
+	creds, err := loadCredentials()
+	if err != nil {
+		log.Fatalf("Failed to read saved credentials: %v", err)
+	}
+	if creds == nil {
+		return ""
+	}
+	if time.Now().Add(refreshMargin).Before(creds.ExpiresAt) {
+		return creds.AccessToken
+	}
+	if creds.RefreshToken == "" {
+		return ""
+	}
+
+	conn, err := dial()
+	if err != nil {
+		log.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout())
+	defer cancel()
+
+	res, err := pb.NewAuthServiceClient(conn).RefreshAccessToken(ctx, &pb.RefreshTokenRequest{RefreshToken: creds.RefreshToken})
+	if err != nil {
+		log.Fatalf("Failed to refresh the saved access token, run login again: %v", err)
+	}
+	creds = newCredentials(res.GetAccessToken(), res.GetRefreshToken())
+	if _, err := saveCredentials(creds); err != nil {
+		log.Fatalf("Failed to save credentials: %v", err)
+	}
+	return creds.AccessToken
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuth endpoints of the server, relative to --issuer
+const (
+	deviceAuthorizationPath = "/oauth/device_authorization"
+	tokenPath               = "/oauth/token"
+	deviceCodeGrantType     = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// Device login flags
+var (
+	issuerURL     string
+	oauthClientID string
+)
+
+// oauthIssuer returns the base URL of the OAuth endpoints from --issuer, or else the profile's issuer
+func oauthIssuer() string {
+	if issuerURL != "" {
+		return issuerURL
+	}
+	if issuer := profileSettings().Issuer; issuer != "" {
+		return issuer
+	}
+	if tlsEnabled() {
+		return "https://" + defaultIssuerHost
+	}
+	return "http://" + defaultIssuerHost
+}
+
+// oauthHTTPClient returns the client calling the OAuth endpoints, which uses the TLS options of the
+// gRPC connection
+func oauthHTTPClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsEnabled() {
+		config, err := clientTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = config
+	}
+	return &http.Client{Transport: transport, Timeout: timeout()}, nil
+}
+
+// deviceClientID returns the OAuth client of device login from --client-id, or else the profile's client
+func deviceClientID() string {
+	if oauthClientID != "" {
+		return oauthClientID
+	}
+	return profileSettings().ClientID
+}
+
+// deviceAuthorization is the response of the device authorization endpoint
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// oauthTokenResponse is the successful response of the token endpoint
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// oauthError is an error response of the OAuth endpoints
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// deviceLogin signs the user in with the OAuth device authorization grant: it shows a code for the
+// user to approve in a browser and polls the token endpoint until they do
+func deviceLogin(ctx context.Context, scope string) (*storedCredentials, error) {
+	clientID := deviceClientID()
+	if clientID == "" {
+		return nil, fmt.Errorf("a client ID is required: pass --client-id, set AUTH_CLI_CLIENT_ID or run config set client-id")
+	}
+	issuer := strings.TrimSuffix(oauthIssuer(), "/")
+	if tlsEnabled() && !strings.HasPrefix(issuer, "https://") {
+		return nil, fmt.Errorf("TLS is configured but the issuer %s does not use https", issuer)
+	}
+	client, err := oauthHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var auth deviceAuthorization
+	form := url.Values{"client_id": {clientID}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	if err := postForm(ctx, client, issuer+deviceAuthorizationPath, form, &auth); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("To sign in, open %s and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	fmt.Printf("Or open %s\n", auth.VerificationURIComplete)
+	fmt.Println("Waiting for approval...")
+
+	interval := time.Duration(auth.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var res oauthTokenResponse
+		err := postForm(ctx, client, issuer+tokenPath, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {clientID},
+		}, &res)
+		var oauthErr *oauthError
+		if errors.As(err, &oauthErr) {
+			switch oauthErr.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			case "access_denied":
+				return nil, fmt.Errorf("the request was denied")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &storedCredentials{
+			AccessToken:  res.AccessToken,
+			RefreshToken: res.RefreshToken,
+			ExpiresAt:    time.Now().Add(time.Duration(res.ExpiresIn) * time.Second),
+		}, nil
+	}
+	return nil, fmt.Errorf("the code expired before it was approved")
+}
+
+// postForm posts a form to an OAuth endpoint and decodes its JSON response into out. OAuth error
+// responses are returned as an *oauthError.
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var oauthErr oauthError
+		if err := json.NewDecoder(res.Body).Decode(&oauthErr); err != nil || oauthErr.Code == "" {
+			return fmt.Errorf("unexpected response from %s: %s", endpoint, res.Status)
+		}
+		return &oauthErr
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
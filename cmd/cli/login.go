@@ -4,24 +4,39 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"time"
+	"os"
 
 	pb "github.com/kraftzpepe/auth-service/proto/generated"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Log in as a user",
-	Long:  "Log in as a user by providing an email and password to receive access and refresh tokens.",
+	Long: "Log in as a user and save the tokens as the credentials of the profile. Without --password, login shows a code " +
+		"to approve in your browser, so your password stays out of the shell history.",
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get flags for email and password
 		email, _ := cmd.Flags().GetString("email")
 		password, _ := cmd.Flags().GetString("password")
+		orgID, _ := cmd.Flags().GetString("org")
+		scope, _ := cmd.Flags().GetString("scope")
+
+		if password == "" {
+			if orgID != "" {
+				log.Fatalf("--org needs --email and --password")
+			}
+			creds, err := deviceLogin(cmd.Context(), scope)
+			if err != nil {
+				log.Fatalf("Login failed: %v", err)
+			}
+			fmt.Println("Login successful.")
+			mustSaveCredentials(creds)
+			return
+		}
 
 		// Connect to the gRPC server
-		conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+		conn, err := dial()
 		if err != nil {
 			log.Fatalf("Failed to connect to server: %v", err)
 		}
@@ -33,10 +48,11 @@ var loginCmd = &cobra.Command{
 		req := &pb.LoginRequest{
 			Email:    email,
 			Password: password,
+			OrgId:    orgID,
 		}
 
 		// Set a timeout for the request
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout())
 		defer cancel()
 
 		// Call the Login method
@@ -45,10 +61,8 @@ var loginCmd = &cobra.Command{
 			log.Fatalf("Login failed: %v", err)
 		}
 
-		// Print the tokens
-		fmt.Printf("Login successful:\n")
-		fmt.Printf("AccessToken: %s\n", res.GetAccessToken())
-		fmt.Printf("RefreshToken: %s\n", res.GetRefreshToken())
+		fmt.Println("Login successful.")
+		mustSaveCredentials(newCredentials(res.GetAccessToken(), res.GetRefreshToken()))
 	},
 }
 
@@ -56,8 +70,11 @@ func init() {
 	// Add flags for the login command
 	loginCmd.Flags().String("email", "", "Email for the user")
 	loginCmd.Flags().String("password", "", "Password for the user")
-	loginCmd.MarkFlagRequired("email")
-	loginCmd.MarkFlagRequired("password")
+	loginCmd.Flags().String("org", "", "ID of the organization to sign in to")
+	loginCmd.Flags().String("scope", "", "Scopes to request when logging in through the browser")
+	loginCmd.Flags().StringVar(&issuerURL, "issuer", os.Getenv("AUTH_CLI_ISSUER"), "Base URL of the server's OAuth endpoints, default http://localhost:8080, or https with TLS (env AUTH_CLI_ISSUER)")
+	loginCmd.Flags().StringVar(&oauthClientID, "client-id", os.Getenv("AUTH_CLI_CLIENT_ID"), "OAuth client registered for the device_code grant (env AUTH_CLI_CLIENT_ID)")
+	loginCmd.MarkFlagsRequiredTogether("email", "password")
 
 	rootCmd.AddCommand(loginCmd)
 }
@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+)
+
+var orgsCmd = &cobra.Command{
+	Use:   "orgs",
+	Short: "Manage organizations and their members",
+	Long: "Create organizations, invite members and switch between organizations. --token is the server's admin token, " +
+		"or a user access token; tokens scoped to an organization manage its members with the members:manage permission.",
+}
+
+var orgsCreateCmd = &cobra.Command{
+	Use:   "create SLUG",
+	Short: "Create an organization",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		isolated, _ := cmd.Flags().GetBool("isolated-accounts")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.CreateOrganization(ctx, &pb.CreateOrganizationRequest{Slug: args[0], Name: name, IsolatedAccounts: isolated})
+		if err != nil {
+			log.Fatalf("Failed to create organization: %v", err)
+		}
+
+		org := res.GetOrganization()
+		fmt.Printf("ID: %s\n", org.GetId())
+		fmt.Printf("Slug: %s\n", org.GetSlug())
+		fmt.Printf("Name: %s\n", org.GetName())
+		fmt.Printf("Isolated accounts: %t\n", org.GetIsolatedAccounts())
+	},
+}
+
+var orgsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List organizations",
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.ListOrganizations(ctx, &pb.ListOrganizationsRequest{})
+		if err != nil {
+			log.Fatalf("Failed to list organizations: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSLUG\tNAME\tISOLATED ACCOUNTS")
+		for _, org := range res.GetOrganizations() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", org.GetId(), org.GetSlug(), org.GetName(), org.GetIsolatedAccounts())
+		}
+		w.Flush()
+	},
+}
+
+var orgsInviteCmd = &cobra.Command{
+	Use:   "invite ORG_ID EMAIL",
+	Short: "Email an invitation to join an organization",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		roles, _ := cmd.Flags().GetStringSlice("role")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.InviteMember(ctx, &pb.InviteMemberRequest{OrgId: args[0], Email: args[1], Roles: roles})
+		if err != nil {
+			log.Fatalf("Failed to invite member: %v", err)
+		}
+
+		fmt.Printf("Invitation sent to %s, valid until %s\n", args[1], res.GetExpiresAt())
+	},
+}
+
+var orgsAcceptCmd = &cobra.Command{
+	Use:   "accept INVITATION_TOKEN",
+	Short: "Accept an invitation",
+	Long: "Accept an invitation to an organization. Organizations with isolated accounts create your account " +
+		"from --username and --password; otherwise pass your access token as --token.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		username, _ := cmd.Flags().GetString("username")
+		password, _ := cmd.Flags().GetString("password")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(false)
+		defer cancel()
+
+		res, err := client.AcceptInvitation(ctx, &pb.AcceptInvitationRequest{Token: args[0], Username: username, Password: password})
+		if err != nil {
+			log.Fatalf("Failed to accept invitation: %v", err)
+		}
+
+		fmt.Printf("Joined organization %s as %s\n", res.GetOrgId(), res.GetUserId())
+		fmt.Printf("AccessToken: %s\n", res.GetAccessToken())
+		fmt.Printf("RefreshToken: %s\n", res.GetRefreshToken())
+	},
+}
+
+var orgsMembersCmd = &cobra.Command{
+	Use:   "members ORG_ID",
+	Short: "List the members of an organization",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		listMemberships(&pb.ListMembershipsRequest{OrgId: args[0]})
+	},
+}
+
+var orgsMembershipsCmd = &cobra.Command{
+	Use:   "memberships",
+	Short: "List the organizations you, or another user, belong to",
+	Run: func(cmd *cobra.Command, args []string) {
+		userID, _ := cmd.Flags().GetString("user")
+		listMemberships(&pb.ListMembershipsRequest{UserId: userID})
+	},
+}
+
+var orgsSetRolesCmd = &cobra.Command{
+	Use:   "set-roles ORG_ID USER_ID",
+	Short: "Replace the roles of a member",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		roles, _ := cmd.Flags().GetStringSlice("role")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.UpdateMemberRoles(ctx, &pb.UpdateMemberRolesRequest{OrgId: args[0], UserId: args[1], Roles: roles})
+		if err != nil {
+			log.Fatalf("Failed to update roles: %v", err)
+		}
+
+		fmt.Printf("Roles: %s\n", strings.Join(res.GetRoles(), ", "))
+	},
+}
+
+var orgsRemoveCmd = &cobra.Command{
+	Use:   "remove ORG_ID USER_ID",
+	Short: "Remove a member from an organization",
+	Long:  "Remove a member from an organization. Accounts that exist only inside the organization are deleted.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		if _, err := client.RemoveMember(ctx, &pb.RemoveMemberRequest{OrgId: args[0], UserId: args[1]}); err != nil {
+			log.Fatalf("Failed to remove member: %v", err)
+		}
+
+		fmt.Printf("Member %s removed from %s\n", args[1], args[0])
+	},
+}
+
+var orgsSwitchCmd = &cobra.Command{
+	Use:   "switch [ORG_ID]",
+	Short: "Get tokens scoped to another organization",
+	Long:  "Exchange the access token passed as --token for tokens scoped to ORG_ID, or to no organization when it is omitted.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var orgID string
+		if len(args) > 0 {
+			orgID = args[0]
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.SwitchOrganization(ctx, &pb.SwitchOrganizationRequest{OrgId: orgID})
+		if err != nil {
+			log.Fatalf("Failed to switch organization: %v", err)
+		}
+
+		fmt.Printf("AccessToken: %s\n", res.GetAccessToken())
+		fmt.Printf("RefreshToken: %s\n", res.GetRefreshToken())
+	},
+}
+
+func listMemberships(req *pb.ListMembershipsRequest) {
+	conn, err := dial()
+	if err != nil {
+		log.Fatalf("Failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	client := pb.NewAuthServiceClient(conn)
+
+	ctx, cancel := tokenContext(true)
+	defer cancel()
+
+	res, err := client.ListMemberships(ctx, req)
+	if err != nil {
+		log.Fatalf("Failed to list memberships: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ORG ID\tORG\tUSER ID\tUSERNAME\tEMAIL\tROLES")
+	for _, m := range res.GetMemberships() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", m.GetOrgId(), m.GetOrgSlug(), m.GetUserId(), m.GetUsername(), m.GetEmail(), strings.Join(m.GetRoles(), ","))
+	}
+	w.Flush()
+}
+
+func init() {
+	orgsCmd.PersistentFlags().StringVar(&userToken, "token", os.Getenv("AUTH_CLI_TOKEN"), "Admin token or access token (env AUTH_CLI_TOKEN)")
+
+	orgsCreateCmd.Flags().String("name", "", "Display name")
+	orgsCreateCmd.Flags().Bool("isolated-accounts", false, "Give members accounts of their own, with usernames and emails unique only inside the organization")
+	orgsCreateCmd.MarkFlagRequired("name")
+
+	for _, cmd := range []*cobra.Command{orgsInviteCmd, orgsSetRolesCmd} {
+		cmd.Flags().StringSlice("role", nil, "Role the member holds in the organization (repeatable)")
+	}
+	orgsAcceptCmd.Flags().String("username", "", "Username of the new account (isolated accounts only)")
+	orgsAcceptCmd.Flags().String("password", "", "Password of the new account (isolated accounts only)")
+	orgsMembershipsCmd.Flags().String("user", "", "List another user's organizations (administrators only)")
+
+	orgsCmd.AddCommand(orgsCreateCmd, orgsListCmd, orgsInviteCmd, orgsAcceptCmd, orgsMembersCmd, orgsMembershipsCmd,
+		orgsSetRolesCmd, orgsRemoveCmd, orgsSwitchCmd)
+	rootCmd.AddCommand(orgsCmd)
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage your profile and email address",
+	Long: "Change your username, display name, picture and email address. update and change-email send --token, " +
+		"your access token; the links sent during an email change carry their own token.",
+}
+
+var profileUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Change your username, display name or picture",
+	Run: func(cmd *cobra.Command, args []string) {
+		username, _ := cmd.Flags().GetString("username")
+		displayName, _ := cmd.Flags().GetString("display-name")
+		avatarURL, _ := cmd.Flags().GetString("avatar-url")
+
+		// Only the flags that were passed are updated
+		var mask []string
+		for _, f := range []struct{ flag, field string }{
+			{"username", "username"}, {"display-name", "display_name"}, {"avatar-url", "avatar_url"},
+		} {
+			if cmd.Flags().Changed(f.flag) {
+				mask = append(mask, f.field)
+			}
+		}
+		if len(mask) == 0 {
+			log.Fatalf("Pass at least one of --username, --display-name or --avatar-url")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.UpdateProfile(ctx, &pb.UpdateProfileRequest{
+			Username:    username,
+			DisplayName: displayName,
+			AvatarUrl:   avatarURL,
+			UpdateMask:  mask,
+		})
+		if err != nil {
+			log.Fatalf("Failed to update profile: %v", err)
+		}
+
+		user := res.GetUser()
+		fmt.Printf("Username: %s\n", user.GetUsername())
+		fmt.Printf("Display name: %s\n", user.GetDisplayName())
+		fmt.Printf("Avatar URL: %s\n", user.GetAvatarUrl())
+	},
+}
+
+var profileChangeEmailCmd = &cobra.Command{
+	Use:   "change-email NEW_EMAIL",
+	Short: "Change your email address",
+	Long:  "Change your email address. The change applies once you follow the link sent to the new address.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		password, _ := cmd.Flags().GetString("password")
+		code, _ := cmd.Flags().GetString("code")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.ChangeEmail(ctx, &pb.ChangeEmailRequest{NewEmail: args[0], CurrentPassword: password, ReauthCode: code})
+		if err != nil {
+			log.Fatalf("Failed to change email: %v", err)
+		}
+
+		fmt.Println(res.GetMessage())
+	},
+}
+
+var profileReauthCodeCmd = &cobra.Command{
+	Use:   "reauth-code",
+	Short: "Email yourself a code that confirms a sensitive change in place of your password",
+	Run: func(cmd *cobra.Command, args []string) {
+		action, _ := cmd.Flags().GetString("action")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(true)
+		defer cancel()
+
+		res, err := client.SendReauthCode(ctx, &pb.SendReauthCodeRequest{Action: action})
+		if err != nil {
+			log.Fatalf("Failed to send code: %v", err)
+		}
+
+		fmt.Println(res.GetMessage())
+	},
+}
+
+var profileConfirmEmailCmd = &cobra.Command{
+	Use:   "confirm-email TOKEN",
+	Short: "Confirm an email change with the token sent to the new address",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(false)
+		defer cancel()
+
+		res, err := client.ConfirmEmailChange(ctx, &pb.ConfirmEmailChangeRequest{Token: args[0]})
+		if err != nil {
+			log.Fatalf("Failed to confirm email change: %v", err)
+		}
+
+		fmt.Printf("Your email is now %s\n", res.GetEmail())
+	},
+}
+
+var profileRevertEmailCmd = &cobra.Command{
+	Use:   "revert-email TOKEN",
+	Short: "Cancel or undo an email change with the token sent to the old address",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := tokenContext(false)
+		defer cancel()
+
+		res, err := client.RevertEmailChange(ctx, &pb.RevertEmailChangeRequest{Token: args[0]})
+		if err != nil {
+			log.Fatalf("Failed to revert email change: %v", err)
+		}
+
+		if res.GetRestored() {
+			fmt.Println("Your old email address is restored and all sessions have been signed out. Change your password now.")
+			return
+		}
+		fmt.Println("The email change was cancelled.")
+	},
+}
+
+func init() {
+	profileCmd.PersistentFlags().StringVar(&userToken, "token", os.Getenv("AUTH_CLI_TOKEN"), "Access token (env AUTH_CLI_TOKEN)")
+
+	profileUpdateCmd.Flags().String("username", "", "New username")
+	profileUpdateCmd.Flags().String("display-name", "", "Name shown to others; empty removes it")
+	profileUpdateCmd.Flags().String("avatar-url", "", "HTTPS URL of your picture; empty removes it")
+	profileChangeEmailCmd.Flags().String("password", "", "Your current password")
+	profileChangeEmailCmd.Flags().String("code", "", "Code from reauth-code, instead of your password")
+	profileChangeEmailCmd.MarkFlagsOneRequired("password", "code")
+	profileChangeEmailCmd.MarkFlagsMutuallyExclusive("password", "code")
+	profileReauthCodeCmd.Flags().String("action", "change_email", "Action the code confirms: change_email")
+
+	profileCmd.AddCommand(profileUpdateCmd, profileChangeEmailCmd, profileReauthCodeCmd, profileConfirmEmailCmd, profileRevertEmailCmd)
+	rootCmd.AddCommand(profileCmd)
+}
@@ -4,11 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"time"
 
 	pb "github.com/kraftzpepe/auth-service/proto/generated"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 var requestPasswordResetCmd = &cobra.Command{
@@ -18,9 +16,10 @@ var requestPasswordResetCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get email flag
 		email, _ := cmd.Flags().GetString("email")
+		orgID, _ := cmd.Flags().GetString("org")
 
 		// Connect to the gRPC server
-		conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+		conn, err := dial()
 		if err != nil {
 			log.Fatalf("Failed to connect to server: %v", err)
 		}
@@ -31,10 +30,11 @@ var requestPasswordResetCmd = &cobra.Command{
 		// Create the RequestPasswordResetRequest
 		req := &pb.RequestPasswordResetRequest{
 			Email: email,
+			OrgId: orgID,
 		}
 
 		// Set a timeout for the request
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout())
 		defer cancel()
 
 		// Call the RequestPasswordReset method
@@ -52,6 +52,7 @@ var requestPasswordResetCmd = &cobra.Command{
 func init() {
 	// Add flag for the email
 	requestPasswordResetCmd.Flags().String("email", "", "Email address of the user requesting password reset")
+	requestPasswordResetCmd.Flags().String("org", "", "ID of the organization the account belongs to, for organizations with isolated accounts")
 	requestPasswordResetCmd.MarkFlagRequired("email")
 
 	// Add the command to the root command
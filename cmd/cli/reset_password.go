@@ -4,11 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"time"
 
 	pb "github.com/kraftzpepe/auth-service/proto/generated"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 var resetPasswordCmd = &cobra.Command{
@@ -21,7 +19,7 @@ var resetPasswordCmd = &cobra.Command{
 		newPassword, _ := cmd.Flags().GetString("new-password")
 
 		// Connect to the gRPC server
-		conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+		conn, err := dial()
 		if err != nil {
 			log.Fatalf("Failed to connect to server: %v", err)
 		}
@@ -36,7 +34,7 @@ var resetPasswordCmd = &cobra.Command{
 		}
 
 		// Set a timeout for the request
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout())
 		defer cancel()
 
 		// Call the ResetPassword method
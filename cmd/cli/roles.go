@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+)
+
+var rolesCmd = &cobra.Command{
+	Use:   "roles",
+	Short: "Manage roles and role assignments",
+	Long: "Define roles with their permissions and assign them to users. Requires the server's admin token " +
+		"or an access token with the roles:manage permission.",
+}
+
+var rolesCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Define a role",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		description, _ := cmd.Flags().GetString("description")
+		permissions, _ := cmd.Flags().GetStringSlice("permission")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.CreateRole(ctx, &pb.CreateRoleRequest{Name: args[0], Description: description, Permissions: permissions})
+		if err != nil {
+			log.Fatalf("Failed to create role: %v", err)
+		}
+
+		printRole(res.GetRole())
+	},
+}
+
+var rolesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List roles",
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ListRoles(ctx, &pb.ListRolesRequest{})
+		if err != nil {
+			log.Fatalf("Failed to list roles: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPERMISSIONS\tDESCRIPTION")
+		for _, role := range res.GetRoles() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", role.GetName(), strings.Join(role.GetPermissions(), ","), role.GetDescription())
+		}
+		w.Flush()
+	},
+}
+
+var rolesUpdateCmd = &cobra.Command{
+	Use:   "update NAME",
+	Short: "Update a role",
+	Long:  "Update a role. Only the settings passed as flags are changed; --permission replaces the existing permissions.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		description, _ := cmd.Flags().GetString("description")
+		permissions, _ := cmd.Flags().GetStringSlice("permission")
+
+		var mask []string
+		if cmd.Flags().Changed("description") {
+			mask = append(mask, "description")
+		}
+		if cmd.Flags().Changed("permission") {
+			mask = append(mask, "permissions")
+		}
+		if len(mask) == 0 {
+			log.Fatalf("Nothing to update: pass --description or --permission")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.UpdateRole(ctx, &pb.UpdateRoleRequest{
+			Name:        args[0],
+			Description: description,
+			Permissions: permissions,
+			UpdateMask:  mask,
+		})
+		if err != nil {
+			log.Fatalf("Failed to update role: %v", err)
+		}
+
+		printRole(res.GetRole())
+	},
+}
+
+var rolesDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Delete a role and all its assignments",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.DeleteRole(ctx, &pb.DeleteRoleRequest{Name: args[0]}); err != nil {
+			log.Fatalf("Failed to delete role: %v", err)
+		}
+
+		fmt.Printf("Role %s deleted\n", args[0])
+	},
+}
+
+var rolesAssignCmd = &cobra.Command{
+	Use:   "assign USER_ID ROLE",
+	Short: "Assign a role to a user",
+	Long:  "Assign a role to a user. The role appears in access tokens issued from now on.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.AssignRole(ctx, &pb.AssignRoleRequest{UserId: args[0], Role: args[1]}); err != nil {
+			log.Fatalf("Failed to assign role: %v", err)
+		}
+
+		fmt.Printf("Role %s assigned to %s\n", args[1], args[0])
+	},
+}
+
+var rolesUnassignCmd = &cobra.Command{
+	Use:   "unassign USER_ID ROLE",
+	Short: "Remove a role from a user",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.UnassignRole(ctx, &pb.UnassignRoleRequest{UserId: args[0], Role: args[1]}); err != nil {
+			log.Fatalf("Failed to remove role: %v", err)
+		}
+
+		fmt.Printf("Role %s removed from %s\n", args[1], args[0])
+	},
+}
+
+var rolesUserCmd = &cobra.Command{
+	Use:   "user USER_ID",
+	Short: "Show the roles and permissions of a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ListUserRoles(ctx, &pb.ListUserRolesRequest{UserId: args[0]})
+		if err != nil {
+			log.Fatalf("Failed to list roles: %v", err)
+		}
+
+		fmt.Printf("Roles: %s\n", strings.Join(res.GetRoles(), ", "))
+		fmt.Printf("Permissions: %s\n", strings.Join(res.GetPermissions(), ", "))
+	},
+}
+
+func printRole(role *pb.Role) {
+	fmt.Printf("Name: %s\n", role.GetName())
+	fmt.Printf("Description: %s\n", role.GetDescription())
+	fmt.Printf("Permissions: %s\n", strings.Join(role.GetPermissions(), ", "))
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{rolesCreateCmd, rolesUpdateCmd} {
+		cmd.Flags().String("description", "", "Human-readable description")
+		cmd.Flags().StringSlice("permission", nil, `Granted permission such as reports:read; "reports:*" and "*" are wildcards (repeatable)`)
+	}
+
+	rolesCmd.AddCommand(rolesCreateCmd, rolesListCmd, rolesUpdateCmd, rolesDeleteCmd, rolesAssignCmd, rolesUnassignCmd, rolesUserCmd)
+}
@@ -4,17 +4,15 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"time"
 
 	pb "github.com/kraftzpepe/auth-service/proto/generated"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 var signupCmd = &cobra.Command{
 	Use:   "signup",
 	Short: "Sign up a new user",
-	Long:  "Sign up a new user by providing a username, email, and password.",
+	Long:  "Sign up a new user by providing a username, email, and password, and save their tokens as the credentials of the profile.",
 	Run: func(cmd *cobra.Command, args []string) {
 		// Local variable declarations
 		username, _ := cmd.Flags().GetString("username")
@@ -22,7 +20,7 @@ var signupCmd = &cobra.Command{
 		password, _ := cmd.Flags().GetString("password")
 
 		// Connect to the gRPC server
-		conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+		conn, err := dial()
 		if err != nil {
 			log.Fatalf("Failed to connect to server: %v", err)
 		}
@@ -38,7 +36,7 @@ var signupCmd = &cobra.Command{
 		}
 
 		// Set a timeout for the request
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout())
 		defer cancel()
 
 		// Call the Register method
@@ -49,8 +47,8 @@ var signupCmd = &cobra.Command{
 
 		// Print the response
 		fmt.Printf("User registered successfully:\n")
-		fmt.Printf("ID: %s\nUsername: %s\nEmail: %s\nAccessToken: %s\nRefreshToken: %s\n",
-			res.GetId(), res.GetUsername(), res.GetEmail(), res.GetAccessToken(), res.GetRefreshToken())
+		fmt.Printf("ID: %s\nUsername: %s\nEmail: %s\n", res.GetId(), res.GetUsername(), res.GetEmail())
+		mustSaveCredentials(newCredentials(res.GetAccessToken(), res.GetRefreshToken()))
 	},
 }
 
@@ -4,11 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"time"
 
 	pb "github.com/kraftzpepe/auth-service/proto/generated"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 var updatePasswordCmd = &cobra.Command{
@@ -22,7 +20,7 @@ var updatePasswordCmd = &cobra.Command{
 		newPassword, _ := cmd.Flags().GetString("new-password")
 
 		// Connect to the gRPC server
-		conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+		conn, err := dial()
 		if err != nil {
 			log.Fatalf("Failed to connect to server: %v", err)
 		}
@@ -30,7 +28,7 @@ var updatePasswordCmd = &cobra.Command{
 
 		client := pb.NewAuthServiceClient(conn)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout())
 		defer cancel()
 
 		// Authenticate user
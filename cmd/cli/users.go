@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var usersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Search and manage user accounts",
+	Long: "Search and manage user accounts. These commands need the server's admin token, or an access token or API key " +
+		"with users:read to list users and users:manage to change them.",
+}
+
+var usersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users matching filters, a page at a time",
+	Run: func(cmd *cobra.Command, args []string) {
+		pageSize, _ := cmd.Flags().GetInt32("page-size")
+		pageToken, _ := cmd.Flags().GetString("page-token")
+		sortBy, _ := cmd.Flags().GetString("sort")
+		descending, _ := cmd.Flags().GetBool("desc")
+		emailPrefix, _ := cmd.Flags().GetString("email-prefix")
+		usernamePrefix, _ := cmd.Flags().GetString("username-prefix")
+		domain, _ := cmd.Flags().GetString("domain")
+		createdAfter, _ := cmd.Flags().GetString("created-after")
+		createdBefore, _ := cmd.Flags().GetString("created-before")
+		status, _ := cmd.Flags().GetString("status")
+		emailStatus, _ := cmd.Flags().GetString("email-status")
+		role, _ := cmd.Flags().GetString("role")
+		search, _ := cmd.Flags().GetString("search")
+		output, _ := cmd.Flags().GetString("output")
+		if output != "table" && output != "json" {
+			log.Fatalf("--output must be table or json")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ListUsers(ctx, &pb.ListUsersRequest{
+			PageSize:       pageSize,
+			PageToken:      pageToken,
+			SortBy:         sortBy,
+			Descending:     descending,
+			EmailPrefix:    emailPrefix,
+			UsernamePrefix: usernamePrefix,
+			EmailDomain:    domain,
+			CreatedAfter:   createdAfter,
+			CreatedBefore:  createdBefore,
+			Status:         status,
+			EmailStatus:    emailStatus,
+			Role:           role,
+			Search:         search,
+		})
+		if err != nil {
+			log.Fatalf("Failed to list users: %v", err)
+		}
+
+		printUsers(res, output)
+	},
+}
+
+var usersSearchCmd = &cobra.Command{
+	Use:   "search QUERY",
+	Short: "Find users whose email or username starts with QUERY",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pageSize, _ := cmd.Flags().GetInt32("page-size")
+		pageToken, _ := cmd.Flags().GetString("page-token")
+		output, _ := cmd.Flags().GetString("output")
+		if output != "table" && output != "json" {
+			log.Fatalf("--output must be table or json")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ListUsers(ctx, &pb.ListUsersRequest{
+			PageSize:  pageSize,
+			PageToken: pageToken,
+			SortBy:    "email",
+			Search:    args[0],
+		})
+		if err != nil {
+			log.Fatalf("Failed to search users: %v", err)
+		}
+
+		printUsers(res, output)
+	},
+}
+
+// printUsers prints a page of users as a table or as JSON
+func printUsers(res *pb.ListUsersResponse, output string) {
+	if output == "json" {
+		data, err := protojson.MarshalOptions{Multiline: true, UseProtoNames: true}.Marshal(res)
+		if err != nil {
+			log.Fatalf("Failed to encode users: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tVERIFIED\tSTATUS\tORG ID\tCREATED AT")
+	for _, user := range res.GetUsers() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n", user.GetId(), user.GetUsername(), user.GetEmail(),
+			user.GetEmailVerified(), user.GetStatus(), user.GetOrgId(), user.GetCreatedAt())
+	}
+	w.Flush()
+	if res.GetNextPageToken() != "" {
+		fmt.Printf("\nNext page: --page-token %s\n", res.GetNextPageToken())
+	}
+}
+
+var usersSuspendCmd = &cobra.Command{
+	Use:   "suspend USER_ID",
+	Short: "Suspend a user and end their sessions",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, _ := cmd.Flags().GetString("reason")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.SuspendUser(ctx, &pb.SuspendUserRequest{UserId: args[0], Reason: reason}); err != nil {
+			log.Fatalf("Failed to suspend user: %v", err)
+		}
+
+		fmt.Printf("User %s suspended\n", args[0])
+	},
+}
+
+var usersReactivateCmd = &cobra.Command{
+	Use:   "reactivate USER_ID",
+	Short: "Make a suspended, pending or deleted user active again",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.ReactivateUser(ctx, &pb.ReactivateUserRequest{UserId: args[0]}); err != nil {
+			log.Fatalf("Failed to reactivate user: %v", err)
+		}
+
+		fmt.Printf("User %s reactivated\n", args[0])
+	},
+}
+
+var usersDeleteCmd = &cobra.Command{
+	Use:   "delete USER_ID",
+	Short: "Delete a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		hard, _ := cmd.Flags().GetBool("hard")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.DeleteUser(ctx, &pb.DeleteUserRequest{UserId: args[0], Hard: hard}); err != nil {
+			log.Fatalf("Failed to delete user: %v", err)
+		}
+
+		if hard {
+			fmt.Printf("User %s and everything they own removed\n", args[0])
+			return
+		}
+		fmt.Printf("User %s deleted\n", args[0])
+	},
+}
+
+var usersForcePasswordResetCmd = &cobra.Command{
+	Use:   "force-password-reset USER_ID",
+	Short: "Make a user choose a new password",
+	Long: "Replace the user's password with an unusable one, end their sessions and email them a password reset link. " +
+		"Access tokens already issued stay valid until they expire.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ForcePasswordReset(ctx, &pb.ForcePasswordResetRequest{UserId: args[0]})
+		if err != nil {
+			log.Fatalf("Failed to force a password reset: %v", err)
+		}
+
+		fmt.Println(res.GetMessage())
+	},
+}
+
+var usersRevokeSessionsCmd = &cobra.Command{
+	Use:   "revoke-sessions USER_ID",
+	Short: "Sign a user out everywhere by revoking their refresh tokens",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.RevokeUserSessions(ctx, &pb.RevokeUserSessionsRequest{UserId: args[0]})
+		if err != nil {
+			log.Fatalf("Failed to revoke sessions: %v", err)
+		}
+
+		fmt.Printf("Revoked %d sessions of user %s\n", res.GetRevoked(), args[0])
+	},
+}
+
+func init() {
+	usersListCmd.Flags().Int32("page-size", 0, "Users per page, up to 500 (default 50)")
+	usersListCmd.Flags().String("page-token", "", "Token of the page to fetch, printed after the previous page")
+	usersListCmd.Flags().String("sort", "created_at", "Sort by created_at, email or username")
+	usersListCmd.Flags().Bool("desc", false, "Sort in descending order")
+	usersListCmd.Flags().String("email-prefix", "", "Only users whose email starts with this")
+	usersListCmd.Flags().String("username-prefix", "", "Only users whose username starts with this")
+	usersListCmd.Flags().String("domain", "", "Only users with an email at this domain")
+	usersListCmd.Flags().String("created-after", "", "Only users created at or after this RFC 3339 time")
+	usersListCmd.Flags().String("created-before", "", "Only users created before this RFC 3339 time")
+	usersListCmd.Flags().String("status", "", "Only users with this status: active, pending, suspended or deleted")
+	usersListCmd.Flags().String("email-status", "", "Only users with a verified or unverified email")
+	usersListCmd.Flags().String("role", "", "Only users holding this role")
+	usersListCmd.Flags().String("search", "", "Only users whose email or username starts with this")
+	usersListCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+
+	usersSearchCmd.Flags().Int32("page-size", 0, "Users per page, up to 500 (default 50)")
+	usersSearchCmd.Flags().String("page-token", "", "Token of the page to fetch, printed after the previous page")
+	usersSearchCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+
+	usersSuspendCmd.Flags().String("reason", "", "Why the account is suspended (required)")
+	usersSuspendCmd.MarkFlagRequired("reason")
+	usersDeleteCmd.Flags().Bool("hard", false, "Remove the user with their tokens, API keys, roles and memberships instead of marking it deleted")
+
+	usersCmd.AddCommand(usersListCmd, usersSearchCmd, usersSuspendCmd, usersReactivateCmd, usersDeleteCmd,
+		usersForcePasswordResetCmd, usersRevokeSessionsCmd)
+}
@@ -0,0 +1,279 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+)
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Manage webhook subscriptions and deliveries",
+	Long: "Subscribe endpoints to user lifecycle events, inspect deliveries and replay failed ones. Requires the " +
+		"server's admin token or an access token with the webhooks:manage permission.",
+}
+
+var webhooksCreateCmd = &cobra.Command{
+	Use:   "create URL",
+	Short: "Subscribe an endpoint to events",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		events, _ := cmd.Flags().GetStringSlice("event")
+		description, _ := cmd.Flags().GetString("description")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.CreateWebhookSubscription(ctx, &pb.CreateWebhookSubscriptionRequest{
+			Url:         args[0],
+			EventTypes:  events,
+			Description: description,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create webhook subscription: %v", err)
+		}
+
+		printWebhookSubscription(res.GetSubscription())
+		fmt.Printf("Secret: %s\n", res.GetSecret())
+		fmt.Println("Store the secret now; it cannot be shown again.")
+	},
+}
+
+var webhooksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhook subscriptions",
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ListWebhookSubscriptions(ctx, &pb.ListWebhookSubscriptionsRequest{})
+		if err != nil {
+			log.Fatalf("Failed to list webhook subscriptions: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tURL\tEVENTS\tACTIVE\tDESCRIPTION")
+		for _, sub := range res.GetSubscriptions() {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", sub.GetId(), sub.GetUrl(), strings.Join(sub.GetEventTypes(), ","),
+				sub.GetActive(), sub.GetDescription())
+		}
+		w.Flush()
+	},
+}
+
+var webhooksUpdateCmd = &cobra.Command{
+	Use:   "update ID",
+	Short: "Update a webhook subscription",
+	Long:  "Update a webhook subscription. Only the settings passed as flags are changed; --event replaces the existing event types.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		url, _ := cmd.Flags().GetString("url")
+		events, _ := cmd.Flags().GetStringSlice("event")
+		description, _ := cmd.Flags().GetString("description")
+		active, _ := cmd.Flags().GetBool("active")
+
+		var mask []string
+		for _, f := range []struct{ flag, field string }{
+			{"url", "url"},
+			{"event", "event_types"},
+			{"description", "description"},
+			{"active", "active"},
+		} {
+			if cmd.Flags().Changed(f.flag) {
+				mask = append(mask, f.field)
+			}
+		}
+		if len(mask) == 0 {
+			log.Fatalf("Nothing to update: pass --url, --event, --description or --active")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.UpdateWebhookSubscription(ctx, &pb.UpdateWebhookSubscriptionRequest{
+			Id:          args[0],
+			Url:         url,
+			EventTypes:  events,
+			Description: description,
+			Active:      active,
+			UpdateMask:  mask,
+		})
+		if err != nil {
+			log.Fatalf("Failed to update webhook subscription: %v", err)
+		}
+
+		printWebhookSubscription(res.GetSubscription())
+	},
+}
+
+var webhooksDeleteCmd = &cobra.Command{
+	Use:   "delete ID",
+	Short: "Delete a webhook subscription and its deliveries",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		if _, err := client.DeleteWebhookSubscription(ctx, &pb.DeleteWebhookSubscriptionRequest{Id: args[0]}); err != nil {
+			log.Fatalf("Failed to delete webhook subscription: %v", err)
+		}
+
+		fmt.Printf("Webhook subscription %s deleted\n", args[0])
+	},
+}
+
+var webhooksDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries",
+	Short: "List webhook deliveries, newest first",
+	Run: func(cmd *cobra.Command, args []string) {
+		subscriptionID, _ := cmd.Flags().GetString("subscription")
+		status, _ := cmd.Flags().GetString("status")
+		eventType, _ := cmd.Flags().GetString("event")
+		pageSize, _ := cmd.Flags().GetInt32("page-size")
+		pageToken, _ := cmd.Flags().GetString("page-token")
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ListWebhookDeliveries(ctx, &pb.ListWebhookDeliveriesRequest{
+			SubscriptionId: subscriptionID,
+			Status:         status,
+			EventType:      eventType,
+			PageSize:       pageSize,
+			PageToken:      pageToken,
+		})
+		if err != nil {
+			log.Fatalf("Failed to list webhook deliveries: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSUBSCRIPTION\tEVENT\tSTATUS\tATTEMPTS\tLAST ATTEMPT\tHTTP\tERROR")
+		for _, d := range res.GetDeliveries() {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%d\t%s\n", d.GetId(), d.GetSubscriptionId(), d.GetEventType(),
+				d.GetStatus(), d.GetAttempts(), d.GetLastAttemptAt(), d.GetResponseStatus(), d.GetLastError())
+		}
+		w.Flush()
+		if res.GetNextPageToken() != "" {
+			fmt.Printf("\nNext page: --page-token %s\n", res.GetNextPageToken())
+		}
+	},
+}
+
+var webhooksReplayCmd = &cobra.Command{
+	Use:   "replay [DELIVERY_ID]",
+	Short: "Queue a failed delivery again, or every failed delivery of a subscription",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		subscriptionID, _ := cmd.Flags().GetString("subscription")
+
+		req := &pb.ReplayWebhookDeliveriesRequest{SubscriptionId: subscriptionID}
+		if len(args) == 1 {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				log.Fatalf("DELIVERY_ID must be a number")
+			}
+			req.DeliveryId = id
+		}
+		if req.DeliveryId == 0 && subscriptionID == "" {
+			log.Fatalf("Pass a DELIVERY_ID or --subscription")
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := adminContext()
+		defer cancel()
+
+		res, err := client.ReplayWebhookDeliveries(ctx, req)
+		if err != nil {
+			log.Fatalf("Failed to replay webhook deliveries: %v", err)
+		}
+
+		fmt.Printf("%d deliveries queued again\n", res.GetReplayed())
+	},
+}
+
+func printWebhookSubscription(sub *pb.WebhookSubscription) {
+	fmt.Printf("ID: %s\n", sub.GetId())
+	fmt.Printf("URL: %s\n", sub.GetUrl())
+	fmt.Printf("Events: %s\n", strings.Join(sub.GetEventTypes(), ", "))
+	fmt.Printf("Active: %t\n", sub.GetActive())
+	if sub.GetDescription() != "" {
+		fmt.Printf("Description: %s\n", sub.GetDescription())
+	}
+}
+
+func init() {
+	webhooksCmd.PersistentFlags().StringVar(&adminToken, "admin-token", os.Getenv("AUTH_CLI_ADMIN_TOKEN"), "Admin token of the server (env AUTH_CLI_ADMIN_TOKEN)")
+
+	webhooksCreateCmd.Flags().StringSlice("event", nil, "Event type to send (repeatable): user.created, user.email_verified, user.email_changed or user.deleted")
+	webhooksCreateCmd.Flags().String("description", "", "What the endpoint is for")
+	webhooksCreateCmd.MarkFlagRequired("event")
+
+	webhooksUpdateCmd.Flags().String("url", "", "New endpoint URL")
+	webhooksUpdateCmd.Flags().StringSlice("event", nil, "Event type to send (repeatable)")
+	webhooksUpdateCmd.Flags().String("description", "", "What the endpoint is for")
+	webhooksUpdateCmd.Flags().Bool("active", true, "Whether the subscription receives new events; --active=false pauses it")
+
+	webhooksDeliveriesCmd.Flags().String("subscription", "", "Only deliveries to this subscription")
+	webhooksDeliveriesCmd.Flags().String("status", "", "Only deliveries with this status: pending, succeeded or failed")
+	webhooksDeliveriesCmd.Flags().String("event", "", "Only deliveries of this event type")
+	webhooksDeliveriesCmd.Flags().Int32("page-size", 0, "Deliveries per page, up to 500 (default 50)")
+	webhooksDeliveriesCmd.Flags().String("page-token", "", "Token of the page to fetch, printed after the previous page")
+
+	webhooksReplayCmd.Flags().String("subscription", "", "Replay every failed delivery of this subscription")
+
+	webhooksCmd.AddCommand(webhooksCreateCmd, webhooksListCmd, webhooksUpdateCmd, webhooksDeleteCmd, webhooksDeliveriesCmd, webhooksReplayCmd)
+	rootCmd.AddCommand(webhooksCmd)
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/spf13/cobra"
+)
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show who you are signed in as",
+	Long:  "Show the user, organization and roles of --token, or else of the credentials saved for the profile.",
+	Run: func(cmd *cobra.Command, args []string) {
+		token := userToken
+		if token == "" {
+			token = storedAccessToken()
+		}
+		if token == "" {
+			log.Fatalf("Not signed in to profile %s: run login", currentProfile())
+		}
+
+		conn, err := dial()
+		if err != nil {
+			log.Fatalf("Failed to connect to server: %v", err)
+		}
+		defer conn.Close()
+
+		client := pb.NewAuthServiceClient(conn)
+
+		ctx, cancel := bearerContext("")
+		defer cancel()
+
+		res, err := client.IntrospectToken(ctx, &pb.IntrospectTokenRequest{Token: token})
+		if err != nil {
+			log.Fatalf("Failed to check token: %v", err)
+		}
+		if !res.GetActive() {
+			log.Fatalf("The token is no longer valid: run login")
+		}
+
+		fmt.Printf("Profile: %s\n", currentProfile())
+		fmt.Printf("Server: %s\n", serverAddress())
+		if res.GetUserId() == "" {
+			fmt.Printf("Client: %s\n", res.GetClientId())
+		} else {
+			user, err := client.GetUserByUUID(ctx, &pb.GetUserRequest{Identifier: res.GetUserId()})
+			if err != nil {
+				log.Fatalf("Failed to load user: %v", err)
+			}
+			fmt.Printf("User ID: %s\n", user.GetId())
+			fmt.Printf("Username: %s\n", user.GetUsername())
+			fmt.Printf("Email: %s\n", user.GetEmail())
+		}
+		if res.GetOrgId() != "" {
+			fmt.Printf("Organization: %s\n", res.GetOrgId())
+		}
+		fmt.Printf("Roles: %s\n", strings.Join(res.GetRoles(), ", "))
+		fmt.Printf("Expires At: %s\n", res.GetExpiresAt())
+	},
+}
+
+func init() {
+	whoamiCmd.Flags().StringVar(&userToken, "token", "", "Access token or API key to check instead of the saved credentials")
+
+	rootCmd.AddCommand(whoamiCmd)
+}
@@ -3,19 +3,81 @@ package config
 import (
 	"log"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/utils"
 )
 
 type Config struct {
 	DatabaseURL string
 	GRPCPort    string
+	JWTSecret   string
+
+	AdminHTTPAddr string
+	HTTPAddr      string
+
+	CORSAllowedOrigins   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	AdminToken         string
+	OAuthIssuer        string
+	OIDCSigningKeyFile string
+
+	FederationProviders []FederationProvider
+
+	WebhookPollInterval time.Duration
+	WebhookTimeout      time.Duration
+
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSClientCAFile   string
+	TLSClientAuth     string
+	TLSReloadInterval time.Duration
+
+	GRPCReflection      bool
+	HealthCheckInterval time.Duration
+	HealthMailRequired  bool
+
+	LogLevel       string
+	LogFormat      string
+	LogRedactRules string
+	LogPayloads    bool
+
+	TracingExporter    string
+	TracingSampleRatio float64
 }
 
+// placeholderJWTSecret is the example secret older deployments were shipped with, which anyone can sign tokens with
+const placeholderJWTSecret = "your_jwt_secret_key_here"
+
 func LoadConfig() *Config {
 	dbURL := os.Getenv("DATABASE_URL")
 	if dbURL == "" {
 		log.Fatal("DATABASE_URL is not set")
 	}
 
+	jwtSecret := os.Getenv("JWT_SECRET")
+	switch {
+	case jwtSecret == "":
+		log.Fatal("JWT_SECRET is not set")
+	case jwtSecret == placeholderJWTSecret:
+		log.Fatal("JWT_SECRET is still the example value, set it to a random secret")
+	case len(jwtSecret) < utils.MinJWTSecretLength:
+		log.Fatalf("JWT_SECRET must be at least %d bytes long", utils.MinJWTSecretLength)
+	}
+
+	corsOrigins := getEnvList("CORS_ALLOWED_ORIGINS", nil)
+	corsCredentials := getEnvBool("CORS_ALLOW_CREDENTIALS", false)
+	if corsCredentials && slices.Contains(corsOrigins, "*") {
+		log.Fatal("CORS_ALLOW_CREDENTIALS cannot be used with CORS_ALLOWED_ORIGINS=*, list the allowed origins instead")
+	}
+
 	grpcPort := os.Getenv("GRPC_PORT")
 	if grpcPort == "" {
 		grpcPort = "50051" // Default gRPC port
@@ -24,5 +86,150 @@ func LoadConfig() *Config {
 	return &Config{
 		DatabaseURL: dbURL,
 		GRPCPort:    grpcPort,
+		JWTSecret:   jwtSecret,
+
+		AdminHTTPAddr: getEnv("ADMIN_HTTP_ADDR", ":9090"),
+		HTTPAddr:      getEnv("HTTP_ADDR", ":8080"),
+
+		CORSAllowedOrigins:   corsOrigins,
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "X-Request-Id"}),
+		CORSAllowCredentials: corsCredentials,
+		CORSMaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+
+		AdminToken:         os.Getenv("ADMIN_TOKEN"),
+		OAuthIssuer:        getEnv("OAUTH_ISSUER", "http://localhost:8080"),
+		OIDCSigningKeyFile: os.Getenv("OIDC_SIGNING_KEY_FILE"),
+
+		FederationProviders: loadFederationProviders(),
+
+		WebhookPollInterval: getEnvPositiveDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		WebhookTimeout:      getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+
+		TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+		TLSClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		TLSClientAuth:     getEnv("TLS_CLIENT_AUTH", "none"),
+		TLSReloadInterval: getEnvDuration("TLS_RELOAD_INTERVAL", 30*time.Second),
+
+		GRPCReflection:      getEnvBool("GRPC_REFLECTION", false),
+		HealthCheckInterval: getEnvPositiveDuration("HEALTH_CHECK_INTERVAL", 10*time.Second),
+		HealthMailRequired:  getEnvBool("HEALTH_MAIL_REQUIRED", false),
+
+		LogLevel:       getEnv("LOG_LEVEL", "info"),
+		LogFormat:      getEnv("LOG_FORMAT", "json"),
+		LogRedactRules: getEnv("LOG_REDACT_RULES", utils.DefaultRedactionRules),
+		LogPayloads:    getEnvBool("LOG_PAYLOADS", false),
+
+		TracingExporter:    getEnv("TRACING_EXPORTER", "none"),
+		TracingSampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1.0),
+	}
+}
+
+// FederationProvider configures an upstream OpenID Provider users can sign in with
+type FederationProvider struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// federationProviderName restricts provider names to what is safe in URLs and environment variable names
+var federationProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9_]*$`)
+
+// loadFederationProviders reads the providers listed in FEDERATION_PROVIDERS. Each provider NAME is
+// configured through FEDERATION_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _DISPLAY_NAME and _SCOPES.
+func loadFederationProviders() []FederationProvider {
+	var providers []FederationProvider
+	for _, name := range getEnvList("FEDERATION_PROVIDERS", nil) {
+		if !federationProviderName.MatchString(name) {
+			log.Fatalf("FEDERATION_PROVIDERS: invalid provider name %q, use lowercase letters, digits and underscores", name)
+		}
+		prefix := "FEDERATION_" + strings.ToUpper(name) + "_"
+		provider := FederationProvider{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       getEnvList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// getEnv returns the value of an environment variable or a fallback when it is unset
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList splits a comma-separated environment variable, ignoring empty entries
+func getEnvList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvBool parses a boolean environment variable, exiting on malformed values
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s must be a boolean: %v", key, err)
+	}
+	return parsed
+}
+
+// getEnvFloat parses a floating point environment variable, exiting on malformed values
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("%s must be a number: %v", key, err)
+	}
+	return parsed
+}
+
+// getEnvDuration parses a duration environment variable such as "30s", exiting on malformed values
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s must be a duration: %v", key, err)
+	}
+	return parsed
+}
+
+// getEnvPositiveDuration parses a duration like getEnvDuration, exiting unless it is above zero
+func getEnvPositiveDuration(key string, fallback time.Duration) time.Duration {
+	parsed := getEnvDuration(key, fallback)
+	if parsed <= 0 {
+		log.Fatalf("%s must be above zero, got %s", key, parsed)
 	}
+	return parsed
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"log"
+	"log/slog"
 	"os"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
@@ -25,6 +26,6 @@ func ConnectDB() (*sql.DB, error) {
 		return nil, err
 	}
 
-	log.Println("Connected to the database successfully")
+	slog.Info("connected to the database")
 	return db, nil
 }
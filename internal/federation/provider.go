@@ -0,0 +1,126 @@
+// Package federation signs users in through upstream OpenID Connect identity providers
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// httpClient bounds every request to an upstream provider
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Provider is an upstream OpenID Provider users can sign in with.
+// Its metadata is discovered on first use, so an unreachable provider does not prevent startup.
+type Provider struct {
+	Name         string // Identifies the provider in URLs and the external_identities table
+	DisplayName  string // Shown on the login page
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string // Our callback URL, registered with the provider
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// Identity is the verified outcome of a login at an upstream provider
+type Identity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	AuthTime          time.Time
+	AMR               []string
+}
+
+// AuthCodeURL returns the provider's login page for an authorization code request protected by PKCE
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	config, _, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+// Exchange redeems an authorization code and verifies the ID token returned with it
+func (p *Provider) Exchange(ctx context.Context, code, nonce, codeVerifier string) (*Identity, error) {
+	config, provider, err := p.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := config.Exchange(oidc.ClientContext(ctx, httpClient), code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match the login request")
+	}
+
+	var claims struct {
+		Email             string   `json:"email"`
+		EmailVerified     bool     `json:"email_verified"`
+		PreferredUsername string   `json:"preferred_username"`
+		AuthTime          int64    `json:"auth_time"`
+		AMR               []string `json:"amr"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid id_token claims: %w", err)
+	}
+
+	identity := &Identity{
+		Provider:          p.Name,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		AuthTime:          idToken.IssuedAt,
+		AMR:               claims.AMR,
+	}
+	if claims.AuthTime > 0 {
+		identity.AuthTime = time.Unix(claims.AuthTime, 0)
+	}
+	return identity, nil
+}
+
+// config discovers the provider on first use and returns its OAuth 2.0 client configuration
+func (p *Provider) config(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		// The provider keeps the context to fetch signing keys later, so it must outlive this request
+		discoveryCtx := oidc.ClientContext(context.WithoutCancel(ctx), httpClient)
+		provider, err := oidc.NewProvider(discoveryCtx, p.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovery of %s failed: %w", p.Issuer, err)
+		}
+		p.provider = provider
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     p.provider.Endpoint(),
+		RedirectURL:  p.RedirectURL,
+		Scopes:       p.Scopes,
+	}, p.provider, nil
+}
@@ -0,0 +1,131 @@
+package federation_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/federation"
+	"github.com/kraftzpepe/auth-service/internal/federation/federationtest"
+)
+
+const codeVerifier = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJ"
+
+func newProvider(idp *federationtest.Provider) *federation.Provider {
+	return &federation.Provider{
+		Name:         "idp",
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  "https://auth.example.com/oauth/federation/callback",
+	}
+}
+
+// login starts a login at provider, signs in at idp with claims and returns the code idp redirects back with
+func login(t *testing.T, idp *federationtest.Provider, provider *federation.Provider, nonce string, claims map[string]any) string {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", nonce, codeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.Login(t, authURL, claims)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want it passed through", state)
+	}
+	return code
+}
+
+func TestExchangeReturnsIdentity(t *testing.T) {
+	idp := federationtest.NewProvider(t)
+	provider := newProvider(idp)
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	code := login(t, idp, provider, "nonce-1", map[string]any{
+		"sub":                "upstream-42",
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"preferred_username": "jane",
+		"auth_time":          authTime.Unix(),
+		"amr":                []string{"pwd", "otp"},
+	})
+
+	identity, err := provider.Exchange(context.Background(), code, "nonce-1", codeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := federation.Identity{
+		Provider:          "idp",
+		Subject:           "upstream-42",
+		Email:             "jane@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "jane",
+		AuthTime:          authTime,
+		AMR:               []string{"pwd", "otp"},
+	}
+	if identity.Provider != want.Provider || identity.Subject != want.Subject || identity.Email != want.Email ||
+		identity.EmailVerified != want.EmailVerified || identity.PreferredUsername != want.PreferredUsername ||
+		!identity.AuthTime.Equal(want.AuthTime) || !slices.Equal(identity.AMR, want.AMR) {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeKeepsEmailUnverified(t *testing.T) {
+	idp := federationtest.NewProvider(t)
+	provider := newProvider(idp)
+	code := login(t, idp, provider, "nonce-1", map[string]any{"sub": "upstream-42", "email": "jane@example.com"})
+
+	identity, err := provider.Exchange(context.Background(), code, "nonce-1", codeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.EmailVerified {
+		t.Error("email without email_verified claim reported as verified")
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		verifier string
+	}{
+		{name: "nonce mismatch", claims: map[string]any{"nonce": "replayed"}},
+		{name: "token for another client", claims: map[string]any{"aud": "someone-else"}},
+		{name: "token from another issuer", claims: map[string]any{"iss": "https://evil.example.com"}},
+		{name: "expired token", claims: map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "wrong code verifier", verifier: codeVerifier + "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := federationtest.NewProvider(t)
+			provider := newProvider(idp)
+			claims := map[string]any{"sub": "upstream-42", "email": "jane@example.com", "email_verified": true}
+			for name, value := range tt.claims {
+				claims[name] = value
+			}
+			code := login(t, idp, provider, "nonce-1", claims)
+			verifier := codeVerifier
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+
+			if identity, err := provider.Exchange(context.Background(), code, "nonce-1", verifier); err == nil {
+				t.Errorf("Exchange accepted the login as %+v", *identity)
+			}
+		})
+	}
+}
+
+func TestExchangeRedeemsCodeOnce(t *testing.T) {
+	idp := federationtest.NewProvider(t)
+	provider := newProvider(idp)
+	code := login(t, idp, provider, "nonce-1", map[string]any{"sub": "upstream-42"})
+
+	if _, err := provider.Exchange(context.Background(), code, "nonce-1", codeVerifier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, "nonce-1", codeVerifier); err == nil {
+		t.Error("code redeemed twice")
+	}
+}
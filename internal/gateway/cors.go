@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions controls which browser origins may call the public HTTP listener
+type CORSOptions struct {
+	AllowedOrigins   []string // "*" allows any origin
+	AllowedHeaders   []string
+	AllowCredentials bool // Ignored when any origin is allowed
+	MaxAge           time.Duration
+}
+
+var corsMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+// WithCORS answers preflight requests and adds CORS headers for allowed origins.
+// Requests from other origins are served without CORS headers, so browsers block the response.
+// When any origin is allowed the origin is never echoed back, so credentialed requests are never allowed.
+func WithCORS(opts CORSOptions, next http.Handler) http.Handler {
+	if len(opts.AllowedOrigins) == 0 {
+		return next
+	}
+	allowAny := slices.Contains(opts.AllowedOrigins, "*")
+	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!allowAny && !slices.Contains(opts.AllowedOrigins, origin)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		if allowAny {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Add("Vary", "Origin")
+			h.Set("Access-Control-Allow-Origin", origin)
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		h.Set("Access-Control-Expose-Headers", "X-Request-Id")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", corsMethods)
+			h.Set("Access-Control-Allow-Headers", allowedHeaders)
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const maxBodyBytes = 1 << 20
+
+// OpenAPIPath is where the generated OpenAPI document is served
+const OpenAPIPath = "/openapi.json"
+
+var (
+	marshaler   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	unmarshaler = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// Gateway translates HTTP/JSON requests into calls on the AuthService over a gRPC connection,
+// so every interceptor of the gRPC server applies to gateway traffic as well
+type Gateway struct {
+	conn    grpc.ClientConnInterface
+	service protoreflect.ServiceDescriptor
+	mux     *http.ServeMux
+	openAPI []byte
+}
+
+// New builds the HTTP handler for the gateway
+func New(conn grpc.ClientConnInterface) (http.Handler, error) {
+	service := pb.File_proto_auth_proto.Services().ByName("AuthService")
+	g := &Gateway{conn: conn, service: service, mux: http.NewServeMux()}
+
+	for _, r := range routes {
+		method := service.Methods().ByName(protoreflect.Name(r.RPC))
+		if method == nil {
+			return nil, fmt.Errorf("route %s %s refers to unknown RPC %s", r.Method, r.Path, r.RPC)
+		}
+		g.mux.HandleFunc(r.Method+" "+r.Path, g.handle(method, hasQuery(r.Method)))
+	}
+	g.mux.HandleFunc("POST "+rpcPath, func(w http.ResponseWriter, req *http.Request) {
+		method := service.Methods().ByName(protoreflect.Name(req.PathValue("method")))
+		if method == nil {
+			writeError(w, status.New(codes.NotFound, "unknown method"))
+			return
+		}
+		g.handle(method, false)(w, req)
+	})
+
+	openAPI, err := buildOpenAPI(service, routes)
+	if err != nil {
+		return nil, err
+	}
+	g.openAPI = openAPI
+	g.mux.HandleFunc("GET "+OpenAPIPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(g.openAPI)
+	})
+
+	return g.mux, nil
+}
+
+func (g *Gateway) handle(method protoreflect.MethodDescriptor, fromQuery bool) http.HandlerFunc {
+	fullMethod := fmt.Sprintf("/%s/%s", g.service.FullName(), method.Name())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, err := newMessage(method.Input())
+		if err != nil {
+			writeError(w, status.New(codes.Internal, err.Error()))
+			return
+		}
+		out, err := newMessage(method.Output())
+		if err != nil {
+			writeError(w, status.New(codes.Internal, err.Error()))
+			return
+		}
+
+		if err := decodeRequest(r, in, fromQuery); err != nil {
+			writeError(w, status.New(codes.InvalidArgument, err.Error()))
+			return
+		}
+
+		var header metadata.MD
+		err = g.conn.Invoke(outgoingContext(r), fullMethod, in, out, grpc.Header(&header))
+		if requestIDs := header.Get("x-request-id"); len(requestIDs) > 0 {
+			w.Header().Set("X-Request-Id", requestIDs[0])
+		}
+		if err != nil {
+			writeError(w, status.Convert(err))
+			return
+		}
+
+		body, err := marshaler.Marshal(out)
+		if err != nil {
+			writeError(w, status.New(codes.Internal, "failed to encode response"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+func newMessage(desc protoreflect.MessageDescriptor) (proto.Message, error) {
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
+	if err != nil {
+		return nil, err
+	}
+	return messageType.New().Interface(), nil
+}
+
+// decodeRequest fills the request message from the JSON body, path parameters and, for GET and DELETE routes, the query string
+func decodeRequest(r *http.Request, msg proto.Message, fromQuery bool) error {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := unmarshaler.Unmarshal(body, msg); err != nil {
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+	}
+
+	m := msg.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	if fromQuery {
+		for key, values := range r.URL.Query() {
+			if err := setField(m, fields, key, values[len(values)-1]); err != nil {
+				return err
+			}
+		}
+	}
+	for i := 0; i < fields.Len(); i++ {
+		name := string(fields.Get(i).Name())
+		if value := r.PathValue(name); value != "" {
+			if err := setField(m, fields, name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setField assigns a string value to a scalar field, converting it to the field's type
+func setField(m protoreflect.Message, fields protoreflect.FieldDescriptors, name, value string) error {
+	fd := fields.ByName(protoreflect.Name(name))
+	if fd == nil {
+		fd = fields.ByJSONName(name)
+	}
+	if fd == nil || fd.IsList() || fd.IsMap() {
+		return fmt.Errorf("unknown parameter %q", name)
+	}
+
+	var v protoreflect.Value
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(value)
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("parameter %q must be a boolean", name)
+		}
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("parameter %q must be an integer", name)
+		}
+		v = protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parameter %q must be an integer", name)
+		}
+		v = protoreflect.ValueOfInt64(n)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("parameter %q must be a non-negative integer", name)
+		}
+		v = protoreflect.ValueOfUint32(uint32(n))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parameter %q must be a non-negative integer", name)
+		}
+		v = protoreflect.ValueOfUint64(n)
+	case protoreflect.EnumKind:
+		enumValue := fd.Enum().Values().ByName(protoreflect.Name(value))
+		if enumValue == nil {
+			return fmt.Errorf("parameter %q has unknown value %q", name, value)
+		}
+		v = protoreflect.ValueOfEnum(enumValue.Number())
+	default:
+		return fmt.Errorf("parameter %q cannot be set from the URL", name)
+	}
+	m.Set(fd, v)
+	return nil
+}
+
+// outgoingContext forwards credentials and client information from the HTTP request as gRPC metadata
+func outgoingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		md.Set("authorization", auth)
+	}
+	if requestID := r.Header.Get("X-Request-Id"); requestID != "" {
+		md.Set("x-request-id", requestID)
+	}
+	if userAgent := r.Header.Get("User-Agent"); userAgent != "" {
+		md.Set("x-forwarded-user-agent", userAgent)
+	}
+
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		clientIP = forwarded + ", " + clientIP
+	}
+	md.Set("x-forwarded-for", clientIP)
+
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/kraftzpepe/auth-service/types"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const timestampName = "google.protobuf.Timestamp"
+
+var pathParamPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// buildOpenAPI generates an OpenAPI 3 document from the service descriptor, so the
+// published schema always matches proto/auth.proto
+func buildOpenAPI(service protoreflect.ServiceDescriptor, routes []route) ([]byte, error) {
+	schemas := map[string]any{
+		"Error": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"error": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"code":    map[string]any{"type": "integer"},
+						"status":  map[string]any{"type": "string"},
+						"message": map[string]any{"type": "string"},
+						"reason":  map[string]any{"type": "string", "description": "Stable machine-readable reason code"},
+						"field_violations": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"field":       map[string]any{"type": "string"},
+									"description": map[string]any{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	paths := map[string]map[string]any{}
+	addOperation := func(httpMethod, path string, method protoreflect.MethodDescriptor, summary string, fromQuery bool) {
+		addSchema(schemas, method.Input())
+		addSchema(schemas, method.Output())
+
+		op := map[string]any{
+			"operationId": string(method.Name()),
+			"summary":     summary,
+			"tags":        []string{string(service.Name())},
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content":     jsonContent(schemaRef(method.Output())),
+				},
+				"default": map[string]any{
+					"description": "Error",
+					"content":     jsonContent(map[string]any{"$ref": "#/components/schemas/Error"}),
+				},
+			},
+		}
+
+		var params []any
+		pathFields := map[string]bool{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+			pathFields[match[1]] = true
+			params = append(params, map[string]any{
+				"name": match[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		if fromQuery {
+			fields := method.Input().Fields()
+			for i := 0; i < fields.Len(); i++ {
+				fd := fields.Get(i)
+				if pathFields[string(fd.Name())] || fd.Kind() == protoreflect.MessageKind || fd.IsList() {
+					continue
+				}
+				params = append(params, map[string]any{
+					"name": string(fd.Name()), "in": "query",
+					"schema": fieldSchema(fd),
+				})
+			}
+		} else {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(schemaRef(method.Input())),
+			}
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(httpMethod)] = op
+	}
+
+	for _, r := range routes {
+		method := service.Methods().ByName(protoreflect.Name(r.RPC))
+		addOperation(r.Method, r.Path, method, r.Summary, hasQuery(r.Method))
+	}
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		path := strings.Replace(rpcPath, "{method}", string(method.Name()), 1)
+		addOperation(http.MethodPost, path, method, fmt.Sprintf("Call %s RPC-style", method.Name()), false)
+	}
+
+	return json.MarshalIndent(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   types.AppName,
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}, map[string]any{}},
+	}, "", "  ")
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func schemaName(desc protoreflect.Descriptor) string {
+	return strings.ReplaceAll(string(desc.FullName()), ".", "_")
+}
+
+func schemaRef(desc protoreflect.Descriptor) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + schemaName(desc)}
+}
+
+// addSchema adds a message and every message it references to the component schemas
+func addSchema(schemas map[string]any, msg protoreflect.MessageDescriptor) {
+	name := schemaName(msg)
+	if _, ok := schemas[name]; ok {
+		return
+	}
+	properties := map[string]any{}
+	schemas[name] = map[string]any{"type": "object", "properties": properties}
+
+	fields := msg.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		properties[string(fd.Name())] = fieldSchema(fd)
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsMap() && fd.Message().FullName() != timestampName {
+			addSchema(schemas, fd.Message())
+		}
+		if fd.IsMap() && fd.MapValue().Kind() == protoreflect.MessageKind {
+			addSchema(schemas, fd.MapValue().Message())
+		}
+	}
+}
+
+// fieldSchema describes a field the way protojson encodes it
+func fieldSchema(fd protoreflect.FieldDescriptor) map[string]any {
+	if fd.IsMap() {
+		return map[string]any{"type": "object", "additionalProperties": singularSchema(fd.MapValue())}
+	}
+	if fd.IsList() {
+		return map[string]any{"type": "array", "items": singularSchema(fd)}
+	}
+	return singularSchema(fd)
+}
+
+func singularSchema(fd protoreflect.FieldDescriptor) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings
+		return map[string]any{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]any{"type": "number"}
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		var values []string
+		enumValues := fd.Enum().Values()
+		for i := 0; i < enumValues.Len(); i++ {
+			values = append(values, string(enumValues.Get(i).Name()))
+		}
+		return map[string]any{"type": "string", "enum": values}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if fd.Message().FullName() == timestampName {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		return schemaRef(fd.Message())
+	}
+	return map[string]any{"type": "string"}
+}
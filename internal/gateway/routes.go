@@ -0,0 +1,81 @@
+package gateway
+
+import "net/http"
+
+// route maps an HTTP endpoint onto an AuthService RPC. Path segments in braces are copied
+// into the request field of the same name; for GET and DELETE routes query parameters are copied too.
+type route struct {
+	Method  string
+	Path    string
+	RPC     string
+	Summary string
+}
+
+var routes = []route{
+	{Method: "POST", Path: "/v1/users", RPC: "Register", Summary: "Register a new user"},
+	{Method: "POST", Path: "/v1/login", RPC: "Login", Summary: "Log in with email and password"},
+	{Method: "POST", Path: "/v1/tokens/refresh", RPC: "RefreshAccessToken", Summary: "Exchange a refresh token for new tokens"},
+	{Method: "GET", Path: "/v1/users/{identifier}", RPC: "GetUserByUUID", Summary: "Get a user by ID"},
+	{Method: "GET", Path: "/v1/users/by-email/{identifier}", RPC: "GetUserByEmail", Summary: "Get a user by email"},
+	{Method: "GET", Path: "/v1/users/by-username/{identifier}", RPC: "GetUserByUsername", Summary: "Get a user by username"},
+	{Method: "POST", Path: "/v1/password-resets", RPC: "RequestPasswordReset", Summary: "Email a password reset token"},
+	{Method: "POST", Path: "/v1/password-resets/confirm", RPC: "ResetPassword", Summary: "Set a new password using a reset token"},
+	{Method: "POST", Path: "/v1/magic-links", RPC: "RequestMagicLink", Summary: "Email a single-use sign-in link"},
+	{Method: "POST", Path: "/v1/magic-links/consume", RPC: "ConsumeMagicLink", Summary: "Sign in with a magic link token"},
+	{Method: "POST", Path: "/v1/login-codes", RPC: "SendLoginCode", Summary: "Email a 6-digit sign-in code"},
+	{Method: "POST", Path: "/v1/login-codes/verify", RPC: "VerifyLoginCode", Summary: "Sign in with an emailed code"},
+	{Method: "POST", Path: "/v1/oauth-clients", RPC: "CreateOAuthClient", Summary: "Register an OAuth client (admin)"},
+	{Method: "GET", Path: "/v1/oauth-clients", RPC: "ListOAuthClients", Summary: "List OAuth clients (admin)"},
+	{Method: "PATCH", Path: "/v1/oauth-clients/{client_id}", RPC: "UpdateOAuthClient", Summary: "Update an OAuth client (admin)"},
+	{Method: "POST", Path: "/v1/oauth-clients/{client_id}/rotate-secret", RPC: "RotateOAuthClientSecret", Summary: "Replace an OAuth client's secret (admin)"},
+	{Method: "DELETE", Path: "/v1/oauth-clients/{client_id}", RPC: "DeleteOAuthClient", Summary: "Delete an OAuth client (admin)"},
+	{Method: "POST", Path: "/v1/roles", RPC: "CreateRole", Summary: "Define a role (admin)"},
+	{Method: "GET", Path: "/v1/roles", RPC: "ListRoles", Summary: "List roles (admin)"},
+	{Method: "PATCH", Path: "/v1/roles/{name}", RPC: "UpdateRole", Summary: "Update a role (admin)"},
+	{Method: "DELETE", Path: "/v1/roles/{name}", RPC: "DeleteRole", Summary: "Delete a role (admin)"},
+	{Method: "GET", Path: "/v1/role-assignments/{user_id}", RPC: "ListUserRoles", Summary: "List a user's roles and permissions (admin)"},
+	{Method: "PUT", Path: "/v1/role-assignments/{user_id}/{role}", RPC: "AssignRole", Summary: "Assign a role to a user (admin)"},
+	{Method: "DELETE", Path: "/v1/role-assignments/{user_id}/{role}", RPC: "UnassignRole", Summary: "Remove a role from a user (admin)"},
+	{Method: "POST", Path: "/v1/permissions/check", RPC: "CheckPermission", Summary: "Check a permission of an access token's user"},
+	{Method: "POST", Path: "/v1/organizations", RPC: "CreateOrganization", Summary: "Create an organization (admin)"},
+	{Method: "GET", Path: "/v1/organizations", RPC: "ListOrganizations", Summary: "List organizations (admin)"},
+	{Method: "POST", Path: "/v1/organizations/{org_id}/invitations", RPC: "InviteMember", Summary: "Invite someone to an organization"},
+	{Method: "POST", Path: "/v1/invitations/accept", RPC: "AcceptInvitation", Summary: "Accept an invitation to an organization"},
+	{Method: "GET", Path: "/v1/organizations/{org_id}/members", RPC: "ListMemberships", Summary: "List the members of an organization"},
+	{Method: "GET", Path: "/v1/memberships", RPC: "ListMemberships", Summary: "List the organizations of the caller, or of user_id"},
+	{Method: "PUT", Path: "/v1/organizations/{org_id}/members/{user_id}/roles", RPC: "UpdateMemberRoles", Summary: "Replace the roles of a member"},
+	{Method: "DELETE", Path: "/v1/organizations/{org_id}/members/{user_id}", RPC: "RemoveMember", Summary: "Remove a member from an organization"},
+	{Method: "POST", Path: "/v1/tokens/switch-organization", RPC: "SwitchOrganization", Summary: "Get tokens scoped to another organization"},
+	{Method: "POST", Path: "/v1/api-keys", RPC: "CreateAPIKey", Summary: "Create an API key for the caller"},
+	{Method: "GET", Path: "/v1/api-keys", RPC: "ListAPIKeys", Summary: "List the API keys of the caller, or of user_id"},
+	{Method: "DELETE", Path: "/v1/api-keys/{id}", RPC: "RevokeAPIKey", Summary: "Revoke an API key"},
+	{Method: "POST", Path: "/v1/tokens/introspect", RPC: "IntrospectToken", Summary: "Inspect an access token or API key"},
+	{Method: "GET", Path: "/v1/users", RPC: "ListUsers", Summary: "List and search users (admin)"},
+	{Method: "POST", Path: "/v1/users/{user_id}/suspend", RPC: "SuspendUser", Summary: "Suspend a user and end their sessions (admin)"},
+	{Method: "POST", Path: "/v1/users/{user_id}/reactivate", RPC: "ReactivateUser", Summary: "Reactivate a user (admin)"},
+	{Method: "DELETE", Path: "/v1/users/{user_id}", RPC: "DeleteUser", Summary: "Delete a user (admin)"},
+	{Method: "POST", Path: "/v1/users/{user_id}/force-password-reset", RPC: "ForcePasswordReset", Summary: "Make a user reset their password (admin)"},
+	{Method: "POST", Path: "/v1/users/{user_id}/revoke-sessions", RPC: "RevokeUserSessions", Summary: "Sign a user out everywhere (admin)"},
+	{Method: "PATCH", Path: "/v1/profile", RPC: "UpdateProfile", Summary: "Update the caller's username and display attributes"},
+	{Method: "POST", Path: "/v1/email-changes", RPC: "ChangeEmail", Summary: "Start changing the caller's email"},
+	{Method: "POST", Path: "/v1/reauth-codes", RPC: "SendReauthCode", Summary: "Email the caller a code confirming a sensitive action"},
+	{Method: "POST", Path: "/v1/email-changes/confirm", RPC: "ConfirmEmailChange", Summary: "Confirm an email change"},
+	{Method: "POST", Path: "/v1/email-changes/revert", RPC: "RevertEmailChange", Summary: "Cancel or undo an email change"},
+	{Method: "GET", Path: "/v1/audit-events", RPC: "QueryAuditLog", Summary: "Search the audit log (admin)"},
+	{Method: "POST", Path: "/v1/audit-events/verify", RPC: "VerifyAuditLog", Summary: "Verify the hash chain of the audit log (admin)"},
+	{Method: "POST", Path: "/v1/webhooks", RPC: "CreateWebhookSubscription", Summary: "Subscribe an endpoint to user events (admin)"},
+	{Method: "GET", Path: "/v1/webhooks", RPC: "ListWebhookSubscriptions", Summary: "List webhook subscriptions (admin)"},
+	{Method: "PATCH", Path: "/v1/webhooks/{id}", RPC: "UpdateWebhookSubscription", Summary: "Update a webhook subscription (admin)"},
+	{Method: "DELETE", Path: "/v1/webhooks/{id}", RPC: "DeleteWebhookSubscription", Summary: "Delete a webhook subscription (admin)"},
+	{Method: "GET", Path: "/v1/webhook-deliveries", RPC: "ListWebhookDeliveries", Summary: "List webhook deliveries (admin)"},
+	{Method: "POST", Path: "/v1/webhook-deliveries/replay", RPC: "ReplayWebhookDeliveries", Summary: "Queue failed webhook deliveries again (admin)"},
+}
+
+// rpcPath exposes every RPC, including ones without a dedicated route, as POST /v1/rpc/{method}
+const rpcPath = "/v1/rpc/{method}"
+
+// hasQuery reports whether requests of an HTTP method carry their fields in the query string
+// instead of a JSON body
+func hasQuery(method string) bool {
+	return method == http.MethodGet || method == http.MethodDelete
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/middleware"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// gRPC endpoint for creating an API key for the caller
+func (h *AuthHandler) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.CreateAPIKeyResponse, error) {
+	claims, err := middleware.AuthenticatedClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(req.GetExpiresIn()) * time.Second
+	key, secret, err := h.APIKeyService.CreateAPIKey(ctx, claims, req.GetName(), req.GetScopes(), ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateAPIKeyResponse{ApiKey: apiKeyToProto(key), Key: secret}, nil
+}
+
+// gRPC endpoint for listing the API keys of a user
+func (h *AuthHandler) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysRequest) (*pb.ListAPIKeysResponse, error) {
+	userID, err := middleware.TargetUser(ctx, req.GetUserId(), middleware.PermissionManageAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := h.APIKeyService.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListAPIKeysResponse{}
+	for _, key := range keys {
+		res.ApiKeys = append(res.ApiKeys, apiKeyToProto(key))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for revoking an API key
+func (h *AuthHandler) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*pb.RevokeAPIKeyResponse, error) {
+	var userID string // Empty lets administrators revoke any user's key
+	if !middleware.HasGlobalPermission(ctx, middleware.PermissionManageAPIKeys) {
+		claims, err := middleware.AuthenticatedClaims(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if claims.UserID == "" {
+			return nil, types.ErrUnauthenticated.WithMessage("a user access token is required")
+		}
+		userID = claims.UserID
+	}
+
+	if err := h.APIKeyService.RevokeAPIKey(ctx, req.GetId(), userID); err != nil {
+		return nil, err
+	}
+
+	return &pb.RevokeAPIKeyResponse{}, nil
+}
+
+// gRPC endpoint for inspecting an access token or API key
+func (h *AuthHandler) IntrospectToken(ctx context.Context, req *pb.IntrospectTokenRequest) (*pb.IntrospectTokenResponse, error) {
+	if req.GetToken() == "" {
+		return nil, types.ErrInvalidRequest.WithMessage("token is required").WithField("token")
+	}
+
+	claims, active, err := h.APIKeyService.IntrospectToken(ctx, req.GetToken())
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return &pb.IntrospectTokenResponse{}, nil
+	}
+
+	res := &pb.IntrospectTokenResponse{
+		Active:      true,
+		TokenType:   service.TokenType(claims),
+		UserId:      claims.UserID,
+		ClientId:    claims.ClientID,
+		OrgId:       claims.OrgID,
+		Scope:       claims.Scope,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		ApiKeyId:    claims.APIKeyID,
+	}
+	if claims.ExpiresAt != nil {
+		res.ExpiresAt = claims.ExpiresAt.Format(time.RFC3339)
+	}
+	return res, nil
+}
+
+func apiKeyToProto(key *models.APIKey) *pb.APIKey {
+	res := &pb.APIKey{
+		Id:        key.ID.String(),
+		UserId:    key.UserID.String(),
+		OrgId:     orgIDString(key.OrgID),
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+	if key.ExpiresAt.Valid {
+		res.ExpiresAt = key.ExpiresAt.Time.Format(time.RFC3339)
+	}
+	if key.LastUsedAt.Valid {
+		res.LastUsedAt = key.LastUsedAt.Time.Format(time.RFC3339)
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// gRPC endpoint for searching the audit log
+func (h *AuthHandler) QueryAuditLog(ctx context.Context, req *pb.QueryAuditLogRequest) (*pb.QueryAuditLogResponse, error) {
+	events, nextPageToken, err := h.AuditService.QueryAuditLog(ctx, service.AuditQuery{
+		PageSize:      int(req.GetPageSize()),
+		PageToken:     req.GetPageToken(),
+		Type:          req.GetType(),
+		ActorID:       req.GetActorId(),
+		SubjectID:     req.GetSubjectId(),
+		CreatedAfter:  req.GetCreatedAfter(),
+		CreatedBefore: req.GetCreatedBefore(),
+		Ascending:     req.GetAscending(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.QueryAuditLogResponse{NextPageToken: nextPageToken}
+	for _, event := range events {
+		res.Events = append(res.Events, auditEventToProto(event))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for verifying the hash chain of the audit log
+func (h *AuthHandler) VerifyAuditLog(ctx context.Context, req *pb.VerifyAuditLogRequest) (*pb.VerifyAuditLogResponse, error) {
+	result, err := h.AuditService.VerifyAuditLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.VerifyAuditLogResponse{
+		Valid:          result.Valid,
+		EventsChecked:  result.EventsChecked,
+		FirstInvalidId: result.FirstInvalidID,
+		Problem:        result.Problem,
+		HeadHash:       result.HeadHash,
+	}, nil
+}
+
+func auditEventToProto(event *models.AuditEvent) *pb.AuditEvent {
+	return &pb.AuditEvent{
+		Id:        event.ID,
+		Type:      event.Type,
+		ActorId:   event.ActorID,
+		SubjectId: event.SubjectID,
+		Ip:        event.IP,
+		UserAgent: event.UserAgent,
+		RequestId: event.RequestID,
+		Metadata:  event.Metadata,
+		CreatedAt: event.CreatedAt.Format(time.RFC3339Nano),
+		PrevHash:  event.PrevHash,
+		Hash:      event.Hash,
+	}
+}
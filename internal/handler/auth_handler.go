@@ -3,17 +3,49 @@ package handler
 import (
 	"context"
 
+	"github.com/google/uuid"
 	"github.com/kraftzpepe/auth-service/internal/service"
 	pb "github.com/kraftzpepe/auth-service/proto/generated"
 )
 
 type AuthHandler struct {
 	pb.UnimplementedAuthServiceServer
-	AuthService *service.AuthService
+	AuthService         *service.AuthService
+	OAuthClientService  *service.OAuthClientService
+	RoleService         *service.RoleService
+	OrganizationService *service.OrganizationService
+	APIKeyService       *service.APIKeyService
+	UserAdminService    *service.UserAdminService
+	ProfileService      *service.ProfileService
+	AuditService        *service.AuditService
+	WebhookService      *service.WebhookService
+	LoginCodeService    *service.LoginCodeService
 }
 
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
-	return &AuthHandler{AuthService: authService}
+func NewAuthHandler(
+	authService *service.AuthService,
+	oauthClientService *service.OAuthClientService,
+	roleService *service.RoleService,
+	organizationService *service.OrganizationService,
+	apiKeyService *service.APIKeyService,
+	userAdminService *service.UserAdminService,
+	profileService *service.ProfileService,
+	auditService *service.AuditService,
+	webhookService *service.WebhookService,
+	loginCodeService *service.LoginCodeService,
+) *AuthHandler {
+	return &AuthHandler{
+		AuthService:         authService,
+		OAuthClientService:  oauthClientService,
+		RoleService:         roleService,
+		OrganizationService: organizationService,
+		APIKeyService:       apiKeyService,
+		UserAdminService:    userAdminService,
+		ProfileService:      profileService,
+		AuditService:        auditService,
+		WebhookService:      webhookService,
+		LoginCodeService:    loginCodeService,
+	}
 }
 
 // Implement the Register method
@@ -34,7 +66,13 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 
 // Implement the Login method
 func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	accessToken, refreshToken, err := h.AuthService.Login(ctx, req.GetEmail(), req.GetPassword())
+	var accessToken, refreshToken string
+	var err error
+	if req.GetOrgId() != "" {
+		accessToken, refreshToken, err = h.OrganizationService.Login(ctx, req.GetOrgId(), req.GetEmail(), req.GetPassword())
+	} else {
+		accessToken, refreshToken, err = h.AuthService.Login(ctx, req.GetEmail(), req.GetPassword())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +85,7 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 
 // gRPC endpoint for refreshing access tokens
 func (h *AuthHandler) RefreshAccessToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
-	accessToken, refreshToken, err := h.AuthService.RefreshAccessToken(req.GetRefreshToken())
+	accessToken, refreshToken, err := h.AuthService.RefreshAccessToken(ctx, req.GetRefreshToken())
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +97,13 @@ func (h *AuthHandler) RefreshAccessToken(ctx context.Context, req *pb.RefreshTok
 }
 
 func (h *AuthHandler) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
-	message, err := h.AuthService.RequestPasswordReset(ctx, req.GetEmail())
+	var message string
+	var err error
+	if req.GetOrgId() != "" {
+		message, err = h.OrganizationService.RequestPasswordReset(ctx, req.GetOrgId(), req.GetEmail())
+	} else {
+		message, err = h.AuthService.RequestPasswordReset(ctx, req.GetEmail())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -80,6 +124,31 @@ func (h *AuthHandler) ResetPassword(ctx context.Context, req *pb.ResetPasswordRe
 	}, nil
 }
 
+// gRPC endpoint for emailing a magic sign-in link
+func (h *AuthHandler) RequestMagicLink(ctx context.Context, req *pb.RequestMagicLinkRequest) (*pb.RequestMagicLinkResponse, error) {
+	message, err := h.AuthService.RequestMagicLink(ctx, req.GetEmail(), req.GetDeviceNonce())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RequestMagicLinkResponse{
+		Message: message,
+	}, nil
+}
+
+// gRPC endpoint for signing in with a magic link
+func (h *AuthHandler) ConsumeMagicLink(ctx context.Context, req *pb.ConsumeMagicLinkRequest) (*pb.ConsumeMagicLinkResponse, error) {
+	accessToken, refreshToken, err := h.AuthService.ConsumeMagicLink(ctx, req.GetToken(), req.GetDeviceNonce())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ConsumeMagicLinkResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
 // gRPC endpoint for getting a user by email
 func (h *AuthHandler) GetUserByEmail(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
 	user, err := h.AuthService.GetUserByEmail(ctx, req.GetIdentifier())
@@ -88,11 +157,15 @@ func (h *AuthHandler) GetUserByEmail(ctx context.Context, req *pb.GetUserRequest
 	}
 
 	return &pb.GetUserResponse{
-		Id:        user.ID.String(),
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.String(),
-		UpdatedAt: user.UpdatedAt.String(),
+		Id:          user.ID.String(),
+		Username:    user.Username,
+		Email:       user.Email,
+		CreatedAt:   user.CreatedAt.String(),
+		UpdatedAt:   user.UpdatedAt.String(),
+		OrgId:       orgIDString(user.OrgID),
+		Status:      user.Status,
+		DisplayName: user.DisplayName,
+		AvatarUrl:   user.AvatarURL,
 	}, nil
 }
 
@@ -104,11 +177,15 @@ func (h *AuthHandler) GetUserByUUID(ctx context.Context, req *pb.GetUserRequest)
 	}
 
 	return &pb.GetUserResponse{
-		Id:        user.ID.String(),
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.String(),
-		UpdatedAt: user.UpdatedAt.String(),
+		Id:          user.ID.String(),
+		Username:    user.Username,
+		Email:       user.Email,
+		CreatedAt:   user.CreatedAt.String(),
+		UpdatedAt:   user.UpdatedAt.String(),
+		OrgId:       orgIDString(user.OrgID),
+		Status:      user.Status,
+		DisplayName: user.DisplayName,
+		AvatarUrl:   user.AvatarURL,
 	}, nil
 }
 
@@ -120,10 +197,22 @@ func (h *AuthHandler) GetUserByUsername(ctx context.Context, req *pb.GetUserRequ
 	}
 
 	return &pb.GetUserResponse{
-		Id:        user.ID.String(),
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.String(),
-		UpdatedAt: user.UpdatedAt.String(),
+		Id:          user.ID.String(),
+		Username:    user.Username,
+		Email:       user.Email,
+		CreatedAt:   user.CreatedAt.String(),
+		UpdatedAt:   user.UpdatedAt.String(),
+		OrgId:       orgIDString(user.OrgID),
+		Status:      user.Status,
+		DisplayName: user.DisplayName,
+		AvatarUrl:   user.AvatarURL,
 	}, nil
 }
+
+// orgIDString formats an optional organization ID, returning an empty string when it is unset
+func orgIDString(orgID uuid.NullUUID) string {
+	if !orgID.Valid {
+		return ""
+	}
+	return orgID.UUID.String()
+}
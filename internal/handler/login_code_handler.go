@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/kraftzpepe/auth-service/internal/middleware"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// gRPC endpoint for emailing a sign-in code
+func (h *AuthHandler) SendLoginCode(ctx context.Context, req *pb.SendLoginCodeRequest) (*pb.SendLoginCodeResponse, error) {
+	message, err := h.LoginCodeService.SendLoginCode(ctx, req.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SendLoginCodeResponse{Message: message}, nil
+}
+
+// gRPC endpoint for signing in with an emailed code
+func (h *AuthHandler) VerifyLoginCode(ctx context.Context, req *pb.VerifyLoginCodeRequest) (*pb.VerifyLoginCodeResponse, error) {
+	accessToken, refreshToken, err := h.LoginCodeService.VerifyLoginCode(ctx, req.GetEmail(), req.GetCode())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.VerifyLoginCodeResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// gRPC endpoint for emailing the caller a confirmation code for sensitive actions
+func (h *AuthHandler) SendReauthCode(ctx context.Context, req *pb.SendReauthCodeRequest) (*pb.SendReauthCodeResponse, error) {
+	userID, err := middleware.TargetUser(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := h.LoginCodeService.SendReauthCode(ctx, userID, req.GetAction())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SendReauthCodeResponse{Message: message}, nil
+}
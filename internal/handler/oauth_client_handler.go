@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// gRPC endpoint for registering an OAuth client
+func (h *AuthHandler) CreateOAuthClient(ctx context.Context, req *pb.CreateOAuthClientRequest) (*pb.CreateOAuthClientResponse, error) {
+	client, secret, err := h.OAuthClientService.CreateClient(ctx, service.OAuthClientParams{
+		Name:            req.GetName(),
+		RedirectURIs:    req.GetRedirectUris(),
+		GrantTypes:      req.GetGrantTypes(),
+		Scopes:          req.GetScopes(),
+		AccessTokenTTL:  time.Duration(req.GetAccessTokenTtlSeconds()) * time.Second,
+		RefreshTokenTTL: time.Duration(req.GetRefreshTokenTtlSeconds()) * time.Second,
+		PublicKey:       req.GetPublicKeyPem(),
+	}, req.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateOAuthClientResponse{
+		Client:       oauthClientToProto(client),
+		ClientSecret: secret,
+	}, nil
+}
+
+// gRPC endpoint for listing OAuth clients
+func (h *AuthHandler) ListOAuthClients(ctx context.Context, _ *pb.ListOAuthClientsRequest) (*pb.ListOAuthClientsResponse, error) {
+	clients, err := h.OAuthClientService.ListClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListOAuthClientsResponse{}
+	for _, client := range clients {
+		res.Clients = append(res.Clients, oauthClientToProto(client))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for updating an OAuth client
+func (h *AuthHandler) UpdateOAuthClient(ctx context.Context, req *pb.UpdateOAuthClientRequest) (*pb.UpdateOAuthClientResponse, error) {
+	client, err := h.OAuthClientService.UpdateClient(ctx, req.GetClientId(), service.OAuthClientParams{
+		Name:            req.GetName(),
+		RedirectURIs:    req.GetRedirectUris(),
+		GrantTypes:      req.GetGrantTypes(),
+		Scopes:          req.GetScopes(),
+		AccessTokenTTL:  time.Duration(req.GetAccessTokenTtlSeconds()) * time.Second,
+		RefreshTokenTTL: time.Duration(req.GetRefreshTokenTtlSeconds()) * time.Second,
+		PublicKey:       req.GetPublicKeyPem(),
+	}, req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateOAuthClientResponse{Client: oauthClientToProto(client)}, nil
+}
+
+// gRPC endpoint for rotating the secret of an OAuth client
+func (h *AuthHandler) RotateOAuthClientSecret(ctx context.Context, req *pb.RotateOAuthClientSecretRequest) (*pb.RotateOAuthClientSecretResponse, error) {
+	secret, err := h.OAuthClientService.RotateSecret(ctx, req.GetClientId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RotateOAuthClientSecretResponse{ClientSecret: secret}, nil
+}
+
+// gRPC endpoint for deleting an OAuth client
+func (h *AuthHandler) DeleteOAuthClient(ctx context.Context, req *pb.DeleteOAuthClientRequest) (*pb.DeleteOAuthClientResponse, error) {
+	if err := h.OAuthClientService.DeleteClient(ctx, req.GetClientId()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteOAuthClientResponse{}, nil
+}
+
+func oauthClientToProto(client *models.OAuthClient) *pb.OAuthClient {
+	return &pb.OAuthClient{
+		ClientId:               client.ID,
+		Name:                   client.Name,
+		RedirectUris:           client.RedirectURIs,
+		GrantTypes:             client.GrantTypes,
+		Scopes:                 client.Scopes,
+		AccessTokenTtlSeconds:  int64(client.AccessTokenTTL.Seconds()),
+		RefreshTokenTtlSeconds: int64(client.RefreshTokenTTL.Seconds()),
+		Public:                 client.IsPublic(),
+		CreatedAt:              client.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:              client.UpdatedAt.Format(time.RFC3339),
+		PublicKeyPem:           client.PublicKey,
+	}
+}
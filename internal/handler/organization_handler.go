@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/middleware"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// gRPC endpoint for creating an organization
+func (h *AuthHandler) CreateOrganization(ctx context.Context, req *pb.CreateOrganizationRequest) (*pb.CreateOrganizationResponse, error) {
+	org, err := h.OrganizationService.CreateOrganization(ctx, req.GetSlug(), req.GetName(), req.GetIsolatedAccounts())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateOrganizationResponse{Organization: organizationToProto(org)}, nil
+}
+
+// gRPC endpoint for listing organizations
+func (h *AuthHandler) ListOrganizations(ctx context.Context, _ *pb.ListOrganizationsRequest) (*pb.ListOrganizationsResponse, error) {
+	orgs, err := h.OrganizationService.ListOrganizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListOrganizationsResponse{}
+	for _, org := range orgs {
+		res.Organizations = append(res.Organizations, organizationToProto(org))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for inviting someone to an organization
+func (h *AuthHandler) InviteMember(ctx context.Context, req *pb.InviteMemberRequest) (*pb.InviteMemberResponse, error) {
+	if err := middleware.RequireOrganizationPermission(ctx, req.GetOrgId(), middleware.PermissionManageMembers); err != nil {
+		return nil, err
+	}
+
+	var invitedBy string // Empty when an administrator invites with the admin token
+	if claims, err := middleware.AuthenticatedClaims(ctx); err == nil {
+		invitedBy = claims.UserID
+	}
+
+	invitation, err := h.OrganizationService.InviteMember(ctx, req.GetOrgId(), req.GetEmail(), req.GetRoles(), invitedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.InviteMemberResponse{
+		InvitationId: invitation.ID.String(),
+		ExpiresAt:    invitation.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// gRPC endpoint for accepting an invitation
+func (h *AuthHandler) AcceptInvitation(ctx context.Context, req *pb.AcceptInvitationRequest) (*pb.AcceptInvitationResponse, error) {
+	org, userID, accessToken, refreshToken, err := h.OrganizationService.AcceptInvitation(ctx,
+		req.GetToken(), middleware.BearerToken(ctx), req.GetUsername(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AcceptInvitationResponse{
+		OrgId:        org.ID.String(),
+		UserId:       userID.String(),
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// gRPC endpoint for listing the members of an organization or the organizations of a user
+func (h *AuthHandler) ListMemberships(ctx context.Context, req *pb.ListMembershipsRequest) (*pb.ListMembershipsResponse, error) {
+	var memberships []*models.Membership
+	var err error
+	switch {
+	case req.GetOrgId() != "" && req.GetUserId() != "":
+		return nil, types.ErrInvalidRequest.WithMessage("set either org_id or user_id")
+	case req.GetOrgId() != "":
+		if err := middleware.RequireOrganizationPermission(ctx, req.GetOrgId(), middleware.PermissionReadMembers); err != nil {
+			return nil, err
+		}
+		memberships, err = h.OrganizationService.ListMembers(ctx, req.GetOrgId())
+	default:
+		userID, authErr := middleware.TargetUser(ctx, req.GetUserId(), middleware.PermissionManageOrganizations)
+		if authErr != nil {
+			return nil, authErr
+		}
+		memberships, err = h.OrganizationService.ListUserMemberships(ctx, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListMembershipsResponse{}
+	for _, membership := range memberships {
+		res.Memberships = append(res.Memberships, membershipToProto(membership))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for replacing the roles of a member
+func (h *AuthHandler) UpdateMemberRoles(ctx context.Context, req *pb.UpdateMemberRolesRequest) (*pb.UpdateMemberRolesResponse, error) {
+	if err := middleware.RequireOrganizationPermission(ctx, req.GetOrgId(), middleware.PermissionManageMembers); err != nil {
+		return nil, err
+	}
+
+	roles, err := h.OrganizationService.UpdateMemberRoles(ctx, req.GetOrgId(), req.GetUserId(), req.GetRoles())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateMemberRolesResponse{Roles: roles}, nil
+}
+
+// gRPC endpoint for removing a member from an organization
+func (h *AuthHandler) RemoveMember(ctx context.Context, req *pb.RemoveMemberRequest) (*pb.RemoveMemberResponse, error) {
+	if err := middleware.RequireOrganizationPermission(ctx, req.GetOrgId(), middleware.PermissionManageMembers); err != nil {
+		return nil, err
+	}
+
+	if err := h.OrganizationService.RemoveMember(ctx, req.GetOrgId(), req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	return &pb.RemoveMemberResponse{}, nil
+}
+
+// gRPC endpoint for exchanging the caller's access token for tokens scoped to another organization
+func (h *AuthHandler) SwitchOrganization(ctx context.Context, req *pb.SwitchOrganizationRequest) (*pb.SwitchOrganizationResponse, error) {
+	accessToken, refreshToken, err := h.OrganizationService.SwitchOrganization(ctx, middleware.BearerToken(ctx), req.GetOrgId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SwitchOrganizationResponse{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func organizationToProto(org *models.Organization) *pb.Organization {
+	return &pb.Organization{
+		Id:               org.ID.String(),
+		Slug:             org.Slug,
+		Name:             org.Name,
+		IsolatedAccounts: org.IsolatedAccounts,
+		CreatedAt:        org.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:        org.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func membershipToProto(membership *models.Membership) *pb.Membership {
+	return &pb.Membership{
+		OrgId:     membership.OrgID.String(),
+		OrgSlug:   membership.OrgSlug,
+		OrgName:   membership.OrgName,
+		UserId:    membership.UserID.String(),
+		Username:  membership.Username,
+		Email:     membership.Email,
+		Roles:     membership.Roles,
+		CreatedAt: membership.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/kraftzpepe/auth-service/internal/middleware"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// gRPC endpoint for updating the caller's profile
+func (h *AuthHandler) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UpdateProfileResponse, error) {
+	userID, err := middleware.TargetUser(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.ProfileService.UpdateProfile(ctx, userID, service.ProfileParams{
+		Username:    req.GetUsername(),
+		DisplayName: req.GetDisplayName(),
+		AvatarURL:   req.GetAvatarUrl(),
+	}, req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateProfileResponse{User: userToProto(user)}, nil
+}
+
+// gRPC endpoint for starting a change of the caller's email
+func (h *AuthHandler) ChangeEmail(ctx context.Context, req *pb.ChangeEmailRequest) (*pb.ChangeEmailResponse, error) {
+	userID, err := middleware.TargetUser(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := h.ProfileService.ChangeEmail(ctx, userID, req.GetNewEmail(), req.GetCurrentPassword(), req.GetReauthCode())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ChangeEmailResponse{Message: message}, nil
+}
+
+// gRPC endpoint for confirming an email change
+func (h *AuthHandler) ConfirmEmailChange(ctx context.Context, req *pb.ConfirmEmailChangeRequest) (*pb.ConfirmEmailChangeResponse, error) {
+	email, err := h.ProfileService.ConfirmEmailChange(ctx, req.GetToken())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConfirmEmailChangeResponse{Email: email}, nil
+}
+
+// gRPC endpoint for reverting an email change
+func (h *AuthHandler) RevertEmailChange(ctx context.Context, req *pb.RevertEmailChangeRequest) (*pb.RevertEmailChangeResponse, error) {
+	restored, err := h.ProfileService.RevertEmailChange(ctx, req.GetToken())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RevertEmailChangeResponse{Restored: restored}, nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// gRPC endpoint for defining a role
+func (h *AuthHandler) CreateRole(ctx context.Context, req *pb.CreateRoleRequest) (*pb.CreateRoleResponse, error) {
+	role, err := h.RoleService.CreateRole(ctx, req.GetName(), req.GetDescription(), req.GetPermissions())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateRoleResponse{Role: roleToProto(role)}, nil
+}
+
+// gRPC endpoint for listing roles
+func (h *AuthHandler) ListRoles(ctx context.Context, _ *pb.ListRolesRequest) (*pb.ListRolesResponse, error) {
+	roles, err := h.RoleService.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListRolesResponse{}
+	for _, role := range roles {
+		res.Roles = append(res.Roles, roleToProto(role))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for updating a role
+func (h *AuthHandler) UpdateRole(ctx context.Context, req *pb.UpdateRoleRequest) (*pb.UpdateRoleResponse, error) {
+	role, err := h.RoleService.UpdateRole(ctx, req.GetName(), req.GetDescription(), req.GetPermissions(), req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateRoleResponse{Role: roleToProto(role)}, nil
+}
+
+// gRPC endpoint for deleting a role
+func (h *AuthHandler) DeleteRole(ctx context.Context, req *pb.DeleteRoleRequest) (*pb.DeleteRoleResponse, error) {
+	if err := h.RoleService.DeleteRole(ctx, req.GetName()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteRoleResponse{}, nil
+}
+
+// gRPC endpoint for assigning a role to a user
+func (h *AuthHandler) AssignRole(ctx context.Context, req *pb.AssignRoleRequest) (*pb.AssignRoleResponse, error) {
+	if err := h.RoleService.AssignRole(ctx, req.GetUserId(), req.GetRole()); err != nil {
+		return nil, err
+	}
+
+	return &pb.AssignRoleResponse{}, nil
+}
+
+// gRPC endpoint for removing a role from a user
+func (h *AuthHandler) UnassignRole(ctx context.Context, req *pb.UnassignRoleRequest) (*pb.UnassignRoleResponse, error) {
+	if err := h.RoleService.UnassignRole(ctx, req.GetUserId(), req.GetRole()); err != nil {
+		return nil, err
+	}
+
+	return &pb.UnassignRoleResponse{}, nil
+}
+
+// gRPC endpoint for listing the roles of a user
+func (h *AuthHandler) ListUserRoles(ctx context.Context, req *pb.ListUserRolesRequest) (*pb.ListUserRolesResponse, error) {
+	roles, permissions, err := h.RoleService.ListUserRoles(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListUserRolesResponse{Roles: roles, Permissions: permissions}, nil
+}
+
+// gRPC endpoint for checking a permission of the user of an access token
+func (h *AuthHandler) CheckPermission(ctx context.Context, req *pb.CheckPermissionRequest) (*pb.CheckPermissionResponse, error) {
+	check, err := h.RoleService.CheckPermission(ctx, req.GetAccessToken(), req.GetPermission())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CheckPermissionResponse{Allowed: check.Allowed, UserId: check.UserID, Roles: check.Roles}, nil
+}
+
+func roleToProto(role *models.Role) *pb.Role {
+	return &pb.Role{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		CreatedAt:   role.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   role.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// gRPC endpoint for listing and searching users
+func (h *AuthHandler) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	users, nextPageToken, err := h.UserAdminService.ListUsers(ctx, service.UserQuery{
+		PageSize:       int(req.GetPageSize()),
+		PageToken:      req.GetPageToken(),
+		SortBy:         req.GetSortBy(),
+		Descending:     req.GetDescending(),
+		EmailPrefix:    req.GetEmailPrefix(),
+		UsernamePrefix: req.GetUsernamePrefix(),
+		EmailDomain:    req.GetEmailDomain(),
+		Search:         req.GetSearch(),
+		CreatedAfter:   req.GetCreatedAfter(),
+		CreatedBefore:  req.GetCreatedBefore(),
+		Status:         req.GetStatus(),
+		EmailStatus:    req.GetEmailStatus(),
+		Role:           req.GetRole(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListUsersResponse{NextPageToken: nextPageToken}
+	for _, user := range users {
+		res.Users = append(res.Users, userToProto(user))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for suspending a user
+func (h *AuthHandler) SuspendUser(ctx context.Context, req *pb.SuspendUserRequest) (*pb.SuspendUserResponse, error) {
+	user, err := h.UserAdminService.SuspendUser(ctx, req.GetUserId(), req.GetReason())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SuspendUserResponse{User: userToProto(user)}, nil
+}
+
+// gRPC endpoint for reactivating a user
+func (h *AuthHandler) ReactivateUser(ctx context.Context, req *pb.ReactivateUserRequest) (*pb.ReactivateUserResponse, error) {
+	user, err := h.UserAdminService.ReactivateUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReactivateUserResponse{User: userToProto(user)}, nil
+}
+
+// gRPC endpoint for deleting a user
+func (h *AuthHandler) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	if err := h.UserAdminService.DeleteUser(ctx, req.GetUserId(), req.GetHard()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteUserResponse{}, nil
+}
+
+// gRPC endpoint for forcing a password reset
+func (h *AuthHandler) ForcePasswordReset(ctx context.Context, req *pb.ForcePasswordResetRequest) (*pb.ForcePasswordResetResponse, error) {
+	message, err := h.UserAdminService.ForcePasswordReset(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ForcePasswordResetResponse{Message: message}, nil
+}
+
+// gRPC endpoint for revoking a user's sessions
+func (h *AuthHandler) RevokeUserSessions(ctx context.Context, req *pb.RevokeUserSessionsRequest) (*pb.RevokeUserSessionsResponse, error) {
+	revoked, err := h.UserAdminService.RevokeSessions(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RevokeUserSessionsResponse{Revoked: revoked}, nil
+}
+
+func userToProto(user *models.User) *pb.User {
+	return &pb.User{
+		Id:            user.ID.String(),
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		OrgId:         orgIDString(user.OrgID),
+		CreatedAt:     user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     user.UpdatedAt.Format(time.RFC3339),
+		Status:        user.Status,
+		StatusReason:  user.StatusReason,
+		DisplayName:   user.DisplayName,
+		AvatarUrl:     user.AvatarURL,
+	}
+}
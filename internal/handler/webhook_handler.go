@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+)
+
+// gRPC endpoint for creating a webhook subscription
+func (h *AuthHandler) CreateWebhookSubscription(ctx context.Context, req *pb.CreateWebhookSubscriptionRequest) (*pb.CreateWebhookSubscriptionResponse, error) {
+	sub, err := h.WebhookService.CreateSubscription(ctx, service.WebhookParams{
+		URL:         req.GetUrl(),
+		EventTypes:  req.GetEventTypes(),
+		Description: req.GetDescription(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateWebhookSubscriptionResponse{
+		Subscription: webhookSubscriptionToProto(sub),
+		Secret:       sub.Secret,
+	}, nil
+}
+
+// gRPC endpoint for listing webhook subscriptions
+func (h *AuthHandler) ListWebhookSubscriptions(ctx context.Context, _ *pb.ListWebhookSubscriptionsRequest) (*pb.ListWebhookSubscriptionsResponse, error) {
+	subs, err := h.WebhookService.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListWebhookSubscriptionsResponse{}
+	for _, sub := range subs {
+		res.Subscriptions = append(res.Subscriptions, webhookSubscriptionToProto(sub))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for updating a webhook subscription
+func (h *AuthHandler) UpdateWebhookSubscription(ctx context.Context, req *pb.UpdateWebhookSubscriptionRequest) (*pb.UpdateWebhookSubscriptionResponse, error) {
+	sub, err := h.WebhookService.UpdateSubscription(ctx, req.GetId(), service.WebhookParams{
+		URL:         req.GetUrl(),
+		EventTypes:  req.GetEventTypes(),
+		Description: req.GetDescription(),
+		Active:      req.GetActive(),
+	}, req.GetUpdateMask())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateWebhookSubscriptionResponse{Subscription: webhookSubscriptionToProto(sub)}, nil
+}
+
+// gRPC endpoint for deleting a webhook subscription
+func (h *AuthHandler) DeleteWebhookSubscription(ctx context.Context, req *pb.DeleteWebhookSubscriptionRequest) (*pb.DeleteWebhookSubscriptionResponse, error) {
+	if err := h.WebhookService.DeleteSubscription(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteWebhookSubscriptionResponse{}, nil
+}
+
+// gRPC endpoint for listing webhook deliveries
+func (h *AuthHandler) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	deliveries, nextPageToken, err := h.WebhookService.ListDeliveries(ctx, service.WebhookDeliveryQuery{
+		SubscriptionID: req.GetSubscriptionId(),
+		Status:         req.GetStatus(),
+		EventType:      req.GetEventType(),
+		PageSize:       int(req.GetPageSize()),
+		PageToken:      req.GetPageToken(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListWebhookDeliveriesResponse{NextPageToken: nextPageToken}
+	for _, delivery := range deliveries {
+		res.Deliveries = append(res.Deliveries, webhookDeliveryToProto(delivery))
+	}
+	return res, nil
+}
+
+// gRPC endpoint for replaying failed webhook deliveries
+func (h *AuthHandler) ReplayWebhookDeliveries(ctx context.Context, req *pb.ReplayWebhookDeliveriesRequest) (*pb.ReplayWebhookDeliveriesResponse, error) {
+	replayed, err := h.WebhookService.ReplayDeliveries(ctx, req.GetDeliveryId(), req.GetSubscriptionId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReplayWebhookDeliveriesResponse{Replayed: replayed}, nil
+}
+
+func webhookSubscriptionToProto(sub *models.WebhookSubscription) *pb.WebhookSubscription {
+	return &pb.WebhookSubscription{
+		Id:          sub.ID.String(),
+		Url:         sub.URL,
+		EventTypes:  sub.EventTypes,
+		Description: sub.Description,
+		Active:      sub.Active,
+		CreatedAt:   sub.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   sub.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func webhookDeliveryToProto(delivery *models.WebhookDelivery) *pb.WebhookDelivery {
+	res := &pb.WebhookDelivery{
+		Id:             delivery.ID,
+		SubscriptionId: delivery.SubscriptionID.String(),
+		EventId:        delivery.EventID.String(),
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       int32(delivery.Attempts),
+		LastError:      delivery.LastError,
+		ResponseStatus: delivery.ResponseStatus.Int32,
+		CreatedAt:      delivery.CreatedAt.Format(time.RFC3339),
+		Payload:        string(delivery.Payload),
+	}
+	if delivery.Status == models.WebhookDeliveryPending {
+		res.NextAttemptAt = delivery.NextAttemptAt.Format(time.RFC3339)
+	}
+	if delivery.LastAttemptAt.Valid {
+		res.LastAttemptAt = delivery.LastAttemptAt.Time.Format(time.RFC3339)
+	}
+	return res
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Check probes a single dependency and returns an error when it is unhealthy
+type Check struct {
+	// Name is exposed as its own health service so the dependency can be probed directly
+	Name string
+	// Critical checks drive the overall status; non-critical failures are only reported under Name
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+// Checker periodically runs dependency checks and publishes the results on a gRPC health server
+type Checker struct {
+	Server   *health.Server
+	services []string
+	checks   []Check
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	started  bool
+	stopping bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewChecker creates a checker whose overall result is published for the empty service name
+// and for each of the given gRPC services
+func NewChecker(interval time.Duration, services []string, checks ...Check) *Checker {
+	return &Checker{
+		Server:   health.NewServer(),
+		services: append([]string{""}, services...),
+		checks:   checks,
+		interval: interval,
+		timeout:  interval / 2,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the checks once synchronously, so the first probe sees a real status, then in the background
+func (c *Checker) Start() {
+	c.mu.Lock()
+	c.started = true
+	c.mu.Unlock()
+
+	c.runChecks()
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.runChecks()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the checks and reports NOT_SERVING for every service so load balancers drain traffic.
+// It does not wait for checks that were never started.
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	c.stopping = true
+	started := c.started
+	c.mu.Unlock()
+
+	close(c.stop)
+	if started {
+		<-c.done
+	}
+	c.Server.Shutdown()
+}
+
+func (c *Checker) runChecks() {
+	overall := healthpb.HealthCheckResponse_SERVING
+	results := make(map[string]healthpb.HealthCheckResponse_ServingStatus, len(c.checks))
+
+	for _, check := range c.checks {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err := check.Probe(ctx)
+		cancel()
+
+		results[check.Name] = healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			slog.Warn("health check failed", "check", check.Name, "error", err)
+			results[check.Name] = healthpb.HealthCheckResponse_NOT_SERVING
+			if check.Critical {
+				overall = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+		}
+	}
+
+	// Once shutdown has begun the server stays NOT_SERVING regardless of check results
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopping {
+		return
+	}
+	for name, status := range results {
+		c.Server.SetServingStatus(name, status)
+	}
+	for _, service := range c.services {
+		c.Server.SetServingStatus(service, overall)
+	}
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const namespace = "auth"
+
+// Result label values for counters that track success and failure
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var allCodes = []codes.Code{
+	codes.OK, codes.Canceled, codes.Unknown, codes.InvalidArgument, codes.DeadlineExceeded,
+	codes.NotFound, codes.AlreadyExists, codes.PermissionDenied, codes.ResourceExhausted,
+	codes.FailedPrecondition, codes.Aborted, codes.OutOfRange, codes.Unimplemented,
+	codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unauthenticated,
+}
+
+// gRPC server metrics
+var (
+	GRPCStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "Total number of RPCs started on the server.",
+	}, []string{"grpc_service", "grpc_method"})
+
+	GRPCHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+	}, []string{"grpc_service", "grpc_method", "grpc_code"})
+
+	GRPCHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Histogram of response latency of RPCs handled by the server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_service", "grpc_method"})
+)
+
+// Domain metrics
+var (
+	Signups = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signups_total",
+		Help:      "Total number of successful user signups.",
+	})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Total number of login attempts by result.",
+	}, []string{"result"})
+
+	TokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "Total number of access token refreshes by result.",
+	}, []string{"result"})
+
+	PasswordResetRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "password_reset_requests_total",
+		Help:      "Total number of password reset requests.",
+	})
+
+	MagicLinkRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "magic_link_requests_total",
+		Help:      "Total number of magic link sign-in requests.",
+	})
+
+	LoginCodeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_code_requests_total",
+		Help:      "Total number of requests for emailed one-time codes by purpose.",
+	}, []string{"purpose"})
+
+	EmailsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_sent_total",
+		Help:      "Total number of emails handed to the mail server by type and result.",
+	}, []string{"type", "result"})
+
+	PasswordHashDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Latency of bcrypt password hashing and comparison.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Total number of webhook delivery attempts by event type and result.",
+	}, []string{"event_type", "result"})
+)
+
+// RegisterDBStats exports connection pool statistics from sql.DB.Stats()
+func RegisterDBStats(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "auth"))
+}
+
+// InitializeGRPC pre-populates the gRPC metrics for every registered method so that
+// series exist with a zero value before the first call
+func InitializeGRPC(server *grpc.Server) {
+	for service, info := range server.GetServiceInfo() {
+		for _, method := range info.Methods {
+			GRPCStarted.WithLabelValues(service, method.Name)
+			GRPCHandlingSeconds.WithLabelValues(service, method.Name)
+			for _, code := range allCodes {
+				GRPCHandled.WithLabelValues(service, method.Name, code.String())
+			}
+		}
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
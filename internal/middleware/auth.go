@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/kraftzpepe/auth-service/types"
+	"google.golang.org/grpc"
+)
+
+// Permissions that grant access to admin RPCs without the admin token
+const (
+	PermissionManageClients       = "clients:manage"
+	PermissionManageRoles         = "roles:manage"
+	PermissionManageOrganizations = "orgs:manage"
+	PermissionManageAPIKeys       = "apikeys:manage"
+	PermissionReadUsers           = "users:read"
+	PermissionManageUsers         = "users:manage"
+	PermissionReadAudit           = "audit:read"
+	PermissionManageWebhooks      = "webhooks:manage"
+)
+
+// Permissions that members hold through their roles in an organization, checked against tokens scoped to it
+const (
+	PermissionReadMembers   = "members:read"
+	PermissionManageMembers = "members:manage"
+)
+
+// MethodPermissions maps full gRPC method names to the permission required to call them
+type MethodPermissions map[string]string
+
+// adminMethods lists the RPCs reserved for administrators and the permission that also unlocks them
+var adminMethods = MethodPermissions{
+	pb.AuthService_CreateOAuthClient_FullMethodName:         PermissionManageClients,
+	pb.AuthService_ListOAuthClients_FullMethodName:          PermissionManageClients,
+	pb.AuthService_UpdateOAuthClient_FullMethodName:         PermissionManageClients,
+	pb.AuthService_RotateOAuthClientSecret_FullMethodName:   PermissionManageClients,
+	pb.AuthService_DeleteOAuthClient_FullMethodName:         PermissionManageClients,
+	pb.AuthService_CreateRole_FullMethodName:                PermissionManageRoles,
+	pb.AuthService_ListRoles_FullMethodName:                 PermissionManageRoles,
+	pb.AuthService_UpdateRole_FullMethodName:                PermissionManageRoles,
+	pb.AuthService_DeleteRole_FullMethodName:                PermissionManageRoles,
+	pb.AuthService_AssignRole_FullMethodName:                PermissionManageRoles,
+	pb.AuthService_UnassignRole_FullMethodName:              PermissionManageRoles,
+	pb.AuthService_ListUserRoles_FullMethodName:             PermissionManageRoles,
+	pb.AuthService_CreateOrganization_FullMethodName:        PermissionManageOrganizations,
+	pb.AuthService_ListOrganizations_FullMethodName:         PermissionManageOrganizations,
+	pb.AuthService_ListUsers_FullMethodName:                 PermissionReadUsers,
+	pb.AuthService_SuspendUser_FullMethodName:               PermissionManageUsers,
+	pb.AuthService_ReactivateUser_FullMethodName:            PermissionManageUsers,
+	pb.AuthService_DeleteUser_FullMethodName:                PermissionManageUsers,
+	pb.AuthService_ForcePasswordReset_FullMethodName:        PermissionManageUsers,
+	pb.AuthService_RevokeUserSessions_FullMethodName:        PermissionManageUsers,
+	pb.AuthService_QueryAuditLog_FullMethodName:             PermissionReadAudit,
+	pb.AuthService_VerifyAuditLog_FullMethodName:            PermissionReadAudit,
+	pb.AuthService_CreateWebhookSubscription_FullMethodName: PermissionManageWebhooks,
+	pb.AuthService_ListWebhookSubscriptions_FullMethodName:  PermissionManageWebhooks,
+	pb.AuthService_UpdateWebhookSubscription_FullMethodName: PermissionManageWebhooks,
+	pb.AuthService_DeleteWebhookSubscription_FullMethodName: PermissionManageWebhooks,
+	pb.AuthService_ListWebhookDeliveries_FullMethodName:     PermissionManageWebhooks,
+	pb.AuthService_ReplayWebhookDeliveries_FullMethodName:   PermissionManageWebhooks,
+}
+
+type claimsKey struct{}
+
+type adminKey struct{}
+
+// APIKeyResolver resolves API keys into the claims of the user they belong to
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, key string) (*utils.Claims, error)
+}
+
+type apiKeysKey struct{}
+
+// AccountChecker checks that the user of an access token still has an active account, since the
+// token remains valid until it expires
+type AccountChecker interface {
+	CheckAccount(ctx context.Context, userID string) error
+}
+
+type accountsKey struct{}
+
+// UnaryAdminAuthInterceptor rejects calls to admin RPCs unless they carry the admin token, or a user
+// access token or API key holding the method's permission, as a bearer token. Tokens scoped to an
+// organization or issued to an OAuth client never unlock admin RPCs. When no admin token is configured only access tokens and API
+// keys are accepted. Calls to any RPC made with the admin token are marked for IsAdmin, and apiKeys
+// is made available so that handlers accept API keys wherever they accept access tokens. Access
+// tokens are accepted only while accounts finds their user active, so suspending or deleting a user
+// takes effect immediately.
+func UnaryAdminAuthInterceptor(adminToken string, apiKeys APIKeyResolver, accounts AccountChecker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = context.WithValue(ctx, apiKeysKey{}, apiKeys)
+		ctx = context.WithValue(ctx, accountsKey{}, accounts)
+
+		token := BearerToken(ctx)
+		if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+			return handler(context.WithValue(ctx, adminKey{}, true), req)
+		}
+
+		permission, ok := adminMethods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		claims, err := bearerClaims(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !isGlobal(claims) {
+			return nil, types.ErrPermissionDenied.WithMessage("admin RPCs need a user's own access token, not scoped to an organization or issued to an OAuth client")
+		}
+		ctx = context.WithValue(ctx, claimsKey{}, claims)
+		if err := RequirePermission(ctx, permission); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// IsAdmin reports whether the call was made with the admin token
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
+
+// UnaryPermissionInterceptor rejects calls to the listed methods unless the bearer access token carries
+// the required permission. The claims of accepted tokens are available to handlers through ClaimsFromContext.
+func UnaryPermissionInterceptor(permissions MethodPermissions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		permission, ok := permissions[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		claims, err := bearerClaims(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, claimsKey{}, claims)
+		if err := RequirePermission(ctx, permission); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ClaimsFromContext returns the access token claims stored by UnaryPermissionInterceptor
+func ClaimsFromContext(ctx context.Context) (*utils.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*utils.Claims)
+	return claims, ok
+}
+
+// AuthenticatedClaims returns the claims of the bearer access token, validating it unless an
+// interceptor already has
+func AuthenticatedClaims(ctx context.Context) (*utils.Claims, error) {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims, nil
+	}
+	return bearerClaims(ctx)
+}
+
+// RequireOrganizationPermission checks a permission for an organization inside a handler. It accepts
+// the admin token, a global token that holds orgs:manage, and a token scoped to orgID that holds
+// permission.
+func RequireOrganizationPermission(ctx context.Context, orgID, permission string) error {
+	if IsAdmin(ctx) {
+		return nil
+	}
+	claims, err := AuthenticatedClaims(ctx)
+	if err != nil {
+		return err
+	}
+	if isGlobal(claims) && models.HasPermission(claims.Permissions, PermissionManageOrganizations) {
+		return nil
+	}
+	if claims.OrgID == orgID && models.HasPermission(claims.Permissions, permission) {
+		return nil
+	}
+	return types.ErrPermissionDenied.WithMessage("missing permission " + permission + " in this organization")
+}
+
+// HasGlobalPermission reports whether the call was made with the admin token, or with a global access
+// token or API key that holds permission
+func HasGlobalPermission(ctx context.Context, permission string) bool {
+	if IsAdmin(ctx) {
+		return true
+	}
+	claims, err := AuthenticatedClaims(ctx)
+	return err == nil && isGlobal(claims) && models.HasPermission(claims.Permissions, permission)
+}
+
+// isGlobal reports whether claims may use their permissions across users and organizations: those
+// of a user's own access token or API key, neither scoped to an organization nor issued to an OAuth
+// client
+func isGlobal(claims *utils.Claims) bool {
+	return claims.OrgID == "" && claims.ClientID == ""
+}
+
+// TargetUser returns the user a self-service call acts on: the caller when userID is empty or their
+// own ID, and any other user for callers with HasGlobalPermission for permission
+func TargetUser(ctx context.Context, userID, permission string) (string, error) {
+	if userID != "" && IsAdmin(ctx) {
+		return userID, nil
+	}
+	claims, err := AuthenticatedClaims(ctx)
+	if err != nil {
+		return "", err
+	}
+	if userID == "" || userID == claims.UserID {
+		if claims.UserID == "" {
+			return "", types.ErrUnauthenticated.WithMessage("a user access token is required")
+		}
+		return claims.UserID, nil
+	}
+	if isGlobal(claims) && models.HasPermission(claims.Permissions, permission) {
+		return userID, nil
+	}
+	return "", types.ErrPermissionDenied.WithMessage("missing permission " + permission)
+}
+
+// RequirePermission checks a permission inside a handler, for checks that depend on the request
+func RequirePermission(ctx context.Context, permission string) error {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return types.ErrUnauthenticated
+	}
+	if !models.HasPermission(claims.Permissions, permission) {
+		return types.ErrPermissionDenied.WithMessage("missing permission " + permission)
+	}
+	return nil
+}
+
+// bearerClaims validates the bearer access token of a call, or resolves its API key when
+// UnaryAdminAuthInterceptor has provided a resolver. Access tokens of users that are no longer
+// active are rejected when it has provided an AccountChecker.
+func bearerClaims(ctx context.Context) (*utils.Claims, error) {
+	token := BearerToken(ctx)
+	if token == "" {
+		return nil, types.ErrUnauthenticated
+	}
+	if strings.HasPrefix(token, models.APIKeyPrefix) {
+		apiKeys, ok := ctx.Value(apiKeysKey{}).(APIKeyResolver)
+		if !ok || apiKeys == nil {
+			return nil, types.ErrUnauthenticated.WithMessage("API keys are not accepted here")
+		}
+		return apiKeys.ResolveAPIKey(ctx, token)
+	}
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		return nil, types.ErrUnauthenticated.WithMessage("invalid access token")
+	}
+	if accounts, ok := ctx.Value(accountsKey{}).(AccountChecker); ok && accounts != nil && claims.UserID != "" {
+		err := accounts.CheckAccount(ctx, claims.UserID)
+		if errors.Is(err, types.ErrUserNotFound) {
+			return nil, types.ErrUnauthenticated.WithMessage("the user of this access token no longer exists")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// BearerToken returns the token from an "authorization: Bearer <token>" metadata entry
+func BearerToken(ctx context.Context) string {
+	scheme, token, ok := strings.Cut(firstMetadata(ctx, "authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	pb "github.com/kraftzpepe/auth-service/proto/generated"
+	"github.com/kraftzpepe/auth-service/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func init() {
+	utils.SetJWTSecret([]byte("middleware-tests-secret-32-bytes"))
+}
+
+// withBearer returns a context carrying an access token for claims, as a gRPC call would
+func withBearer(t *testing.T, claims utils.Claims) context.Context {
+	t.Helper()
+	token, err := utils.GenerateJWTWithClaims(claims, utils.AccessTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// fakeAccounts reports the users in it as not active, with their error
+type fakeAccounts map[string]error
+
+func (f fakeAccounts) CheckAccount(_ context.Context, userID string) error {
+	return f[userID]
+}
+
+func TestAdminAuthInterceptor(t *testing.T) {
+	admin := utils.Claims{UserID: "7d5bf3a5-3f0e-4b9e-9a52-6f1d0c3b8e21", Roles: []string{"admin"}, Permissions: []string{"*"}}
+	withClient, withOrg := admin, admin
+	withClient.ClientID = "app"
+	withOrg.OrgID = "0a7a4b8e-2a4c-4b58-8f0e-1f6f0b0f4a10"
+	suspended, deleted := admin, admin
+	suspended.UserID = "5c1e8d2a-7b3f-4e6a-9d0c-2f8b1a4e7c63"
+	deleted.UserID = "e2b7c4a9-1d6f-4a83-b5e0-9c3d8f2a6b14"
+	accounts := fakeAccounts{suspended.UserID: types.ErrAccountSuspended, deleted.UserID: types.ErrUserNotFound}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{name: "user token", ctx: withBearer(t, admin)},
+		{name: "without the permission", ctx: withBearer(t, utils.Claims{UserID: admin.UserID}), want: types.ErrPermissionDenied},
+		{name: "issued to an OAuth client", ctx: withBearer(t, withClient), want: types.ErrPermissionDenied},
+		{name: "scoped to an organization", ctx: withBearer(t, withOrg), want: types.ErrPermissionDenied},
+		{name: "suspended admin", ctx: withBearer(t, suspended), want: types.ErrAccountSuspended},
+		{name: "deleted admin", ctx: withBearer(t, deleted), want: types.ErrUnauthenticated},
+		{name: "without a token", ctx: context.Background(), want: types.ErrUnauthenticated},
+		{name: "admin token", ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer admin-secret"))},
+	}
+	interceptor := UnaryAdminAuthInterceptor("admin-secret", nil, accounts)
+	info := &grpc.UnaryServerInfo{FullMethod: pb.AuthService_SuspendUser_FullMethodName}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			_, err := interceptor(tt.ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				return nil, nil
+			})
+			if !errors.Is(err, tt.want) || called != (tt.want == nil) {
+				t.Errorf("error = %v, handler called %v, want %v", err, called, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTokensHoldNoGlobalPermissions(t *testing.T) {
+	claims := utils.Claims{UserID: "7d5bf3a5-3f0e-4b9e-9a52-6f1d0c3b8e21", ClientID: "app", Permissions: []string{"*"}}
+	ctx := withBearer(t, claims)
+
+	if HasGlobalPermission(ctx, PermissionManageUsers) {
+		t.Error("client token holds a global permission")
+	}
+	if _, err := TargetUser(ctx, "a6b2f0c1-9d8e-4f7a-8b6c-5d4e3f2a1b0c", PermissionManageUsers); !errors.Is(err, types.ErrPermissionDenied) {
+		t.Errorf("client token acting on another user: error = %v, want %v", err, types.ErrPermissionDenied)
+	}
+	if userID, err := TargetUser(ctx, "", PermissionManageUsers); err != nil || userID != claims.UserID {
+		t.Errorf("client token acting on its user = %q, %v, want %q", userID, err, claims.UserID)
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// inProcessNetwork is the network of connections made by the in-process HTTP gateway
+const inProcessNetwork = "bufconn"
+
+// fromGateway reports whether the call arrived through the in-process HTTP gateway, whose
+// forwarded client headers can be trusted
+func fromGateway(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	return ok && p.Addr != nil && p.Addr.Network() == inProcessNetwork
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ClientIP returns the address of the caller, looking through the HTTP gateway
+func ClientIP(ctx context.Context) string {
+	if fromGateway(ctx) {
+		forwarded := firstMetadata(ctx, "x-forwarded-for")
+		if i := strings.LastIndex(forwarded, ","); i >= 0 {
+			forwarded = forwarded[i+1:]
+		}
+		return strings.TrimSpace(forwarded)
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// UserAgent returns the caller's user agent, looking through the HTTP gateway
+func UserAgent(ctx context.Context) string {
+	if fromGateway(ctx) {
+		return firstMetadata(ctx, "x-forwarded-user-agent")
+	}
+	return firstMetadata(ctx, "user-agent")
+}
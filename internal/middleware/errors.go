@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// kindCodes maps domain error kinds to gRPC status codes
+var kindCodes = map[types.Kind]codes.Code{
+	types.KindInternal:           codes.Internal,
+	types.KindInvalidArgument:    codes.InvalidArgument,
+	types.KindNotFound:           codes.NotFound,
+	types.KindAlreadyExists:      codes.AlreadyExists,
+	types.KindUnauthenticated:    codes.Unauthenticated,
+	types.KindPermissionDenied:   codes.PermissionDenied,
+	types.KindFailedPrecondition: codes.FailedPrecondition,
+	types.KindResourceExhausted:  codes.ResourceExhausted,
+	types.KindUnavailable:        codes.Unavailable,
+}
+
+// UnaryErrorInterceptor converts errors returned by handlers into gRPC statuses
+func UnaryErrorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, ToStatus(ctx, err).Err()
+		}
+		return resp, nil
+	}
+}
+
+// ToStatus maps an error to a gRPC status. Domain errors carry an ErrorInfo with their
+// stable reason code and, for invalid arguments, a BadRequest field violation.
+// Internal causes are logged and never sent to the client.
+func ToStatus(ctx context.Context, err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+
+	var domainErr *types.Error
+	if !errors.As(err, &domainErr) {
+		domainErr = types.ErrInternalError.Wrap(err)
+	}
+
+	code, ok := kindCodes[domainErr.Kind]
+	if !ok {
+		code = codes.Internal
+	}
+
+	message := domainErr.Message
+	if code == codes.Internal {
+		utils.LoggerFromContext(ctx).ErrorContext(ctx, "internal error", "error", err)
+		message = types.ErrInternalError.Message
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason: domainErr.Reason,
+		Domain: types.ErrorDomain,
+	}
+	if domainErr.Field != "" {
+		info.Metadata = map[string]string{"field": domainErr.Field}
+	}
+
+	st := status.New(code, message)
+	if code == codes.InvalidArgument && domainErr.Field != "" {
+		withDetails, detailErr := st.WithDetails(info, &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: domainErr.Field, Description: domainErr.Message},
+			},
+		})
+		if detailErr == nil {
+			return withDetails
+		}
+	} else if withDetails, detailErr := st.WithDetails(info); detailErr == nil {
+		return withDetails
+	}
+	return st
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/tlsconfig"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RequestIDHeader is the metadata key used to propagate request correlation IDs
+const RequestIDHeader = "x-request-id"
+
+// UnaryLoggingInterceptor assigns every call a request ID (reusing one sent by the client),
+// stores a request-scoped logger in the context and logs the outcome of the call.
+// When logPayloads is set, request messages are logged at debug level after redaction.
+func UnaryLoggingInterceptor(logger *slog.Logger, logPayloads bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+
+		requestID := incomingRequestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, requestID))
+
+		reqLogger := logger.With("request_id", requestID, "method", info.FullMethod)
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			reqLogger = reqLogger.With("trace_id", spanContext.TraceID().String())
+		}
+		if commonName, ok := tlsconfig.PeerCommonName(ctx); ok {
+			reqLogger = reqLogger.With("client_cn", commonName)
+		}
+		ctx = utils.ContextWithRequestID(ctx, requestID)
+		ctx = utils.ContextWithLogger(ctx, reqLogger)
+
+		if msg, ok := req.(proto.Message); ok && logPayloads {
+			reqLogger.DebugContext(ctx, "request received", slog.Group("request", messageAttrs(msg.ProtoReflect())...))
+		}
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		attrs := []any{
+			"peer", ClientIP(ctx),
+			"duration", time.Since(start),
+			"status", code.String(), // Not "code", which the default redaction rules hide
+		}
+		if err != nil {
+			attrs = append(attrs, "error", status.Convert(err).Message())
+		}
+		reqLogger.Log(ctx, levelForCode(code), "rpc completed", attrs...)
+
+		return resp, err
+	}
+}
+
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return uuid.NewString()
+}
+
+// levelForCode logs client mistakes as warnings and server faults as errors
+func levelForCode(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.Unauthenticated,
+		codes.PermissionDenied, codes.FailedPrecondition, codes.ResourceExhausted, codes.Canceled:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// messageAttrs flattens a protobuf message into log attributes keyed by field name,
+// so redaction rules match on the field names of the request
+func messageAttrs(m protoreflect.Message) []any {
+	var attrs []any
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := string(fd.Name())
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			attrs = append(attrs, slog.Group(name, messageAttrs(v.Message())...))
+		} else {
+			attrs = append(attrs, slog.String(name, v.String()))
+		}
+		return true
+	})
+	return attrs
+}
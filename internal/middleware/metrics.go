@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryMetricsInterceptor records per-method call counts, status codes and latency
+func UnaryMetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := splitMethodName(info.FullMethod)
+		metrics.GRPCStarted.WithLabelValues(service, method).Inc()
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		metrics.GRPCHandlingSeconds.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+		metrics.GRPCHandled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+		return resp, err
+	}
+}
+
+// splitMethodName splits "/package.Service/Method" into its service and method parts
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
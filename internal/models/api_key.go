@@ -0,0 +1,32 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix starts every API key, telling keys apart from JWT access tokens
+const APIKeyPrefix = "ak_"
+
+// APIKey is a long-lived credential a user creates to call the API as themselves. Only the hash
+// of the key is stored. Keys with scopes hold only the owner's permissions that the scopes
+// cover; keys without scopes hold all of them.
+type APIKey struct {
+	ID         uuid.UUID     `json:"id"`
+	UserID     uuid.UUID     `json:"user_id"`
+	OrgID      uuid.NullUUID `json:"org_id"` // Organization the key is scoped to
+	Name       string        `json:"name"`
+	Prefix     string        `json:"prefix"` // Leading characters of the key, to recognize it in listings
+	KeyHash    string        `json:"-"`
+	Scopes     []string      `json:"scopes"`
+	ExpiresAt  sql.NullTime  `json:"expires_at"`
+	LastUsedAt sql.NullTime  `json:"last_used_at"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// IsExpired reports whether the key has an expiry time that has passed
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt.Valid && !now.Before(k.ExpiresAt.Time)
+}
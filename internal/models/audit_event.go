@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Audit event types
+const (
+	AuditSignup                 = "signup"
+	AuditLoginSucceeded         = "login.succeeded"
+	AuditLoginFailed            = "login.failed"
+	AuditTokenRefreshed         = "token.refreshed"
+	AuditPasswordResetRequested = "password_reset.requested"
+	AuditPasswordResetCompleted = "password_reset.completed"
+	AuditMagicLinkRequested     = "magic_link.requested"
+	AuditLoginCodeSent          = "login_code.sent"
+	AuditReauthSucceeded        = "reauth.succeeded"
+	AuditReauthFailed           = "reauth.failed"
+	AuditRoleAssigned           = "role.assigned"
+	AuditRoleUnassigned         = "role.unassigned"
+	AuditMemberRolesUpdated     = "member_roles.updated"
+	AuditAdminAction            = "admin_action" // An admin RPC was called; Metadata["rpc"] names it
+)
+
+// AuditActorAdmin is the actor of calls made with the server's admin token
+const AuditActorAdmin = "admin"
+
+// AuditEvent is an entry of the append-only audit log. Every event stores the hash of the one
+// before it and a hash of its own content including that link, so changing, removing or
+// reordering events breaks the chain.
+type AuditEvent struct {
+	ID        int64             `json:"id"`         // Position in the log, starting at 1 without gaps
+	Type      string            `json:"type"`       // One of the Audit event types
+	ActorID   string            `json:"actor_id"`   // User or "client:<id>" that acted, AuditActorAdmin, or empty when anonymous
+	SubjectID string            `json:"subject_id"` // User the event is about, if any
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	RequestID string            `json:"request_id"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	PrevHash  string            `json:"prev_hash"` // Hash of the previous event; empty for the first
+	Hash      string            `json:"hash"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuthorizationCode struct {
+	CodeHash            string    `json:"-"`
+	ClientID            string    `json:"client_id"`
+	UserID              uuid.UUID `json:"user_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scope               string    `json:"scope"`
+	CodeChallenge       string    `json:"code_challenge"`
+	CodeChallengeMethod string    `json:"code_challenge_method"`
+	Nonce               string    `json:"nonce"`
+	AuthTime            time.Time `json:"auth_time"` // When the user authenticated
+	AMR                 []string  `json:"amr"`       // Authentication methods used, e.g. "pwd"
+	ExpiresAt           time.Time `json:"expires_at"`
+	CreatedAt           time.Time `json:"created_at"`
+}
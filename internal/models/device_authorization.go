@@ -0,0 +1,32 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of a device authorization
+const (
+	DeviceAuthorizationPending  = "pending"  // Waiting for the user to enter the user code
+	DeviceAuthorizationApproved = "approved" // The user signed in and allowed the device
+	DeviceAuthorizationDenied   = "denied"   // The user refused the device
+)
+
+// DeviceAuthorization is a pending OAuth device authorization grant (RFC 8628). The device polls
+// with the device code while the user approves it in a browser with the user code. Only hashes of
+// both codes are stored.
+type DeviceAuthorization struct {
+	DeviceCodeHash string        `json:"-"`
+	UserCodeHash   string        `json:"-"`
+	ClientID       string        `json:"client_id"`
+	Scope          string        `json:"scope"`
+	Status         string        `json:"status"`
+	UserID         uuid.NullUUID `json:"user_id"`   // User who approved or denied the device
+	AuthTime       sql.NullTime  `json:"auth_time"` // When that user signed in
+	Interval       int           `json:"interval"`  // Seconds the device must wait between polls
+	LastPolledAt   sql.NullTime  `json:"last_polled_at"`
+	ExpiresAt      time.Time     `json:"expires_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailChange is a request to change a user's email address. The address is swapped once the
+// user follows the confirmation link sent to NewEmail; until RevertExpiresAt the link sent to
+// OldEmail cancels the request or, once confirmed, restores the old address.
+type EmailChange struct {
+	ID               uuid.UUID    `json:"id"`
+	UserID           uuid.UUID    `json:"user_id"`
+	OldEmail         string       `json:"old_email"`
+	NewEmail         string       `json:"new_email"`
+	ConfirmTokenHash string       `json:"-"`
+	RevertTokenHash  string       `json:"-"`
+	ExpiresAt        time.Time    `json:"expires_at"` // Deadline for confirming the change
+	RevertExpiresAt  time.Time    `json:"revert_expires_at"`
+	ConfirmedAt      sql.NullTime `json:"confirmed_at"`
+	CreatedAt        time.Time    `json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExternalIdentity links an account at an upstream identity provider to a local user
+type ExternalIdentity struct {
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"` // The provider's stable user identifier (sub claim)
+	UserID      uuid.UUID `json:"user_id"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// FederatedLoginState tracks a login in progress at an upstream provider, together with
+// the authorization request of our own client that started it
+type FederatedLoginState struct {
+	StateHash           string    `json:"-"`
+	Provider            string    `json:"provider"`
+	UpstreamNonce       string    `json:"-"`
+	CodeVerifier        string    `json:"-"`
+	ClientID            string    `json:"client_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scope               string    `json:"scope"`
+	State               string    `json:"state"`
+	Nonce               string    `json:"nonce"`
+	CodeChallenge       string    `json:"code_challenge"`
+	CodeChallengeMethod string    `json:"code_challenge_method"`
+	ExpiresAt           time.Time `json:"expires_at"`
+	CreatedAt           time.Time `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Purposes of a login code. A user has at most one code per purpose at a time.
+const (
+	LoginCodePurposeLogin       = "login"        // Signs the user in
+	LoginCodePurposeChangeEmail = "change_email" // Lets a signed-in user change their email without their password
+)
+
+// LoginCode is a short numeric code emailed to a user. Only a bcrypt hash of the code is stored,
+// since six digits are too few to protect with a fast hash. The send count and window track how
+// many codes were sent recently, so sending can be throttled.
+type LoginCode struct {
+	UserID          uuid.UUID `json:"user_id"`
+	Purpose         string    `json:"purpose"`
+	CodeHash        string    `json:"-"`
+	Attempts        int       `json:"attempts"` // Verification attempts made with the current code
+	ExpiresAt       time.Time `json:"expires_at"`
+	SentAt          time.Time `json:"sent_at"`
+	SendCount       int       `json:"send_count"` // Codes sent since WindowStartedAt
+	WindowStartedAt time.Time `json:"window_started_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Grant types a client can be allowed to use
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// GrantTypes lists every supported grant type
+var GrantTypes = []string{GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials, GrantDeviceCode}
+
+type OAuthClient struct {
+	ID              string        `json:"client_id"`
+	Name            string        `json:"name"`
+	SecretHash      string        `json:"-"`
+	PublicKey       string        `json:"public_key_pem,omitempty"` // PEM key verifying private_key_jwt assertions
+	RedirectURIs    []string      `json:"redirect_uris"`
+	GrantTypes      []string      `json:"grant_types"`
+	Scopes          []string      `json:"scopes"`
+	AccessTokenTTL  time.Duration `json:"access_token_ttl"`  // Zero uses the server default
+	RefreshTokenTTL time.Duration `json:"refresh_token_ttl"` // Zero uses the server default
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// IsPublic reports whether the client has no credentials, such as a browser or mobile app
+func (c *OAuthClient) IsPublic() bool {
+	return c.SecretHash == "" && c.PublicKey == ""
+}
+
+// HasRedirectURI reports whether uri exactly matches one of the registered redirect URIs
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AllowsGrant reports whether the client may use the given grant type
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsScopes reports whether every requested scope has been granted to the client
+func (c *OAuthClient) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization groups users under a customer account. Members hold roles that apply only inside
+// the organization. With IsolatedAccounts the organization has its own namespace of usernames and
+// emails, and its members' accounts cannot be used outside it.
+type Organization struct {
+	ID               uuid.UUID `json:"id"`
+	Slug             string    `json:"slug"`
+	Name             string    `json:"name"`
+	IsolatedAccounts bool      `json:"isolated_accounts"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Membership is a user's membership of an organization, with the user and organization details
+// needed to list it from either side
+type Membership struct {
+	OrgID     uuid.UUID `json:"org_id"`
+	OrgSlug   string    `json:"org_slug"`
+	OrgName   string    `json:"org_name"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationInvitation is a pending invitation to join an organization, redeemed with the
+// token emailed to the invitee
+type OrganizationInvitation struct {
+	ID        uuid.UUID     `json:"id"`
+	OrgID     uuid.UUID     `json:"org_id"`
+	Email     string        `json:"email"`
+	Roles     []string      `json:"roles"`
+	TokenHash string        `json:"-"`
+	InvitedBy uuid.NullUUID `json:"invited_by"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	CreatedAt time.Time     `json:"created_at"`
+}
@@ -1,13 +1,22 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Purposes of the single-use tokens kept in password_reset_tokens
+const (
+	TokenPurposePasswordReset = "password_reset" // The token is sent as is and sets a new password
+	TokenPurposeMagicLink     = "magic_link"     // Only the hash of the token is stored; it signs the user in
+)
+
 type PasswordResetToken struct {
-	UserID    uuid.UUID `db:"user_id"`
-	Token     string    `db:"token"`
-	ExpiresAt time.Time `db:"expires_at"`
+	UserID          uuid.UUID      `db:"user_id"`
+	Token           string         `db:"token"`
+	ExpiresAt       time.Time      `db:"expires_at"`
+	Purpose         string         `db:"purpose"`
+	DeviceNonceHash sql.NullString `db:"device_nonce_hash"` // Set when a magic link is bound to the device that requested it
 }
@@ -1,15 +1,19 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type RefreshToken struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID      `json:"id"`
+	UserID    uuid.UUID      `json:"user_id"`
+	OrgID     uuid.NullUUID  `json:"org_id"`    // Organization the tokens issued from it are scoped to
+	ClientID  sql.NullString `json:"client_id"` // OAuth client it was issued to, the only one that may use it
+	Scope     string         `json:"scope"`     // Scope granted to the client, carried by the access tokens issued from it
+	Token     string         `json:"token"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	CreatedAt time.Time      `json:"created_at"`
 }
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// PermissionWildcard grants every permission; "prefix:*" grants every permission starting with "prefix:"
+const PermissionWildcard = "*"
+
+// Role is a named set of permissions that can be assigned to users
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// HasPermission reports whether the granted permissions include permission, directly or through a wildcard
+func HasPermission(granted []string, permission string) bool {
+	return slices.ContainsFunc(granted, func(g string) bool {
+		if g == permission || g == PermissionWildcard {
+			return true
+		}
+		prefix, ok := strings.CutSuffix(g, PermissionWildcard)
+		return ok && strings.HasSuffix(prefix, ":") && strings.HasPrefix(permission, prefix)
+	})
+}
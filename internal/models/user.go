@@ -6,11 +6,28 @@ import (
 	"github.com/google/uuid"
 )
 
+// Account statuses. Only active users can sign in or obtain tokens.
+const (
+	UserStatusActive    = "active"
+	UserStatusPending   = "pending"   // Created but not activated yet
+	UserStatusSuspended = "suspended" // Blocked by an administrator, with a reason
+	UserStatusDeleted   = "deleted"   // Removed by an administrator but kept for the record
+)
+
+// UserStatuses lists every account status
+var UserStatuses = []string{UserStatusActive, UserStatusPending, UserStatusSuspended, UserStatusDeleted}
+
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID     `json:"id"`
+	OrgID         uuid.NullUUID `json:"org_id"` // Set for accounts that exist only inside an organization with isolated accounts
+	Username      string        `json:"username"`
+	Email         string        `json:"email"`
+	EmailVerified bool          `json:"email_verified"`
+	Password      string        `json:"password"`
+	DisplayName   string        `json:"display_name"` // Name shown to other users, chosen by the user
+	AvatarURL     string        `json:"avatar_url"`   // HTTPS URL of the user's picture
+	Status        string        `json:"status"`
+	StatusReason  string        `json:"status_reason"` // Why an administrator suspended the account
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
 }
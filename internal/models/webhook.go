@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook event types
+const (
+	WebhookUserCreated       = "user.created"
+	WebhookUserEmailVerified = "user.email_verified"
+	WebhookUserEmailChanged  = "user.email_changed"
+	WebhookUserDeleted       = "user.deleted"
+)
+
+// WebhookEventTypes lists the event types subscriptions can select
+var WebhookEventTypes = []string{WebhookUserCreated, WebhookUserEmailVerified, WebhookUserEmailChanged, WebhookUserDeleted}
+
+// WebhookSecretPrefix starts every webhook signing secret
+const WebhookSecretPrefix = "whsec_"
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"   // Waiting for its next attempt
+	WebhookDeliverySucceeded = "succeeded" // The endpoint answered with a 2xx status
+	WebhookDeliveryFailed    = "failed"    // Every attempt failed; it is only retried when replayed
+)
+
+// WebhookDeliveryStatuses lists every delivery status
+var WebhookDeliveryStatuses = []string{WebhookDeliveryPending, WebhookDeliverySucceeded, WebhookDeliveryFailed}
+
+// WebhookSubscription sends the events of the selected types to an HTTPS endpoint. The secret is
+// stored as is, since signing payloads needs it.
+type WebhookSubscription struct {
+	ID          uuid.UUID `json:"id"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description"`
+	Secret      string    `json:"-"`
+	Active      bool      `json:"active"` // Inactive subscriptions receive no new events
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is an event queued for, or sent to, a subscription
+type WebhookDelivery struct {
+	ID             int64         `json:"id"`
+	SubscriptionID uuid.UUID     `json:"subscription_id"`
+	EventID        uuid.UUID     `json:"event_id"` // Shared by the deliveries of one event to different subscriptions
+	EventType      string        `json:"event_type"`
+	Payload        []byte        `json:"-"` // JSON body sent to the endpoint
+	Status         string        `json:"status"`
+	Attempts       int           `json:"attempts"`
+	NextAttemptAt  time.Time     `json:"next_attempt_at"`
+	LastAttemptAt  sql.NullTime  `json:"last_attempt_at"`
+	LastError      string        `json:"last_error"`
+	ResponseStatus sql.NullInt32 `json:"response_status"` // HTTP status of the last attempt, if the endpoint answered
+	CreatedAt      time.Time     `json:"created_at"`
+}
@@ -0,0 +1,191 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/service"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	// DeviceAuthorizationPath issues device and user codes to devices without a browser (RFC 8628)
+	DeviceAuthorizationPath = service.DeviceAuthorizationPath
+	// DevicePath serves the page where users enter the user code shown on their device
+	DevicePath = service.DevicePath
+
+	// User codes are short enough to guess, so each client IP may enter only so many unknown codes
+	// and wrong passwords on the device page per window
+	maxDeviceFailuresPerIP = 10
+	deviceFailureWindow    = 15 * time.Minute
+)
+
+// deviceAuthorizationResponse is the JSON body of a successful device authorization request
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// devicePageData is rendered by the device template
+type devicePageData struct {
+	Action     string
+	UserCode   string
+	ClientName string
+	Scopes     []string
+	CSRFToken  string
+	Email      string
+	LoginError string
+	Done       string // Set once the user has approved or denied the device
+}
+
+// deviceAuthorization starts a device authorization grant. Clients authenticate as at the token
+// endpoint, and errors are reported the same way.
+func (h *Handler) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, r, types.ErrInvalidRequest.WithMessage("malformed form"), false)
+		return
+	}
+
+	creds, basicAuth := clientCredentials(r)
+	client, err := h.OAuthService.AuthenticateClient(r.Context(), creds)
+	if err != nil {
+		writeTokenError(w, r, err, basicAuth)
+		return
+	}
+
+	resp, err := h.OAuthService.StartDeviceAuthorization(r.Context(), client, r.PostForm.Get("scope"))
+	if err != nil {
+		writeTokenError(w, r, err, basicAuth)
+		return
+	}
+	writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              resp.DeviceCode,
+		UserCode:                resp.UserCode,
+		VerificationURI:         resp.VerificationURI,
+		VerificationURIComplete: resp.VerificationURIComplete,
+		ExpiresIn:               resp.ExpiresIn,
+		Interval:                resp.Interval,
+	})
+}
+
+// devicePage shows the form where users enter a user code and sign in to approve the device. A
+// user code in the query, as in the complete verification URI, is filled in.
+func (h *Handler) devicePage(w http.ResponseWriter, r *http.Request) {
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		h.renderDeviceForm(w, r, http.StatusOK, devicePageData{})
+		return
+	}
+	data := devicePageData{UserCode: userCode}
+	status := http.StatusOK
+	if err := h.describeDevice(r, &data); err != nil {
+		data.LoginError = deviceErrorMessage(r, err)
+		status = deviceErrorStatus(err, status)
+	}
+	h.renderDeviceForm(w, r, status, data)
+}
+
+// deviceSubmit authenticates the user, then approves or denies the device
+func (h *Handler) deviceSubmit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, r, types.ErrInvalidRequest.WithMessage("malformed form"))
+		return
+	}
+	if !validCSRFToken(r) {
+		h.renderError(w, r, types.ErrInvalidRequest.WithMessage("the form has expired, please start again"))
+		return
+	}
+
+	data := devicePageData{UserCode: r.PostForm.Get("user_code"), Email: r.PostForm.Get("email")}
+	if err := h.describeDevice(r, &data); err != nil {
+		data.LoginError = deviceErrorMessage(r, err)
+		h.renderDeviceForm(w, r, deviceErrorStatus(err, http.StatusBadRequest), data)
+		return
+	}
+
+	decide, done := h.OAuthService.ApproveDevice, "The device is signed in. You can close this page and return to it."
+	if r.PostForm.Get("action") != "allow" {
+		decide, done = h.OAuthService.DenyDevice, "The device was denied access to your account."
+	}
+	err := decide(r.Context(), data.UserCode, data.Email, r.PostForm.Get("password"))
+	switch {
+	case errors.Is(err, types.ErrInvalidCredentials):
+		h.deviceFailures.Fail(utils.CallerFromContext(r.Context()).IP)
+		data.LoginError = types.ErrInvalidCredentials.Message
+		h.renderDeviceForm(w, r, http.StatusUnauthorized, data)
+		return
+	case errors.Is(err, types.ErrAccountSuspended), errors.Is(err, types.ErrAccountPending):
+		data.LoginError = deviceErrorMessage(r, err)
+		h.renderDeviceForm(w, r, http.StatusForbidden, data)
+		return
+	case err != nil:
+		data.LoginError = deviceErrorMessage(r, err)
+		h.renderDeviceForm(w, r, http.StatusBadRequest, data)
+		return
+	}
+	renderDevice(w, http.StatusOK, devicePageData{Done: done})
+}
+
+// describeDevice fills in the client and scopes of the device authorization of data.UserCode.
+// Unknown codes count against the client IP, which fails with types.ErrTooManyAttempts once it
+// has failed too often.
+func (h *Handler) describeDevice(r *http.Request, data *devicePageData) error {
+	ip := utils.CallerFromContext(r.Context()).IP
+	if !h.deviceFailures.Allow(ip) {
+		return types.ErrTooManyAttempts
+	}
+	auth, client, err := h.OAuthService.LookupDeviceAuthorization(r.Context(), data.UserCode)
+	if errors.Is(err, types.ErrInvalidUserCode) {
+		h.deviceFailures.Fail(ip)
+	}
+	if err != nil {
+		return err
+	}
+	data.ClientName = client.Name
+	if data.ClientName == "" {
+		data.ClientName = client.ID
+	}
+	data.Scopes = strings.Fields(auth.Scope)
+	return nil
+}
+
+func (h *Handler) renderDeviceForm(w http.ResponseWriter, r *http.Request, status int, data devicePageData) {
+	data.CSRFToken = utils.GenerateSecureToken(32)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    data.CSRFToken,
+		Path:     DevicePath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	data.Action = DevicePath
+	renderDevice(w, status, data)
+}
+
+// deviceErrorStatus returns the HTTP status of the device page failing to describe a device:
+// 429 for too many attempts, otherwise status
+func deviceErrorStatus(err error, status int) int {
+	if errors.Is(err, types.ErrTooManyAttempts) {
+		return http.StatusTooManyRequests
+	}
+	return status
+}
+
+// deviceErrorMessage returns the message of an error that can be shown on the device page
+func deviceErrorMessage(r *http.Request, err error) string {
+	_, description := toOAuthError(r, err)
+	if description == "" {
+		description = "The request could not be processed."
+	}
+	return description
+}
@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// errorCodes maps domain error reasons to the error codes of RFC 6749 section 5.2
+var errorCodes = map[string]string{
+	types.ReasonInvalidRequest:          "invalid_request",
+	types.ReasonInvalidClient:           "invalid_client",
+	types.ReasonInvalidRedirectURI:      "invalid_request",
+	types.ReasonInvalidGrant:            "invalid_grant",
+	types.ReasonInvalidRefreshToken:     "invalid_grant",
+	types.ReasonInvalidScope:            "invalid_scope",
+	types.ReasonUnauthorizedClient:      "unauthorized_client",
+	types.ReasonUnsupportedGrantType:    "unsupported_grant_type",
+	types.ReasonUnsupportedResponseType: "unsupported_response_type",
+	types.ReasonAccessDenied:            "access_denied",
+	types.ReasonFederatedLoginFailed:    "access_denied",
+	types.ReasonAccountSuspended:        "invalid_grant",
+	types.ReasonAccountPending:          "invalid_grant",
+	types.ReasonUserNotFound:            "invalid_grant",
+	types.ReasonAuthorizationPending:    "authorization_pending",
+	types.ReasonSlowDown:                "slow_down",
+	types.ReasonExpiredDeviceCode:       "expired_token",
+	types.ReasonInvalidUserCode:         "invalid_request",
+	types.ReasonTooManyAttempts:         "invalid_request",
+}
+
+// errorResponse is the JSON error body of the token endpoint
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// toOAuthError converts an error to an OAuth error code and description.
+// Internal errors are logged and reported as server_error without details.
+func toOAuthError(r *http.Request, err error) (string, string) {
+	var domainErr *types.Error
+	if errors.As(err, &domainErr) {
+		if code, ok := errorCodes[domainErr.Reason]; ok {
+			return code, domainErr.Message
+		}
+		if domainErr.Kind == types.KindInvalidArgument {
+			return "invalid_request", domainErr.Message
+		}
+	}
+	utils.LoggerFromContext(r.Context()).ErrorContext(r.Context(), "oauth request failed", "error", err)
+	return "server_error", ""
+}
+
+// writeTokenError renders an error from the token endpoint
+func writeTokenError(w http.ResponseWriter, r *http.Request, err error, basicAuth bool) {
+	code, description := toOAuthError(r, err)
+
+	status := http.StatusBadRequest
+	switch code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		if basicAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+
+	writeJSON(w, status, errorResponse{Error: code, ErrorDescription: description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeCacheableJSON renders public metadata that clients may cache
+func writeCacheableJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+
+	"github.com/kraftzpepe/auth-service/internal/service"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	// FederationCallbackPath receives users returning from an upstream identity provider
+	FederationCallbackPath = service.FederationCallbackPath
+
+	federationCookie = "oauth_federation"
+)
+
+// startFederatedLogin sends the user to an upstream identity provider. A cookie carrying the state
+// binds the callback to this browser, so a login started elsewhere cannot be completed here.
+func (h *Handler) startFederatedLogin(w http.ResponseWriter, r *http.Request, provider string, req *service.AuthorizationRequest) {
+	loginURL, state, err := h.FederationService.StartLogin(r.Context(), provider, req)
+	if err != nil {
+		redirectError(w, r, req, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationCookie,
+		Value:    state,
+		Path:     FederationCallbackPath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode, // Sent on the top-level redirect back from the provider
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// federationCallback completes a federated login and redirects back to the client with an authorization code
+func (h *Handler) federationCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	cookie, err := r.Cookie(federationCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		h.renderError(w, r, types.ErrInvalidRequest.WithMessage("the sign-in was started in another browser, please start again"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: federationCookie, Path: FederationCallbackPath, MaxAge: -1})
+
+	req, code, err := h.FederationService.CompleteLogin(r.Context(), state, query.Get("code"), query.Get("error"))
+	if err != nil {
+		if req == nil {
+			h.renderError(w, r, err)
+			return
+		}
+		redirectError(w, r, req, err)
+		return
+	}
+
+	redirect(w, r, req, url.Values{"code": {code}})
+}
@@ -0,0 +1,370 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	// AuthorizePath serves the login and consent page
+	AuthorizePath = service.AuthorizePath
+	// TokenPath issues tokens for the authorization_code, refresh_token, client_credentials and device_code grants
+	TokenPath = service.TokenPath
+
+	csrfCookie   = "oauth_csrf"
+	maxFormBytes = 1 << 16
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// Handler implements the browser-facing OAuth 2.0 endpoints on top of the OAuthService
+type Handler struct {
+	OAuthService      *service.OAuthService
+	FederationService *service.FederationService
+	APIKeyService     *service.APIKeyService
+
+	deviceFailures *failureLimiter // By client IP
+}
+
+// New builds the HTTP handler serving the OAuth endpoints
+func New(oauthService *service.OAuthService, federationService *service.FederationService, apiKeyService *service.APIKeyService) http.Handler {
+	h := &Handler{
+		OAuthService:      oauthService,
+		FederationService: federationService,
+		APIKeyService:     apiKeyService,
+		deviceFailures:    newFailureLimiter(maxDeviceFailuresPerIP, deviceFailureWindow),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+AuthorizePath, h.authorizePage)
+	mux.HandleFunc("POST "+AuthorizePath, h.authorizeSubmit)
+	mux.HandleFunc("POST "+TokenPath, h.token)
+	mux.HandleFunc("POST "+IntrospectionPath, h.introspect)
+	mux.HandleFunc("GET "+UserInfoPath, h.userInfo)
+	mux.HandleFunc("POST "+UserInfoPath, h.userInfo)
+	mux.HandleFunc("GET "+DiscoveryPath, h.discovery)
+	mux.HandleFunc("GET "+JWKSPath, h.jwks)
+	mux.HandleFunc("GET "+FederationCallbackPath, h.federationCallback)
+	mux.HandleFunc("POST "+DeviceAuthorizationPath, h.deviceAuthorization)
+	mux.HandleFunc("GET "+DevicePath, h.devicePage)
+	mux.HandleFunc("POST "+DevicePath, h.deviceSubmit)
+	return withCaller(mux)
+}
+
+// withCaller identifies the client of each request and gives the request a correlation ID, so the
+// audit log records where OAuth logins and token grants came from
+func withCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		requestID := r.Header.Get("X-Request-Id")
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set("X-Request-Id", requestID)
+
+		ctx := utils.ContextWithRequestID(r.Context(), requestID)
+		ctx = utils.ContextWithCaller(ctx, utils.Caller{IP: ip, UserAgent: r.UserAgent()})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// pageData is rendered by the authorize template
+type pageData struct {
+	Action     string
+	ClientName string
+	Scopes     []string
+	Request    *service.AuthorizationRequest
+	CSRFToken  string
+	Email      string
+	LoginError string
+	Error      string
+	Providers  []providerButton
+}
+
+// providerButton offers sign-in with an upstream identity provider on the authorize page
+type providerButton struct {
+	Name        string
+	DisplayName string
+}
+
+// authorizePage validates an authorization request and shows the login and consent form
+func (h *Handler) authorizePage(w http.ResponseWriter, r *http.Request) {
+	req := authorizationRequest(r.URL.Query())
+
+	client, err := h.OAuthService.ValidateClient(r.Context(), req)
+	if err != nil {
+		h.renderError(w, r, err)
+		return
+	}
+	if err := h.OAuthService.ValidateAuthorizationRequest(client, req); err != nil {
+		redirectError(w, r, req, err)
+		return
+	}
+
+	h.renderForm(w, r, http.StatusOK, client, req, "", "")
+}
+
+// authorizeSubmit authenticates the user and redirects back to the client with an authorization code
+func (h *Handler) authorizeSubmit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, r, types.ErrInvalidRequest.WithMessage("malformed form"))
+		return
+	}
+	req := authorizationRequest(r.PostForm)
+
+	client, err := h.OAuthService.ValidateClient(r.Context(), req)
+	if err != nil {
+		h.renderError(w, r, err)
+		return
+	}
+	if !validCSRFToken(r) {
+		h.renderError(w, r, types.ErrInvalidRequest.WithMessage("the form has expired, please start again"))
+		return
+	}
+	if err := h.OAuthService.ValidateAuthorizationRequest(client, req); err != nil {
+		redirectError(w, r, req, err)
+		return
+	}
+
+	if provider := r.PostForm.Get("provider"); provider != "" {
+		h.startFederatedLogin(w, r, provider, req)
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		redirectError(w, r, req, types.ErrAccessDenied)
+		return
+	}
+
+	email := r.PostForm.Get("email")
+	code, err := h.OAuthService.Authorize(r.Context(), req, email, r.PostForm.Get("password"))
+	if errors.Is(err, types.ErrInvalidCredentials) {
+		h.renderForm(w, r, http.StatusUnauthorized, client, req, email, types.ErrInvalidCredentials.Message)
+		return
+	}
+	if errors.Is(err, types.ErrAccountSuspended) {
+		h.renderForm(w, r, http.StatusForbidden, client, req, email, types.ErrAccountSuspended.Message)
+		return
+	}
+	if errors.Is(err, types.ErrAccountPending) {
+		h.renderForm(w, r, http.StatusForbidden, client, req, email, types.ErrAccountPending.Message)
+		return
+	}
+	if err != nil {
+		redirectError(w, r, req, err)
+		return
+	}
+
+	redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// token implements the token endpoint
+func (h *Handler) token(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, r, types.ErrInvalidRequest.WithMessage("malformed form"), false)
+		return
+	}
+	form := r.PostForm
+
+	creds, basicAuth := clientCredentials(r)
+	client, err := h.OAuthService.AuthenticateClient(r.Context(), creds)
+	if err != nil {
+		writeTokenError(w, r, err, basicAuth)
+		return
+	}
+
+	var resp *service.TokenResponse
+	switch form.Get("grant_type") {
+	case "authorization_code":
+		resp, err = h.OAuthService.ExchangeAuthorizationCode(r.Context(), client,
+			form.Get("code"), form.Get("redirect_uri"), form.Get("code_verifier"))
+	case "refresh_token":
+		resp, err = h.OAuthService.RefreshToken(r.Context(), client, form.Get("refresh_token"))
+	case "client_credentials":
+		resp, err = h.OAuthService.ClientCredentialsGrant(r.Context(), client, form.Get("scope"))
+	case models.GrantDeviceCode:
+		resp, err = h.OAuthService.DeviceCodeGrant(r.Context(), client, form.Get("device_code"))
+	case "":
+		err = types.ErrInvalidRequest.WithMessage("grant_type is required")
+	default:
+		err = types.ErrUnsupportedGrantType
+	}
+	if err != nil {
+		writeTokenError(w, r, err, basicAuth)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  resp.AccessToken,
+		TokenType:    resp.TokenType,
+		ExpiresIn:    resp.ExpiresIn,
+		RefreshToken: resp.RefreshToken,
+		Scope:        resp.Scope,
+		IDToken:      resp.IDToken,
+	})
+}
+
+// tokenResponse is the JSON body of a successful token request
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+func authorizationRequest(values url.Values) *service.AuthorizationRequest {
+	return &service.AuthorizationRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		ResponseType:        values.Get("response_type"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		Nonce:               values.Get("nonce"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// clientCredentials reads client credentials from HTTP Basic authentication or, failing that, the form.
+// It also reports whether Basic authentication was used.
+func clientCredentials(r *http.Request) (service.ClientCredentials, bool) {
+	creds := service.ClientCredentials{
+		ClientID:      r.PostForm.Get("client_id"),
+		ClientSecret:  r.PostForm.Get("client_secret"),
+		AssertionType: r.PostForm.Get("client_assertion_type"),
+		Assertion:     r.PostForm.Get("client_assertion"),
+	}
+	if id, secret, ok := r.BasicAuth(); ok {
+		// RFC 6749 section 2.3.1 form-encodes credentials before Basic encoding
+		if unescaped, err := url.QueryUnescape(id); err == nil {
+			id = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(secret); err == nil {
+			secret = unescaped
+		}
+		creds.ClientID, creds.ClientSecret = id, secret
+		return creds, true
+	}
+	return creds, false
+}
+
+func (h *Handler) renderForm(w http.ResponseWriter, r *http.Request, status int, client *models.OAuthClient, req *service.AuthorizationRequest, email, loginError string) {
+	csrfToken := utils.GenerateSecureToken(32)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     AuthorizePath,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	name := client.Name
+	if name == "" {
+		name = client.ID
+	}
+	var providers []providerButton
+	for _, provider := range h.FederationService.Providers {
+		providers = append(providers, providerButton{Name: provider.Name, DisplayName: provider.DisplayName})
+	}
+	render(w, status, pageData{
+		Action:     AuthorizePath,
+		ClientName: name,
+		Scopes:     strings.Fields(req.Scope),
+		Request:    req,
+		CSRFToken:  csrfToken,
+		Email:      email,
+		LoginError: loginError,
+		Providers:  providers,
+	})
+}
+
+// renderError shows an error to the user instead of redirecting, for requests whose redirect URI cannot be trusted
+func (h *Handler) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	_, description := toOAuthError(r, err)
+	if description == "" {
+		description = "The request could not be processed."
+	}
+	render(w, http.StatusBadRequest, pageData{Error: description})
+}
+
+func render(w http.ResponseWriter, status int, data pageData) {
+	renderTemplate(w, status, "authorize.html", data)
+}
+
+func renderDevice(w http.ResponseWriter, status int, data devicePageData) {
+	renderTemplate(w, status, "device.html", data)
+}
+
+func renderTemplate(w http.ResponseWriter, status int, name string, data any) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Frame-Options", "DENY")
+	// No form-action: browsers apply it to the redirects that follow a submitted form,
+	// which lead to the client or to an upstream identity provider
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	_ = templates.ExecuteTemplate(w, name, data)
+}
+
+// redirectError sends an OAuth error back to the client's validated redirect URI
+func redirectError(w http.ResponseWriter, r *http.Request, req *service.AuthorizationRequest, err error) {
+	code, description := toOAuthError(r, err)
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	redirect(w, r, req, params)
+}
+
+// redirect returns to the client's redirect URI with the given parameters and the request state
+func redirect(w http.ResponseWriter, r *http.Request, req *service.AuthorizationRequest, params url.Values) {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// validCSRFToken checks the form token against the cookie set when the form was rendered
+func validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostForm.Get("csrf_token"))) == 1
+}
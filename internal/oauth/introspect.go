@@ -0,0 +1,85 @@
+package oauth
+
+import (
+	"net/http"
+
+	"github.com/kraftzpepe/auth-service/internal/service"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// IntrospectionPath reports whether a token is active (RFC 7662)
+const IntrospectionPath = service.IntrospectionPath
+
+// introspectionResponse is the RFC 7662 introspection response, extended with the organization,
+// API key, roles and permissions of the token. Inactive tokens report only active.
+type introspectionResponse struct {
+	Active      bool     `json:"active"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	TokenType   string   `json:"token_type,omitempty"`
+	Exp         int64    `json:"exp,omitempty"`
+	Iat         int64    `json:"iat,omitempty"`
+	Sub         string   `json:"sub,omitempty"`
+	OrgID       string   `json:"org_id,omitempty"`
+	APIKeyID    string   `json:"api_key_id,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// introspect implements token introspection for resource servers. Callers authenticate as a
+// confidential client; both JWT access tokens and API keys can be introspected.
+func (h *Handler) introspect(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, r, types.ErrInvalidRequest.WithMessage("malformed form"), false)
+		return
+	}
+
+	creds, basicAuth := clientCredentials(r)
+	client, err := h.OAuthService.AuthenticateClient(r.Context(), creds)
+	if err == nil && client.IsPublic() {
+		err = types.ErrInvalidClient.WithMessage("public clients cannot introspect tokens")
+	}
+	if err != nil {
+		writeTokenError(w, r, err, basicAuth)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeTokenError(w, r, types.ErrInvalidRequest.WithMessage("token is required"), basicAuth)
+		return
+	}
+
+	claims, active, err := h.APIKeyService.IntrospectToken(r.Context(), token)
+	if err != nil {
+		writeTokenError(w, r, err, basicAuth)
+		return
+	}
+	if !active {
+		writeJSON(w, http.StatusOK, introspectionResponse{})
+		return
+	}
+
+	resp := introspectionResponse{
+		Active:      true,
+		Scope:       claims.Scope,
+		ClientID:    claims.ClientID,
+		TokenType:   "Bearer",
+		Sub:         claims.Subject,
+		OrgID:       claims.OrgID,
+		APIKeyID:    claims.APIKeyID,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+	}
+	if resp.Sub == "" {
+		resp.Sub = claims.UserID
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,64 @@
+package oauth
+
+import (
+	"sync"
+	"time"
+)
+
+// failureLimiter counts failures by key, such as a client IP, over a fixed window and reports when
+// a key has failed too often. Counts are kept in memory, so each instance of the server limits
+// on its own.
+type failureLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*failureWindow
+	pruned   time.Time
+}
+
+type failureWindow struct {
+	start time.Time
+	count int
+}
+
+func newFailureLimiter(limit int, window time.Duration) *failureLimiter {
+	return &failureLimiter{limit: limit, window: window, now: time.Now, failures: map[string]*failureWindow{}}
+}
+
+// Allow reports whether key has failed fewer than limit times in its current window
+func (l *failureLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failures, ok := l.failures[key]
+	return !ok || l.now().Sub(failures.start) >= l.window || failures.count < l.limit
+}
+
+// Fail counts a failure of key, starting a new window if its last one is over
+func (l *failureLimiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	failures, ok := l.failures[key]
+	if !ok || now.Sub(failures.start) >= l.window {
+		l.prune(now)
+		failures = &failureWindow{start: now}
+		l.failures[key] = failures
+	}
+	failures.count++
+}
+
+// prune forgets the keys whose window is over, at most once a window, so the map does not grow
+// with every key ever seen
+func (l *failureLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.window {
+		return
+	}
+	l.pruned = now
+	for key, failures := range l.failures {
+		if now.Sub(failures.start) >= l.window {
+			delete(l.failures, key)
+		}
+	}
+}
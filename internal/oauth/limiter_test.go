@@ -0,0 +1,33 @@
+package oauth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newFailureLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Fail("198.51.100.1")
+	if !limiter.Allow("198.51.100.1") {
+		t.Error("refused after one failure")
+	}
+	limiter.Fail("198.51.100.1")
+	if limiter.Allow("198.51.100.1") {
+		t.Error("allowed after reaching the limit")
+	}
+	if !limiter.Allow("198.51.100.2") {
+		t.Error("another key refused")
+	}
+
+	now = now.Add(time.Minute)
+	if !limiter.Allow("198.51.100.1") {
+		t.Error("refused after the window")
+	}
+	limiter.Fail("198.51.100.2")
+	if _, ok := limiter.failures["198.51.100.1"]; ok {
+		t.Error("key of a window that is over kept")
+	}
+}
@@ -0,0 +1,104 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/service"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	// UserInfoPath returns claims about the user an access token belongs to
+	UserInfoPath = service.UserInfoPath
+	// JWKSPath publishes the keys that verify ID tokens
+	JWKSPath = service.JWKSPath
+	// DiscoveryPath serves the OpenID Provider metadata
+	DiscoveryPath = service.DiscoveryPath
+)
+
+// discoveryDocument is the OpenID Connect Discovery 1.0 provider metadata
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgs      []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// discovery serves the provider metadata that OpenID Connect client libraries configure themselves from
+func (h *Handler) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := h.OAuthService.Issuer
+	writeCacheableJSON(w, discoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + AuthorizePath,
+		TokenEndpoint:                     issuer + TokenPath,
+		DeviceAuthorizationEndpoint:       issuer + DeviceAuthorizationPath,
+		UserInfoEndpoint:                  issuer + UserInfoPath,
+		IntrospectionEndpoint:             issuer + IntrospectionPath,
+		JWKSURI:                           issuer + JWKSPath,
+		ScopesSupported:                   []string{service.ScopeOpenID, service.ScopeEmail, service.ScopeProfile},
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               models.GrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		TokenEndpointAuthSigningAlgs:      []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"},
+		CodeChallengeMethodsSupported:     []string{service.PKCEMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr",
+			"email", "email_verified", "preferred_username", "name", "picture",
+		},
+	})
+}
+
+// jwks publishes the public signing key as a JSON Web Key Set
+func (h *Handler) jwks(w http.ResponseWriter, r *http.Request) {
+	writeCacheableJSON(w, map[string]any{
+		"keys": []map[string]string{h.OAuthService.SigningKey.JWK()},
+	})
+}
+
+// userInfo implements the UserInfo endpoint. The access token is accepted as a bearer token
+// in the Authorization header or, for POST requests, as the access_token form parameter.
+func (h *Handler) userInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+		token = r.PostFormValue("access_token")
+	}
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid_request", ErrorDescription: "an access token is required"})
+		return
+	}
+
+	info, err := h.OAuthService.UserInfo(r.Context(), token)
+	if errors.Is(err, types.ErrUnauthenticated) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oauth", error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid_token", ErrorDescription: "the access token is invalid or expired"})
+		return
+	}
+	if err != nil {
+		code, description := toOAuthError(r, err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: code, ErrorDescription: description})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/types"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `id, user_id, org_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at`
+
+type APIKeyRepository struct {
+	DB *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{DB: db}
+}
+
+// CreateAPIKey inserts a new API key
+func (repo *APIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (` + apiKeyColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := execContext(ctx, repo.DB, "APIKeyRepository.CreateAPIKey", query,
+		key.ID, key.UserID, key.OrgID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes),
+		key.ExpiresAt, key.LastUsedAt, key.CreatedAt)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		switch pqErr.Constraint {
+		case "api_keys_user_id_fkey":
+			return types.ErrUserNotFound
+		case "api_keys_org_id_fkey":
+			return types.ErrOrganizationNotFound
+		}
+	}
+	return err
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (repo *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	row := queryRowContext(ctx, repo.DB, "APIKeyRepository.GetAPIKeyByHash", query, keyHash)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // No key found
+	}
+	return key, err
+}
+
+// ListAPIKeys retrieves the API keys of a user, newest first
+func (repo *APIKeyRepository) ListAPIKeys(ctx context.Context, userID string) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC, id`
+	rows, err := queryContext(ctx, repo.DB, "APIKeyRepository.ListAPIKeys", query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey removes an API key, limited to the keys of userID unless it is empty.
+// It reports false if no such key exists.
+func (repo *APIKeyRepository) DeleteAPIKey(ctx context.Context, id, userID string) (bool, error) {
+	query := `DELETE FROM api_keys WHERE id = $1 AND ($2 = '' OR user_id::text = $2)`
+	result, err := execContext(ctx, repo.DB, "APIKeyRepository.DeleteAPIKey", query, id, userID)
+	return affectedRow(result, err)
+}
+
+// TouchAPIKey records that a key was used at the given time
+func (repo *APIKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`
+	_, err := execContext(ctx, repo.DB, "APIKeyRepository.TouchAPIKey", query, id, usedAt)
+	return err
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := row.Scan(&key.ID, &key.UserID, &key.OrgID, &key.Name, &key.Prefix, &key.KeyHash,
+		pq.Array(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/lib/pq"
+)
+
+const auditEventColumns = `id, type, actor_id, subject_id, ip, user_agent, request_id, metadata, created_at, prev_hash, hash`
+
+type AuditRepository struct {
+	DB *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{DB: db}
+}
+
+// LastEvent retrieves the newest event, or nil when the log is empty
+func (repo *AuditRepository) LastEvent(ctx context.Context) (*models.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events ORDER BY id DESC LIMIT 1`
+	row := queryRowContext(ctx, repo.DB, "AuditRepository.LastEvent", query)
+
+	event, err := scanAuditEvent(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return event, err
+}
+
+// AppendEvent inserts an event at the position given by its ID. It reports false, without an error,
+// if another event was appended at that position first.
+func (repo *AuditRepository) AppendEvent(ctx context.Context, event *models.AuditEvent) (bool, error) {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return false, err
+	}
+	query := `
+		INSERT INTO audit_events (` + auditEventColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err = execContext(ctx, repo.DB, "AuditRepository.AppendEvent", query,
+		event.ID, event.Type, event.ActorID, event.SubjectID, event.IP, event.UserAgent, event.RequestID,
+		metadata, event.CreatedAt, event.PrevHash, event.Hash)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// AuditListOptions filters and positions a ListEvents query. Zero values do not filter.
+type AuditListOptions struct {
+	Type          string
+	ActorID       string
+	SubjectID     string
+	CreatedAfter  time.Time // Inclusive
+	CreatedBefore time.Time // Exclusive
+	Ascending     bool      // Oldest first; newest first by default
+	AfterID       int64     // Continue after this event in the chosen order
+	Limit         int
+}
+
+// ListEvents retrieves a page of events ordered by ID
+func (repo *AuditRepository) ListEvents(ctx context.Context, opts AuditListOptions) ([]*models.AuditEvent, error) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if opts.Type != "" {
+		conditions = append(conditions, "type = "+arg(opts.Type))
+	}
+	if opts.ActorID != "" {
+		conditions = append(conditions, "actor_id = "+arg(opts.ActorID))
+	}
+	if opts.SubjectID != "" {
+		conditions = append(conditions, "subject_id = "+arg(opts.SubjectID))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(opts.CreatedAfter))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(opts.CreatedBefore))
+	}
+	comparison, direction := "<", "DESC"
+	if opts.Ascending {
+		comparison, direction = ">", "ASC"
+	}
+	if opts.AfterID > 0 {
+		conditions = append(conditions, "id "+comparison+" "+arg(opts.AfterID))
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id %s LIMIT %s", direction, arg(opts.Limit))
+
+	rows, err := queryContext(ctx, repo.DB, "AuditRepository.ListEvents", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func scanAuditEvent(row rowScanner) (*models.AuditEvent, error) {
+	var event models.AuditEvent
+	var metadata []byte
+	if err := row.Scan(&event.ID, &event.Type, &event.ActorID, &event.SubjectID, &event.IP, &event.UserAgent,
+		&event.RequestID, &metadata, &event.CreatedAt, &event.PrevHash, &event.Hash); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata of audit event %d: %w", event.ID, err)
+	}
+	event.CreatedAt = event.CreatedAt.UTC()
+	return &event, nil
+}
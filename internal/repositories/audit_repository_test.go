@@ -0,0 +1,107 @@
+//go:build integration
+
+package repositories
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+func auditEvent(id int64, eventType string, at time.Time) *models.AuditEvent {
+	return &models.AuditEvent{
+		ID:        id,
+		Type:      eventType,
+		ActorID:   "user-1",
+		SubjectID: "user-2",
+		IP:        "192.0.2.1",
+		Metadata:  map[string]string{"attempt": strconv.FormatInt(id, 10)},
+		CreatedAt: at,
+		PrevHash:  "hash-" + strconv.FormatInt(id-1, 10),
+		Hash:      "hash-" + strconv.FormatInt(id, 10),
+	}
+}
+
+func TestAppendEvent(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAuditRepository(db)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	if last, err := repo.LastEvent(ctx); err != nil || last != nil {
+		t.Fatalf("LastEvent of an empty log = %+v, %v", last, err)
+	}
+	first := auditEvent(1, models.AuditLoginSucceeded, now)
+	if appended, err := repo.AppendEvent(ctx, first); err != nil || !appended {
+		t.Fatalf("AppendEvent = %v, %v", appended, err)
+	}
+	if appended, err := repo.AppendEvent(ctx, auditEvent(1, models.AuditSignup, now)); err != nil || appended {
+		t.Errorf("append at a taken position = %v, %v, want false", appended, err)
+	}
+
+	last, err := repo.LastEvent(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(last, first) {
+		t.Errorf("LastEvent = %+v, want %+v", last, first)
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAuditRepository(db)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for id, eventType := range []string{models.AuditSignup, models.AuditLoginSucceeded, models.AuditLoginFailed, models.AuditLoginSucceeded} {
+		if _, err := repo.AppendEvent(ctx, auditEvent(int64(id+1), eventType, now.Add(time.Duration(id)*time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts AuditListOptions
+		want []int64
+	}{
+		{name: "newest first", opts: AuditListOptions{Limit: 10}, want: []int64{4, 3, 2, 1}},
+		{name: "oldest first after an event", opts: AuditListOptions{Ascending: true, AfterID: 1, Limit: 2}, want: []int64{2, 3}},
+		{name: "newest first after an event", opts: AuditListOptions{AfterID: 3, Limit: 10}, want: []int64{2, 1}},
+		{name: "by type", opts: AuditListOptions{Type: models.AuditLoginSucceeded, Limit: 10}, want: []int64{4, 2}},
+		{name: "by time", opts: AuditListOptions{CreatedAfter: now.Add(time.Minute), CreatedBefore: now.Add(3 * time.Minute), Limit: 10}, want: []int64{3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := repo.ListEvents(ctx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("events = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAuditRepository(db)
+	if _, err := repo.AppendEvent(ctx, auditEvent(1, models.AuditSignup, time.Now().UTC())); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range []string{
+		`UPDATE audit_events SET actor_id = 'someone-else'`,
+		`DELETE FROM audit_events`,
+		`TRUNCATE audit_events`,
+	} {
+		if _, err := db.Exec(statement); err == nil {
+			t.Errorf("%s succeeded", statement)
+		}
+	}
+}
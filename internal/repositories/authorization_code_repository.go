@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/lib/pq"
+)
+
+type AuthorizationCodeRepository struct {
+	DB *sql.DB
+}
+
+func NewAuthorizationCodeRepository(db *sql.DB) *AuthorizationCodeRepository {
+	return &AuthorizationCodeRepository{DB: db}
+}
+
+// SaveCode stores a newly issued authorization code
+func (repo *AuthorizationCodeRepository) SaveCode(ctx context.Context, code *models.AuthorizationCode) error {
+	query := `
+		INSERT INTO oauth_authorization_codes
+			(code_hash, client_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := execContext(ctx, repo.DB, "AuthorizationCodeRepository.SaveCode", query,
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope,
+		code.CodeChallenge, code.CodeChallengeMethod, code.Nonce, code.AuthTime, pq.Array(code.AMR), code.ExpiresAt, code.CreatedAt)
+	return err
+}
+
+// ConsumeCode deletes and returns an authorization code, so each code can be redeemed only once
+func (repo *AuthorizationCodeRepository) ConsumeCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	query := `
+		DELETE FROM oauth_authorization_codes
+		WHERE code_hash = $1
+		RETURNING code_hash, client_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at, created_at
+	`
+	row := queryRowContext(ctx, repo.DB, "AuthorizationCodeRepository.ConsumeCode", query, codeHash)
+
+	var code models.AuthorizationCode
+	if err := row.Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope,
+		&code.CodeChallenge, &code.CodeChallengeMethod, &code.Nonce, &code.AuthTime, pq.Array(&code.AMR), &code.ExpiresAt, &code.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No code found
+		}
+		return nil, err
+	}
+
+	return &code, nil
+}
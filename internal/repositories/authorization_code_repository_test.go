@@ -0,0 +1,88 @@
+//go:build integration
+
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+func TestConsumeAuthorizationCode(t *testing.T) {
+	db := openTestDB(t)
+	insertClient(t, db, "app")
+	repo := NewAuthorizationCodeRepository(db)
+	now := testNow()
+	code := &models.AuthorizationCode{
+		CodeHash:            "code-1",
+		ClientID:            "app",
+		UserID:              insertUser(t, db),
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "openid email",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: "S256",
+		Nonce:               "nonce",
+		AuthTime:            now,
+		AMR:                 []string{"pwd", "otp"},
+		ExpiresAt:           now.Add(5 * time.Minute),
+		CreatedAt:           now,
+	}
+	if err := repo.SaveCode(ctx, code); err != nil {
+		t.Fatal(err)
+	}
+
+	consumed, err := repo.ConsumeCode(ctx, "code-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed == nil || consumed.UserID != code.UserID || consumed.Scope != code.Scope || consumed.Nonce != code.Nonce ||
+		!slices.Equal(consumed.AMR, code.AMR) || !consumed.AuthTime.Equal(now) || !consumed.ExpiresAt.Equal(code.ExpiresAt) {
+		t.Errorf("consumed code = %+v, want %+v", consumed, code)
+	}
+	if again, err := repo.ConsumeCode(ctx, "code-1"); err != nil || again != nil {
+		t.Errorf("second consumption = %+v, %v, want none", again, err)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db := openTestDB(t)
+	insertClient(t, db, "app")
+	repo := NewRefreshTokenRepository(db)
+	userID := insertUser(t, db)
+	now := testNow()
+
+	clientID := sql.NullString{String: "app", Valid: true}
+	if err := repo.SaveRefreshToken(ctx, userID, uuid.NullUUID{}, clientID, "email", "token-1", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveRefreshToken(ctx, userID, uuid.NullUUID{}, sql.NullString{}, "", "session", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := repo.FindRefreshToken(ctx, "token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.UserID != userID || token.ClientID != clientID || token.Scope != "email" || token.OrgID.Valid {
+		t.Errorf("refresh token = %+v", *token)
+	}
+
+	if err := repo.UpdateRefreshToken(ctx, token.ID, "token-2", now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FindRefreshToken(ctx, "token-1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("rotated token found: error = %v, want %v", err, sql.ErrNoRows)
+	}
+	rotated, err := repo.FindRefreshToken(ctx, "token-2")
+	if err != nil || rotated.ID != token.ID || rotated.ClientID != clientID || !rotated.ExpiresAt.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("rotated token = %+v, %v, want the same grant with a new expiry", rotated, err)
+	}
+	if session, err := repo.FindRefreshToken(ctx, "session"); err != nil || session.ClientID.Valid {
+		t.Errorf("session token = %+v, %v, want it untouched and without a client", session, err)
+	}
+}
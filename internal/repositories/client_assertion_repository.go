@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type ClientAssertionRepository struct {
+	DB *sql.DB
+}
+
+func NewClientAssertionRepository(db *sql.DB) *ClientAssertionRepository {
+	return &ClientAssertionRepository{DB: db}
+}
+
+// SaveAssertionID records the jti of a client assertion until it expires. It reports false when the
+// same client already used the jti in an assertion that has not expired yet, i.e. on a replay.
+// Expired entries are pruned as a side effect.
+func (repo *ClientAssertionRepository) SaveAssertionID(ctx context.Context, clientID, jti string, expiresAt time.Time) (bool, error) {
+	query := `
+		WITH pruned AS (
+			DELETE FROM oauth_client_assertions WHERE expires_at < NOW()
+		)
+		INSERT INTO oauth_client_assertions (client_id, jti, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (client_id, jti) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE oauth_client_assertions.expires_at < NOW()
+	`
+	result, err := execContext(ctx, repo.DB, "ClientAssertionRepository.SaveAssertionID", query, clientID, jti, expiresAt)
+	return affectedRow(result, err)
+}
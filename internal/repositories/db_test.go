@@ -0,0 +1,112 @@
+//go:build integration
+
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// The integration tests run the repositories' SQL against a real Postgres server:
+//
+//	TEST_DATABASE_URL=postgres://localhost/auth_test?sslmode=disable go test -tags integration ./internal/repositories/
+//
+// Each test gets empty tables in a schema of its own, created from the schema in README.md and
+// dropped when the test ends, so tests can share a server and also check that the documented
+// schema matches the queries.
+
+var ctx = context.Background()
+
+// openTestDB returns a database whose tables are those of README.md, empty
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := server.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := server.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+		server.Close()
+	})
+
+	db, err := sql.Open("postgres", dsn+" search_path="+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(readSchema(t)); err != nil {
+		t.Fatalf("create the schema of README.md: %v", err)
+	}
+	return db
+}
+
+// readSchema returns the SQL of the schema section at the top of README.md, whose headings are
+// the only lines that are not SQL
+func readSchema(t *testing.T) string {
+	t.Helper()
+	readme, err := os.ReadFile("../../README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, _, ok := strings.Cut(string(readme), "#### Run server")
+	if !ok {
+		t.Fatal("README.md has no schema section")
+	}
+	var lines []string
+	for _, line := range strings.Split(schema, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// testNow returns the current time as Postgres stores it in TIMESTAMP columns, so values read back compare equal
+func testNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// insertUser creates an active user and returns its ID
+func insertUser(t *testing.T, db *sql.DB) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	_, err := db.Exec(`INSERT INTO users (id, username, email, password) VALUES ($1, $2, $3, 'hash')`,
+		id, "user-"+id.String(), id.String()+"@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// insertClient registers an OAuth client with the given ID
+func insertClient(t *testing.T, db *sql.DB, clientID string) {
+	t.Helper()
+	if _, err := db.Exec(`INSERT INTO oauth_clients (client_id, name) VALUES ($1, $1)`, clientID); err != nil {
+		t.Fatal(err)
+	}
+}
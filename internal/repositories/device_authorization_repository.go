@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+const deviceAuthorizationColumns = `device_code_hash, user_code_hash, client_id, scope, status, user_id, auth_time,
+	interval_seconds, last_polled_at, expires_at, created_at`
+
+type DeviceAuthorizationRepository struct {
+	DB *sql.DB
+}
+
+func NewDeviceAuthorizationRepository(db *sql.DB) *DeviceAuthorizationRepository {
+	return &DeviceAuthorizationRepository{DB: db}
+}
+
+// CreateDeviceAuthorization stores a new device authorization and prunes expired ones. It reports
+// false, storing nothing, if its user code is already in use.
+func (repo *DeviceAuthorizationRepository) CreateDeviceAuthorization(ctx context.Context, auth *models.DeviceAuthorization) (bool, error) {
+	query := `
+		WITH pruned AS (
+			DELETE FROM device_authorizations WHERE expires_at < $11
+		)
+		INSERT INTO device_authorizations (` + deviceAuthorizationColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (user_code_hash) DO NOTHING
+	`
+	result, err := execContext(ctx, repo.DB, "DeviceAuthorizationRepository.CreateDeviceAuthorization", query,
+		auth.DeviceCodeHash, auth.UserCodeHash, auth.ClientID, auth.Scope, auth.Status, auth.UserID, auth.AuthTime,
+		auth.Interval, auth.LastPolledAt, auth.ExpiresAt, auth.CreatedAt)
+	return affectedRow(result, err)
+}
+
+// GetByUserCode retrieves a device authorization by the hash of its user code, or nil if there is none
+func (repo *DeviceAuthorizationRepository) GetByUserCode(ctx context.Context, userCodeHash string) (*models.DeviceAuthorization, error) {
+	query := `SELECT ` + deviceAuthorizationColumns + ` FROM device_authorizations WHERE user_code_hash = $1`
+	row := queryRowContext(ctx, repo.DB, "DeviceAuthorizationRepository.GetByUserCode", query, userCodeHash)
+
+	auth, err := scanDeviceAuthorization(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return auth, err
+}
+
+// Decide records the approval or denial of a pending device authorization that has not expired by
+// now, along with the user who signed in to decide and when, if anyone did. It reports false if
+// the authorization was decided already or has expired.
+func (repo *DeviceAuthorizationRepository) Decide(ctx context.Context, userCodeHash, status string, userID uuid.NullUUID, authTime sql.NullTime, now time.Time) (bool, error) {
+	query := `
+		UPDATE device_authorizations
+		SET status = $2, user_id = $3, auth_time = $4
+		WHERE user_code_hash = $1 AND status = $5 AND expires_at > $6
+	`
+	result, err := execContext(ctx, repo.DB, "DeviceAuthorizationRepository.Decide", query,
+		userCodeHash, status, userID, authTime, models.DeviceAuthorizationPending, now)
+	return affectedRow(result, err)
+}
+
+// RecordFailedSignIn counts a failed sign-in on the verification page against the pending device
+// authorization with the user code hash, and denies it once maxAttempts sign-ins have failed
+func (repo *DeviceAuthorizationRepository) RecordFailedSignIn(ctx context.Context, userCodeHash string, maxAttempts int) error {
+	query := `
+		UPDATE device_authorizations
+		SET failed_attempts = failed_attempts + 1,
+			status = CASE WHEN failed_attempts + 1 >= $3 THEN $4 ELSE status END
+		WHERE user_code_hash = $1 AND status = $2
+	`
+	_, err := execContext(ctx, repo.DB, "DeviceAuthorizationRepository.RecordFailedSignIn", query,
+		userCodeHash, models.DeviceAuthorizationPending, maxAttempts, models.DeviceAuthorizationDenied)
+	return err
+}
+
+// Poll records a poll of the device authorization with the given device code hash and returns it,
+// or nil if there is none. It also reports whether the device polled sooner than its interval
+// allows, in which case the interval grows by five seconds as RFC 8628 section 3.5 requires.
+func (repo *DeviceAuthorizationRepository) Poll(ctx context.Context, deviceCodeHash string, now time.Time) (*models.DeviceAuthorization, bool, error) {
+	query := `
+		WITH polled AS (
+			SELECT device_code_hash,
+				COALESCE(last_polled_at > $2::timestamp - interval_seconds * INTERVAL '1 second', FALSE) AS too_fast
+			FROM device_authorizations
+			WHERE device_code_hash = $1
+			FOR UPDATE
+		)
+		UPDATE device_authorizations d
+		SET last_polled_at = $2,
+			interval_seconds = CASE WHEN p.too_fast THEN d.interval_seconds + 5 ELSE d.interval_seconds END
+		FROM polled p
+		WHERE d.device_code_hash = p.device_code_hash
+		RETURNING d.device_code_hash, d.user_code_hash, d.client_id, d.scope, d.status, d.user_id, d.auth_time,
+			d.interval_seconds, d.last_polled_at, d.expires_at, d.created_at, p.too_fast
+	`
+	row := queryRowContext(ctx, repo.DB, "DeviceAuthorizationRepository.Poll", query, deviceCodeHash, now)
+
+	var tooFast bool
+	auth, err := scanDeviceAuthorization(row, &tooFast)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	return auth, tooFast, err
+}
+
+// ConsumeApproved deletes an approved device authorization, so its device code is exchanged for
+// tokens only once. It reports false if the authorization is not approved or was consumed already.
+func (repo *DeviceAuthorizationRepository) ConsumeApproved(ctx context.Context, deviceCodeHash string) (bool, error) {
+	query := `DELETE FROM device_authorizations WHERE device_code_hash = $1 AND status = $2`
+	result, err := execContext(ctx, repo.DB, "DeviceAuthorizationRepository.ConsumeApproved", query,
+		deviceCodeHash, models.DeviceAuthorizationApproved)
+	return affectedRow(result, err)
+}
+
+// scanDeviceAuthorization scans the device authorization columns followed by any extra columns of the row
+func scanDeviceAuthorization(row rowScanner, extra ...any) (*models.DeviceAuthorization, error) {
+	var auth models.DeviceAuthorization
+	dest := append([]any{&auth.DeviceCodeHash, &auth.UserCodeHash, &auth.ClientID, &auth.Scope, &auth.Status, &auth.UserID,
+		&auth.AuthTime, &auth.Interval, &auth.LastPolledAt, &auth.ExpiresAt, &auth.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
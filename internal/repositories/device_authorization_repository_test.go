@@ -0,0 +1,176 @@
+//go:build integration
+
+package repositories
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+// createDeviceAuthorization stores a pending authorization of the client "cli" created at now
+func createDeviceAuthorization(t *testing.T, repo *DeviceAuthorizationRepository, deviceCodeHash, userCodeHash string, now time.Time) bool {
+	t.Helper()
+	created, err := repo.CreateDeviceAuthorization(ctx, &models.DeviceAuthorization{
+		DeviceCodeHash: deviceCodeHash,
+		UserCodeHash:   userCodeHash,
+		ClientID:       "cli",
+		Scope:          "email",
+		Status:         models.DeviceAuthorizationPending,
+		Interval:       5,
+		ExpiresAt:      now.Add(10 * time.Minute),
+		CreatedAt:      now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func TestCreateDeviceAuthorization(t *testing.T) {
+	db := openTestDB(t)
+	insertClient(t, db, "cli")
+	repo := NewDeviceAuthorizationRepository(db)
+	now := testNow()
+
+	if !createDeviceAuthorization(t, repo, "device-1", "user-1", now) {
+		t.Fatal("authorization not created")
+	}
+	if createDeviceAuthorization(t, repo, "device-2", "user-1", now) {
+		t.Error("authorization created with a user code in use")
+	}
+
+	// Creating an authorization prunes those that have expired
+	if !createDeviceAuthorization(t, repo, "device-3", "user-3", now.Add(11*time.Minute)) {
+		t.Fatal("authorization not created")
+	}
+	if auth, err := repo.GetByUserCode(ctx, "user-1"); err != nil || auth != nil {
+		t.Errorf("expired authorization = %+v, %v, want it pruned", auth, err)
+	}
+	if !createDeviceAuthorization(t, repo, "device-4", "user-4", now.Add(12*time.Minute)) {
+		t.Fatal("authorization not created")
+	}
+	if auth, err := repo.GetByUserCode(ctx, "user-3"); err != nil || auth == nil {
+		t.Errorf("pending authorization = %+v, %v, want it kept", auth, err)
+	}
+}
+
+func TestDecideDeviceAuthorization(t *testing.T) {
+	db := openTestDB(t)
+	insertClient(t, db, "cli")
+	userID := insertUser(t, db)
+	repo := NewDeviceAuthorizationRepository(db)
+	now := testNow()
+	createDeviceAuthorization(t, repo, "device-1", "user-1", now)
+	createDeviceAuthorization(t, repo, "device-2", "user-2", now)
+
+	approver := uuid.NullUUID{UUID: userID, Valid: true}
+	authTime := sql.NullTime{Time: now, Valid: true}
+	if decided, err := repo.Decide(ctx, "user-1", models.DeviceAuthorizationApproved, approver, authTime, now); err != nil || !decided {
+		t.Fatalf("Decide = %v, %v", decided, err)
+	}
+	auth, err := repo.GetByUserCode(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Status != models.DeviceAuthorizationApproved || auth.UserID != approver || !auth.AuthTime.Time.Equal(now) {
+		t.Errorf("approved authorization = %+v", *auth)
+	}
+	if decided, err := repo.Decide(ctx, "user-1", models.DeviceAuthorizationDenied, uuid.NullUUID{}, sql.NullTime{}, now); err != nil || decided {
+		t.Errorf("second decision = %v, %v, want false", decided, err)
+	}
+
+	if decided, err := repo.Decide(ctx, "user-2", models.DeviceAuthorizationApproved, approver, authTime, now.Add(10*time.Minute)); err != nil || decided {
+		t.Errorf("decision on an expired authorization = %v, %v, want false", decided, err)
+	}
+	if decided, err := repo.Decide(ctx, "unknown", models.DeviceAuthorizationApproved, approver, authTime, now); err != nil || decided {
+		t.Errorf("decision on an unknown user code = %v, %v, want false", decided, err)
+	}
+}
+
+func TestPollDeviceAuthorization(t *testing.T) {
+	db := openTestDB(t)
+	insertClient(t, db, "cli")
+	repo := NewDeviceAuthorizationRepository(db)
+	now := testNow()
+	createDeviceAuthorization(t, repo, "device-1", "user-1", now)
+
+	polls := []struct {
+		after        time.Duration
+		tooFast      bool
+		wantInterval int
+	}{
+		{0, false, 5},
+		{time.Second, true, 10},
+		{5 * time.Second, true, 15}, // Waiting the old interval is no longer enough
+		{21 * time.Second, false, 15},
+	}
+	for _, poll := range polls {
+		auth, tooFast, err := repo.Poll(ctx, "device-1", now.Add(poll.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth == nil || tooFast != poll.tooFast || auth.Interval != poll.wantInterval || !auth.LastPolledAt.Time.Equal(now.Add(poll.after)) {
+			t.Errorf("poll %v after the start = %+v, too fast %v, want too fast %v and an interval of %d",
+				poll.after, auth, tooFast, poll.tooFast, poll.wantInterval)
+		}
+	}
+
+	if auth, tooFast, err := repo.Poll(ctx, "unknown", now); err != nil || auth != nil || tooFast {
+		t.Errorf("poll of an unknown device code = %+v, %v, %v, want none", auth, tooFast, err)
+	}
+}
+
+func TestConsumeApprovedDeviceAuthorization(t *testing.T) {
+	db := openTestDB(t)
+	insertClient(t, db, "cli")
+	userID := insertUser(t, db)
+	repo := NewDeviceAuthorizationRepository(db)
+	now := testNow()
+	createDeviceAuthorization(t, repo, "device-1", "user-1", now)
+
+	if consumed, err := repo.ConsumeApproved(ctx, "device-1"); err != nil || consumed {
+		t.Errorf("consumption of a pending authorization = %v, %v, want false", consumed, err)
+	}
+	if _, err := repo.Decide(ctx, "user-1", models.DeviceAuthorizationApproved, uuid.NullUUID{UUID: userID, Valid: true},
+		sql.NullTime{Time: now, Valid: true}, now); err != nil {
+		t.Fatal(err)
+	}
+	if consumed, err := repo.ConsumeApproved(ctx, "device-1"); err != nil || !consumed {
+		t.Fatalf("ConsumeApproved = %v, %v", consumed, err)
+	}
+	if consumed, err := repo.ConsumeApproved(ctx, "device-1"); err != nil || consumed {
+		t.Errorf("second consumption = %v, %v, want false", consumed, err)
+	}
+}
+
+func TestRecordFailedSignIn(t *testing.T) {
+	db := openTestDB(t)
+	insertClient(t, db, "cli")
+	repo := NewDeviceAuthorizationRepository(db)
+	now := testNow()
+	createDeviceAuthorization(t, repo, "device-1", "user-1", now)
+
+	for i := 1; i <= 3; i++ {
+		if err := repo.RecordFailedSignIn(ctx, "user-1", 3); err != nil {
+			t.Fatal(err)
+		}
+		auth, err := repo.GetByUserCode(ctx, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := models.DeviceAuthorizationPending
+		if i == 3 {
+			want = models.DeviceAuthorizationDenied
+		}
+		if auth.Status != want {
+			t.Errorf("status after %d failed sign-ins = %q, want %q", i, auth.Status, want)
+		}
+	}
+	if err := repo.RecordFailedSignIn(ctx, "unknown", 3); err != nil {
+		t.Errorf("failed sign-in on an unknown user code: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+const emailChangeColumns = `id, user_id, old_email, new_email, confirm_token_hash, revert_token_hash, expires_at,
+	revert_expires_at, confirmed_at, created_at`
+
+type EmailChangeRepository struct {
+	DB *sql.DB
+}
+
+func NewEmailChangeRepository(db *sql.DB) *EmailChangeRepository {
+	return &EmailChangeRepository{DB: db}
+}
+
+// CreateEmailChange stores an email change, replacing the user's unconfirmed ones and pruning
+// those that can no longer be reverted
+func (repo *EmailChangeRepository) CreateEmailChange(ctx context.Context, change *models.EmailChange) error {
+	query := `
+		WITH pruned AS (
+			DELETE FROM email_changes
+			WHERE revert_expires_at < NOW() OR (user_id = $2 AND confirmed_at IS NULL)
+		)
+		INSERT INTO email_changes (` + emailChangeColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := execContext(ctx, repo.DB, "EmailChangeRepository.CreateEmailChange", query,
+		change.ID, change.UserID, change.OldEmail, change.NewEmail, change.ConfirmTokenHash, change.RevertTokenHash,
+		change.ExpiresAt, change.RevertExpiresAt, change.ConfirmedAt, change.CreatedAt)
+	return err
+}
+
+// GetByConfirmToken retrieves an email change by the hash of its confirmation token
+func (repo *EmailChangeRepository) GetByConfirmToken(ctx context.Context, tokenHash string) (*models.EmailChange, error) {
+	query := `SELECT ` + emailChangeColumns + ` FROM email_changes WHERE confirm_token_hash = $1`
+	row := queryRowContext(ctx, repo.DB, "EmailChangeRepository.GetByConfirmToken", query, tokenHash)
+	return scanEmailChange(row)
+}
+
+// GetByRevertToken retrieves an email change by the hash of its revert token
+func (repo *EmailChangeRepository) GetByRevertToken(ctx context.Context, tokenHash string) (*models.EmailChange, error) {
+	query := `SELECT ` + emailChangeColumns + ` FROM email_changes WHERE revert_token_hash = $1`
+	row := queryRowContext(ctx, repo.DB, "EmailChangeRepository.GetByRevertToken", query, tokenHash)
+	return scanEmailChange(row)
+}
+
+// ConfirmEmailChange swaps the user's email for the new address, marking it verified, and records the
+// confirmation. The swap only happens while the change is unconfirmed and the user still has the old
+// address; it reports false otherwise. It fails with types.ErrEmailTaken if the address was registered
+// in the meantime.
+func (repo *EmailChangeRepository) ConfirmEmailChange(ctx context.Context, change *models.EmailChange) (bool, error) {
+	query := `
+		WITH confirmed AS (
+			UPDATE email_changes
+			SET confirmed_at = NOW()
+			WHERE id = $1 AND confirmed_at IS NULL
+			RETURNING user_id, old_email, new_email
+		)
+		UPDATE users u
+		SET email = c.new_email, email_verified = TRUE, updated_at = NOW()
+		FROM confirmed c
+		WHERE u.id = c.user_id AND u.email = c.old_email
+	`
+	result, err := execContext(ctx, repo.DB, "EmailChangeRepository.ConfirmEmailChange", query, change.ID)
+	return affectedRow(result, translateUserConstraint(err))
+}
+
+// RevertEmailChange deletes an email change. If it was confirmed and the user still has the new
+// address, the old address is restored and the user's refresh tokens are deleted, ending every
+// session. It reports whether the address was restored.
+func (repo *EmailChangeRepository) RevertEmailChange(ctx context.Context, change *models.EmailChange) (bool, error) {
+	query := `
+		WITH reverted AS (
+			DELETE FROM email_changes
+			WHERE id = $1
+			RETURNING user_id, old_email, new_email, confirmed_at
+		), restored AS (
+			UPDATE users u
+			SET email = r.old_email, email_verified = TRUE, updated_at = NOW()
+			FROM reverted r
+			WHERE u.id = r.user_id AND r.confirmed_at IS NOT NULL AND u.email = r.new_email
+			RETURNING u.id
+		), revoked AS (
+			DELETE FROM refresh_tokens WHERE user_id IN (SELECT id FROM restored)
+		)
+		SELECT count(*) FROM restored
+	`
+	var count int
+	err := queryRowContext(ctx, repo.DB, "EmailChangeRepository.RevertEmailChange", query, change.ID).Scan(&count)
+	return count > 0, translateUserConstraint(err)
+}
+
+func scanEmailChange(row rowScanner) (*models.EmailChange, error) {
+	var change models.EmailChange
+	err := row.Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail, &change.ConfirmTokenHash,
+		&change.RevertTokenHash, &change.ExpiresAt, &change.RevertExpiresAt, &change.ConfirmedAt, &change.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // No email change found
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
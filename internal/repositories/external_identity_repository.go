@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+type ExternalIdentityRepository struct {
+	DB *sql.DB
+}
+
+func NewExternalIdentityRepository(db *sql.DB) *ExternalIdentityRepository {
+	return &ExternalIdentityRepository{DB: db}
+}
+
+// GetIdentity retrieves the identity a provider knows by the given subject
+func (repo *ExternalIdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	query := `
+		SELECT provider, subject, user_id, email, created_at, last_login_at
+		FROM external_identities
+		WHERE provider = $1 AND subject = $2
+	`
+	row := queryRowContext(ctx, repo.DB, "ExternalIdentityRepository.GetIdentity", query, provider, subject)
+
+	var identity models.ExternalIdentity
+	if err := row.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email,
+		&identity.CreatedAt, &identity.LastLoginAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No identity found
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity links an external identity to an existing user
+func (repo *ExternalIdentityRepository) CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	query := `
+		INSERT INTO external_identities (provider, subject, user_id, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := execContext(ctx, repo.DB, "ExternalIdentityRepository.CreateIdentity", query,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt, identity.LastLoginAt)
+	return err
+}
+
+// CreateUserWithIdentity inserts a new user and its external identity in a single statement,
+// so a user is never provisioned without the identity that owns it
+func (repo *ExternalIdentityRepository) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.ExternalIdentity) error {
+	query := `
+		WITH new_user AS (
+			INSERT INTO users (id, username, email, email_verified, password, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $10, $6, $7)
+			RETURNING id
+		)
+		INSERT INTO external_identities (provider, subject, user_id, email, created_at, last_login_at)
+		SELECT $8, $9, id, $3, $6, $6 FROM new_user
+	`
+	_, err := execContext(ctx, repo.DB, "ExternalIdentityRepository.CreateUserWithIdentity", query,
+		user.ID, user.Username, user.Email, user.EmailVerified, user.Password, user.CreatedAt, user.UpdatedAt,
+		identity.Provider, identity.Subject, user.Status)
+	return translateUserConstraint(err)
+}
+
+// RecordLogin updates the last login time and the email last reported by the provider
+func (repo *ExternalIdentityRepository) RecordLogin(ctx context.Context, provider, subject, email string) error {
+	query := `
+		UPDATE external_identities
+		SET email = $3, last_login_at = $4
+		WHERE provider = $1 AND subject = $2
+	`
+	_, err := execContext(ctx, repo.DB, "ExternalIdentityRepository.RecordLogin", query, provider, subject, email, time.Now())
+	return err
+}
@@ -0,0 +1,117 @@
+//go:build integration
+
+package repositories
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+func federatedUser(username string, now time.Time) *models.User {
+	return &models.User{
+		ID:            uuid.New(),
+		Username:      username,
+		Email:         username + "@example.com",
+		EmailVerified: true,
+		Password:      "hash",
+		Status:        models.UserStatusActive,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+func TestCreateUserWithIdentity(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewExternalIdentityRepository(db)
+	users := NewUserRepository(db)
+	now := testNow()
+
+	user := federatedUser("alice", now)
+	if err := repo.CreateUserWithIdentity(ctx, user, &models.ExternalIdentity{Provider: "google", Subject: "sub-1"}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := users.GetUserByUUID(ctx, user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Email != user.Email || !stored.EmailVerified || stored.Status != models.UserStatusActive {
+		t.Errorf("user = %+v", *stored)
+	}
+	identity, err := repo.GetIdentity(ctx, "google", "sub-1")
+	if err != nil || identity == nil || identity.UserID != user.ID || identity.Email != user.Email {
+		t.Errorf("identity = %+v, %v, want one of %s", identity, err, user.ID)
+	}
+
+	// Neither the user nor the identity is created when the username is taken
+	err = repo.CreateUserWithIdentity(ctx, federatedUser("alice", now), &models.ExternalIdentity{Provider: "google", Subject: "sub-2"})
+	if !errors.Is(err, types.ErrUsernameTaken) {
+		t.Errorf("error = %v, want %v", err, types.ErrUsernameTaken)
+	}
+	if identity, err := repo.GetIdentity(ctx, "google", "sub-2"); err != nil || identity != nil {
+		t.Errorf("identity of the failed signup = %+v, %v, want none", identity, err)
+	}
+}
+
+func TestRecordLogin(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewExternalIdentityRepository(db)
+	start := testNow().Add(-time.Hour)
+	userID := insertUser(t, db)
+	for _, subject := range []string{"sub-1", "sub-2"} {
+		if err := repo.CreateIdentity(ctx, &models.ExternalIdentity{
+			Provider: "google", Subject: subject, UserID: userID, Email: "old@example.com", CreatedAt: start, LastLoginAt: start,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.RecordLogin(ctx, "google", "sub-1", "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	identity, err := repo.GetIdentity(ctx, "google", "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Email != "new@example.com" || !identity.LastLoginAt.After(start) || !identity.CreatedAt.Equal(start) {
+		t.Errorf("identity = %+v, want the new email and login time", *identity)
+	}
+	if other, err := repo.GetIdentity(ctx, "google", "sub-2"); err != nil || other.Email != "old@example.com" || !other.LastLoginAt.Equal(start) {
+		t.Errorf("other identity = %+v, %v, want it untouched", other, err)
+	}
+}
+
+func TestConsumeFederatedLoginState(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewFederatedLoginStateRepository(db)
+	now := time.Now()
+	state := func(hash string, expiresAt time.Time) *models.FederatedLoginState {
+		return &models.FederatedLoginState{
+			StateHash: hash, Provider: "google", UpstreamNonce: "nonce", CodeVerifier: "verifier",
+			ClientID: "app", RedirectURI: "https://app.example.com/callback", Scope: "openid", State: "state",
+			CodeChallenge: "challenge", CodeChallengeMethod: "S256", ExpiresAt: expiresAt, CreatedAt: now,
+		}
+	}
+	if err := repo.SaveState(ctx, state("abandoned", now.Add(-time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveState(ctx, state("pending", now.Add(10*time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+
+	consumed, err := repo.ConsumeState(ctx, "pending")
+	if err != nil || consumed == nil || consumed.ClientID != "app" || consumed.CodeVerifier != "verifier" {
+		t.Fatalf("ConsumeState = %+v, %v", consumed, err)
+	}
+	if again, err := repo.ConsumeState(ctx, "pending"); err != nil || again != nil {
+		t.Errorf("second ConsumeState = %+v, %v, want none", again, err)
+	}
+	// Saving the pending login pruned the abandoned one
+	if abandoned, err := repo.ConsumeState(ctx, "abandoned"); err != nil || abandoned != nil {
+		t.Errorf("abandoned login = %+v, %v, want it pruned", abandoned, err)
+	}
+}
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+const federatedLoginStateColumns = `state_hash, provider, upstream_nonce, code_verifier, client_id, redirect_uri, scope,
+	state, nonce, code_challenge, code_challenge_method, expires_at, created_at`
+
+type FederatedLoginStateRepository struct {
+	DB *sql.DB
+}
+
+func NewFederatedLoginStateRepository(db *sql.DB) *FederatedLoginStateRepository {
+	return &FederatedLoginStateRepository{DB: db}
+}
+
+// SaveState stores a login started at an upstream provider, pruning abandoned logins
+func (repo *FederatedLoginStateRepository) SaveState(ctx context.Context, state *models.FederatedLoginState) error {
+	query := `
+		WITH pruned AS (
+			DELETE FROM federated_login_states WHERE expires_at < NOW()
+		)
+		INSERT INTO federated_login_states (` + federatedLoginStateColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	_, err := execContext(ctx, repo.DB, "FederatedLoginStateRepository.SaveState", query,
+		state.StateHash, state.Provider, state.UpstreamNonce, state.CodeVerifier,
+		state.ClientID, state.RedirectURI, state.Scope, state.State, state.Nonce,
+		state.CodeChallenge, state.CodeChallengeMethod, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+// ConsumeState deletes and returns a pending login, so each callback can be processed only once
+func (repo *FederatedLoginStateRepository) ConsumeState(ctx context.Context, stateHash string) (*models.FederatedLoginState, error) {
+	query := `DELETE FROM federated_login_states WHERE state_hash = $1 RETURNING ` + federatedLoginStateColumns
+	row := queryRowContext(ctx, repo.DB, "FederatedLoginStateRepository.ConsumeState", query, stateHash)
+
+	var state models.FederatedLoginState
+	if err := row.Scan(&state.StateHash, &state.Provider, &state.UpstreamNonce, &state.CodeVerifier,
+		&state.ClientID, &state.RedirectURI, &state.Scope, &state.State, &state.Nonce,
+		&state.CodeChallenge, &state.CodeChallengeMethod, &state.ExpiresAt, &state.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No pending login found
+		}
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+const loginCodeColumns = `user_id, purpose, code_hash, attempts, expires_at, sent_at, send_count, window_started_at`
+
+type LoginCodeRepository struct {
+	DB *sql.DB
+}
+
+func NewLoginCodeRepository(db *sql.DB) *LoginCodeRepository {
+	return &LoginCodeRepository{DB: db}
+}
+
+// LoginCodeThrottle limits how often codes are sent to a user for one purpose
+type LoginCodeThrottle struct {
+	LastSentBefore      time.Time // A new code is only sent if the previous one was sent before this
+	WindowStartedBefore time.Time // Send windows that started before this are over, and the count restarts
+	MaxSends            int       // Codes that can be sent within one window
+}
+
+// SaveCode stores a new code for the user and purpose of code, replacing the previous one and
+// resetting its attempts, unless the throttle forbids sending another code yet. It reports false
+// when the code was not stored because of the throttle.
+func (repo *LoginCodeRepository) SaveCode(ctx context.Context, code *models.LoginCode, throttle LoginCodeThrottle) (bool, error) {
+	query := `
+		INSERT INTO login_codes (` + loginCodeColumns + `)
+		VALUES ($1, $2, $3, 0, $4, $5, 1, $5)
+		ON CONFLICT (user_id, purpose) DO UPDATE
+		SET code_hash = EXCLUDED.code_hash, attempts = 0, expires_at = EXCLUDED.expires_at, sent_at = EXCLUDED.sent_at,
+			send_count = CASE WHEN login_codes.window_started_at < $7 THEN 1 ELSE login_codes.send_count + 1 END,
+			window_started_at = CASE WHEN login_codes.window_started_at < $7 THEN EXCLUDED.sent_at ELSE login_codes.window_started_at END
+		WHERE login_codes.sent_at < $6 AND (login_codes.window_started_at < $7 OR login_codes.send_count < $8)
+	`
+	result, err := execContext(ctx, repo.DB, "LoginCodeRepository.SaveCode", query,
+		code.UserID, code.Purpose, code.CodeHash, code.ExpiresAt, code.SentAt,
+		throttle.LastSentBefore, throttle.WindowStartedBefore, throttle.MaxSends)
+	return affectedRow(result, err)
+}
+
+// ClaimAttempt counts a verification attempt against the user's unexpired code for purpose and
+// returns the code, or nil if there is none or its attempts are used up
+func (repo *LoginCodeRepository) ClaimAttempt(ctx context.Context, userID, purpose string, now time.Time, maxAttempts int) (*models.LoginCode, error) {
+	query := `
+		UPDATE login_codes
+		SET attempts = attempts + 1
+		WHERE user_id = $1 AND purpose = $2 AND expires_at > $3 AND attempts < $4
+		RETURNING ` + loginCodeColumns
+	row := queryRowContext(ctx, repo.DB, "LoginCodeRepository.ClaimAttempt", query, userID, purpose, now, maxAttempts)
+
+	code, err := scanLoginCode(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return code, err
+}
+
+// ConsumeCode expires a verified code so it cannot be used again. The row is kept so the send
+// throttle still applies. It reports false if the code was replaced or used in the meantime.
+func (repo *LoginCodeRepository) ConsumeCode(ctx context.Context, code *models.LoginCode, now time.Time) (bool, error) {
+	query := `
+		UPDATE login_codes
+		SET expires_at = $4
+		WHERE user_id = $1 AND purpose = $2 AND code_hash = $3 AND expires_at > $4
+	`
+	result, err := execContext(ctx, repo.DB, "LoginCodeRepository.ConsumeCode", query, code.UserID, code.Purpose, code.CodeHash, now)
+	return affectedRow(result, err)
+}
+
+func scanLoginCode(row rowScanner) (*models.LoginCode, error) {
+	var code models.LoginCode
+	if err := row.Scan(&code.UserID, &code.Purpose, &code.CodeHash, &code.Attempts, &code.ExpiresAt, &code.SentAt,
+		&code.SendCount, &code.WindowStartedAt); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
@@ -0,0 +1,123 @@
+//go:build integration
+
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+// sendLoginCode saves a code for purpose sent at the given time, with the throttle of the login code service
+func sendLoginCode(t *testing.T, repo *LoginCodeRepository, userID uuid.UUID, purpose, hash string, at time.Time) bool {
+	t.Helper()
+	saved, err := repo.SaveCode(ctx, &models.LoginCode{
+		UserID: userID, Purpose: purpose, CodeHash: hash, ExpiresAt: at.Add(10 * time.Minute), SentAt: at,
+	}, LoginCodeThrottle{LastSentBefore: at.Add(-time.Minute), WindowStartedBefore: at.Add(-time.Hour), MaxSends: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return saved
+}
+
+func TestSaveCodeThrottlesSends(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewLoginCodeRepository(db)
+	userID := insertUser(t, db)
+	start := testNow()
+
+	sends := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},
+		{30 * time.Second, false}, // Within a minute of the last code
+		{61 * time.Second, true},
+		{122 * time.Second, true},
+		{183 * time.Second, true},
+		{244 * time.Second, true},
+		{305 * time.Second, false}, // Sixth code within the hour
+		{time.Hour + time.Second, true},
+		{time.Hour + 62*time.Second, true}, // The window restarted with the previous code
+	}
+	for _, send := range sends {
+		if got := sendLoginCode(t, repo, userID, models.LoginCodePurposeLogin, "hash", start.Add(send.after)); got != send.want {
+			t.Errorf("code sent %v after the first: saved = %v, want %v", send.after, got, send.want)
+		}
+	}
+
+	// Codes for another purpose have a throttle of their own
+	if !sendLoginCode(t, repo, userID, models.LoginCodePurposeChangeEmail, "hash", start.Add(time.Hour+62*time.Second)) {
+		t.Error("reauth code throttled by sign-in codes")
+	}
+}
+
+func TestClaimAttempt(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewLoginCodeRepository(db)
+	userID := insertUser(t, db)
+	now := testNow()
+	sendLoginCode(t, repo, userID, models.LoginCodePurposeLogin, "first", now)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		code, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeLogin, now, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code == nil || code.Attempts != attempt || code.CodeHash != "first" {
+			t.Fatalf("attempt %d: code = %+v", attempt, code)
+		}
+	}
+	if code, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeLogin, now, 3); err != nil || code != nil {
+		t.Errorf("attempt after the last: code = %+v, %v, want none", code, err)
+	}
+
+	// A new code comes with a fresh set of attempts
+	sendLoginCode(t, repo, userID, models.LoginCodePurposeLogin, "second", now.Add(61*time.Second))
+	code, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeLogin, now.Add(61*time.Second), 3)
+	if err != nil || code == nil || code.Attempts != 1 || code.CodeHash != "second" {
+		t.Errorf("new code: %+v, %v, want its first attempt", code, err)
+	}
+
+	if code, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeChangeEmail, now, 3); err != nil || code != nil {
+		t.Errorf("other purpose: code = %+v, %v, want none", code, err)
+	}
+	if code, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeLogin, now.Add(12*time.Minute), 3); err != nil || code != nil {
+		t.Errorf("expired code: %+v, %v, want none", code, err)
+	}
+}
+
+func TestConsumeCode(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewLoginCodeRepository(db)
+	userID := insertUser(t, db)
+	now := testNow()
+	sendLoginCode(t, repo, userID, models.LoginCodePurposeLogin, "first", now)
+
+	code, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeLogin, now, 5)
+	if err != nil || code == nil {
+		t.Fatalf("ClaimAttempt = %+v, %v", code, err)
+	}
+	if consumed, err := repo.ConsumeCode(ctx, code, now); err != nil || !consumed {
+		t.Fatalf("ConsumeCode = %v, %v", consumed, err)
+	}
+	if consumed, err := repo.ConsumeCode(ctx, code, now); err != nil || consumed {
+		t.Errorf("second ConsumeCode = %v, %v, want false", consumed, err)
+	}
+	if code, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeLogin, now, 5); err != nil || code != nil {
+		t.Errorf("claim of a used code = %+v, %v, want none", code, err)
+	}
+
+	// A code replaced after it was claimed cannot be consumed
+	sendLoginCode(t, repo, userID, models.LoginCodePurposeLogin, "second", now.Add(61*time.Second))
+	claimed, err := repo.ClaimAttempt(ctx, userID.String(), models.LoginCodePurposeLogin, now.Add(61*time.Second), 5)
+	if err != nil || claimed == nil {
+		t.Fatalf("ClaimAttempt = %+v, %v", claimed, err)
+	}
+	sendLoginCode(t, repo, userID, models.LoginCodePurposeLogin, "third", now.Add(122*time.Second))
+	if consumed, err := repo.ConsumeCode(ctx, claimed, now.Add(122*time.Second)); err != nil || consumed {
+		t.Errorf("ConsumeCode of a replaced code = %v, %v, want false", consumed, err)
+	}
+}
@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/lib/pq"
+)
+
+const oauthClientColumns = `client_id, name, secret_hash, public_key_pem, redirect_uris, grant_types, scopes,
+	access_token_ttl_seconds, refresh_token_ttl_seconds, created_at, updated_at`
+
+type OAuthClientRepository struct {
+	DB *sql.DB
+}
+
+func NewOAuthClientRepository(db *sql.DB) *OAuthClientRepository {
+	return &OAuthClientRepository{DB: db}
+}
+
+// CreateClient inserts a new OAuth client
+func (repo *OAuthClientRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (` + oauthClientColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err := execContext(ctx, repo.DB, "OAuthClientRepository.CreateClient", query,
+		client.ID, client.Name, client.SecretHash, client.PublicKey,
+		pq.Array(client.RedirectURIs), pq.Array(client.GrantTypes), pq.Array(client.Scopes),
+		int64(client.AccessTokenTTL.Seconds()), int64(client.RefreshTokenTTL.Seconds()),
+		client.CreatedAt, client.UpdatedAt)
+	return err
+}
+
+// GetClient retrieves a client by its ID
+func (repo *OAuthClientRepository) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE client_id = $1`
+	row := queryRowContext(ctx, repo.DB, "OAuthClientRepository.GetClient", query, clientID)
+
+	client, err := scanOAuthClient(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // No client found
+	}
+	return client, err
+}
+
+// ListClients retrieves all clients, oldest first
+func (repo *OAuthClientRepository) ListClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at, client_id`
+	rows, err := queryContext(ctx, repo.DB, "OAuthClientRepository.ListClients", query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []*models.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// UpdateClient saves the settings of an existing client. It reports false if the client does not exist.
+func (repo *OAuthClientRepository) UpdateClient(ctx context.Context, client *models.OAuthClient) (bool, error) {
+	query := `
+		UPDATE oauth_clients
+		SET name = $2, public_key_pem = $3, redirect_uris = $4, grant_types = $5, scopes = $6,
+			access_token_ttl_seconds = $7, refresh_token_ttl_seconds = $8, updated_at = $9
+		WHERE client_id = $1
+	`
+	result, err := execContext(ctx, repo.DB, "OAuthClientRepository.UpdateClient", query,
+		client.ID, client.Name, client.PublicKey,
+		pq.Array(client.RedirectURIs), pq.Array(client.GrantTypes), pq.Array(client.Scopes),
+		int64(client.AccessTokenTTL.Seconds()), int64(client.RefreshTokenTTL.Seconds()),
+		client.UpdatedAt)
+	return affectedRow(result, err)
+}
+
+// UpdateSecret replaces the secret hash of a client. It reports false if the client does not exist.
+func (repo *OAuthClientRepository) UpdateSecret(ctx context.Context, clientID, secretHash string) (bool, error) {
+	query := `UPDATE oauth_clients SET secret_hash = $2, updated_at = $3 WHERE client_id = $1`
+	result, err := execContext(ctx, repo.DB, "OAuthClientRepository.UpdateSecret", query, clientID, secretHash, time.Now())
+	return affectedRow(result, err)
+}
+
+// DeleteClient removes a client and, through foreign keys, its outstanding authorization codes.
+// It reports false if the client does not exist.
+func (repo *OAuthClientRepository) DeleteClient(ctx context.Context, clientID string) (bool, error) {
+	query := `DELETE FROM oauth_clients WHERE client_id = $1`
+	result, err := execContext(ctx, repo.DB, "OAuthClientRepository.DeleteClient", query, clientID)
+	return affectedRow(result, err)
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOAuthClient(row rowScanner) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	var accessTTL, refreshTTL int64
+	err := row.Scan(&client.ID, &client.Name, &client.SecretHash, &client.PublicKey,
+		pq.Array(&client.RedirectURIs), pq.Array(&client.GrantTypes), pq.Array(&client.Scopes),
+		&accessTTL, &refreshTTL, &client.CreatedAt, &client.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	client.AccessTokenTTL = time.Duration(accessTTL) * time.Second
+	client.RefreshTokenTTL = time.Duration(refreshTTL) * time.Second
+	return &client, nil
+}
+
+// affectedRow reports whether a statement changed at least one row
+func affectedRow(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,265 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/types"
+	"github.com/lib/pq"
+)
+
+// membershipSelect loads memberships together with the organization, the user and the member's sorted roles
+const membershipSelect = `
+	SELECT m.org_id, o.slug, o.name, m.user_id, u.username, u.email,
+		COALESCE(array_agg(mr.role ORDER BY mr.role) FILTER (WHERE mr.role IS NOT NULL), '{}'),
+		m.created_at
+	FROM organization_memberships m
+	JOIN organizations o ON o.id = m.org_id
+	JOIN users u ON u.id = m.user_id
+	LEFT JOIN organization_member_roles mr ON mr.org_id = m.org_id AND mr.user_id = m.user_id
+`
+
+const membershipGroupBy = ` GROUP BY m.org_id, m.user_id, o.id, u.id`
+
+type OrganizationRepository struct {
+	DB *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) *OrganizationRepository {
+	return &OrganizationRepository{DB: db}
+}
+
+// CreateOrganization inserts a new organization
+func (repo *OrganizationRepository) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	query := `
+		INSERT INTO organizations (id, slug, name, isolated_accounts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := execContext(ctx, repo.DB, "OrganizationRepository.CreateOrganization", query,
+		org.ID, org.Slug, org.Name, org.IsolatedAccounts, org.CreatedAt, org.UpdatedAt)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "organizations_slug_key" {
+		return types.ErrOrganizationExists
+	}
+	return err
+}
+
+// GetOrganization retrieves an organization by ID
+func (repo *OrganizationRepository) GetOrganization(ctx context.Context, id string) (*models.Organization, error) {
+	query := `
+		SELECT id, slug, name, isolated_accounts, created_at, updated_at
+		FROM organizations
+		WHERE id = $1
+	`
+	row := queryRowContext(ctx, repo.DB, "OrganizationRepository.GetOrganization", query, id)
+
+	org, err := scanOrganization(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // No organization found
+	}
+	return org, err
+}
+
+// ListOrganizations retrieves all organizations ordered by slug
+func (repo *OrganizationRepository) ListOrganizations(ctx context.Context) ([]*models.Organization, error) {
+	query := `
+		SELECT id, slug, name, isolated_accounts, created_at, updated_at
+		FROM organizations
+		ORDER BY slug
+	`
+	rows, err := queryContext(ctx, repo.DB, "OrganizationRepository.ListOrganizations", query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organization
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// AddMember makes a user a member of an organization holding the given roles. Adding an existing
+// member grants the roles they do not hold yet.
+func (repo *OrganizationRepository) AddMember(ctx context.Context, membership *models.Membership) error {
+	query := `
+		WITH membership AS (
+			INSERT INTO organization_memberships (org_id, user_id, created_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		)
+		INSERT INTO organization_member_roles (org_id, user_id, role)
+		SELECT $1, $2, role FROM unnest($4::text[]) AS role
+		ON CONFLICT DO NOTHING
+	`
+	_, err := execContext(ctx, repo.DB, "OrganizationRepository.AddMember", query,
+		membership.OrgID, membership.UserID, membership.CreatedAt, pq.Array(membership.Roles))
+	return translateMembershipConstraint(err)
+}
+
+// CreateUserWithMembership inserts an account of an organization with isolated accounts together
+// with its membership and roles, in a single statement
+func (repo *OrganizationRepository) CreateUserWithMembership(ctx context.Context, user *models.User, roles []string) error {
+	query := `
+		WITH new_user AS (
+			INSERT INTO users (id, org_id, username, email, email_verified, password, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $10, $7, $8)
+			RETURNING id, org_id
+		), membership AS (
+			INSERT INTO organization_memberships (org_id, user_id, created_at)
+			SELECT org_id, id, $7 FROM new_user
+		)
+		INSERT INTO organization_member_roles (org_id, user_id, role)
+		SELECT new_user.org_id, new_user.id, role FROM new_user, unnest($9::text[]) AS role
+	`
+	_, err := execContext(ctx, repo.DB, "OrganizationRepository.CreateUserWithMembership", query,
+		user.ID, user.OrgID, user.Username, user.Email, user.EmailVerified, user.Password, user.CreatedAt, user.UpdatedAt,
+		pq.Array(roles), user.Status)
+	return translateMembershipConstraint(translateUserConstraint(err))
+}
+
+// SetMemberRoles replaces the roles of a member. It reports false if the user is not a member.
+func (repo *OrganizationRepository) SetMemberRoles(ctx context.Context, orgID, userID string, roles []string) (bool, error) {
+	query := `
+		WITH member AS (
+			SELECT org_id, user_id FROM organization_memberships
+			WHERE org_id = $1 AND user_id = $2
+		), removed AS (
+			DELETE FROM organization_member_roles
+			WHERE org_id = $1 AND user_id = $2 AND role <> ALL($3::text[])
+		), added AS (
+			INSERT INTO organization_member_roles (org_id, user_id, role)
+			SELECT member.org_id, member.user_id, role FROM member, unnest($3::text[]) AS role
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*) FROM member
+	`
+	var count int
+	err := queryRowContext(ctx, repo.DB, "OrganizationRepository.SetMemberRoles", query, orgID, userID, pq.Array(roles)).Scan(&count)
+	return count > 0, translateMembershipConstraint(err)
+}
+
+// RemoveMember ends a membership. Accounts that belong to the organization are deleted with it,
+// since they cannot be used anywhere else. It reports false if the user was not a member.
+func (repo *OrganizationRepository) RemoveMember(ctx context.Context, orgID, userID string) (bool, error) {
+	query := `
+		WITH removed AS (
+			DELETE FROM organization_memberships
+			WHERE org_id = $1 AND user_id = $2
+			RETURNING user_id
+		), deleted AS (
+			DELETE FROM users
+			WHERE id IN (SELECT user_id FROM removed) AND org_id = $1
+		)
+		SELECT count(*) FROM removed
+	`
+	var count int
+	err := queryRowContext(ctx, repo.DB, "OrganizationRepository.RemoveMember", query, orgID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// ListMembers retrieves the members of an organization ordered by username
+func (repo *OrganizationRepository) ListMembers(ctx context.Context, orgID string) ([]*models.Membership, error) {
+	query := membershipSelect + ` WHERE m.org_id = $1` + membershipGroupBy + ` ORDER BY u.username`
+	return repo.listMemberships(ctx, "OrganizationRepository.ListMembers", query, orgID)
+}
+
+// ListUserMemberships retrieves the organizations a user belongs to ordered by slug
+func (repo *OrganizationRepository) ListUserMemberships(ctx context.Context, userID string) ([]*models.Membership, error) {
+	query := membershipSelect + ` WHERE m.user_id = $1` + membershipGroupBy + ` ORDER BY o.slug`
+	return repo.listMemberships(ctx, "OrganizationRepository.ListUserMemberships", query, userID)
+}
+
+func (repo *OrganizationRepository) listMemberships(ctx context.Context, name, query string, arg string) ([]*models.Membership, error) {
+	rows, err := queryContext(ctx, repo.DB, name, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []*models.Membership
+	for rows.Next() {
+		var m models.Membership
+		if err := rows.Scan(&m.OrgID, &m.OrgSlug, &m.OrgName, &m.UserID, &m.Username, &m.Email,
+			pq.Array(&m.Roles), &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, &m)
+	}
+	return memberships, rows.Err()
+}
+
+// CreateInvitation stores an invitation, pruning expired ones
+func (repo *OrganizationRepository) CreateInvitation(ctx context.Context, invitation *models.OrganizationInvitation) error {
+	query := `
+		WITH pruned AS (
+			DELETE FROM organization_invitations WHERE expires_at < NOW()
+		)
+		INSERT INTO organization_invitations (id, org_id, email, roles, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := execContext(ctx, repo.DB, "OrganizationRepository.CreateInvitation", query,
+		invitation.ID, invitation.OrgID, invitation.Email, pq.Array(invitation.Roles), invitation.TokenHash,
+		invitation.InvitedBy, invitation.ExpiresAt, invitation.CreatedAt)
+	return translateMembershipConstraint(err)
+}
+
+// GetInvitation retrieves an invitation by the hash of its token
+func (repo *OrganizationRepository) GetInvitation(ctx context.Context, tokenHash string) (*models.OrganizationInvitation, error) {
+	query := `
+		SELECT id, org_id, email, roles, token_hash, invited_by, expires_at, created_at
+		FROM organization_invitations
+		WHERE token_hash = $1
+	`
+	row := queryRowContext(ctx, repo.DB, "OrganizationRepository.GetInvitation", query, tokenHash)
+
+	var invitation models.OrganizationInvitation
+	if err := row.Scan(&invitation.ID, &invitation.OrgID, &invitation.Email, pq.Array(&invitation.Roles),
+		&invitation.TokenHash, &invitation.InvitedBy, &invitation.ExpiresAt, &invitation.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No invitation found
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// DeleteInvitation removes a redeemed invitation. It reports false if the invitation was already gone.
+func (repo *OrganizationRepository) DeleteInvitation(ctx context.Context, id string) (bool, error) {
+	query := `DELETE FROM organization_invitations WHERE id = $1`
+	result, err := execContext(ctx, repo.DB, "OrganizationRepository.DeleteInvitation", query, id)
+	return affectedRow(result, err)
+}
+
+// translateMembershipConstraint maps foreign key violations on membership tables to domain errors
+func translateMembershipConstraint(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != foreignKeyViolation {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "organization_memberships_org_id_fkey", "organization_invitations_org_id_fkey", "users_org_id_fkey":
+		return types.ErrOrganizationNotFound
+	case "organization_memberships_user_id_fkey":
+		return types.ErrUserNotFound
+	case "organization_member_roles_role_fkey":
+		return types.ErrRoleNotFound
+	}
+	return err
+}
+
+func scanOrganization(row rowScanner) (*models.Organization, error) {
+	var org models.Organization
+	if err := row.Scan(&org.ID, &org.Slug, &org.Name, &org.IsolatedAccounts, &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -26,32 +27,32 @@ func NewPasswordResetTokenRepository(db *sql.DB) *PasswordResetTokenRepository {
 }
 
 // CreateToken creates a new password reset token for a user
-func (r *PasswordResetTokenRepository) CreateToken(userID uuid.UUID, token string, expiresAt time.Time) error {
+func (r *PasswordResetTokenRepository) CreateToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) error {
 	query := `
 		INSERT INTO password_reset_tokens (user_id, token, expires_at)
 		VALUES ($1, $2, $3)
 	`
-	_, err := r.DB.Exec(query, userID, token, expiresAt)
+	_, err := execContext(ctx, r.DB, "PasswordResetTokenRepository.CreateToken", query, userID, token, expiresAt)
 	return err
 }
 
-func (repo *PasswordResetTokenRepository) SaveToken(userID uuid.UUID, token string, expiresAt time.Time) error {
+func (repo *PasswordResetTokenRepository) SaveToken(ctx context.Context, userID uuid.UUID, token string, expiresAt time.Time) error {
 	query := `
 		INSERT INTO password_reset_tokens (user_id, token, expires_at)
 		VALUES ($1, $2, $3)
 	`
-	_, err := repo.DB.Exec(query, userID, token, expiresAt)
+	_, err := execContext(ctx, repo.DB, "PasswordResetTokenRepository.SaveToken", query, userID, token, expiresAt)
 	return err
 }
 
 // FindToken retrieves a password reset token from the database
-func (repo *PasswordResetTokenRepository) FindToken(token string) (*models.PasswordResetToken, error) {
+func (repo *PasswordResetTokenRepository) FindToken(ctx context.Context, token string) (*models.PasswordResetToken, error) {
 	query := `
 		SELECT user_id, token, expires_at
 		FROM password_reset_tokens
-		WHERE token = $1
+		WHERE token = $1 AND purpose = $2
 	`
-	row := repo.DB.QueryRow(query, token)
+	row := queryRowContext(ctx, repo.DB, "PasswordResetTokenRepository.FindToken", query, token, models.TokenPurposePasswordReset)
 
 	var resetToken models.PasswordResetToken
 	if err := row.Scan(&resetToken.UserID, &resetToken.Token, &resetToken.ExpiresAt); err != nil {
@@ -65,8 +66,46 @@ func (repo *PasswordResetTokenRepository) FindToken(token string) (*models.Passw
 }
 
 // DeleteToken removes a password reset token from the database
-func (r *PasswordResetTokenRepository) DeleteToken(token string) error {
-	query := `DELETE FROM password_reset_tokens WHERE token = $1`
-	_, err := r.DB.Exec(query, token)
+func (r *PasswordResetTokenRepository) DeleteToken(ctx context.Context, token string) error {
+	query := `DELETE FROM password_reset_tokens WHERE token = $1 AND purpose = $2`
+	_, err := execContext(ctx, r.DB, "PasswordResetTokenRepository.DeleteToken", query, token, models.TokenPurposePasswordReset)
 	return err
 }
+
+// SaveMagicLinkToken stores the hash of a magic link token for a user, along with the hash of the
+// device nonce it is bound to, if any. Expired magic link tokens are pruned at the same time.
+func (repo *PasswordResetTokenRepository) SaveMagicLinkToken(ctx context.Context, userID uuid.UUID, tokenHash string, deviceNonceHash sql.NullString, expiresAt time.Time) error {
+	query := `
+		WITH pruned AS (
+			DELETE FROM password_reset_tokens WHERE purpose = $4 AND expires_at < NOW()
+		)
+		INSERT INTO password_reset_tokens (user_id, token, expires_at, purpose, device_nonce_hash)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := execContext(ctx, repo.DB, "PasswordResetTokenRepository.SaveMagicLinkToken", query,
+		userID, tokenHash, expiresAt, models.TokenPurposeMagicLink, deviceNonceHash)
+	return err
+}
+
+// ConsumeMagicLinkToken deletes the unexpired magic link token with the given hash and returns it,
+// so each token signs in once. A token bound to a device is only consumed with the hash of the
+// same nonce. It returns nil if there is no such token.
+func (repo *PasswordResetTokenRepository) ConsumeMagicLinkToken(ctx context.Context, tokenHash, deviceNonceHash string, now time.Time) (*models.PasswordResetToken, error) {
+	query := `
+		DELETE FROM password_reset_tokens
+		WHERE token = $1 AND purpose = $2 AND expires_at > $3
+		  AND (device_nonce_hash IS NULL OR device_nonce_hash = $4)
+		RETURNING user_id, token, expires_at, purpose, device_nonce_hash
+	`
+	row := queryRowContext(ctx, repo.DB, "PasswordResetTokenRepository.ConsumeMagicLinkToken", query,
+		tokenHash, models.TokenPurposeMagicLink, now, deviceNonceHash)
+
+	var token models.PasswordResetToken
+	if err := row.Scan(&token.UserID, &token.Token, &token.ExpiresAt, &token.Purpose, &token.DeviceNonceHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No usable token
+		}
+		return nil, err
+	}
+	return &token, nil
+}
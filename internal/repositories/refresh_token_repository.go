@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -16,25 +17,25 @@ func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
 	return &RefreshTokenRepository{DB: db}
 }
 
-func (repo *RefreshTokenRepository) SaveRefreshToken(userID uuid.UUID, token string, expiresAt time.Time) error {
+func (repo *RefreshTokenRepository) SaveRefreshToken(ctx context.Context, userID uuid.UUID, orgID uuid.NullUUID, clientID sql.NullString, scope, token string, expiresAt time.Time) error {
 	query := `
-		INSERT INTO refresh_tokens (user_id, token, expires_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO refresh_tokens (user_id, org_id, client_id, scope, token, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
-	_, err := repo.DB.Exec(query, userID, token, expiresAt)
+	_, err := execContext(ctx, repo.DB, "RefreshTokenRepository.SaveRefreshToken", query, userID, orgID, clientID, scope, token, expiresAt)
 	return err
 }
 
-func (repo *RefreshTokenRepository) FindRefreshToken(token string) (*models.RefreshToken, error) {
+func (repo *RefreshTokenRepository) FindRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
 	query := `
-		SELECT id, user_id, token, expires_at, created_at
+		SELECT id, user_id, org_id, client_id, scope, token, expires_at, created_at
 		FROM refresh_tokens
 		WHERE token = $1
 	`
-	row := repo.DB.QueryRow(query, token)
+	row := queryRowContext(ctx, repo.DB, "RefreshTokenRepository.FindRefreshToken", query, token)
 
 	var rt models.RefreshToken
-	err := row.Scan(&rt.ID, &rt.UserID, &rt.Token, &rt.ExpiresAt, &rt.CreatedAt)
+	err := row.Scan(&rt.ID, &rt.UserID, &rt.OrgID, &rt.ClientID, &rt.Scope, &rt.Token, &rt.ExpiresAt, &rt.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -42,12 +43,23 @@ func (repo *RefreshTokenRepository) FindRefreshToken(token string) (*models.Refr
 	return &rt, nil
 }
 
-func (repo *RefreshTokenRepository) UpdateRefreshToken(userID uuid.UUID, token string, expiresAt time.Time) error {
+// UpdateRefreshToken rotates a single refresh token, leaving the user's other sessions untouched
+func (repo *RefreshTokenRepository) UpdateRefreshToken(ctx context.Context, id uuid.UUID, token string, expiresAt time.Time) error {
 	query := `
 		UPDATE refresh_tokens
 		SET token = $1, expires_at = $2
-		WHERE user_id = $3
+		WHERE id = $3
 	`
-	_, err := repo.DB.Exec(query, token, expiresAt, userID)
+	_, err := execContext(ctx, repo.DB, "RefreshTokenRepository.UpdateRefreshToken", query, token, expiresAt, id)
 	return err
 }
+
+// DeleteUserTokens revokes every refresh token of a user and returns how many there were
+func (repo *RefreshTokenRepository) DeleteUserTokens(ctx context.Context, userID string) (int64, error) {
+	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
+	result, err := execContext(ctx, repo.DB, "RefreshTokenRepository.DeleteUserTokens", query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/types"
+	"github.com/lib/pq"
+)
+
+// foreignKeyViolation is the PostgreSQL error code for a foreign key violation
+const foreignKeyViolation = "23503"
+
+// roleSelect loads roles together with their sorted permissions
+const roleSelect = `
+	SELECT r.name, r.description,
+		COALESCE(array_agg(p.permission ORDER BY p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}'),
+		r.created_at, r.updated_at
+	FROM roles r
+	LEFT JOIN role_permissions p ON p.role = r.name
+`
+
+type RoleRepository struct {
+	DB *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) *RoleRepository {
+	return &RoleRepository{DB: db}
+}
+
+// CreateRole inserts a role and its permissions
+func (repo *RoleRepository) CreateRole(ctx context.Context, role *models.Role) error {
+	query := `
+		WITH new_role AS (
+			INSERT INTO roles (name, description, created_at, updated_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING name
+		)
+		INSERT INTO role_permissions (role, permission)
+		SELECT new_role.name, permission FROM new_role, unnest($5::text[]) AS permission
+	`
+	_, err := execContext(ctx, repo.DB, "RoleRepository.CreateRole", query,
+		role.Name, role.Description, role.CreatedAt, role.UpdatedAt, pq.Array(role.Permissions))
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "roles_pkey" {
+		return types.ErrRoleExists
+	}
+	return err
+}
+
+// GetRole retrieves a role by name
+func (repo *RoleRepository) GetRole(ctx context.Context, name string) (*models.Role, error) {
+	query := roleSelect + ` WHERE r.name = $1 GROUP BY r.name`
+	row := queryRowContext(ctx, repo.DB, "RoleRepository.GetRole", query, name)
+
+	role, err := scanRole(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // No role found
+	}
+	return role, err
+}
+
+// ListRoles retrieves all roles ordered by name
+func (repo *RoleRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	query := roleSelect + ` GROUP BY r.name ORDER BY r.name`
+	rows, err := queryContext(ctx, repo.DB, "RoleRepository.ListRoles", query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// UpdateRole saves the description of a role and replaces its permissions.
+// It reports false if the role does not exist.
+func (repo *RoleRepository) UpdateRole(ctx context.Context, role *models.Role) (bool, error) {
+	query := `
+		WITH updated AS (
+			UPDATE roles SET description = $2, updated_at = $3
+			WHERE name = $1
+			RETURNING name
+		), removed AS (
+			DELETE FROM role_permissions
+			WHERE role IN (SELECT name FROM updated) AND permission <> ALL($4::text[])
+		), added AS (
+			INSERT INTO role_permissions (role, permission)
+			SELECT updated.name, permission FROM updated, unnest($4::text[]) AS permission
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*) FROM updated
+	`
+	var count int
+	err := queryRowContext(ctx, repo.DB, "RoleRepository.UpdateRole", query,
+		role.Name, role.Description, role.UpdatedAt, pq.Array(role.Permissions)).Scan(&count)
+	return count > 0, err
+}
+
+// DeleteRole removes a role and, through foreign keys, its permissions and assignments.
+// It reports false if the role does not exist.
+func (repo *RoleRepository) DeleteRole(ctx context.Context, name string) (bool, error) {
+	query := `DELETE FROM roles WHERE name = $1`
+	result, err := execContext(ctx, repo.DB, "RoleRepository.DeleteRole", query, name)
+	return affectedRow(result, err)
+}
+
+// AssignRole grants a role to a user. Assigning a role the user already holds is not an error.
+func (repo *RoleRepository) AssignRole(ctx context.Context, userID, role string) error {
+	query := `
+		INSERT INTO user_roles (user_id, role, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := execContext(ctx, repo.DB, "RoleRepository.AssignRole", query, userID, role, time.Now())
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		switch pqErr.Constraint {
+		case "user_roles_user_id_fkey":
+			return types.ErrUserNotFound
+		case "user_roles_role_fkey":
+			return types.ErrRoleNotFound
+		}
+	}
+	return err
+}
+
+// UnassignRole removes a role from a user. It reports false if the user did not hold the role.
+func (repo *RoleRepository) UnassignRole(ctx context.Context, userID, role string) (bool, error) {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`
+	result, err := execContext(ctx, repo.DB, "RoleRepository.UnassignRole", query, userID, role)
+	return affectedRow(result, err)
+}
+
+// GetUserRoles returns the sorted roles of a user and the union of their permissions
+func (repo *RoleRepository) GetUserRoles(ctx context.Context, userID string) ([]string, []string, error) {
+	query := `
+		SELECT COALESCE(array_agg(DISTINCT ur.role), '{}'),
+			COALESCE(array_agg(DISTINCT p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}')
+		FROM user_roles ur
+		LEFT JOIN role_permissions p ON p.role = ur.role
+		WHERE ur.user_id = $1
+	`
+	var roles, permissions []string
+	err := queryRowContext(ctx, repo.DB, "RoleRepository.GetUserRoles", query, userID).
+		Scan(pq.Array(&roles), pq.Array(&permissions))
+	if err != nil {
+		return nil, nil, err
+	}
+	return roles, permissions, nil
+}
+
+// GetMemberRoles returns the sorted roles a member holds in an organization and the union of their
+// permissions. It returns types.ErrNotMember if the user is not a member of the organization.
+func (repo *RoleRepository) GetMemberRoles(ctx context.Context, orgID, userID string) ([]string, []string, error) {
+	query := `
+		SELECT COALESCE(array_agg(DISTINCT mr.role) FILTER (WHERE mr.role IS NOT NULL), '{}'),
+			COALESCE(array_agg(DISTINCT p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}')
+		FROM organization_memberships m
+		LEFT JOIN organization_member_roles mr ON mr.org_id = m.org_id AND mr.user_id = m.user_id
+		LEFT JOIN role_permissions p ON p.role = mr.role
+		WHERE m.org_id = $1 AND m.user_id = $2
+		GROUP BY m.org_id, m.user_id
+	`
+	var roles, permissions []string
+	err := queryRowContext(ctx, repo.DB, "RoleRepository.GetMemberRoles", query, orgID, userID).
+		Scan(pq.Array(&roles), pq.Array(&permissions))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, types.ErrNotMember
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return roles, permissions, nil
+}
+
+func scanRole(row rowScanner) (*models.Role, error) {
+	var role models.Role
+	if err := row.Scan(&role.Name, &role.Description, pq.Array(&role.Permissions), &role.CreatedAt, &role.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/kraftzpepe/auth-service/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("github.com/kraftzpepe/auth-service/internal/repositories")
+
+// startQuerySpan starts a client span describing a SQL statement
+func startQuerySpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	query = strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(query, " ")
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(strings.ToUpper(operation)),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// execContext runs a statement that returns no rows inside a span
+func execContext(ctx context.Context, db *sql.DB, name, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, name, query)
+	result, err := db.ExecContext(ctx, query, args...)
+	tracing.EndSpan(span, err)
+	return result, err
+}
+
+// queryContext runs a statement that returns rows inside a span. The span covers
+// query execution only; errors encountered while iterating rows are not recorded.
+func queryContext(ctx context.Context, db *sql.DB, name, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, name, query)
+	rows, err := db.QueryContext(ctx, query, args...)
+	tracing.EndSpan(span, err)
+	return rows, err
+}
+
+// queryRowContext runs a single-row query inside a span
+func queryRowContext(ctx context.Context, db *sql.DB, name, query string, args ...any) *sql.Row {
+	ctx, span := startQuerySpan(ctx, name, query)
+	row := db.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		tracing.EndSpan(span, err)
+		return row
+	}
+	span.End()
+	return row
+}
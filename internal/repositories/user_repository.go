@@ -4,10 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/types"
+	"github.com/lib/pq"
 )
 
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
+
 type UserRepository struct {
 	DB *sql.DB
 }
@@ -16,67 +25,190 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
+// userSelect loads the columns scanned by scanUser
+const userSelect = `
+	SELECT id, org_id, username, email, email_verified, password, display_name, avatar_url, status, status_reason,
+		created_at, updated_at
+	FROM users
+`
+
 // CreateUser inserts a new user into the database
 func (repo *UserRepository) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (id, username, email, password, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (id, org_id, username, email, email_verified, password, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := repo.DB.ExecContext(ctx, query, user.ID, user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt)
-	return err
+	_, err := execContext(ctx, repo.DB, "UserRepository.CreateUser", query, user.ID, user.OrgID, user.Username, user.Email, user.EmailVerified, user.Password, user.Status, user.CreatedAt, user.UpdatedAt)
+	return translateUserConstraint(err)
 }
 
-// GetUserByEmail retrieves a user by their email
-func (repo *UserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `
-		SELECT id, username, email, password, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`
-	row := repo.DB.QueryRowContext(ctx, query, email)
-
-	user := &models.User{}
-	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil // No user found
-		}
-		return nil, err
+// translateUserConstraint maps unique violations on the users table to domain errors.
+// Global accounts and each organization with isolated accounts have their own unique indexes.
+func translateUserConstraint(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "users_username_key", "users_org_username_key":
+		return types.ErrUsernameTaken
+	case "users_email_key", "users_org_email_key":
+		return types.ErrEmailTaken
 	}
+	return types.ErrUserExists
+}
 
-	return user, nil
+// GetUserByEmail retrieves a global user, one that does not belong to an organization, by their email
+func (repo *UserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := userSelect + ` WHERE email = $1 AND org_id IS NULL`
+	row := queryRowContext(ctx, repo.DB, "UserRepository.GetUserByEmail", query, email)
+	return scanUser(row)
+}
+
+// GetOrgUserByEmail retrieves a user of an organization with isolated accounts by their email
+func (repo *UserRepository) GetOrgUserByEmail(ctx context.Context, orgID, email string) (*models.User, error) {
+	query := userSelect + ` WHERE org_id = $1 AND email = $2`
+	row := queryRowContext(ctx, repo.DB, "UserRepository.GetOrgUserByEmail", query, orgID, email)
+	return scanUser(row)
 }
 
 // GetUserByUUID retrieves a user by their UUID
 func (repo *UserRepository) GetUserByUUID(ctx context.Context, uuid string) (*models.User, error) {
-	query := `
-		SELECT id, username, email, password, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
-	row := repo.DB.QueryRowContext(ctx, query, uuid)
+	query := userSelect + ` WHERE id = $1`
+	row := queryRowContext(ctx, repo.DB, "UserRepository.GetUserByUUID", query, uuid)
+	return scanUser(row)
+}
 
-	user := &models.User{}
-	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil // No user found
+// GetUserByUsername retrieves a global user by their username
+func (repo *UserRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := userSelect + ` WHERE username = $1 AND org_id IS NULL`
+	row := queryRowContext(ctx, repo.DB, "UserRepository.GetUserByUsername", query, username)
+	return scanUser(row)
+}
+
+// Columns ListUsers can sort by
+const (
+	UserSortCreatedAt = "created_at"
+	UserSortEmail     = "email"
+	UserSortUsername  = "username"
+)
+
+// UserListOptions filters, orders and positions a ListUsers query. Zero values do not filter.
+type UserListOptions struct {
+	EmailPrefix    string    // Case-insensitive
+	UsernamePrefix string    // Case-insensitive
+	EmailDomain    string    // Case-insensitive, without the "@"
+	Search         string    // Case-insensitive prefix of the email or the username
+	CreatedAfter   time.Time // Inclusive
+	CreatedBefore  time.Time // Exclusive
+	EmailVerified  *bool
+	Status         string
+	Role           string // Global role the user holds
+	SortBy         string // One of the UserSort columns; created_at when empty
+	Descending     bool
+	After          *models.User // Continue after this user in sort order; only its ID and sort column are read
+	Limit          int
+}
+
+// ListUsers retrieves a page of users with a keyset query, ordered by the sort column and then by ID
+func (repo *UserRepository) ListUsers(ctx context.Context, opts UserListOptions) ([]*models.User, error) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if opts.EmailPrefix != "" {
+		conditions = append(conditions, "lower(email) LIKE "+arg(escapeLike(strings.ToLower(opts.EmailPrefix))+"%"))
+	}
+	if opts.UsernamePrefix != "" {
+		conditions = append(conditions, "lower(username) LIKE "+arg(escapeLike(strings.ToLower(opts.UsernamePrefix))+"%"))
+	}
+	if opts.EmailDomain != "" {
+		conditions = append(conditions, "lower(email) LIKE "+arg("%@"+escapeLike(strings.ToLower(opts.EmailDomain))))
+	}
+	if opts.Search != "" {
+		pattern := arg(escapeLike(strings.ToLower(opts.Search)) + "%")
+		conditions = append(conditions, "(lower(email) LIKE "+pattern+" OR lower(username) LIKE "+pattern+")")
+	}
+	if !opts.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(opts.CreatedAfter))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(opts.CreatedBefore))
+	}
+	if opts.EmailVerified != nil {
+		conditions = append(conditions, "email_verified = "+arg(*opts.EmailVerified))
+	}
+	if opts.Status != "" {
+		conditions = append(conditions, "status = "+arg(opts.Status))
+	}
+	if opts.Role != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = users.id AND ur.role = "+arg(opts.Role)+")")
+	}
+
+	column := UserSortCreatedAt
+	var afterValue any
+	switch opts.SortBy {
+	case UserSortCreatedAt, "":
+		if opts.After != nil {
+			afterValue = opts.After.CreatedAt
 		}
+	case UserSortEmail:
+		column = UserSortEmail
+		if opts.After != nil {
+			afterValue = opts.After.Email
+		}
+	case UserSortUsername:
+		column = UserSortUsername
+		if opts.After != nil {
+			afterValue = opts.After.Username
+		}
+	default:
+		return nil, fmt.Errorf("unknown sort column %q", opts.SortBy)
+	}
+	comparison, direction := ">", "ASC"
+	if opts.Descending {
+		comparison, direction = "<", "DESC"
+	}
+	if opts.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, arg(afterValue), arg(opts.After.ID)))
+	}
+
+	query := userSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column, direction, direction, arg(opts.Limit))
+
+	rows, err := queryContext(ctx, repo.DB, "UserRepository.ListUsers", query, args...)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return user, nil
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
 }
 
-// GetUserByUsername retrieves a user by their username
-func (repo *UserRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
-	query := `
-		SELECT id, username, email, password, created_at, updated_at
-		FROM users
-		WHERE username = $1
-	`
-	row := repo.DB.QueryRowContext(ctx, query, username)
+// escapeLike escapes the wildcard characters of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
 
+// scanUser scans a row selected with userSelect, returning nil when there is no row
+func scanUser(row rowScanner) (*models.User, error) {
 	user := &models.User{}
-	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt); err != nil {
+	if err := row.Scan(&user.ID, &user.OrgID, &user.Username, &user.Email, &user.EmailVerified, &user.Password,
+		&user.DisplayName, &user.AvatarURL, &user.Status, &user.StatusReason, &user.CreatedAt, &user.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil // No user found
 		}
@@ -93,6 +225,79 @@ func (repo *UserRepository) UpdatePassword(ctx context.Context, userID, hashedPa
         SET password = $1, updated_at = CURRENT_TIMESTAMP
         WHERE id = $2
     `
-	_, err := repo.DB.ExecContext(ctx, query, hashedPassword, userID)
+	_, err := execContext(ctx, repo.DB, "UserRepository.UpdatePassword", query, hashedPassword, userID)
 	return err
 }
+
+// ReplacePassword sets a new password hash for a user and revokes their refresh tokens, ending their
+// sessions. It reports false if there is no such user.
+func (repo *UserRepository) ReplacePassword(ctx context.Context, userID, hashedPassword string) (bool, error) {
+	query := `
+		WITH updated AS (
+			UPDATE users
+			SET password = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING id
+		), revoked AS (
+			DELETE FROM refresh_tokens
+			WHERE user_id IN (SELECT id FROM updated)
+		)
+		SELECT count(*) FROM updated
+	`
+	var count int
+	err := queryRowContext(ctx, repo.DB, "UserRepository.ReplacePassword", query, userID, hashedPassword).Scan(&count)
+	return count > 0, err
+}
+
+// UpdateProfile saves the username and display attributes of a user. It fails with
+// types.ErrUsernameTaken if the username belongs to another user, and reports false if there is no such user.
+func (repo *UserRepository) UpdateProfile(ctx context.Context, user *models.User) (bool, error) {
+	query := `
+		UPDATE users
+		SET username = $2, display_name = $3, avatar_url = $4, updated_at = $5
+		WHERE id = $1
+	`
+	result, err := execContext(ctx, repo.DB, "UserRepository.UpdateProfile", query,
+		user.ID, user.Username, user.DisplayName, user.AvatarURL, user.UpdatedAt)
+	return affectedRow(result, translateUserConstraint(err))
+}
+
+// SetStatus changes the status of a user. Unless the new status is active, the user's refresh tokens
+// are deleted in the same statement, ending their sessions. It reports false if there is no such user.
+func (repo *UserRepository) SetStatus(ctx context.Context, userID, status, reason string) (bool, error) {
+	query := `
+		WITH updated AS (
+			UPDATE users
+			SET status = $2, status_reason = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING id
+		), revoked AS (
+			DELETE FROM refresh_tokens
+			WHERE user_id IN (SELECT id FROM updated) AND $2 <> 'active'
+		)
+		SELECT count(*) FROM updated
+	`
+	var count int
+	err := queryRowContext(ctx, repo.DB, "UserRepository.SetStatus", query, userID, status, reason).Scan(&count)
+	return count > 0, err
+}
+
+// DeleteUser removes a user. Their tokens, API keys, roles and memberships are deleted with them
+// through the ON DELETE CASCADE foreign keys. It reports false if there is no such user.
+func (repo *UserRepository) DeleteUser(ctx context.Context, userID string) (bool, error) {
+	query := `DELETE FROM users WHERE id = $1`
+	result, err := execContext(ctx, repo.DB, "UserRepository.DeleteUser", query, userID)
+	return affectedRow(result, err)
+}
+
+// MarkEmailVerified records that the user has proven control of their email address. It reports
+// false if the address was already verified.
+func (repo *UserRepository) MarkEmailVerified(ctx context.Context, userID string) (bool, error) {
+	query := `
+		UPDATE users
+		SET email_verified = TRUE, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND NOT email_verified
+	`
+	result, err := execContext(ctx, repo.DB, "UserRepository.MarkEmailVerified", query, userID)
+	return affectedRow(result, err)
+}
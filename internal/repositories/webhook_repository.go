@@ -0,0 +1,259 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	webhookSubscriptionColumns = `id, url, event_types, description, secret, active, created_at, updated_at`
+	webhookDeliveryColumns     = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, last_error, response_status, created_at`
+)
+
+type WebhookRepository struct {
+	DB *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{DB: db}
+}
+
+// CreateSubscription inserts a new webhook subscription
+func (repo *WebhookRepository) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (` + webhookSubscriptionColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := execContext(ctx, repo.DB, "WebhookRepository.CreateSubscription", query,
+		sub.ID, sub.URL, pq.Array(sub.EventTypes), sub.Description, sub.Secret, sub.Active, sub.CreatedAt, sub.UpdatedAt)
+	return err
+}
+
+// GetSubscription retrieves a subscription by ID, or nil if it does not exist
+func (repo *WebhookRepository) GetSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+	row := queryRowContext(ctx, repo.DB, "WebhookRepository.GetSubscription", query, id)
+
+	sub, err := scanWebhookSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// ListSubscriptions retrieves every subscription, oldest first
+func (repo *WebhookRepository) ListSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions ORDER BY created_at, id`
+	rows, err := queryContext(ctx, repo.DB, "WebhookRepository.ListSubscriptions", query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*models.WebhookSubscription
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateSubscription saves the settings of a subscription. It reports false if there is no such subscription.
+func (repo *WebhookRepository) UpdateSubscription(ctx context.Context, sub *models.WebhookSubscription) (bool, error) {
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $2, event_types = $3, description = $4, active = $5, updated_at = $6
+		WHERE id = $1
+	`
+	result, err := execContext(ctx, repo.DB, "WebhookRepository.UpdateSubscription", query,
+		sub.ID, sub.URL, pq.Array(sub.EventTypes), sub.Description, sub.Active, sub.UpdatedAt)
+	return affectedRow(result, err)
+}
+
+// DeleteSubscription removes a subscription along with its deliveries. It reports false if there is
+// no such subscription.
+func (repo *WebhookRepository) DeleteSubscription(ctx context.Context, id string) (bool, error) {
+	query := `DELETE FROM webhook_subscriptions WHERE id = $1`
+	result, err := execContext(ctx, repo.DB, "WebhookRepository.DeleteSubscription", query, id)
+	return affectedRow(result, err)
+}
+
+// EnqueueDeliveries queues an event for every active subscription to its type, due immediately.
+// It returns the number of deliveries queued.
+func (repo *WebhookRepository) EnqueueDeliveries(ctx context.Context, delivery *models.WebhookDelivery) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		SELECT id, $1, $2, $3, $4, $5, $5
+		FROM webhook_subscriptions
+		WHERE active AND $2 = ANY(event_types)
+	`
+	result, err := execContext(ctx, repo.DB, "WebhookRepository.EnqueueDeliveries", query,
+		delivery.EventID, delivery.EventType, delivery.Payload, models.WebhookDeliveryPending, delivery.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClaimedDelivery is a delivery claimed for an attempt, with the endpoint and secret of its subscription
+type ClaimedDelivery struct {
+	Delivery *models.WebhookDelivery
+	URL      string
+	Secret   string
+}
+
+// ClaimDueDeliveries claims up to limit pending deliveries whose next attempt is due by moving that
+// attempt to leaseUntil, so other instances skip them while they are sent. A delivery whose attempt
+// is never recorded, because the instance sending it stopped, is picked up again after the lease.
+func (repo *WebhookRepository) ClaimDueDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*ClaimedDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $3
+		FROM due, webhook_subscriptions s
+		WHERE d.id = due.id AND s.id = d.subscription_id
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+			d.last_attempt_at, d.last_error, d.response_status, d.created_at, s.url, s.secret
+	`
+	rows, err := queryContext(ctx, repo.DB, "WebhookRepository.ClaimDueDeliveries", query,
+		models.WebhookDeliveryPending, now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []*ClaimedDelivery
+	for rows.Next() {
+		var c ClaimedDelivery
+		var err error
+		if c.Delivery, err = scanWebhookDelivery(rows, &c.URL, &c.Secret); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, &c)
+	}
+	return claimed, rows.Err()
+}
+
+// RecordAttempt saves the outcome of an attempt: the status, attempt count, next attempt time,
+// error and response status of the delivery
+func (repo *WebhookRepository) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_attempt_at = $5, last_error = $6, response_status = $7
+		WHERE id = $1
+	`
+	_, err := execContext(ctx, repo.DB, "WebhookRepository.RecordAttempt", query,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastAttemptAt,
+		delivery.LastError, delivery.ResponseStatus)
+	return err
+}
+
+// WebhookDeliveryListOptions filters and positions a ListDeliveries query. Zero values do not filter.
+type WebhookDeliveryListOptions struct {
+	SubscriptionID string
+	Status         string
+	EventType      string
+	BeforeID       int64 // Continue with deliveries older than this one
+	Limit          int
+}
+
+// ListDeliveries retrieves a page of deliveries, newest first
+func (repo *WebhookRepository) ListDeliveries(ctx context.Context, opts WebhookDeliveryListOptions) ([]*models.WebhookDelivery, error) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if opts.SubscriptionID != "" {
+		conditions = append(conditions, "subscription_id = "+arg(opts.SubscriptionID))
+	}
+	if opts.Status != "" {
+		conditions = append(conditions, "status = "+arg(opts.Status))
+	}
+	if opts.EventType != "" {
+		conditions = append(conditions, "event_type = "+arg(opts.EventType))
+	}
+	if opts.BeforeID > 0 {
+		conditions = append(conditions, "id < "+arg(opts.BeforeID))
+	}
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %s", arg(opts.Limit))
+
+	rows, err := queryContext(ctx, repo.DB, "WebhookRepository.ListDeliveries", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// ReplayDeliveries queues failed deliveries again with a fresh set of attempts, due at now. It
+// replays the delivery with deliveryID when it is set, or else every failed delivery of
+// subscriptionID, and returns the number of deliveries replayed.
+func (repo *WebhookRepository) ReplayDeliveries(ctx context.Context, deliveryID int64, subscriptionID string, now time.Time) (int64, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = $2
+		WHERE status = $3
+		  AND ($4 = 0 OR id = $4)
+		  AND ($5 = '' OR subscription_id::text = $5)
+	`
+	result, err := execContext(ctx, repo.DB, "WebhookRepository.ReplayDeliveries", query,
+		models.WebhookDeliveryPending, now, models.WebhookDeliveryFailed, deliveryID, subscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanWebhookSubscription(row rowScanner) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	if err := row.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &sub.Description, &sub.Secret, &sub.Active,
+		&sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// scanWebhookDelivery scans the delivery columns followed by any extra columns of the row
+func scanWebhookDelivery(row rowScanner, extra ...any) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	dest := append([]any{&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastAttemptAt, &d.LastError, &d.ResponseStatus, &d.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
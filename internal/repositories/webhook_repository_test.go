@@ -0,0 +1,96 @@
+//go:build integration
+
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+func createSubscription(t *testing.T, repo *WebhookRepository, active bool, eventTypes ...string) *models.WebhookSubscription {
+	t.Helper()
+	now := testNow()
+	sub := &models.WebhookSubscription{
+		ID: uuid.New(), URL: "https://hooks.example.com/" + eventTypes[0], EventTypes: eventTypes,
+		Secret: "secret", Active: active, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := repo.CreateSubscription(ctx, sub); err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func TestEnqueueDeliveries(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewWebhookRepository(db)
+	signups := createSubscription(t, repo, true, models.AuditSignup, models.AuditLoginSucceeded)
+	createSubscription(t, repo, true, models.AuditLoginFailed)
+	createSubscription(t, repo, false, models.AuditSignup)
+
+	now := testNow()
+	queued, err := repo.EnqueueDeliveries(ctx, &models.WebhookDelivery{
+		EventID: uuid.New(), EventType: models.AuditSignup, Payload: []byte(`{}`), CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued != 1 {
+		t.Fatalf("queued %d deliveries, want 1", queued)
+	}
+
+	claimed, err := repo.ClaimDueDeliveries(ctx, now, now.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].Delivery.SubscriptionID != signups.ID || claimed[0].URL != signups.URL || claimed[0].Secret != signups.Secret {
+		t.Errorf("claimed %+v, want the delivery to %s", claimed, signups.URL)
+	}
+}
+
+func TestClaimDueDeliveries(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewWebhookRepository(db)
+	createSubscription(t, repo, true, models.AuditSignup)
+	now := testNow()
+	for range 3 {
+		if _, err := repo.EnqueueDeliveries(ctx, &models.WebhookDelivery{
+			EventID: uuid.New(), EventType: models.AuditSignup, Payload: []byte(`{}`), CreatedAt: now,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if claimed, err := repo.ClaimDueDeliveries(ctx, now.Add(-time.Second), now.Add(time.Minute), 10); err != nil || len(claimed) != 0 {
+		t.Errorf("claimed %d deliveries before they were due, %v", len(claimed), err)
+	}
+	first, err := repo.ClaimDueDeliveries(ctx, now, now.Add(time.Minute), 2)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("claimed %d deliveries, %v, want 2", len(first), err)
+	}
+	second, err := repo.ClaimDueDeliveries(ctx, now, now.Add(time.Minute), 10)
+	if err != nil || len(second) != 1 {
+		t.Fatalf("claimed %d deliveries, %v, want the one left", len(second), err)
+	}
+	if !second[0].Delivery.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("next attempt = %v, want the end of the lease", second[0].Delivery.NextAttemptAt)
+	}
+
+	// A lease that ran out without an attempt being recorded lets the delivery be claimed again
+	again, err := repo.ClaimDueDeliveries(ctx, now.Add(time.Minute), now.Add(2*time.Minute), 10)
+	if err != nil || len(again) != 3 {
+		t.Errorf("claimed %d deliveries after the lease, %v, want 3", len(again), err)
+	}
+
+	delivery := again[0].Delivery
+	delivery.Status = models.WebhookDeliverySucceeded
+	delivery.Attempts = 1
+	if err := repo.RecordAttempt(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := repo.ClaimDueDeliveries(ctx, now.Add(time.Hour), now.Add(2*time.Hour), 10); err != nil || len(claimed) != 2 {
+		t.Errorf("claimed %d deliveries, %v, want the 2 still pending", len(claimed), err)
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	apiKeySecretBytes   = 32
+	apiKeyDisplayLength = len(models.APIKeyPrefix) + 8 // Characters of the key kept for listings
+	apiKeyTouchInterval = time.Minute                  // How often the last-used time of a busy key is written
+	maxAPIKeyNameLength = 100
+)
+
+// Token types reported by IntrospectToken
+const (
+	TokenTypeAccessToken = "access_token"
+	TokenTypeAPIKey      = "api_key"
+)
+
+// APIKeyService manages API keys and resolves them, alongside JWT access tokens, into claims
+type APIKeyService struct {
+	AuthService *AuthService
+	APIKeyRepo  *repositories.APIKeyRepository
+}
+
+func NewAPIKeyService(authService *AuthService, apiKeyRepo *repositories.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{AuthService: authService, APIKeyRepo: apiKeyRepo}
+}
+
+// CreateAPIKey creates a key for the user of an access token, scoped to the same organization as
+// the token. A ttl of zero creates a key that does not expire. The key itself is returned only here.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, owner *utils.Claims, name string, scopes []string, ttl time.Duration) (*models.APIKey, string, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.CreateAPIKey")
+	defer span.End()
+
+	if owner.APIKeyID != "" {
+		return nil, "", types.ErrPermissionDenied.WithMessage("API keys cannot create API keys")
+	}
+	if owner.ClientID != "" {
+		return nil, "", types.ErrPermissionDenied.WithMessage("access tokens issued to OAuth clients cannot create API keys")
+	}
+	userID, err := uuid.Parse(owner.UserID)
+	if err != nil {
+		return nil, "", types.ErrUnauthenticated.WithMessage("a user access token is required")
+	}
+	var orgID uuid.NullUUID
+	if owner.OrgID != "" {
+		if orgID.UUID, err = uuid.Parse(owner.OrgID); err != nil {
+			return nil, "", types.ErrUnauthenticated.WithMessage("invalid access token")
+		}
+		orgID.Valid = true
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return nil, "", types.ErrInvalidAPIKey.WithMessage("name must be 1 to 100 characters").WithField("name")
+	}
+	if scopes, err = normalizePermissions(scopes); err != nil {
+		return nil, "", types.ErrInvalidAPIKey.WithMessage("scopes must be permissions such as reports:read").WithField("scopes")
+	}
+	if ttl < 0 {
+		return nil, "", types.ErrInvalidAPIKey.WithMessage("expires_in cannot be negative").WithField("expires_in")
+	}
+
+	secret := models.APIKeyPrefix + utils.GenerateSecureToken(apiKeySecretBytes)
+	now := time.Now()
+	key := &models.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		OrgID:     orgID,
+		Name:      name,
+		Prefix:    secret[:apiKeyDisplayLength],
+		KeyHash:   utils.HashToken(secret),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		key.ExpiresAt = sql.NullTime{Time: now.Add(ttl), Valid: true}
+	}
+
+	if err := s.APIKeyRepo.CreateAPIKey(ctx, key); err != nil {
+		if errors.Is(err, types.ErrUserNotFound) || errors.Is(err, types.ErrOrganizationNotFound) {
+			return nil, "", types.ErrUnauthenticated.WithMessage("the account of this access token no longer exists")
+		}
+		return nil, "", types.ErrInternalError.WithMessage("failed to save API key").Wrap(err)
+	}
+	return key, secret, nil
+}
+
+// ListAPIKeys returns the API keys of a user
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID string) ([]*models.APIKey, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.ListAPIKeys")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	keys, err := s.APIKeyRepo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to list API keys").Wrap(err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey deletes an API key of userID, or of any user when userID is empty.
+// Calls made with the key fail from then on.
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id, userID string) error {
+	ctx, span := tracer.Start(ctx, "APIKeyService.RevokeAPIKey")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return types.ErrInvalidIdentifier.WithMessage("id must be a UUID").WithField("id")
+	}
+	found, err := s.APIKeyRepo.DeleteAPIKey(ctx, id, userID)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to revoke API key").Wrap(err)
+	}
+	if !found {
+		return types.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ResolveAPIKey returns the claims of the user an API key belongs to. Roles and permissions are
+// read when the key is used, so role changes apply to existing keys immediately, and scoped keys
+// hold only the permissions their scopes cover.
+func (s *APIKeyService) ResolveAPIKey(ctx context.Context, secret string) (*utils.Claims, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.ResolveAPIKey")
+	defer span.End()
+
+	invalid := types.ErrUnauthenticated.WithMessage("invalid API key")
+	if !strings.HasPrefix(secret, models.APIKeyPrefix) {
+		return nil, invalid
+	}
+	key, err := s.APIKeyRepo.GetAPIKeyByHash(ctx, utils.HashToken(secret))
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load API key").Wrap(err)
+	}
+	now := time.Now()
+	if key == nil || key.IsExpired(now) {
+		return nil, invalid
+	}
+
+	claims, err := s.AuthService.userClaims(ctx, key.UserID, key.OrgID)
+	if errors.Is(err, types.ErrNotMember) {
+		return nil, invalid // The owner has left the organization the key is scoped to
+	}
+	if errors.Is(err, types.ErrAccountSuspended) || errors.Is(err, types.ErrAccountPending) || errors.Is(err, types.ErrUserNotFound) {
+		return nil, invalid // Keys stop working as soon as their owner is no longer active
+	}
+	if err != nil {
+		return nil, err
+	}
+	claims.APIKeyID = key.ID.String()
+	claims.Subject = key.UserID.String()
+	claims.IssuedAt = jwt.NewNumericDate(key.CreatedAt)
+	if key.ExpiresAt.Valid {
+		claims.ExpiresAt = jwt.NewNumericDate(key.ExpiresAt.Time)
+	}
+	if len(key.Scopes) > 0 {
+		claims.Permissions = scopePermissions(claims.Permissions, key.Scopes)
+		claims.Scope = strings.Join(key.Scopes, " ")
+	}
+
+	if !key.LastUsedAt.Valid || now.Sub(key.LastUsedAt.Time) >= apiKeyTouchInterval {
+		if err := s.APIKeyRepo.TouchAPIKey(ctx, key.ID.String(), now); err != nil {
+			utils.LoggerFromContext(ctx).WarnContext(ctx, "failed to record API key use", "api_key_id", key.ID, "error", err)
+		}
+	}
+	return &claims, nil
+}
+
+// IntrospectToken reports whether an access token or API key is currently valid, and returns its
+// claims if it is. Tokens of users who are no longer active are not. Only failures to reach the
+// database are returned as errors.
+func (s *APIKeyService) IntrospectToken(ctx context.Context, token string) (*utils.Claims, bool, error) {
+	ctx, span := tracer.Start(ctx, "APIKeyService.IntrospectToken")
+	defer span.End()
+
+	if strings.HasPrefix(token, models.APIKeyPrefix) {
+		claims, err := s.ResolveAPIKey(ctx, token)
+		if errors.Is(err, types.ErrUnauthenticated) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return claims, true, nil
+	}
+
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		return nil, false, nil
+	}
+	// A user's access tokens stop being active, like their keys, once the account is no longer active
+	if claims.UserID != "" {
+		user, err := s.AuthService.UserRepo.GetUserByUUID(ctx, claims.UserID)
+		if err != nil {
+			return nil, false, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+		}
+		if user == nil || accountStatusError(user) != nil {
+			return nil, false, nil
+		}
+	}
+	return claims, true, nil
+}
+
+// TokenType returns the token type IntrospectToken reports for claims
+func TokenType(claims *utils.Claims) string {
+	if claims.APIKeyID != "" {
+		return TokenTypeAPIKey
+	}
+	return TokenTypeAccessToken
+}
+
+// scopePermissions narrows granted permissions to those covered by scopes. Both sides may hold
+// wildcards, so a permission is kept when the other side covers it.
+func scopePermissions(granted, scopes []string) []string {
+	permissions := []string{}
+	for _, permission := range granted {
+		if models.HasPermission(scopes, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	for _, scope := range scopes {
+		if models.HasPermission(granted, scope) && !slices.Contains(permissions, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+	slices.Sort(permissions)
+	return permissions
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+)
+
+func TestIntrospectTokenChecksAccountStatus(t *testing.T) {
+	env := newTestEnv(t)
+	svc := NewAPIKeyService(env.oauth.AuthService, repositories.NewAPIKeyRepository(env.sqlDB))
+	user := env.addUser("jane", "")
+	token, err := utils.GenerateJWTWithClaims(utils.Claims{UserID: user.ID.String()}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range models.UserStatuses {
+		user.Status = status
+		claims, active, err := svc.IntrospectToken(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := status == models.UserStatusActive; active != want || (claims != nil) != want {
+			t.Errorf("token of a %s user: claims = %+v, active = %v, want active %v", status, claims, active, want)
+		}
+	}
+
+	// Client credentials tokens have no user to check
+	clientToken, err := utils.GenerateClientJWT("service", "reports:read", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, active, err := svc.IntrospectToken(context.Background(), clientToken); err != nil || !active {
+		t.Errorf("client token: active = %v, %v, want it active", active, err)
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+	auditAppendAttempts  = 5    // Appends retried when other events take the next position first
+	auditVerifyBatchSize = 1000 // Events read at a time while verifying the chain
+)
+
+// AuditQuery holds the filters and page of a QueryAuditLog call as clients send them.
+// Empty fields do not filter.
+type AuditQuery struct {
+	PageSize      int
+	PageToken     string
+	Type          string
+	ActorID       string
+	SubjectID     string
+	CreatedAfter  string // RFC 3339, inclusive
+	CreatedBefore string // RFC 3339, exclusive
+	Ascending     bool
+}
+
+// AuditVerification is the result of checking the hash chain of the audit log
+type AuditVerification struct {
+	Valid          bool
+	EventsChecked  int64
+	FirstInvalidID int64  // First event that breaks the chain; zero when the chain is valid
+	Problem        string // What is wrong with FirstInvalidID
+	HeadHash       string // Hash of the newest event; keeping a copy elsewhere detects removal of the newest events
+}
+
+// AuditService records security events in a hash-chained, append-only log and reads them back
+type AuditService struct {
+	AuditRepo *repositories.AuditRepository
+}
+
+func NewAuditService(auditRepo *repositories.AuditRepository) *AuditService {
+	return &AuditService{AuditRepo: auditRepo}
+}
+
+// Record appends an event to the audit log. The caller's IP, user agent and request ID are taken
+// from the context, as is the actor unless the event sets one. Failures are logged rather than
+// returned so that the audited operation is not undone by them.
+func (s *AuditService) Record(ctx context.Context, event *models.AuditEvent) {
+	// The event is written even if the caller gives up on the request
+	ctx, span := tracer.Start(context.WithoutCancel(ctx), "AuditService.Record")
+	defer span.End()
+
+	caller := utils.CallerFromContext(ctx)
+	if event.ActorID == "" {
+		event.ActorID = caller.ActorID
+	}
+	event.IP = caller.IP
+	event.UserAgent = caller.UserAgent
+	event.RequestID = utils.RequestIDFromContext(ctx)
+	if event.Metadata == nil {
+		event.Metadata = map[string]string{}
+	}
+	if caller.APIKeyID != "" {
+		event.Metadata["api_key_id"] = caller.APIKeyID
+	}
+	// Stored timestamps keep microseconds, so the hash must not cover more
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		last, err := s.AuditRepo.LastEvent(ctx)
+		if err != nil {
+			s.logFailure(ctx, event, err)
+			return
+		}
+		event.ID, event.PrevHash = 1, ""
+		if last != nil {
+			event.ID, event.PrevHash = last.ID+1, last.Hash
+		}
+		event.Hash = auditEventHash(event)
+
+		appended, err := s.AuditRepo.AppendEvent(ctx, event)
+		if err != nil {
+			s.logFailure(ctx, event, err)
+			return
+		}
+		if appended {
+			return
+		}
+	}
+	s.logFailure(ctx, event, types.ErrInternalError.WithMessage("too many concurrent audit events"))
+}
+
+func (s *AuditService) logFailure(ctx context.Context, event *models.AuditEvent, err error) {
+	utils.LoggerFromContext(ctx).ErrorContext(ctx, "failed to record audit event",
+		"type", event.Type, "actor_id", event.ActorID, "subject_id", event.SubjectID, "error", err)
+}
+
+// QueryAuditLog returns a page of events matching the query and the token of the next page, which
+// is empty on the last page
+func (s *AuditService) QueryAuditLog(ctx context.Context, q AuditQuery) ([]*models.AuditEvent, string, error) {
+	ctx, span := tracer.Start(ctx, "AuditService.QueryAuditLog")
+	defer span.End()
+
+	opts := repositories.AuditListOptions{
+		Type:      q.Type,
+		ActorID:   q.ActorID,
+		SubjectID: q.SubjectID,
+		Ascending: q.Ascending,
+		Limit:     q.PageSize,
+	}
+	switch {
+	case q.PageSize < 0 || q.PageSize > maxAuditPageSize:
+		return nil, "", types.ErrInvalidRequest.WithMessage("page_size must be between 1 and 1000").WithField("page_size")
+	case q.PageSize == 0:
+		opts.Limit = defaultAuditPageSize
+	}
+	var err error
+	if opts.CreatedAfter, err = parseUserTime(q.CreatedAfter, "created_after"); err != nil {
+		return nil, "", err
+	}
+	if opts.CreatedBefore, err = parseUserTime(q.CreatedBefore, "created_before"); err != nil {
+		return nil, "", err
+	}
+	if q.PageToken != "" {
+		// Events are ordered by ID alone, so the token is the ID of the last event of the previous page
+		if opts.AfterID, err = strconv.ParseInt(q.PageToken, 10, 64); err != nil || opts.AfterID <= 0 {
+			return nil, "", types.ErrInvalidRequest.WithMessage("invalid page_token").WithField("page_token")
+		}
+	}
+
+	pageSize := opts.Limit
+	opts.Limit++ // One extra row tells whether there is a next page
+	events, err := s.AuditRepo.ListEvents(ctx, opts)
+	if err != nil {
+		return nil, "", types.ErrInternalError.WithMessage("failed to query audit log").Wrap(err)
+	}
+	if len(events) <= pageSize {
+		return events, "", nil
+	}
+	events = events[:pageSize]
+	return events, strconv.FormatInt(events[pageSize-1].ID, 10), nil
+}
+
+// VerifyAuditLog walks the whole log from the first event and checks that IDs have no gaps, that
+// every event links to the hash of the one before it, and that every hash matches the event's content
+func (s *AuditService) VerifyAuditLog(ctx context.Context) (*AuditVerification, error) {
+	ctx, span := tracer.Start(ctx, "AuditService.VerifyAuditLog")
+	defer span.End()
+
+	result := &AuditVerification{Valid: true}
+	var prev *models.AuditEvent
+	for {
+		opts := repositories.AuditListOptions{Ascending: true, Limit: auditVerifyBatchSize}
+		if prev != nil {
+			opts.AfterID = prev.ID
+		}
+		events, err := s.AuditRepo.ListEvents(ctx, opts)
+		if err != nil {
+			return nil, types.ErrInternalError.WithMessage("failed to read audit log").Wrap(err)
+		}
+
+		for _, event := range events {
+			if problem := auditChainProblem(prev, event); problem != "" {
+				result.Valid = false
+				result.FirstInvalidID = event.ID
+				result.Problem = problem
+				return result, nil
+			}
+			result.EventsChecked++
+			result.HeadHash = event.Hash
+			prev = event
+		}
+		if len(events) < auditVerifyBatchSize {
+			return result, nil
+		}
+	}
+}
+
+// auditChainProblem describes how event fails to follow prev in the chain, or returns ""
+func auditChainProblem(prev, event *models.AuditEvent) string {
+	wantID, wantPrevHash := int64(1), ""
+	if prev != nil {
+		wantID, wantPrevHash = prev.ID+1, prev.Hash
+	}
+	switch {
+	case event.ID != wantID:
+		return "expected event " + strconv.FormatInt(wantID, 10) + ", events are missing"
+	case event.PrevHash != wantPrevHash:
+		return "prev_hash does not match the previous event"
+	case event.Hash != auditEventHash(event):
+		return "hash does not match the event's content"
+	}
+	return ""
+}
+
+// auditEventHash returns the hex SHA-256 of an event's content, including the hash of the previous event
+func auditEventHash(event *models.AuditEvent) string {
+	// Struct fields marshal in a fixed order and map keys sorted, so the encoding is stable
+	content, _ := json.Marshal(struct {
+		ID        int64             `json:"id"`
+		Type      string            `json:"type"`
+		ActorID   string            `json:"actor_id"`
+		SubjectID string            `json:"subject_id"`
+		IP        string            `json:"ip"`
+		UserAgent string            `json:"user_agent"`
+		RequestID string            `json:"request_id"`
+		Metadata  map[string]string `json:"metadata"`
+		CreatedAt string            `json:"created_at"`
+		PrevHash  string            `json:"prev_hash"`
+	}{
+		event.ID, event.Type, event.ActorID, event.SubjectID, event.IP, event.UserAgent, event.RequestID,
+		event.Metadata, event.CreatedAt.UTC().Format(time.RFC3339Nano), event.PrevHash,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+)
+
+func newTestAuditService(t *testing.T) (*AuditService, *fakeAuditLog) {
+	env := newTestEnv(t)
+	return env.oauth.AuthService.Audit, env.audit
+}
+
+func recordEvents(s *AuditService, n int) {
+	for i := 0; i < n; i++ {
+		s.Record(context.Background(), &models.AuditEvent{
+			Type:      models.AuditLoginSucceeded,
+			ActorID:   "user-1",
+			SubjectID: "user-1",
+			Metadata:  map[string]string{"attempt": strconv.Itoa(i)},
+		})
+	}
+}
+
+func TestRecordChainsEvents(t *testing.T) {
+	s, log := newTestAuditService(t)
+	recordEvents(s, 3)
+
+	if len(log.rows) != 3 {
+		t.Fatalf("recorded %d events, want 3", len(log.rows))
+	}
+	prevHash := ""
+	for i, row := range log.rows {
+		if row[0] != int64(i+1) {
+			t.Errorf("event %d has ID %v", i+1, row[0])
+		}
+		if row[9] != prevHash {
+			t.Errorf("event %d prev_hash = %q, want %q", i+1, row[9], prevHash)
+		}
+		prevHash = row[10].(string)
+	}
+
+	result, err := s.VerifyAuditLog(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.EventsChecked != 3 || result.HeadHash != prevHash {
+		t.Errorf("VerifyAuditLog = %+v, want a valid chain of 3 events ending in %s", *result, prevHash)
+	}
+}
+
+func TestRecordRetriesWhenPositionIsTaken(t *testing.T) {
+	s, log := newTestAuditService(t)
+	recordEvents(s, 1)
+
+	// Another instance appends event 2 between this instance reading the head and appending
+	log.beforeAppend = func() {
+		other := NewAuditService(s.AuditRepo)
+		other.Record(context.Background(), &models.AuditEvent{Type: models.AuditSignup})
+	}
+	s.Record(context.Background(), &models.AuditEvent{Type: models.AuditRoleAssigned})
+
+	want := []string{models.AuditLoginSucceeded, models.AuditSignup, models.AuditRoleAssigned}
+	if got := log.types(); !slices.Equal(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if result, err := s.VerifyAuditLog(context.Background()); err != nil || !result.Valid {
+		t.Errorf("VerifyAuditLog = %+v, %v, want a valid chain", result, err)
+	}
+}
+
+func TestVerifyAuditLogDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name        string
+		tamper      func(rows [][]driver.Value) [][]driver.Value
+		wantInvalid int64
+		wantProblem string
+	}{
+		{
+			name: "edited content",
+			tamper: func(rows [][]driver.Value) [][]driver.Value {
+				rows[1][2] = "someone-else"
+				return rows
+			},
+			wantInvalid: 2,
+			wantProblem: "hash does not match the event's content",
+		},
+		{
+			name: "edited metadata",
+			tamper: func(rows [][]driver.Value) [][]driver.Value {
+				rows[1][7], _ = json.Marshal(map[string]string{"attempt": "z"})
+				return rows
+			},
+			wantInvalid: 2,
+			wantProblem: "hash does not match the event's content",
+		},
+		{
+			name: "edited content with a recomputed hash",
+			tamper: func(rows [][]driver.Value) [][]driver.Value {
+				rows[1][2] = "someone-else"
+				rows[1][10] = rehash(rows[1])
+				return rows
+			},
+			wantInvalid: 3,
+			wantProblem: "prev_hash does not match the previous event",
+		},
+		{
+			name: "removed event",
+			tamper: func(rows [][]driver.Value) [][]driver.Value {
+				return slices.Delete(rows, 1, 2)
+			},
+			wantInvalid: 3,
+			wantProblem: "expected event 2, events are missing",
+		},
+		{
+			name: "removed first event",
+			tamper: func(rows [][]driver.Value) [][]driver.Value {
+				return rows[1:]
+			},
+			wantInvalid: 2,
+			wantProblem: "expected event 1, events are missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, log := newTestAuditService(t)
+			recordEvents(s, 4)
+			log.rows = tt.tamper(log.rows)
+
+			result, err := s.VerifyAuditLog(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Valid || result.FirstInvalidID != tt.wantInvalid || result.Problem != tt.wantProblem {
+				t.Errorf("VerifyAuditLog = %+v, want event %d invalid because %q", *result, tt.wantInvalid, tt.wantProblem)
+			}
+		})
+	}
+}
+
+// rehash returns the hash a stored audit event would have with its current content
+func rehash(row []driver.Value) string {
+	event := &models.AuditEvent{
+		ID:        row[0].(int64),
+		Type:      row[1].(string),
+		ActorID:   row[2].(string),
+		SubjectID: row[3].(string),
+		IP:        row[4].(string),
+		UserAgent: row[5].(string),
+		RequestID: row[6].(string),
+		PrevHash:  row[9].(string),
+	}
+	json.Unmarshal(row[7].([]byte), &event.Metadata)
+	event.CreatedAt = row[8].(time.Time)
+	return auditEventHash(event)
+}
@@ -2,37 +2,60 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"log"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/metrics"
 	"github.com/kraftzpepe/auth-service/internal/models"
 	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/tracing"
 	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+var tracer = tracing.Tracer("github.com/kraftzpepe/auth-service/internal/service")
+
+// Passwordless login methods, recorded in the metadata of login events
+const (
+	loginMethodMagicLink = "magic_link"
+	loginMethodEmailCode = "email_code"
 )
 
 type AuthService struct {
 	UserRepo               *repositories.UserRepository
 	RefreshTokenRepo       *repositories.RefreshTokenRepository
 	PasswordResetTokenRepo *repositories.PasswordResetTokenRepository
+	RoleRepo               *repositories.RoleRepository
+	Audit                  *AuditService
+	Webhooks               *WebhookService
 }
 
 func NewAuthService(
 	userRepo *repositories.UserRepository,
 	refreshTokenRepo *repositories.RefreshTokenRepository,
 	passwordResetTokenRepo *repositories.PasswordResetTokenRepository,
+	roleRepo *repositories.RoleRepository,
+	audit *AuditService,
+	webhooks *WebhookService,
 ) *AuthService {
 	return &AuthService{
 		UserRepo:               userRepo,
 		RefreshTokenRepo:       refreshTokenRepo,
 		PasswordResetTokenRepo: passwordResetTokenRepo,
+		RoleRepo:               roleRepo,
+		Audit:                  audit,
+		Webhooks:               webhooks,
 	}
 }
 
 // Signup creates a new user, generates tokens, and saves them in the database
 func (s *AuthService) Signup(ctx context.Context, username, email, password string) (*models.User, string, string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Signup")
+	defer span.End()
+
 	// Validate inputs
 	if err := utils.ValidateEmail(email); err != nil {
 		return nil, "", "", err
@@ -42,7 +65,7 @@ func (s *AuthService) Signup(ctx context.Context, username, email, password stri
 	}
 
 	// Hash password
-	hashedPassword, err := utils.HashPassword(password)
+	hashedPassword, err := hashPassword(ctx, password)
 	if err != nil {
 		return nil, "", "", err
 	}
@@ -54,6 +77,7 @@ func (s *AuthService) Signup(ctx context.Context, username, email, password stri
 		Username:  username,
 		Email:     email,
 		Password:  hashedPassword,
+		Status:    models.UserStatusActive,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -61,186 +85,478 @@ func (s *AuthService) Signup(ctx context.Context, username, email, password stri
 	// Save user to the database
 	err = s.UserRepo.CreateUser(ctx, user)
 	if err != nil {
-		if strings.Contains(err.Error(), "users_username_key") {
-			return nil, "", "", errors.New("username is already taken")
+		var domainErr *types.Error
+		if errors.As(err, &domainErr) {
+			return nil, "", "", err
 		}
-		if strings.Contains(err.Error(), "users_email_key") {
-			return nil, "", "", errors.New("email is already registered")
-		}
-		return nil, "", "", errors.New("failed to save user")
+		return nil, "", "", types.ErrInternalError.WithMessage("failed to save user").Wrap(err)
 	}
+	metrics.Signups.Inc()
+	s.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditSignup, ActorID: user.ID.String(), SubjectID: user.ID.String()})
+	s.Webhooks.PublishUserEvent(ctx, models.WebhookUserCreated, user, "", false)
 
-	// Generate tokens
-	accessToken, err := utils.GenerateJWT(user.ID.String())
+	// Generate and save tokens
+	accessToken, refreshToken, err := s.IssueTokens(ctx, user.ID)
 	if err != nil {
-		return nil, "", "", errors.New("failed to generate access token")
+		return nil, "", "", err
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken()
+	return user, accessToken, refreshToken, nil
+}
+
+// Login authenticates a user and issues tokens
+func (s *AuthService) Login(ctx context.Context, email, password string) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer span.End()
+
+	user, err := s.Authenticate(ctx, email, password)
 	if err != nil {
-		return nil, "", "", errors.New("failed to generate refresh token")
+		return "", "", err
 	}
 
-	// Save refresh token to the database
-	err = s.RefreshTokenRepo.SaveRefreshToken(user.ID, refreshToken, time.Now().Add(7*24*time.Hour)) // 7 days expiration
+	return s.IssueTokens(ctx, user.ID)
+}
+
+// Authenticate verifies a user's email and password
+func (s *AuthService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := s.UserRepo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return nil, "", "", errors.New("failed to save refresh token")
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
 	}
+	return s.checkLogin(ctx, user, email, password, "")
+}
 
-	return user, accessToken, refreshToken, nil
+// checkLogin verifies the credentials of a login, like checkCredentials, and records the attempt in
+// the audit log. orgID is set for logins to an organization.
+func (s *AuthService) checkLogin(ctx context.Context, user *models.User, email, password, orgID string) (*models.User, error) {
+	event := &models.AuditEvent{Type: models.AuditLoginSucceeded, Metadata: map[string]string{"email": email}}
+	if orgID != "" {
+		event.Metadata["org_id"] = orgID
+	}
+	if user != nil {
+		event.SubjectID = user.ID.String()
+	}
+
+	checked, err := checkCredentials(ctx, user, password)
+	if err != nil {
+		event.Type = models.AuditLoginFailed
+		var domainErr *types.Error
+		if errors.As(err, &domainErr) {
+			event.Metadata["reason"] = domainErr.Reason
+		}
+	} else {
+		event.ActorID = event.SubjectID
+	}
+	s.Audit.Record(ctx, event)
+	return checked, err
 }
 
-// Login authenticates a user and issues tokens
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, string, error) {
-	user, err := s.UserRepo.GetUserByEmail(ctx, email)
-	if err != nil || user == nil {
-		return "", "", errors.New("invalid email or password")
+// checkCredentials verifies the password of a user looked up for a login, which may be nil,
+// and counts the attempt
+func checkCredentials(ctx context.Context, user *models.User, password string) (*models.User, error) {
+	if user == nil || user.Status == models.UserStatusDeleted || !checkPassword(ctx, password, user.Password) {
+		metrics.Logins.WithLabelValues(metrics.ResultFailure).Inc()
+		return nil, types.ErrInvalidCredentials
+	}
+	// The status is only revealed to someone who knows the password
+	if err := accountStatusError(user); err != nil {
+		metrics.Logins.WithLabelValues(metrics.ResultFailure).Inc()
+		return nil, err
+	}
+
+	metrics.Logins.WithLabelValues(metrics.ResultSuccess).Inc()
+	return user, nil
+}
+
+// accountStatusError returns the error that stops a user from signing in or obtaining tokens,
+// or nil for active users. Deleted users are reported as not found.
+func accountStatusError(user *models.User) error {
+	switch user.Status {
+	case models.UserStatusActive:
+		return nil
+	case models.UserStatusSuspended:
+		return types.ErrAccountSuspended
+	case models.UserStatusPending:
+		return types.ErrAccountPending
+	default:
+		return types.ErrUserNotFound
 	}
+}
+
+// CheckAccount returns the error of accountStatusError unless the user still has an active account.
+// Access tokens stay valid until they expire, so this is how suspending or deleting a user takes
+// effect on the tokens they hold.
+func (s *AuthService) CheckAccount(ctx context.Context, userID string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.CheckAccount")
+	defer span.End()
 
-	if !utils.CheckPasswordHash(password, user.Password) {
-		return "", "", errors.New("invalid email or password")
+	user, err := s.UserRepo.GetUserByUUID(ctx, userID)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil {
+		return types.ErrUserNotFound
 	}
+	return accountStatusError(user)
+}
 
-	accessToken, err := utils.GenerateJWT(user.ID.String())
+// IssueTokens generates an access token and a refresh token for a user and stores the refresh token
+func (s *AuthService) IssueTokens(ctx context.Context, userID uuid.UUID) (string, string, error) {
+	return s.issueTokens(ctx, userID, uuid.NullUUID{}, tokenGrant{}, defaultLifetimes)
+}
+
+// issueTokens generates and stores tokens for a user, scoped to an organization when orgID is set.
+// The refresh token can only be used within the same grant.
+func (s *AuthService) issueTokens(ctx context.Context, userID uuid.UUID, orgID uuid.NullUUID, grant tokenGrant, lifetimes tokenLifetimes) (string, string, error) {
+	claims, err := s.userClaims(ctx, userID, orgID)
 	if err != nil {
-		return "", "", errors.New("failed to generate access token")
+		return "", "", err
 	}
+	grant.apply(&claims)
 
-	refreshToken, err := utils.GenerateRefreshToken()
+	accessToken, refreshToken, err := generateTokens(ctx, claims, lifetimes.access)
 	if err != nil {
-		return "", "", errors.New("failed to generate refresh token")
+		return "", "", err
 	}
 
-	err = s.RefreshTokenRepo.SaveRefreshToken(user.ID, refreshToken, time.Now().Add(7*24*time.Hour))
+	err = s.RefreshTokenRepo.SaveRefreshToken(ctx, userID, orgID, grant.storedClientID(), grant.scope, refreshToken, time.Now().Add(lifetimes.refresh))
 	if err != nil {
-		return "", "", errors.New("failed to save refresh token")
+		return "", "", types.ErrInternalError.WithMessage("failed to save refresh token").Wrap(err)
 	}
 
 	return accessToken, refreshToken, nil
 }
 
+// issueAccessToken generates an access token for a user without a refresh token
+func (s *AuthService) issueAccessToken(ctx context.Context, userID uuid.UUID, grant tokenGrant, ttl time.Duration) (string, error) {
+	claims, err := s.userClaims(ctx, userID, uuid.NullUUID{})
+	if err != nil {
+		return "", err
+	}
+	grant.apply(&claims)
+	return generateAccessToken(ctx, claims, ttl)
+}
+
+// userClaims returns the access token claims of a user, including their current roles and permissions.
+// When orgID is set the claims are scoped to that organization and carry the roles the user holds there;
+// it fails with types.ErrNotMember if the user is not a member. Users that are not active get the
+// error of accountStatusError, so no token is issued to them.
+func (s *AuthService) userClaims(ctx context.Context, userID uuid.UUID, orgID uuid.NullUUID) (utils.Claims, error) {
+	user, err := s.UserRepo.GetUserByUUID(ctx, userID.String())
+	if err != nil {
+		return utils.Claims{}, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil {
+		return utils.Claims{}, types.ErrUserNotFound
+	}
+	if err := accountStatusError(user); err != nil {
+		return utils.Claims{}, err
+	}
+
+	if orgID.Valid {
+		roles, permissions, err := s.RoleRepo.GetMemberRoles(ctx, orgID.UUID.String(), userID.String())
+		if errors.Is(err, types.ErrNotMember) {
+			return utils.Claims{}, err
+		}
+		if err != nil {
+			return utils.Claims{}, types.ErrInternalError.WithMessage("failed to load roles").Wrap(err)
+		}
+		return utils.Claims{UserID: userID.String(), OrgID: orgID.UUID.String(), Roles: roles, Permissions: permissions}, nil
+	}
+
+	roles, permissions, err := s.RoleRepo.GetUserRoles(ctx, userID.String())
+	if err != nil {
+		return utils.Claims{}, types.ErrInternalError.WithMessage("failed to load roles").Wrap(err)
+	}
+	return utils.Claims{UserID: userID.String(), Roles: roles, Permissions: permissions}, nil
+}
+
 // RequestPasswordReset generates a reset token and sends it to the user's email
 func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) (string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RequestPasswordReset")
+	defer span.End()
+
+	metrics.PasswordResetRequests.Inc()
+
 	// Fetch the user by email
 	user, err := s.UserRepo.GetUserByEmail(ctx, email)
-	if err != nil || user == nil {
-		return "", errors.New("user not found")
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
 	}
+	if user == nil {
+		return "", types.ErrUserNotFound
+	}
+
+	return s.sendPasswordReset(ctx, user)
+}
 
+// sendPasswordReset generates a reset token for a user and sends it to their email
+func (s *AuthService) sendPasswordReset(ctx context.Context, user *models.User) (string, error) {
 	// Generate a reset token
 	resetToken, err := utils.GenerateRefreshToken() // Reuse the token generation logic
 	if err != nil {
-		return "", errors.New("failed to generate reset token")
+		return "", types.ErrInternalError.WithMessage("failed to generate reset token").Wrap(err)
 	}
 
-	// Set expiration time (e.g., 15 minutes)
-	expiresAt := time.Now().Add(15 * time.Minute)
+	// Set expiration time
+	expiresAt := time.Now().Add(passwordResetTTL)
 
 	// Save the token to the database
-	err = s.PasswordResetTokenRepo.SaveToken(user.ID, resetToken, expiresAt)
+	err = s.PasswordResetTokenRepo.SaveToken(ctx, user.ID, resetToken, expiresAt)
 	if err != nil {
-		return "", errors.New("failed to save reset token")
+		return "", types.ErrInternalError.WithMessage("failed to save reset token").Wrap(err)
 	}
 
 	// Send the reset token via email
-	err = utils.SendPasswordResetEmail(email, resetToken)
+	err = utils.SendPasswordResetEmail(ctx, user.Email, resetToken)
 	if err != nil {
-		return "", errors.New("failed to send password reset email")
+		return "", types.ErrEmailDeliveryFailed.WithMessage("failed to send password reset email").Wrap(err)
 	}
+	s.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditPasswordResetRequested, SubjectID: user.ID.String()})
 
 	return "Password reset email sent successfully.", nil
 }
 
 // ResetPassword verifies the reset token and updates the user's password
 func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) (string, error) {
-	resetToken, err := s.PasswordResetTokenRepo.FindToken(token)
-	if err != nil || resetToken == nil {
-		log.Printf("Token not found or error: %v", err)
-		return "", errors.New("invalid or expired token")
-	}
+	ctx, span := tracer.Start(ctx, "AuthService.ResetPassword")
+	defer span.End()
 
-	log.Printf("Reset Token: %+v", resetToken)
+	resetToken, err := s.PasswordResetTokenRepo.FindToken(ctx, token)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to load reset token").Wrap(err)
+	}
+	if resetToken == nil {
+		return "", types.ErrInvalidResetToken
+	}
 
 	if resetToken.ExpiresAt.Before(time.Now()) {
-		log.Printf("Token expired at: %s", resetToken.ExpiresAt)
-		return "", errors.New("invalid or expired token")
+		utils.LoggerFromContext(ctx).InfoContext(ctx, "password reset token expired", "user_id", resetToken.UserID, "expired_at", resetToken.ExpiresAt)
+		return "", types.ErrInvalidResetToken
 	}
 
-	hashedPassword, err := utils.HashPassword(newPassword)
+	hashedPassword, err := hashPassword(ctx, newPassword)
 	if err != nil {
-		return "", errors.New("failed to hash password")
+		return "", err
 	}
 
 	err = s.UserRepo.UpdatePassword(ctx, resetToken.UserID.String(), hashedPassword)
 	if err != nil {
-		return "", errors.New("failed to update password")
+		return "", types.ErrInternalError.WithMessage("failed to update password").Wrap(err)
 	}
 
-	err = s.PasswordResetTokenRepo.DeleteToken(token)
+	// The reset link was delivered by email, so following it proves control of the address
+	verified, err := s.UserRepo.MarkEmailVerified(ctx, resetToken.UserID.String())
 	if err != nil {
-		return "", errors.New("failed to delete reset token")
+		return "", types.ErrInternalError.WithMessage("failed to mark email as verified").Wrap(err)
 	}
+	if verified {
+		s.Webhooks.PublishUserChange(ctx, models.WebhookUserEmailVerified, resetToken.UserID.String(), "")
+	}
+
+	err = s.PasswordResetTokenRepo.DeleteToken(ctx, token)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to delete reset token").Wrap(err)
+	}
+	s.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditPasswordResetCompleted, SubjectID: resetToken.UserID.String()})
 
 	return "Password has been reset successfully.", nil
 }
 
+// magicLinkSent is the response to RequestMagicLink, which is the same whether or not the address has an account
+const magicLinkSent = "Sign-in link sent successfully."
+
+// RequestMagicLink emails a single-use link that signs the user in without a password. When
+// deviceNonce is set the link is bound to it, and only works when it is presented with the same
+// nonce, so a link opened on another device or intercepted from the mailbox cannot be used.
+// Addresses without an account get the same response but no email.
+func (s *AuthService) RequestMagicLink(ctx context.Context, email, deviceNonce string) (string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RequestMagicLink")
+	defer span.End()
+
+	metrics.MagicLinkRequests.Inc()
+
+	if len(deviceNonce) > 0 && (len(deviceNonce) < minDeviceNonceLength || len(deviceNonce) > maxDeviceNonceLength) {
+		return "", types.ErrInvalidRequest.WithMessage("device_nonce must be 16 to 256 characters").WithField("device_nonce")
+	}
+	user, err := s.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil || user.Status == models.UserStatusDeleted {
+		return magicLinkSent, nil
+	}
+
+	token := utils.GenerateSecureToken(32)
+	var nonceHash sql.NullString
+	if deviceNonce != "" {
+		nonceHash = sql.NullString{String: utils.HashToken(deviceNonce), Valid: true}
+	}
+	err = s.PasswordResetTokenRepo.SaveMagicLinkToken(ctx, user.ID, utils.HashToken(token), nonceHash, time.Now().Add(magicLinkTTL))
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to save magic link token").Wrap(err)
+	}
+
+	if err := utils.SendMagicLinkEmail(ctx, user.Email, token); err != nil {
+		return "", types.ErrEmailDeliveryFailed.WithMessage("failed to send magic link email").Wrap(err)
+	}
+	s.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditMagicLinkRequested, SubjectID: user.ID.String(),
+		Metadata: map[string]string{"device_bound": strconv.FormatBool(nonceHash.Valid)}})
+
+	return magicLinkSent, nil
+}
+
+// ConsumeMagicLink signs a user in with the token of a magic link, which stops working once used,
+// and issues tokens like Login. Links bound to a device need the nonce they were requested with.
+func (s *AuthService) ConsumeMagicLink(ctx context.Context, token, deviceNonce string) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ConsumeMagicLink")
+	defer span.End()
+
+	var nonceHash string
+	if deviceNonce != "" {
+		nonceHash = utils.HashToken(deviceNonce)
+	}
+	link, err := s.PasswordResetTokenRepo.ConsumeMagicLinkToken(ctx, utils.HashToken(token), nonceHash, time.Now())
+	if err != nil {
+		return "", "", types.ErrInternalError.WithMessage("failed to load magic link token").Wrap(err)
+	}
+	if link == nil {
+		s.failLogin(ctx, &models.AuditEvent{Metadata: map[string]string{"method": loginMethodMagicLink}}, types.ErrInvalidMagicLink)
+		return "", "", types.ErrInvalidMagicLink
+	}
+	return s.emailLogin(ctx, link.UserID, loginMethodMagicLink)
+}
+
+// emailLogin signs in a user who proved control of their email address with a passwordless method,
+// issuing tokens like Login. The login is counted and recorded like password logins, and the address
+// becomes verified.
+func (s *AuthService) emailLogin(ctx context.Context, userID uuid.UUID, method string) (string, string, error) {
+	event := &models.AuditEvent{Type: models.AuditLoginSucceeded, SubjectID: userID.String(), Metadata: map[string]string{"method": method}}
+
+	accessToken, refreshToken, err := s.IssueTokens(ctx, userID)
+	if err != nil {
+		s.failLogin(ctx, event, err)
+		return "", "", err
+	}
+	metrics.Logins.WithLabelValues(metrics.ResultSuccess).Inc()
+	event.ActorID = event.SubjectID
+	s.Audit.Record(ctx, event)
+
+	verified, err := s.UserRepo.MarkEmailVerified(ctx, userID.String())
+	if err != nil {
+		utils.LoggerFromContext(ctx).WarnContext(ctx, "failed to mark email as verified", "user_id", userID, "error", err)
+	} else if verified {
+		s.Webhooks.PublishUserChange(ctx, models.WebhookUserEmailVerified, userID.String(), "")
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// failLogin counts a failed login and records it in the audit log with the reason of err
+func (s *AuthService) failLogin(ctx context.Context, event *models.AuditEvent, err error) {
+	metrics.Logins.WithLabelValues(metrics.ResultFailure).Inc()
+	event.Type = models.AuditLoginFailed
+	var domainErr *types.Error
+	if errors.As(err, &domainErr) {
+		event.Metadata["reason"] = domainErr.Reason
+	}
+	s.Audit.Record(ctx, event)
+}
+
 // RefreshAccessToken generates a new AccessToken and RefreshToken
-func (s *AuthService) RefreshAccessToken(refreshToken string) (string, string, error) {
-	tokenData, err := s.RefreshTokenRepo.FindRefreshToken(refreshToken)
-	if err != nil || tokenData.ExpiresAt.Before(time.Now()) {
-		return "", "", errors.New("invalid or expired refresh token")
+func (s *AuthService) RefreshAccessToken(ctx context.Context, refreshToken string) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RefreshAccessToken")
+	defer span.End()
+
+	return s.refreshTokens(ctx, refreshToken, tokenGrant{}, defaultLifetimes)
+}
+
+// refreshTokens rotates a refresh token. Refresh tokens issued to an OAuth client are only accepted from
+// that client, and those of the user's own sessions only outside of OAuth.
+func (s *AuthService) refreshTokens(ctx context.Context, refreshToken string, grant tokenGrant, lifetimes tokenLifetimes) (string, string, error) {
+	tokenData, err := s.RefreshTokenRepo.FindRefreshToken(ctx, refreshToken)
+	if err != nil || tokenData.ExpiresAt.Before(time.Now()) || tokenData.ClientID != grant.storedClientID() {
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultFailure).Inc()
+		return "", "", types.ErrInvalidRefreshToken
 	}
 
-	accessToken, err := utils.GenerateJWT(tokenData.UserID.String())
+	// Tokens scoped to an organization stop refreshing once the user leaves it, and no tokens
+	// refresh once the account is no longer active
+	claims, err := s.userClaims(ctx, tokenData.UserID, tokenData.OrgID)
+	if errors.Is(err, types.ErrAccountSuspended) || errors.Is(err, types.ErrAccountPending) {
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultFailure).Inc()
+		return "", "", err
+	}
+	if errors.Is(err, types.ErrNotMember) || errors.Is(err, types.ErrUserNotFound) {
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultFailure).Inc()
+		return "", "", types.ErrInvalidRefreshToken
+	}
 	if err != nil {
-		return "", "", errors.New("failed to generate access token")
+		return "", "", err
 	}
+	// A client's grant is narrowed to its scope again, from the permissions the user holds now
+	tokenGrant{clientID: tokenData.ClientID.String, scope: tokenData.Scope}.apply(&claims)
 
-	newRefreshToken, err := utils.GenerateRefreshToken()
+	accessToken, newRefreshToken, err := generateTokens(ctx, claims, lifetimes.access)
 	if err != nil {
-		return "", "", errors.New("failed to generate refresh token")
+		return "", "", err
 	}
 
-	err = s.RefreshTokenRepo.UpdateRefreshToken(tokenData.UserID, newRefreshToken, time.Now().Add(7*24*time.Hour))
+	err = s.RefreshTokenRepo.UpdateRefreshToken(ctx, tokenData.ID, newRefreshToken, time.Now().Add(lifetimes.refresh))
 	if err != nil {
-		return "", "", errors.New("failed to update refresh token")
+		return "", "", types.ErrInternalError.WithMessage("failed to update refresh token").Wrap(err)
 	}
 
+	metrics.TokenRefreshes.WithLabelValues(metrics.ResultSuccess).Inc()
+	s.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditTokenRefreshed, ActorID: claims.UserID, SubjectID: claims.UserID})
 	return accessToken, newRefreshToken, nil
 }
 
 // GetUserByEmail retrieves a user by their email
 func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetUserByEmail")
+	defer span.End()
+
 	user, err := s.UserRepo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return nil, err
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, types.ErrUserNotFound
 	}
 	return user, nil
 }
 
 // GetUserByUUID retrieves a user by their UUID
-func (s *AuthService) GetUserByUUID(ctx context.Context, uuid string) (*models.User, error) {
-	user, err := s.UserRepo.GetUserByUUID(ctx, uuid)
+func (s *AuthService) GetUserByUUID(ctx context.Context, id string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetUserByUUID")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, types.ErrInvalidIdentifier.WithMessage("identifier is not a valid UUID")
+	}
+
+	user, err := s.UserRepo.GetUserByUUID(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, types.ErrUserNotFound
 	}
 	return user, nil
 }
 
 // GetUserByUsername retrieves a user by their username
 func (s *AuthService) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetUserByUsername")
+	defer span.End()
+
 	user, err := s.UserRepo.GetUserByUsername(ctx, username)
 	if err != nil {
-		return nil, err
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, types.ErrUserNotFound
 	}
 	return user, nil
 }
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestMagicLinkToUnknownAddress(t *testing.T) {
+	env := newTestEnv(t)
+
+	message, err := env.oauth.AuthService.RequestMagicLink(context.Background(), "nobody@example.com", "")
+	if err != nil || message != magicLinkSent {
+		t.Errorf("RequestMagicLink = %q, %v, want the response for registered addresses", message, err)
+	}
+	if saved := env.db.calls("INSERT INTO password_reset_tokens"); len(saved) != 0 {
+		t.Errorf("saved %d tokens, want none for an address without an account", len(saved))
+	}
+}
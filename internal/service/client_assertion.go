@@ -0,0 +1,69 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+)
+
+// ClientAssertionType is the client_assertion_type of private_key_jwt authentication (RFC 7523)
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// maxAssertionLifetime bounds how far in the future a client assertion may expire,
+// which also bounds how long its jti must be remembered
+const maxAssertionLifetime = 10 * time.Minute
+
+// assertionClientID returns the unverified issuer of a client assertion, so the
+// client can be looked up before its signature is checked
+func assertionClientID(assertion string) string {
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, &claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+// verifyClientAssertion checks a private_key_jwt assertion against the client's registered key.
+// The issuer and subject must be the client and the audience one of the given values.
+func verifyClientAssertion(assertion string, client *models.OAuthClient, audiences []string) (*jwt.RegisteredClaims, error) {
+	key, err := utils.ParsePublicKeyPEM(client.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []string
+	switch key.(type) {
+	case *rsa.PublicKey:
+		methods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	case *ecdsa.PublicKey:
+		methods = []string{"ES256", "ES384", "ES512"}
+	case ed25519.PublicKey:
+		methods = []string{"EdDSA"}
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err = jwt.ParseWithClaims(assertion, &claims, func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods(methods), jwt.WithExpirationRequired(), jwt.WithIssuer(client.ID), jwt.WithSubject(client.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(audiences, aud) }) {
+		return nil, errors.New("assertion audience does not match this server")
+	}
+	if claims.ID == "" {
+		return nil, errors.New("assertion has no jti")
+	}
+	if claims.ExpiresAt.After(time.Now().Add(maxAssertionLifetime)) {
+		return nil, errors.New("assertion expires too far in the future")
+	}
+	return &claims, nil
+}
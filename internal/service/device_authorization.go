@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 // Seconds a device waits between polls, unless told to slow down
+	// maxDeviceSignInAttempts is how many sign-ins may fail on the verification page before the
+	// device is denied
+	maxDeviceSignInAttempts = 5
+
+	// userCodeAlphabet leaves out vowels, so codes do not spell words, and characters that are
+	// easily confused
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// DeviceAuthorizationResponse is what a device shows the user, and how it polls for tokens
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string
+	UserCode                string // Formatted as XXXX-XXXX
+	VerificationURI         string
+	VerificationURIComplete string // VerificationURI with the user code filled in
+	ExpiresIn               int64
+	Interval                int64
+}
+
+// StartDeviceAuthorization begins the device authorization grant for a client: it issues a device
+// code the client polls the token endpoint with, and a short user code the user enters on the
+// verification page to approve the request
+func (s *OAuthService) StartDeviceAuthorization(ctx context.Context, client *models.OAuthClient, scope string) (*DeviceAuthorizationResponse, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.StartDeviceAuthorization")
+	defer span.End()
+
+	if !client.AllowsGrant(models.GrantDeviceCode) {
+		return nil, types.ErrUnauthorizedClient
+	}
+	scopes := strings.Fields(scope)
+	if !client.AllowsScopes(scopes) {
+		return nil, types.ErrInvalidScope
+	}
+
+	deviceCode, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to generate device code").Wrap(err)
+	}
+	now := time.Now()
+	auth := &models.DeviceAuthorization{
+		DeviceCodeHash: utils.HashToken(deviceCode),
+		ClientID:       client.ID,
+		Scope:          strings.Join(scopes, " "),
+		Status:         models.DeviceAuthorizationPending,
+		Interval:       devicePollInterval,
+		ExpiresAt:      now.Add(deviceCodeTTL),
+		CreatedAt:      now,
+	}
+
+	// User codes are short, so a new one can collide with a pending one now and then
+	var userCode string
+	for attempt := 0; ; attempt++ {
+		if userCode, err = generateUserCode(); err != nil {
+			return nil, types.ErrInternalError.WithMessage("failed to generate user code").Wrap(err)
+		}
+		auth.UserCodeHash = utils.HashToken(userCode)
+		created, err := s.DeviceRepo.CreateDeviceAuthorization(ctx, auth)
+		if err != nil {
+			return nil, types.ErrInternalError.WithMessage("failed to save device authorization").Wrap(err)
+		}
+		if created {
+			break
+		}
+		if attempt == 2 {
+			return nil, types.ErrInternalError.WithMessage("failed to generate a unique user code")
+		}
+	}
+
+	formatted := userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatted,
+		VerificationURI:         s.Issuer + DevicePath,
+		VerificationURIComplete: s.Issuer + DevicePath + "?" + url.Values{"user_code": {formatted}}.Encode(),
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+// LookupDeviceAuthorization returns the pending device authorization of a user code and its
+// client, for the verification page to show what the user is approving
+func (s *OAuthService) LookupDeviceAuthorization(ctx context.Context, userCode string) (*models.DeviceAuthorization, *models.OAuthClient, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.LookupDeviceAuthorization")
+	defer span.End()
+
+	code, ok := normalizeUserCode(userCode)
+	if !ok {
+		return nil, nil, types.ErrInvalidUserCode
+	}
+	auth, err := s.DeviceRepo.GetByUserCode(ctx, utils.HashToken(code))
+	if err != nil {
+		return nil, nil, types.ErrInternalError.WithMessage("failed to load device authorization").Wrap(err)
+	}
+	if auth == nil || auth.Status != models.DeviceAuthorizationPending || time.Now().After(auth.ExpiresAt) {
+		return nil, nil, types.ErrInvalidUserCode
+	}
+	client, err := s.lookupClient(ctx, auth.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth, client, nil
+}
+
+// ApproveDevice authenticates the user and lets the device with the user code obtain tokens for them
+func (s *OAuthService) ApproveDevice(ctx context.Context, userCode, email, password string) error {
+	ctx, span := tracer.Start(ctx, "OAuthService.ApproveDevice")
+	defer span.End()
+
+	return s.decideDevice(ctx, userCode, email, password, models.DeviceAuthorizationApproved)
+}
+
+// DenyDevice authenticates the user and refuses the device with the user code, which then stops
+// polling. Signing in keeps anyone who merely sees the code from cancelling the user's login.
+func (s *OAuthService) DenyDevice(ctx context.Context, userCode, email, password string) error {
+	ctx, span := tracer.Start(ctx, "OAuthService.DenyDevice")
+	defer span.End()
+
+	return s.decideDevice(ctx, userCode, email, password, models.DeviceAuthorizationDenied)
+}
+
+// decideDevice records the decision of the user signing in with email and password on the device
+// with the user code. Wrong passwords count against the device, which is denied after
+// maxDeviceSignInAttempts of them.
+func (s *OAuthService) decideDevice(ctx context.Context, userCode, email, password, status string) error {
+	if _, _, err := s.LookupDeviceAuthorization(ctx, userCode); err != nil {
+		return err
+	}
+	code, _ := normalizeUserCode(userCode)
+	userCodeHash := utils.HashToken(code)
+
+	user, err := s.AuthService.Authenticate(ctx, email, password)
+	if errors.Is(err, types.ErrInvalidCredentials) {
+		if err := s.DeviceRepo.RecordFailedSignIn(ctx, userCodeHash, maxDeviceSignInAttempts); err != nil {
+			return types.ErrInternalError.WithMessage("failed to record the failed sign-in").Wrap(err)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	decided, err := s.DeviceRepo.Decide(ctx, userCodeHash, status,
+		uuid.NullUUID{UUID: user.ID, Valid: true}, sql.NullTime{Time: now, Valid: true}, now)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to record the decision on the device").Wrap(err)
+	}
+	if !decided {
+		return types.ErrInvalidUserCode
+	}
+	return nil
+}
+
+// DeviceCodeGrant exchanges the device code of an approved device authorization for tokens. Until
+// the user decides it fails with types.ErrAuthorizationPending, or types.ErrSlowDown when the
+// client polls faster than the interval it was given.
+func (s *OAuthService) DeviceCodeGrant(ctx context.Context, client *models.OAuthClient, deviceCode string) (*TokenResponse, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.DeviceCodeGrant")
+	defer span.End()
+
+	if !client.AllowsGrant(models.GrantDeviceCode) {
+		return nil, types.ErrUnauthorizedClient
+	}
+	if deviceCode == "" {
+		return nil, types.ErrInvalidRequest.WithMessage("device_code is required")
+	}
+
+	deviceCodeHash := utils.HashToken(deviceCode)
+	auth, tooFast, err := s.DeviceRepo.Poll(ctx, deviceCodeHash, time.Now())
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load device authorization").Wrap(err)
+	}
+	if auth == nil || auth.ClientID != client.ID {
+		return nil, types.ErrInvalidGrant
+	}
+	if time.Now().After(auth.ExpiresAt) {
+		return nil, types.ErrExpiredDeviceCode
+	}
+	switch auth.Status {
+	case models.DeviceAuthorizationDenied:
+		return nil, types.ErrAccessDenied
+	case models.DeviceAuthorizationPending:
+		if tooFast {
+			return nil, types.ErrSlowDown
+		}
+		return nil, types.ErrAuthorizationPending
+	}
+
+	consumed, err := s.DeviceRepo.ConsumeApproved(ctx, deviceCodeHash)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to consume device authorization").Wrap(err)
+	}
+	if !consumed {
+		return nil, types.ErrInvalidGrant // Exchanged by a concurrent poll
+	}
+
+	lifetimes := clientLifetimes(client)
+	resp := &TokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int64(lifetimes.access.Seconds()),
+		Scope:     auth.Scope,
+	}
+	if client.AllowsGrant(models.GrantRefreshToken) {
+		resp.AccessToken, resp.RefreshToken, err = s.AuthService.issueTokens(ctx, auth.UserID.UUID, uuid.NullUUID{}, tokenGrant{clientID: client.ID, scope: auth.Scope}, lifetimes)
+	} else {
+		resp.AccessToken, err = s.AuthService.issueAccessToken(ctx, auth.UserID.UUID, tokenGrant{clientID: client.ID, scope: auth.Scope}, lifetimes.access)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(strings.Fields(auth.Scope), ScopeOpenID) {
+		resp.IDToken, err = s.issueIDToken(ctx, client, &models.AuthorizationCode{
+			ClientID: client.ID,
+			UserID:   auth.UserID.UUID,
+			Scope:    auth.Scope,
+			AuthTime: auth.AuthTime.Time,
+			AMR:      []string{"pwd"},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// generateUserCode returns a random code of userCodeLength characters from userCodeAlphabet
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode turns a user code as typed into its canonical form, ignoring case, spaces and
+// dashes, and reports whether it is well formed
+func normalizeUserCode(userCode string) (string, bool) {
+	code := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(code) != userCodeLength {
+		return "", false
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(userCodeAlphabet, c) {
+			return "", false
+		}
+	}
+	return code, true
+}
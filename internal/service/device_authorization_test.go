@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const deviceTestPassword = "correct horse battery staple"
+
+var deviceTestClient = &models.OAuthClient{
+	ID:         "cli",
+	GrantTypes: []string{models.GrantDeviceCode},
+	Scopes:     []string{"email", "profile"},
+}
+
+// deviceTest runs the device authorization a client started, kept in memory. Handlers apply what
+// the statements set to it and return it by its device or user code; whether a poll came too soon
+// is scripted with tooFast, since the SQL of the repository works that out.
+type deviceTest struct {
+	*testEnv
+	user *models.User
+
+	mu            sync.Mutex
+	current       *models.DeviceAuthorization
+	failedSignIns int
+	tooFast       bool
+}
+
+func newDeviceTest(t *testing.T) *deviceTest {
+	dt := &deviceTest{testEnv: newTestEnv(t)}
+	dt.user = dt.addUser("jane", deviceTestPassword)
+	dt.addClient(deviceTestClient)
+
+	dt.db.on("INSERT INTO device_authorizations", func(args []driver.Value) fakeResult {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		dt.current = &models.DeviceAuthorization{
+			DeviceCodeHash: args[0].(string),
+			UserCodeHash:   args[1].(string),
+			ClientID:       args[2].(string),
+			Scope:          args[3].(string),
+			Status:         args[4].(string),
+			Interval:       args[7].(int),
+			ExpiresAt:      args[9].(time.Time),
+			CreatedAt:      args[10].(time.Time),
+		}
+		return fakeResult{affected: 1}
+	})
+	dt.db.on("FROM device_authorizations WHERE user_code_hash = $1", func(args []driver.Value) fakeResult {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		if dt.current == nil || dt.current.UserCodeHash != args[0] {
+			return fakeResult{}
+		}
+		return fakeResult{rows: [][]driver.Value{deviceAuthorizationRow(dt.current)}}
+	})
+	dt.db.on("UPDATE device_authorizations SET status = $2", func(args []driver.Value) fakeResult {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		if dt.current == nil || dt.current.UserCodeHash != args[0] {
+			return fakeResult{}
+		}
+		dt.current.Status = args[1].(string)
+		if userID, ok := args[2].(string); ok {
+			dt.current.UserID = uuid.NullUUID{UUID: uuid.MustParse(userID), Valid: true}
+		}
+		if authTime, ok := args[3].(time.Time); ok {
+			dt.current.AuthTime = sql.NullTime{Time: authTime, Valid: true}
+		}
+		return fakeResult{affected: 1}
+	})
+	dt.db.on("UPDATE device_authorizations SET failed_attempts", func(args []driver.Value) fakeResult {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		if dt.current == nil || dt.current.UserCodeHash != args[0] || dt.current.Status != args[1] {
+			return fakeResult{}
+		}
+		dt.failedSignIns++
+		if dt.failedSignIns >= args[2].(int) {
+			dt.current.Status = args[3].(string)
+		}
+		return fakeResult{affected: 1}
+	})
+	dt.db.on("WITH polled AS", func(args []driver.Value) fakeResult {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		if dt.current == nil || dt.current.DeviceCodeHash != args[0] {
+			return fakeResult{}
+		}
+		dt.current.LastPolledAt = sql.NullTime{Time: args[1].(time.Time), Valid: true}
+		return fakeResult{rows: [][]driver.Value{append(deviceAuthorizationRow(dt.current), dt.tooFast)}}
+	})
+	dt.db.on("DELETE FROM device_authorizations WHERE device_code_hash = $1 AND status = $2", func(args []driver.Value) fakeResult {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		if dt.current == nil || dt.current.DeviceCodeHash != args[0] {
+			return fakeResult{}
+		}
+		dt.current = nil
+		return fakeResult{affected: 1}
+	})
+	return dt
+}
+
+func deviceAuthorizationRow(auth *models.DeviceAuthorization) []driver.Value {
+	var userID, authTime, lastPolledAt driver.Value
+	if auth.UserID.Valid {
+		userID = auth.UserID.UUID.String()
+	}
+	if auth.AuthTime.Valid {
+		authTime = auth.AuthTime.Time
+	}
+	if auth.LastPolledAt.Valid {
+		lastPolledAt = auth.LastPolledAt.Time
+	}
+	return []driver.Value{auth.DeviceCodeHash, auth.UserCodeHash, auth.ClientID, auth.Scope, auth.Status, userID,
+		authTime, int64(auth.Interval), lastPolledAt, auth.ExpiresAt, auth.CreatedAt}
+}
+
+// start begins a device authorization for deviceTestClient
+func (dt *deviceTest) start() *DeviceAuthorizationResponse {
+	dt.t.Helper()
+	resp, err := dt.oauth.StartDeviceAuthorization(context.Background(), deviceTestClient, "email")
+	if err != nil {
+		dt.t.Fatal(err)
+	}
+	return resp
+}
+
+func (dt *deviceTest) poll(deviceCode string) (*TokenResponse, error) {
+	return dt.oauth.DeviceCodeGrant(context.Background(), deviceTestClient, deviceCode)
+}
+
+func TestDeviceCodeGrantPolling(t *testing.T) {
+	dt := newDeviceTest(t)
+	resp := dt.start()
+	if !strings.HasSuffix(resp.VerificationURIComplete, "user_code="+resp.UserCode) || resp.Interval != devicePollInterval {
+		t.Errorf("device authorization = %+v", *resp)
+	}
+
+	start := time.Now()
+	if _, err := dt.poll(resp.DeviceCode); !errors.Is(err, types.ErrAuthorizationPending) {
+		t.Errorf("first poll: error = %v, want %v", err, types.ErrAuthorizationPending)
+	}
+	polls := dt.db.calls("WITH polled AS")
+	if len(polls) != 1 || polls[0][0] != utils.HashToken(resp.DeviceCode) || polls[0][1].(time.Time).Before(start) {
+		t.Errorf("polls = %v, want one of the device code at the time of the request", polls)
+	}
+	dt.tooFast = true
+	if _, err := dt.poll(resp.DeviceCode); !errors.Is(err, types.ErrSlowDown) {
+		t.Errorf("poll sooner than the interval: error = %v, want %v", err, types.ErrSlowDown)
+	}
+	dt.tooFast = false
+
+	// Users may type the code in lower case and without the dash
+	typed := strings.ToLower(strings.ReplaceAll(resp.UserCode, "-", " "))
+	if err := dt.oauth.ApproveDevice(context.Background(), typed, dt.user.Email, deviceTestPassword); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := dt.poll(resp.DeviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.ValidateJWT(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != dt.user.ID.String() || claims.ClientID != deviceTestClient.ID || claims.Scope != "email" || tokens.RefreshToken != "" {
+		t.Errorf("tokens = %+v with claims %+v, want an access token for the user, client and scope only", *tokens, *claims)
+	}
+
+	if _, err := dt.poll(resp.DeviceCode); !errors.Is(err, types.ErrInvalidGrant) {
+		t.Errorf("poll after the exchange: error = %v, want %v", err, types.ErrInvalidGrant)
+	}
+}
+
+func TestDeviceCodeGrantDenied(t *testing.T) {
+	dt := newDeviceTest(t)
+	resp := dt.start()
+
+	if err := dt.oauth.DenyDevice(context.Background(), resp.UserCode, dt.user.Email, deviceTestPassword); err != nil {
+		t.Fatal(err)
+	}
+	if dt.current.UserID.UUID != dt.user.ID {
+		t.Errorf("denied by %v, want the signed-in user", dt.current.UserID)
+	}
+	if _, err := dt.poll(resp.DeviceCode); !errors.Is(err, types.ErrAccessDenied) {
+		t.Errorf("error = %v, want %v", err, types.ErrAccessDenied)
+	}
+	if err := dt.oauth.ApproveDevice(context.Background(), resp.UserCode, dt.user.Email, deviceTestPassword); !errors.Is(err, types.ErrInvalidUserCode) {
+		t.Errorf("approval after denial: error = %v, want %v", err, types.ErrInvalidUserCode)
+	}
+}
+
+func TestApproveDeviceRequiresPassword(t *testing.T) {
+	dt := newDeviceTest(t)
+	resp := dt.start()
+
+	if err := dt.oauth.ApproveDevice(context.Background(), resp.UserCode, dt.user.Email, "wrong"); !errors.Is(err, types.ErrInvalidCredentials) {
+		t.Errorf("error = %v, want %v", err, types.ErrInvalidCredentials)
+	}
+	if status := dt.current.Status; status != models.DeviceAuthorizationPending {
+		t.Errorf("status = %q, want the device still pending", status)
+	}
+}
+
+func TestDenyDeviceRequiresPassword(t *testing.T) {
+	dt := newDeviceTest(t)
+	resp := dt.start()
+
+	if err := dt.oauth.DenyDevice(context.Background(), resp.UserCode, dt.user.Email, "wrong"); !errors.Is(err, types.ErrInvalidCredentials) {
+		t.Errorf("error = %v, want %v", err, types.ErrInvalidCredentials)
+	}
+	if status := dt.current.Status; status != models.DeviceAuthorizationPending {
+		t.Errorf("status = %q, want the device still pending", status)
+	}
+}
+
+func TestDeviceDeniedAfterFailedSignIns(t *testing.T) {
+	dt := newDeviceTest(t)
+	resp := dt.start()
+
+	for i := 0; i < maxDeviceSignInAttempts; i++ {
+		if err := dt.oauth.ApproveDevice(context.Background(), resp.UserCode, dt.user.Email, "wrong"); !errors.Is(err, types.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: error = %v, want %v", i+1, err, types.ErrInvalidCredentials)
+		}
+	}
+	failed := dt.db.calls("UPDATE device_authorizations SET failed_attempts")
+	if len(failed) != maxDeviceSignInAttempts || failed[0][0] != utils.HashToken(strings.ReplaceAll(resp.UserCode, "-", "")) {
+		t.Errorf("failed sign-ins recorded = %v, want one for the user code per wrong password", failed)
+	}
+	if err := dt.oauth.ApproveDevice(context.Background(), resp.UserCode, dt.user.Email, deviceTestPassword); !errors.Is(err, types.ErrInvalidUserCode) {
+		t.Errorf("approval after too many failed sign-ins: error = %v, want %v", err, types.ErrInvalidUserCode)
+	}
+	if _, err := dt.poll(resp.DeviceCode); !errors.Is(err, types.ErrAccessDenied) {
+		t.Errorf("poll: error = %v, want %v", err, types.ErrAccessDenied)
+	}
+}
+
+func TestDeviceCodeGrantRejects(t *testing.T) {
+	dt := newDeviceTest(t)
+	resp := dt.start()
+
+	other := *deviceTestClient
+	other.ID = "other"
+	if _, err := dt.oauth.DeviceCodeGrant(context.Background(), &other, resp.DeviceCode); !errors.Is(err, types.ErrInvalidGrant) {
+		t.Errorf("other client: error = %v, want %v", err, types.ErrInvalidGrant)
+	}
+	if _, err := dt.poll("unknown"); !errors.Is(err, types.ErrInvalidGrant) {
+		t.Errorf("unknown device code: error = %v, want %v", err, types.ErrInvalidGrant)
+	}
+
+	withoutGrant := *deviceTestClient
+	withoutGrant.GrantTypes = []string{models.GrantAuthorizationCode}
+	if _, err := dt.oauth.DeviceCodeGrant(context.Background(), &withoutGrant, resp.DeviceCode); !errors.Is(err, types.ErrUnauthorizedClient) {
+		t.Errorf("client without the grant: error = %v, want %v", err, types.ErrUnauthorizedClient)
+	}
+
+	dt.current.ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := dt.poll(resp.DeviceCode); !errors.Is(err, types.ErrExpiredDeviceCode) {
+		t.Errorf("expired device code: error = %v, want %v", err, types.ErrExpiredDeviceCode)
+	}
+	if err := dt.oauth.ApproveDevice(context.Background(), resp.UserCode, dt.user.Email, deviceTestPassword); !errors.Is(err, types.ErrInvalidUserCode) {
+		t.Errorf("approval of an expired device: error = %v, want %v", err, types.ErrInvalidUserCode)
+	}
+}
+
+func TestUserCodes(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := generateUserCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if normalized, ok := normalizeUserCode(code[:4] + "-" + code[4:]); !ok || normalized != code {
+			t.Fatalf("generated code %q does not survive formatting: %q, %v", code, normalized, ok)
+		}
+	}
+
+	tests := []struct {
+		typed string
+		want  string
+		ok    bool
+	}{
+		{"BCDF-GHJK", "BCDFGHJK", true},
+		{" bcdf ghjk ", "BCDFGHJK", true},
+		{"bcdfghjk", "BCDFGHJK", true},
+		{"BCDF-GHJ", "", false},
+		{"BCDF-GHJKL", "", false},
+		{"ABCD-EFGH", "", false}, // Vowels are not in the alphabet
+		{"BCD0-GHJK", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := normalizeUserCode(tt.typed); got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeUserCode(%q) = %q, %v, want %q, %v", tt.typed, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDeviceTokensCarryNoAdminPermissions(t *testing.T) {
+	dt := newDeviceTest(t)
+	admin := dt.addAdmin("root", deviceTestPassword)
+	resp := dt.start()
+
+	if err := dt.oauth.ApproveDevice(context.Background(), resp.UserCode, admin.Email, deviceTestPassword); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := dt.poll(resp.DeviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.ValidateJWT(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != admin.ID.String() || len(claims.Roles) != 0 || len(claims.Permissions) != 0 {
+		t.Errorf("access token claims = %+v, want the approving admin without roles or permissions", *claims)
+	}
+}
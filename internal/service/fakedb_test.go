@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/lib/pq"
+)
+
+// fakeDB is a database/sql driver that answers each statement with the first handler whose SQL
+// fragment the statement contains. It lets services run against their real repositories without
+// Postgres. Handlers return what a test scripts, not what the SQL would: the conditions in the
+// SQL are tested against Postgres by the integration tests of the repositories, so here they
+// only need the outcomes the service must handle.
+type fakeDB struct {
+	t          testing.TB
+	mu         sync.Mutex
+	handlers   []fakeHandler
+	statements []fakeStatement
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeHandler struct {
+	fragment string
+	fn       func(args []driver.Value) fakeResult
+}
+
+// fakeResult is the outcome of a statement: rows for queries, a row count for other statements
+type fakeResult struct {
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// newFakeDB returns a fake database and a *sql.DB connected to it, closed when the test ends
+func newFakeDB(t testing.TB) (*fakeDB, *sql.DB) {
+	db := &fakeDB{t: t}
+	sqlDB := sql.OpenDB(db)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db, sqlDB
+}
+
+// on answers statements containing fragment, compared with whitespace collapsed, with fn.
+// Handlers registered first take precedence.
+func (db *fakeDB) on(fragment string, fn func(args []driver.Value) fakeResult) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.handlers = append(db.handlers, fakeHandler{fragment: strings.Join(strings.Fields(fragment), " "), fn: fn})
+}
+
+func (db *fakeDB) run(query string, named []driver.NamedValue) fakeResult {
+	query = strings.Join(strings.Fields(query), " ")
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	db.mu.Lock()
+	db.statements = append(db.statements, fakeStatement{query: query, args: args})
+	var fn func(args []driver.Value) fakeResult
+	for _, h := range db.handlers {
+		if strings.Contains(query, h.fragment) {
+			fn = h.fn
+			break
+		}
+	}
+	db.mu.Unlock()
+
+	if fn == nil {
+		db.t.Errorf("unexpected statement: %s", query)
+		return fakeResult{err: errors.New("fakedb: unexpected statement")}
+	}
+	return fn(args)
+}
+
+// calls returns the arguments of each statement run so far that contains fragment, oldest first
+func (db *fakeDB) calls(fragment string) [][]driver.Value {
+	fragment = strings.Join(strings.Fields(fragment), " ")
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var calls [][]driver.Value
+	for _, stmt := range db.statements {
+		if strings.Contains(stmt.query, fragment) {
+			calls = append(calls, stmt.args)
+		}
+	}
+	return calls
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return db }
+func (db *fakeDB) Open(string) (driver.Conn, error)             { return fakeConn{db}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+// CheckNamedValue passes arguments through as they are, after resolving driver.Valuer implementations
+// such as uuid.UUID and pq.Array, so handlers see what the application passed
+func (c fakeConn) CheckNamedValue(arg *driver.NamedValue) error {
+	if valuer, ok := arg.Value.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		arg.Value = value
+	}
+	return nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result := c.db.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return driver.RowsAffected(result.affected), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result := c.db.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeRows{rows: result.rows}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// testEnv wires the services to their repositories over one fakeDB, and answers the statements
+// most tests need the same way: lookups of users, their roles and OAuth clients from the ones
+// added to the environment, the audit log, and webhook deliveries, which have no subscriptions.
+// Tests register handlers of their own for the statements of the feature they test.
+type testEnv struct {
+	t          *testing.T
+	db         *fakeDB
+	sqlDB      *sql.DB
+	oauth      *OAuthService
+	loginCodes *LoginCodeService
+	audit      *fakeAuditLog
+
+	mu          sync.Mutex
+	users       []*models.User
+	permissions map[uuid.UUID][]string // Of the users with the admin role
+	clients     []*models.OAuthClient
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	db, sqlDB := newFakeDB(t)
+	env := &testEnv{t: t, db: db, sqlDB: sqlDB, audit: newFakeAuditLog(db), permissions: map[uuid.UUID][]string{}}
+
+	db.on("FROM users WHERE id = $1", func(args []driver.Value) fakeResult {
+		return env.userRows(func(user *models.User) bool { return user.ID.String() == args[0] })
+	})
+	db.on("FROM users WHERE email = $1 AND org_id IS NULL", func(args []driver.Value) fakeResult {
+		return env.userRows(func(user *models.User) bool { return user.Email == args[0] && !user.OrgID.Valid })
+	})
+	db.on("FROM user_roles ur", func(args []driver.Value) fakeResult {
+		env.mu.Lock()
+		defer env.mu.Unlock()
+		roles, permissions := []string{}, env.permissions[uuid.MustParse(args[0].(string))]
+		if permissions != nil {
+			roles = []string{"admin"}
+		}
+		return fakeResult{rows: [][]driver.Value{{textArray(roles), textArray(permissions)}}}
+	})
+	db.on("FROM oauth_clients WHERE client_id = $1", func(args []driver.Value) fakeResult {
+		env.mu.Lock()
+		defer env.mu.Unlock()
+		for _, client := range env.clients {
+			if client.ID == args[0] {
+				return fakeResult{rows: [][]driver.Value{oauthClientRow(client)}}
+			}
+		}
+		return fakeResult{}
+	})
+	db.on("INSERT INTO webhook_deliveries", func([]driver.Value) fakeResult { return fakeResult{} })
+
+	userRepo := repositories.NewUserRepository(sqlDB)
+	audit := NewAuditService(repositories.NewAuditRepository(sqlDB))
+	webhooks := NewWebhookService(repositories.NewWebhookRepository(sqlDB), userRepo)
+	authService := NewAuthService(userRepo, repositories.NewRefreshTokenRepository(sqlDB),
+		repositories.NewPasswordResetTokenRepository(sqlDB), repositories.NewRoleRepository(sqlDB), audit, webhooks)
+	env.oauth = NewOAuthService(authService, repositories.NewOAuthClientRepository(sqlDB),
+		repositories.NewAuthorizationCodeRepository(sqlDB), repositories.NewClientAssertionRepository(sqlDB),
+		repositories.NewDeviceAuthorizationRepository(sqlDB), nil, "https://auth.example.com")
+	env.loginCodes = NewLoginCodeService(authService, repositories.NewLoginCodeRepository(sqlDB))
+	return env
+}
+
+// addUser adds an active user with the given password, which may be empty
+func (env *testEnv) addUser(username, password string) *models.User {
+	env.t.Helper()
+	user := &models.User{ID: uuid.New(), Username: username, Email: username + "@example.com", EmailVerified: true, Status: models.UserStatusActive}
+	if password != "" {
+		var err error
+		if user.Password, err = utils.HashPassword(password); err != nil {
+			env.t.Fatal(err)
+		}
+	}
+	env.insertUser(user)
+	return user
+}
+
+// addAdmin adds an active user holding the admin role, which grants every permission
+func (env *testEnv) addAdmin(username, password string) *models.User {
+	user := env.addUser(username, password)
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.permissions[user.ID] = []string{"*"}
+	return user
+}
+
+func (env *testEnv) insertUser(user *models.User) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.users = append(env.users, user)
+}
+
+// userByEmail returns the global user with an email, or nil
+func (env *testEnv) userByEmail(email string) *models.User {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	for _, user := range env.users {
+		if user.Email == email && !user.OrgID.Valid {
+			return user
+		}
+	}
+	return nil
+}
+
+func (env *testEnv) userRows(match func(user *models.User) bool) fakeResult {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	for _, user := range env.users {
+		if match(user) {
+			return fakeResult{rows: [][]driver.Value{userRow(user)}}
+		}
+	}
+	return fakeResult{}
+}
+
+// addClient registers an OAuth client
+func (env *testEnv) addClient(client *models.OAuthClient) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.clients = append(env.clients, client)
+}
+
+// textArray returns values as Postgres returns a text array
+func textArray(values []string) driver.Value {
+	if values == nil {
+		values = []string{}
+	}
+	value, _ := pq.Array(values).Value()
+	return value
+}
+
+// userRow returns a user as selected by the user repository
+func userRow(user *models.User) []driver.Value {
+	var orgID driver.Value
+	if user.OrgID.Valid {
+		orgID = user.OrgID.UUID.String()
+	}
+	return []driver.Value{user.ID.String(), orgID, user.Username, user.Email, user.EmailVerified, user.Password,
+		user.DisplayName, user.AvatarURL, user.Status, user.StatusReason, user.CreatedAt, user.UpdatedAt}
+}
+
+// oauthClientRow returns a client as selected by the OAuth client repository
+func oauthClientRow(client *models.OAuthClient) []driver.Value {
+	return []driver.Value{client.ID, client.Name, client.SecretHash, client.PublicKey,
+		textArray(client.RedirectURIs), textArray(client.GrantTypes), textArray(client.Scopes),
+		int64(client.AccessTokenTTL.Seconds()), int64(client.RefreshTokenTTL.Seconds()), client.CreatedAt, client.UpdatedAt}
+}
+
+// fakeAuditLog keeps the audit_events table of a fakeDB in memory, in ID order
+type fakeAuditLog struct {
+	mu   sync.Mutex
+	rows [][]driver.Value // Stored columns, in the order of auditEventColumns
+
+	// beforeAppend, when set, runs once before the next append, like a concurrent writer would
+	beforeAppend func()
+}
+
+func newFakeAuditLog(db *fakeDB) *fakeAuditLog {
+	log := &fakeAuditLog{}
+	db.on("FROM audit_events ORDER BY id DESC LIMIT 1", func([]driver.Value) fakeResult {
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		if len(log.rows) == 0 {
+			return fakeResult{}
+		}
+		return fakeResult{rows: log.rows[len(log.rows)-1:]}
+	})
+	db.on("FROM audit_events WHERE id > $1 ORDER BY id ASC", func(args []driver.Value) fakeResult {
+		return log.list(args[0].(int64), args[1].(int))
+	})
+	db.on("FROM audit_events ORDER BY id ASC", func(args []driver.Value) fakeResult {
+		return log.list(0, args[0].(int))
+	})
+	db.on("INSERT INTO audit_events", func(args []driver.Value) fakeResult {
+		log.mu.Lock()
+		interfere := log.beforeAppend
+		log.beforeAppend = nil
+		log.mu.Unlock()
+		if interfere != nil {
+			interfere()
+		}
+
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		for _, row := range log.rows {
+			if row[0] == args[0] {
+				return fakeResult{err: &pq.Error{Code: "23505", Constraint: "audit_events_pkey"}}
+			}
+		}
+		log.rows = append(log.rows, slices.Clone(args))
+		return fakeResult{affected: 1}
+	})
+	return log
+}
+
+func (log *fakeAuditLog) list(afterID int64, limit int) fakeResult {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	var rows [][]driver.Value
+	for _, row := range log.rows {
+		if row[0].(int64) > afterID && len(rows) < limit {
+			rows = append(rows, row)
+		}
+	}
+	return fakeResult{rows: rows}
+}
+
+// types returns the types of the recorded events, oldest first
+func (log *fakeAuditLog) types() []string {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	var types []string
+	for _, row := range log.rows {
+		types = append(types, row[1].(string))
+	}
+	return types
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/federation"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	// federatedLoginTTL bounds how long a user may take to sign in at the upstream provider
+	federatedLoginTTL = 10 * time.Minute
+
+	maxUsernameLength    = 50
+	usernameAttempts     = 3
+	usernameSuffixLength = 6
+)
+
+type FederationService struct {
+	OAuthService *OAuthService
+	IdentityRepo *repositories.ExternalIdentityRepository
+	StateRepo    *repositories.FederatedLoginStateRepository
+	Providers    []*federation.Provider
+}
+
+func NewFederationService(
+	oauthService *OAuthService,
+	identityRepo *repositories.ExternalIdentityRepository,
+	stateRepo *repositories.FederatedLoginStateRepository,
+	providers []*federation.Provider,
+) *FederationService {
+	return &FederationService{
+		OAuthService: oauthService,
+		IdentityRepo: identityRepo,
+		StateRepo:    stateRepo,
+		Providers:    providers,
+	}
+}
+
+// Provider returns the configured provider with the given name, or nil
+func (s *FederationService) Provider(name string) *federation.Provider {
+	for _, provider := range s.Providers {
+		if provider.Name == name {
+			return provider
+		}
+	}
+	return nil
+}
+
+// StartLogin remembers a validated authorization request and returns the upstream login URL
+// the user must be sent to, along with the state that ties the callback to this browser
+func (s *FederationService) StartLogin(ctx context.Context, providerName string, req *AuthorizationRequest) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "FederationService.StartLogin")
+	defer span.End()
+
+	provider := s.Provider(providerName)
+	if provider == nil {
+		return "", "", types.ErrInvalidRequest.WithMessage("unknown identity provider")
+	}
+
+	state := utils.GenerateSecureToken(32)
+	nonce := utils.GenerateSecureToken(32)
+	codeVerifier := utils.GenerateSecureToken(48)
+
+	loginURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		utils.LoggerFromContext(ctx).ErrorContext(ctx, "identity provider unavailable", "provider", provider.Name, "error", err)
+		return "", "", types.ErrFederatedLoginFailed.WithMessage("the identity provider is unavailable").Wrap(err)
+	}
+
+	now := time.Now()
+	err = s.StateRepo.SaveState(ctx, &models.FederatedLoginState{
+		StateHash:           utils.HashToken(state),
+		Provider:            provider.Name,
+		UpstreamNonce:       nonce,
+		CodeVerifier:        codeVerifier,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           now.Add(federatedLoginTTL),
+		CreatedAt:           now,
+	})
+	if err != nil {
+		return "", "", types.ErrInternalError.WithMessage("failed to save login state").Wrap(err)
+	}
+
+	return loginURL, state, nil
+}
+
+// CompleteLogin handles the user's return from the upstream provider. It verifies the provider's
+// ID token, finds or provisions the local user and issues an authorization code for the original
+// request. The original request is returned whenever it is known, so errors can be sent to the client.
+func (s *FederationService) CompleteLogin(ctx context.Context, state, code, upstreamError string) (*AuthorizationRequest, string, error) {
+	ctx, span := tracer.Start(ctx, "FederationService.CompleteLogin")
+	defer span.End()
+
+	if state == "" {
+		return nil, "", types.ErrInvalidRequest.WithMessage("state is required")
+	}
+	login, err := s.StateRepo.ConsumeState(ctx, utils.HashToken(state))
+	if err != nil {
+		return nil, "", types.ErrInternalError.WithMessage("failed to load login state").Wrap(err)
+	}
+	if login == nil || login.ExpiresAt.Before(time.Now()) {
+		return nil, "", types.ErrInvalidRequest.WithMessage("the sign-in has expired, please start again")
+	}
+
+	req := &AuthorizationRequest{
+		ClientID:            login.ClientID,
+		RedirectURI:         login.RedirectURI,
+		ResponseType:        "code",
+		Scope:               login.Scope,
+		State:               login.State,
+		Nonce:               login.Nonce,
+		CodeChallenge:       login.CodeChallenge,
+		CodeChallengeMethod: login.CodeChallengeMethod,
+	}
+	client, err := s.OAuthService.ValidateClient(ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if upstreamError != "" {
+		if upstreamError == "access_denied" {
+			return req, "", types.ErrAccessDenied
+		}
+		return req, "", types.ErrFederatedLoginFailed.WithMessage("the identity provider returned " + upstreamError)
+	}
+	if code == "" {
+		return req, "", types.ErrFederatedLoginFailed.WithMessage("the identity provider returned no code")
+	}
+
+	provider := s.Provider(login.Provider)
+	if provider == nil {
+		return req, "", types.ErrFederatedLoginFailed.WithMessage("the identity provider is no longer configured")
+	}
+	identity, err := provider.Exchange(ctx, code, login.UpstreamNonce, login.CodeVerifier)
+	if err != nil {
+		utils.LoggerFromContext(ctx).WarnContext(ctx, "federated login rejected", "provider", provider.Name, "error", err)
+		return req, "", types.ErrFederatedLoginFailed.Wrap(err)
+	}
+
+	userID, err := s.resolveUser(ctx, identity)
+	if err != nil {
+		return req, "", err
+	}
+	s.OAuthService.AuthService.Audit.Record(ctx, &models.AuditEvent{
+		Type:      models.AuditLoginSucceeded,
+		ActorID:   userID.String(),
+		SubjectID: userID.String(),
+		Metadata:  map[string]string{"provider": provider.Name, "client_id": client.ID},
+	})
+
+	authCode, err := s.OAuthService.issueCode(ctx, client, req, userID, identity.AuthTime, identity.AMR)
+	if err != nil {
+		return req, "", err
+	}
+	return req, authCode, nil
+}
+
+// resolveUser returns the local user linked to an external identity. Unknown identities are linked to
+// the account with the same email when the provider has verified that email, and otherwise get a new account.
+func (s *FederationService) resolveUser(ctx context.Context, identity *federation.Identity) (uuid.UUID, error) {
+	linked, err := s.IdentityRepo.GetIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		return uuid.Nil, types.ErrInternalError.WithMessage("failed to load external identity").Wrap(err)
+	}
+	if linked != nil {
+		if err := s.IdentityRepo.RecordLogin(ctx, identity.Provider, identity.Subject, identity.Email); err != nil {
+			return uuid.Nil, types.ErrInternalError.WithMessage("failed to update external identity").Wrap(err)
+		}
+		return linked.UserID, nil
+	}
+
+	if identity.Email == "" {
+		return uuid.Nil, types.ErrFederatedLoginFailed.WithMessage("the identity provider did not share an email address")
+	}
+	if err := utils.ValidateEmail(identity.Email); err != nil {
+		return uuid.Nil, types.ErrFederatedLoginFailed.WithMessage("the identity provider returned an invalid email address")
+	}
+
+	existing, err := s.OAuthService.AuthService.UserRepo.GetUserByEmail(ctx, identity.Email)
+	if err != nil {
+		return uuid.Nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if existing != nil {
+		if !identity.EmailVerified {
+			return uuid.Nil, types.ErrFederatedLoginFailed.WithMessage("an account with this email already exists, sign in with your password instead")
+		}
+		now := time.Now()
+		err := s.IdentityRepo.CreateIdentity(ctx, &models.ExternalIdentity{
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			UserID:      existing.ID,
+			Email:       identity.Email,
+			CreatedAt:   now,
+			LastLoginAt: now,
+		})
+		if err != nil {
+			return uuid.Nil, types.ErrInternalError.WithMessage("failed to link external identity").Wrap(err)
+		}
+		utils.LoggerFromContext(ctx).InfoContext(ctx, "external identity linked", "provider", identity.Provider, "user_id", existing.ID)
+		return existing.ID, nil
+	}
+
+	return s.provisionUser(ctx, identity)
+}
+
+// provisionUser creates an account for a first-time federated user. The account gets an unusable
+// random password; the user can set one later through a password reset.
+func (s *FederationService) provisionUser(ctx context.Context, identity *federation.Identity) (uuid.UUID, error) {
+	hashedPassword, err := hashPassword(ctx, utils.GenerateSecureToken(32))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	base := usernameFromIdentity(identity)
+	username := base
+	for attempt := 0; ; attempt++ {
+		now := time.Now()
+		user := &models.User{
+			ID:            uuid.New(),
+			Username:      username,
+			Email:         identity.Email,
+			EmailVerified: identity.EmailVerified,
+			Password:      hashedPassword,
+			Status:        models.UserStatusActive,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		err := s.IdentityRepo.CreateUserWithIdentity(ctx, user, &models.ExternalIdentity{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+		})
+		if err == nil {
+			utils.LoggerFromContext(ctx).InfoContext(ctx, "user provisioned from external identity", "provider", identity.Provider, "user_id", user.ID)
+			s.OAuthService.AuthService.Webhooks.PublishUserEvent(ctx, models.WebhookUserCreated, user, "", false)
+			return user.ID, nil
+		}
+		if !errors.Is(err, types.ErrUsernameTaken) || attempt+1 == usernameAttempts {
+			var domainErr *types.Error
+			if errors.As(err, &domainErr) {
+				return uuid.Nil, err
+			}
+			return uuid.Nil, types.ErrInternalError.WithMessage("failed to provision user").Wrap(err)
+		}
+		username = base + "-" + strings.ToLower(utils.GenerateSecureToken(8)[:usernameSuffixLength])
+	}
+}
+
+// usernameFromIdentity derives a username from the provider's preferred username or the email's local part
+func usernameFromIdentity(identity *federation.Identity) string {
+	candidate := identity.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(identity.Email, "@")
+	}
+	username := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-') {
+			return r
+		}
+		return -1
+	}, candidate)
+	if len(username) > maxUsernameLength-usernameSuffixLength-1 {
+		username = username[:maxUsernameLength-usernameSuffixLength-1]
+	}
+	if username == "" {
+		username = "user"
+	}
+	return username
+}
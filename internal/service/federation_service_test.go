@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/federation"
+	"github.com/kraftzpepe/auth-service/internal/federation/federationtest"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/types"
+	"github.com/lib/pq"
+)
+
+var federationTestClient = &models.OAuthClient{
+	ID:           "app",
+	Name:         "App",
+	RedirectURIs: []string{"https://app.example.com/callback"},
+	GrantTypes:   []string{models.GrantAuthorizationCode},
+	Scopes:       []string{ScopeOpenID, "email"},
+}
+
+// federationTest signs users in through an upstream provider, with the external identities and
+// pending logins of the service kept in memory by their keys
+type federationTest struct {
+	*testEnv
+	svc *FederationService
+	idp *federationtest.Provider
+
+	mu            sync.Mutex
+	identities    map[string]*models.ExternalIdentity // By provider and subject
+	states        map[string][]driver.Value           // Pending logins by state hash
+	codeUsers     []string                            // Users authorization codes were issued to
+	usernameTaken string                              // Username that new users cannot have
+}
+
+func newFederationTest(t *testing.T) *federationTest {
+	ft := &federationTest{
+		testEnv:    newTestEnv(t),
+		idp:        federationtest.NewProvider(t),
+		identities: map[string]*models.ExternalIdentity{},
+		states:     map[string][]driver.Value{},
+	}
+	ft.addClient(federationTestClient)
+
+	ft.db.on("INSERT INTO federated_login_states", func(args []driver.Value) fakeResult {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		ft.states[args[0].(string)] = slices.Clone(args)
+		return fakeResult{affected: 1}
+	})
+	ft.db.on("DELETE FROM federated_login_states WHERE state_hash = $1", func(args []driver.Value) fakeResult {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		row, ok := ft.states[args[0].(string)]
+		if !ok {
+			return fakeResult{}
+		}
+		delete(ft.states, args[0].(string))
+		return fakeResult{rows: [][]driver.Value{row}}
+	})
+	ft.db.on("FROM external_identities WHERE provider = $1 AND subject = $2", func(args []driver.Value) fakeResult {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		identity, ok := ft.identities[args[0].(string)+"|"+args[1].(string)]
+		if !ok {
+			return fakeResult{}
+		}
+		return fakeResult{rows: [][]driver.Value{{identity.Provider, identity.Subject, identity.UserID.String(),
+			identity.Email, identity.CreatedAt, identity.LastLoginAt}}}
+	})
+	ft.db.on("UPDATE external_identities", func(args []driver.Value) fakeResult {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		identity := ft.identities[args[0].(string)+"|"+args[1].(string)]
+		identity.Email, identity.LastLoginAt = args[2].(string), args[3].(time.Time)
+		return fakeResult{affected: 1}
+	})
+	ft.db.on("WITH new_user AS", func(args []driver.Value) fakeResult {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		if args[1] == ft.usernameTaken {
+			return fakeResult{err: &pq.Error{Code: "23505", Constraint: "users_username_key"}}
+		}
+		user := &models.User{
+			ID:            uuid.MustParse(args[0].(string)),
+			Username:      args[1].(string),
+			Email:         args[2].(string),
+			EmailVerified: args[3].(bool),
+			Password:      args[4].(string),
+			Status:        args[9].(string),
+		}
+		ft.insertUser(user)
+		ft.identities[args[7].(string)+"|"+args[8].(string)] = &models.ExternalIdentity{
+			Provider: args[7].(string), Subject: args[8].(string), UserID: user.ID, Email: user.Email,
+		}
+		return fakeResult{affected: 1}
+	})
+	ft.db.on("INSERT INTO external_identities", func(args []driver.Value) fakeResult {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		ft.identities[args[0].(string)+"|"+args[1].(string)] = &models.ExternalIdentity{
+			Provider: args[0].(string), Subject: args[1].(string), UserID: uuid.MustParse(args[2].(string)), Email: args[3].(string),
+		}
+		return fakeResult{affected: 1}
+	})
+	ft.db.on("INSERT INTO oauth_authorization_codes", func(args []driver.Value) fakeResult {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		ft.codeUsers = append(ft.codeUsers, args[2].(string))
+		return fakeResult{affected: 1}
+	})
+
+	provider := &federation.Provider{
+		Name:         "idp",
+		Issuer:       ft.idp.URL,
+		ClientID:     ft.idp.ClientID,
+		ClientSecret: ft.idp.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  ft.oauth.Issuer + FederationCallbackPath,
+	}
+	ft.svc = NewFederationService(ft.oauth, repositories.NewExternalIdentityRepository(ft.sqlDB),
+		repositories.NewFederatedLoginStateRepository(ft.sqlDB), []*federation.Provider{provider})
+	return ft
+}
+
+// start begins a federated login for the test client and returns the upstream login URL and state
+func (ft *federationTest) start() (string, string) {
+	ft.t.Helper()
+	loginURL, state, err := ft.svc.StartLogin(context.Background(), "idp", &AuthorizationRequest{
+		ClientID:            federationTestClient.ID,
+		RedirectURI:         federationTestClient.RedirectURIs[0],
+		ResponseType:        "code",
+		Scope:               "openid email",
+		State:               "client-state",
+		Nonce:               "client-nonce",
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: PKCEMethodS256,
+	})
+	if err != nil {
+		ft.t.Fatal(err)
+	}
+	return loginURL, state
+}
+
+// login signs in at the upstream provider with claims and returns the local user an authorization
+// code was issued to
+func (ft *federationTest) login(claims map[string]any) (string, error) {
+	ft.t.Helper()
+	loginURL, state := ft.start()
+	code, returnedState := ft.idp.Login(ft.t, loginURL, claims)
+	if returnedState != state {
+		ft.t.Fatalf("provider returned state %q, want %q", returnedState, state)
+	}
+
+	req, authCode, err := ft.svc.CompleteLogin(context.Background(), state, code, "")
+	if err != nil {
+		return "", err
+	}
+	if req.State != "client-state" || req.Nonce != "client-nonce" || authCode == "" {
+		ft.t.Fatalf("CompleteLogin = %+v, %q, want the client's request restored and a code", *req, authCode)
+	}
+	return ft.codeUsers[len(ft.codeUsers)-1], nil
+}
+
+func TestFederatedLoginProvisionsNewUser(t *testing.T) {
+	ft := newFederationTest(t)
+	userID, err := ft.login(map[string]any{
+		"sub":                "upstream-1",
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"preferred_username": "Jane Doe!",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := ft.userByEmail("jane@example.com")
+	if user == nil || user.ID.String() != userID {
+		t.Fatalf("code issued to %s, want the provisioned user %+v", userID, user)
+	}
+	if user.Username != "JaneDoe" || !user.EmailVerified || user.Status != models.UserStatusActive {
+		t.Errorf("provisioned user = %+v", *user)
+	}
+	if identity := ft.identities["idp|upstream-1"]; identity == nil || identity.UserID != user.ID {
+		t.Errorf("external identity = %+v, want it linked to %s", identity, user.ID)
+	}
+	if !slices.Contains(ft.audit.types(), models.AuditLoginSucceeded) {
+		t.Errorf("audit events = %v, want a successful login", ft.audit.types())
+	}
+
+	// The next login with the same subject finds the user through the identity, even with a new email
+	again, err := ft.login(map[string]any{"sub": "upstream-1", "email": "jane@new.example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != userID || len(ft.users) != 1 {
+		t.Errorf("second login signed in %s with %d users, want %s", again, len(ft.users), userID)
+	}
+	if email := ft.identities["idp|upstream-1"].Email; email != "jane@new.example.com" {
+		t.Errorf("identity email = %q, want the one the provider reported last", email)
+	}
+}
+
+func TestFederatedLoginPicksAnotherUsernameWhenTaken(t *testing.T) {
+	ft := newFederationTest(t)
+	ft.usernameTaken = "jane"
+
+	if _, err := ft.login(map[string]any{"sub": "upstream-1", "email": "jane@example.com", "email_verified": true}); err != nil {
+		t.Fatal(err)
+	}
+	username := ft.userByEmail("jane@example.com").Username
+	if !strings.HasPrefix(username, "jane-") || len(username) != len("jane-")+usernameSuffixLength {
+		t.Errorf("username = %q, want jane with a random suffix", username)
+	}
+}
+
+func TestFederatedLoginLinksVerifiedEmail(t *testing.T) {
+	ft := newFederationTest(t)
+	existing := ft.addUser("jane", "")
+
+	userID, err := ft.login(map[string]any{"sub": "upstream-1", "email": "jane@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != existing.ID.String() || len(ft.users) != 1 {
+		t.Errorf("code issued to %s with %d users, want the existing user %s", userID, len(ft.users), existing.ID)
+	}
+	if identity := ft.identities["idp|upstream-1"]; identity == nil || identity.UserID != existing.ID {
+		t.Errorf("external identity = %+v, want it linked to %s", identity, existing.ID)
+	}
+}
+
+func TestFederatedLoginRejectsUnverifiedEmailOfExistingUser(t *testing.T) {
+	ft := newFederationTest(t)
+	ft.addUser("jane", "")
+
+	for _, claims := range []map[string]any{
+		{"sub": "upstream-1", "email": "jane@example.com", "email_verified": false},
+		{"sub": "upstream-1", "email": "jane@example.com"},
+	} {
+		_, err := ft.login(claims)
+		if !errors.Is(err, types.ErrFederatedLoginFailed) {
+			t.Errorf("login with claims %v: error = %v, want %v", claims, err, types.ErrFederatedLoginFailed)
+		}
+	}
+	if len(ft.identities) != 0 || len(ft.codeUsers) != 0 {
+		t.Errorf("identities = %v, codes issued to %v, want neither", ft.identities, ft.codeUsers)
+	}
+}
+
+func TestFederatedLoginRejectsMissingEmail(t *testing.T) {
+	ft := newFederationTest(t)
+	if _, err := ft.login(map[string]any{"sub": "upstream-1"}); !errors.Is(err, types.ErrFederatedLoginFailed) {
+		t.Errorf("error = %v, want %v", err, types.ErrFederatedLoginFailed)
+	}
+	if len(ft.users) != 0 {
+		t.Errorf("users = %v, want none provisioned", ft.users)
+	}
+}
+
+func TestCompleteLoginRejectsNonceMismatch(t *testing.T) {
+	ft := newFederationTest(t)
+	_, err := ft.login(map[string]any{"sub": "upstream-1", "email": "jane@example.com", "email_verified": true, "nonce": "replayed"})
+	if !errors.Is(err, types.ErrFederatedLoginFailed) {
+		t.Errorf("error = %v, want %v", err, types.ErrFederatedLoginFailed)
+	}
+	if len(ft.users) != 0 || len(ft.codeUsers) != 0 {
+		t.Errorf("users = %v, codes issued to %v, want neither", ft.users, ft.codeUsers)
+	}
+}
+
+func TestCompleteLoginRejectsUnknownOrReusedState(t *testing.T) {
+	ft := newFederationTest(t)
+	loginURL, state := ft.start()
+	code, _ := ft.idp.Login(t, loginURL, map[string]any{"sub": "upstream-1", "email": "jane@example.com", "email_verified": true})
+
+	if _, _, err := ft.svc.CompleteLogin(context.Background(), "forged-state", code, ""); !errors.Is(err, types.ErrInvalidRequest) {
+		t.Errorf("forged state: error = %v, want %v", err, types.ErrInvalidRequest)
+	}
+	if _, _, err := ft.svc.CompleteLogin(context.Background(), state, code, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ft.svc.CompleteLogin(context.Background(), state, code, ""); !errors.Is(err, types.ErrInvalidRequest) {
+		t.Errorf("reused state: error = %v, want %v", err, types.ErrInvalidRequest)
+	}
+	if len(ft.codeUsers) != 1 {
+		t.Errorf("codes issued to %v, want one", ft.codeUsers)
+	}
+}
+
+func TestCompleteLoginReportsUpstreamDenial(t *testing.T) {
+	ft := newFederationTest(t)
+	_, state := ft.start()
+
+	req, _, err := ft.svc.CompleteLogin(context.Background(), state, "", "access_denied")
+	if !errors.Is(err, types.ErrAccessDenied) {
+		t.Errorf("error = %v, want %v", err, types.ErrAccessDenied)
+	}
+	if req == nil || req.RedirectURI != federationTestClient.RedirectURIs[0] {
+		t.Errorf("request = %+v, want the client's request so the error can be sent to it", req)
+	}
+}
+
+func TestUsernameFromIdentity(t *testing.T) {
+	tests := []struct {
+		identity federation.Identity
+		want     string
+	}{
+		{federation.Identity{PreferredUsername: "jane.doe", Email: "other@example.com"}, "jane.doe"},
+		{federation.Identity{Email: "jane_doe-1@example.com"}, "jane_doe-1"},
+		{federation.Identity{PreferredUsername: "Jöhn Dœ <admin>"}, "JhnDadmin"},
+		{federation.Identity{PreferredUsername: "名前", Email: "@example.com"}, "user"},
+		{federation.Identity{PreferredUsername: strings.Repeat("a", 60)}, strings.Repeat("a", maxUsernameLength-usernameSuffixLength-1)},
+	}
+	for _, tt := range tests {
+		if got := usernameFromIdentity(&tt.identity); got != tt.want {
+			t.Errorf("usernameFromIdentity(%+v) = %q, want %q", tt.identity, got, tt.want)
+		}
+	}
+}
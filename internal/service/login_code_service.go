@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/metrics"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	loginCodeDigits         = 6
+	loginCodeTTL            = 10 * time.Minute
+	maxLoginCodeAttempts    = 5           // Wrong guesses before a code stops working
+	loginCodeResendInterval = time.Minute // Minimum time between two codes for the same purpose
+	loginCodeSendWindow     = time.Hour
+	maxLoginCodeSends       = 5 // Codes sent for the same purpose per window
+)
+
+// reauthActions are the purposes of reauth codes, each only accepted for its action, and how emails
+// describe them
+var reauthActions = map[string]string{
+	models.LoginCodePurposeChangeEmail: "change your email address",
+}
+
+// LoginCodeService emails short numeric codes that sign users in, or that confirm a signed-in user is
+// still present before a sensitive action. Codes are throttled per user and purpose, and each code
+// allows a few attempts only, so the small code space cannot be guessed.
+type LoginCodeService struct {
+	AuthService   *AuthService
+	LoginCodeRepo *repositories.LoginCodeRepository
+}
+
+func NewLoginCodeService(authService *AuthService, loginCodeRepo *repositories.LoginCodeRepository) *LoginCodeService {
+	return &LoginCodeService{AuthService: authService, LoginCodeRepo: loginCodeRepo}
+}
+
+// loginCodeSent is the response to SendLoginCode, which is the same whether or not the address has an account
+const loginCodeSent = "Sign-in code sent successfully."
+
+// SendLoginCode emails a code that signs the user with that email in. Addresses without an account
+// get the same response but no email, so callers cannot tell which addresses are registered.
+func (s *LoginCodeService) SendLoginCode(ctx context.Context, email string) (string, error) {
+	ctx, span := tracer.Start(ctx, "LoginCodeService.SendLoginCode")
+	defer span.End()
+
+	user, err := s.AuthService.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil || user.Status == models.UserStatusDeleted {
+		return loginCodeSent, nil
+	}
+	if err := s.sendCode(ctx, user, models.LoginCodePurposeLogin); err != nil {
+		return "", err
+	}
+	return loginCodeSent, nil
+}
+
+// VerifyLoginCode signs a user in with a code from SendLoginCode and issues tokens like Login
+func (s *LoginCodeService) VerifyLoginCode(ctx context.Context, email, code string) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "LoginCodeService.VerifyLoginCode")
+	defer span.End()
+
+	event := &models.AuditEvent{Metadata: map[string]string{"method": loginMethodEmailCode, "email": email}}
+	user, err := s.AuthService.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return "", "", types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil {
+		s.AuthService.failLogin(ctx, event, types.ErrInvalidLoginCode)
+		return "", "", types.ErrInvalidLoginCode
+	}
+	event.SubjectID = user.ID.String()
+	if err := s.verifyCode(ctx, user.ID, models.LoginCodePurposeLogin, code); err != nil {
+		s.AuthService.failLogin(ctx, event, err)
+		return "", "", err
+	}
+	return s.AuthService.emailLogin(ctx, user.ID, loginMethodEmailCode)
+}
+
+// SendReauthCode emails a signed-in user a code that VerifyReauthCode accepts before the sensitive action,
+// and no other
+func (s *LoginCodeService) SendReauthCode(ctx context.Context, userID, action string) (string, error) {
+	ctx, span := tracer.Start(ctx, "LoginCodeService.SendReauthCode")
+	defer span.End()
+
+	if _, ok := reauthActions[action]; !ok {
+		return "", types.ErrInvalidRequest.WithMessage("action must be change_email").WithField("action")
+	}
+	user, err := s.AuthService.GetUserByUUID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if err := accountStatusError(user); err != nil {
+		return "", err
+	}
+	if err := s.sendCode(ctx, user, action); err != nil {
+		return "", err
+	}
+	return "Confirmation code sent to " + user.Email + ".", nil
+}
+
+// VerifyReauthCode checks a code sent by SendReauthCode for action, which then stops working. Services
+// call it to let users confirm a sensitive action with a code instead of their password.
+func (s *LoginCodeService) VerifyReauthCode(ctx context.Context, userID, action, code string) error {
+	ctx, span := tracer.Start(ctx, "LoginCodeService.VerifyReauthCode")
+	defer span.End()
+
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	event := &models.AuditEvent{Type: models.AuditReauthSucceeded, ActorID: userID, SubjectID: userID,
+		Metadata: map[string]string{"action": action}}
+	if err := s.verifyCode(ctx, id, action, code); err != nil {
+		event.Type = models.AuditReauthFailed
+		s.AuthService.Audit.Record(ctx, event)
+		return err
+	}
+	s.AuthService.Audit.Record(ctx, event)
+	return nil
+}
+
+// sendCode generates a code for a user, replacing their previous code for purpose, and emails it
+func (s *LoginCodeService) sendCode(ctx context.Context, user *models.User, purpose string) error {
+	metrics.LoginCodeRequests.WithLabelValues(purpose).Inc()
+
+	code, err := generateLoginCode()
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to generate code").Wrap(err)
+	}
+	codeHash, err := hashPassword(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	saved, err := s.LoginCodeRepo.SaveCode(ctx, &models.LoginCode{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		CodeHash:  codeHash,
+		ExpiresAt: now.Add(loginCodeTTL),
+		SentAt:    now,
+	}, repositories.LoginCodeThrottle{
+		LastSentBefore:      now.Add(-loginCodeResendInterval),
+		WindowStartedBefore: now.Add(-loginCodeSendWindow),
+		MaxSends:            maxLoginCodeSends,
+	})
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to save code").Wrap(err)
+	}
+	if !saved {
+		return types.ErrLoginCodeThrottled
+	}
+
+	if action, ok := reauthActions[purpose]; ok {
+		err = utils.SendReauthCodeEmail(ctx, user.Email, action, code)
+	} else {
+		err = utils.SendLoginCodeEmail(ctx, user.Email, code)
+	}
+	if err != nil {
+		return types.ErrEmailDeliveryFailed.WithMessage("failed to send code email").Wrap(err)
+	}
+	s.AuthService.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditLoginCodeSent, SubjectID: user.ID.String(),
+		Metadata: map[string]string{"purpose": purpose}})
+	return nil
+}
+
+// verifyCode checks a code against the user's current code for purpose. Every check counts as an
+// attempt, and a code that matches is used up.
+func (s *LoginCodeService) verifyCode(ctx context.Context, userID uuid.UUID, purpose, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) != loginCodeDigits || strings.Trim(code, "0123456789") != "" {
+		return types.ErrInvalidLoginCode.WithMessage("code must be 6 digits")
+	}
+
+	now := time.Now()
+	current, err := s.LoginCodeRepo.ClaimAttempt(ctx, userID.String(), purpose, now, maxLoginCodeAttempts)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to load code").Wrap(err)
+	}
+	if current == nil || !checkPassword(ctx, code, current.CodeHash) {
+		return types.ErrInvalidLoginCode
+	}
+
+	consumed, err := s.LoginCodeRepo.ConsumeCode(ctx, current, now)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to use code").Wrap(err)
+	}
+	if !consumed {
+		return types.ErrInvalidLoginCode // Used or replaced concurrently
+	}
+	return nil
+}
+
+// generateLoginCode returns a random code of loginCodeDigits decimal digits
+func generateLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", loginCodeDigits, n.Int64()), nil
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// loginCodeTest keeps the user's current code for each purpose, which ClaimAttempt returns with one
+// more attempt counted, as long as it has attempts left and has not expired, and ConsumeCode removes.
+// Whether a new code may be sent is decided by the SQL of the repository; tests script it with
+// throttled.
+type loginCodeTest struct {
+	*testEnv
+	user *models.User
+
+	mu        sync.Mutex
+	codes     map[string]*models.LoginCode // By purpose
+	throttled bool
+}
+
+func newLoginCodeTest(t *testing.T) *loginCodeTest {
+	lt := &loginCodeTest{testEnv: newTestEnv(t), codes: map[string]*models.LoginCode{}}
+	lt.user = lt.addUser("jane", "")
+
+	lt.db.on("UPDATE login_codes SET attempts = attempts + 1", func(args []driver.Value) fakeResult {
+		lt.mu.Lock()
+		defer lt.mu.Unlock()
+		code, ok := lt.codes[args[1].(string)]
+		if !ok || !code.ExpiresAt.After(args[2].(time.Time)) || code.Attempts >= args[3].(int) {
+			return fakeResult{}
+		}
+		code.Attempts++
+		return fakeResult{rows: [][]driver.Value{{code.UserID.String(), code.Purpose, code.CodeHash, int64(code.Attempts),
+			code.ExpiresAt, code.SentAt, int64(code.SendCount), code.WindowStartedAt}}}
+	})
+	lt.db.on("UPDATE login_codes SET expires_at = $4", func(args []driver.Value) fakeResult {
+		lt.mu.Lock()
+		defer lt.mu.Unlock()
+		if _, ok := lt.codes[args[1].(string)]; !ok {
+			return fakeResult{}
+		}
+		delete(lt.codes, args[1].(string))
+		return fakeResult{affected: 1}
+	})
+	lt.db.on("INSERT INTO login_codes", func(args []driver.Value) fakeResult {
+		lt.mu.Lock()
+		defer lt.mu.Unlock()
+		if lt.throttled {
+			return fakeResult{}
+		}
+		lt.t.Error("code sent, but the tests cannot deliver email")
+		return fakeResult{err: errors.New("no email delivery")}
+	})
+	lt.db.on("INSERT INTO refresh_tokens", func([]driver.Value) fakeResult { return fakeResult{affected: 1} })
+	lt.db.on("SET email_verified = TRUE", func([]driver.Value) fakeResult { return fakeResult{} })
+	return lt
+}
+
+// send stores code as the user's current code for purpose, as if it had just been emailed
+func (lt *loginCodeTest) send(purpose, code string) {
+	lt.t.Helper()
+	hash, err := utils.HashPassword(code)
+	if err != nil {
+		lt.t.Fatal(err)
+	}
+	now := time.Now()
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.codes[purpose] = &models.LoginCode{
+		UserID: lt.user.ID, Purpose: purpose, CodeHash: hash,
+		ExpiresAt: now.Add(loginCodeTTL), SentAt: now, SendCount: 1, WindowStartedAt: now,
+	}
+}
+
+// claims returns the attempts claimed so far: the user, purpose, time and attempt limit of each
+func (lt *loginCodeTest) claims() [][]driver.Value {
+	return lt.db.calls("UPDATE login_codes SET attempts = attempts + 1")
+}
+
+func (lt *loginCodeTest) verify(code string) error {
+	return lt.loginCodes.VerifyReauthCode(context.Background(), lt.user.ID.String(), models.LoginCodePurposeChangeEmail, code)
+}
+
+func TestVerifyLoginCode(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeLogin, "123456")
+
+	accessToken, _, err := lt.loginCodes.VerifyLoginCode(context.Background(), lt.user.Email, "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.ValidateJWT(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != lt.user.ID.String() {
+		t.Errorf("access token of %q, want %q", claims.UserID, lt.user.ID)
+	}
+	if _, _, err := lt.loginCodes.VerifyLoginCode(context.Background(), lt.user.Email, "123456"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Errorf("second use: error = %v, want %v", err, types.ErrInvalidLoginCode)
+	}
+	want := []string{models.AuditLoginSucceeded, models.AuditLoginFailed}
+	if got := lt.audit.types(); !slices.Equal(got, want) {
+		t.Errorf("audit events = %v, want %v", got, want)
+	}
+}
+
+func TestVerifyLoginCodeAttemptLimit(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeLogin, "123456")
+
+	for i := 0; i < maxLoginCodeAttempts; i++ {
+		if _, _, err := lt.loginCodes.VerifyLoginCode(context.Background(), lt.user.Email, "654321"); !errors.Is(err, types.ErrInvalidLoginCode) {
+			t.Fatalf("wrong guess %d: error = %v, want %v", i+1, err, types.ErrInvalidLoginCode)
+		}
+	}
+	if _, _, err := lt.loginCodes.VerifyLoginCode(context.Background(), lt.user.Email, "123456"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Errorf("right code after %d wrong guesses: error = %v, want %v", maxLoginCodeAttempts, err, types.ErrInvalidLoginCode)
+	}
+}
+
+func TestVerifyLoginCodeExpiry(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeLogin, "123456")
+	lt.codes[models.LoginCodePurposeLogin].ExpiresAt = time.Now()
+
+	if _, _, err := lt.loginCodes.VerifyLoginCode(context.Background(), lt.user.Email, "123456"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Errorf("expired code: error = %v, want %v", err, types.ErrInvalidLoginCode)
+	}
+}
+
+func TestVerifyLoginCodeRejectsUnknownAddresses(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeLogin, "123456")
+
+	if _, _, err := lt.loginCodes.VerifyLoginCode(context.Background(), "nobody@example.com", "123456"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Errorf("error = %v, want %v", err, types.ErrInvalidLoginCode)
+	}
+	if claims := lt.claims(); len(claims) != 0 {
+		t.Errorf("claimed %d attempts, want none", len(claims))
+	}
+}
+
+func TestSendLoginCodeThrottle(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.throttled = true
+
+	start := time.Now()
+	if _, err := lt.loginCodes.SendLoginCode(context.Background(), lt.user.Email); !errors.Is(err, types.ErrLoginCodeThrottled) {
+		t.Fatalf("error = %v, want %v", err, types.ErrLoginCodeThrottled)
+	}
+	saves := lt.db.calls("INSERT INTO login_codes")
+	if len(saves) != 1 {
+		t.Fatalf("saved %d codes, want 1", len(saves))
+	}
+	// One code a minute and 5 an hour: the last code must have been sent before a minute ago, and
+	// the window of 5 codes must have started before an hour ago
+	sentAt, lastSentBefore, windowStartedBefore := saves[0][4].(time.Time), saves[0][5].(time.Time), saves[0][6].(time.Time)
+	if sentAt.Before(start) || sentAt.After(time.Now()) {
+		t.Errorf("code sent at %v, want the time of the request", sentAt)
+	}
+	if sentAt.Sub(lastSentBefore) != time.Minute || sentAt.Sub(windowStartedBefore) != time.Hour || saves[0][7] != 5 {
+		t.Errorf("throttle = %v, %v, %v, want a minute between codes and 5 an hour", lastSentBefore, windowStartedBefore, saves[0][7])
+	}
+	if got := lt.audit.types(); len(got) != 0 {
+		t.Errorf("audit events = %v, want none for a throttled code", got)
+	}
+}
+
+func TestVerifyReauthCode(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeChangeEmail, "123456")
+
+	if err := lt.verify(" 123456 "); err != nil {
+		t.Fatal(err)
+	}
+	if err := lt.verify("123456"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Errorf("second use: error = %v, want %v", err, types.ErrInvalidLoginCode)
+	}
+	want := []string{models.AuditReauthSucceeded, models.AuditReauthFailed}
+	if got := lt.audit.types(); !slices.Equal(got, want) {
+		t.Errorf("audit events = %v, want %v", got, want)
+	}
+}
+
+func TestVerifyReauthCodeClaimsAnAttempt(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeChangeEmail, "123456")
+
+	start := time.Now()
+	if err := lt.verify("654321"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Fatalf("wrong guess: error = %v, want %v", err, types.ErrInvalidLoginCode)
+	}
+	claims := lt.claims()
+	if len(claims) != 1 {
+		t.Fatalf("claimed %d attempts, want 1", len(claims))
+	}
+	claim := claims[0]
+	if claim[0] != lt.user.ID.String() || claim[1] != models.LoginCodePurposeChangeEmail || claim[3] != maxLoginCodeAttempts {
+		t.Errorf("claimed attempt %v, want one of at most %d for the user's reauth code", claim, maxLoginCodeAttempts)
+	}
+	// Codes past this time count as expired
+	if now := claim[2].(time.Time); now.Before(start) || now.After(time.Now()) {
+		t.Errorf("attempt claimed at %v, want the time of the check", now)
+	}
+}
+
+func TestVerifyReauthCodeRejectsCodesWithoutAttemptsLeft(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeChangeEmail, "123456")
+	// The repository claims nothing once the code is out of attempts or has expired
+	delete(lt.codes, models.LoginCodePurposeChangeEmail)
+
+	if err := lt.verify("123456"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Errorf("error = %v, want %v", err, types.ErrInvalidLoginCode)
+	}
+	if got := lt.audit.types(); !slices.Equal(got, []string{models.AuditReauthFailed}) {
+		t.Errorf("audit events = %v, want a failed reauth", got)
+	}
+}
+
+func TestVerifyReauthCodeRejectsMalformedCodesWithoutAnAttempt(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeChangeEmail, "123456")
+
+	for _, code := range []string{"", "12345", "1234567", "12a456", "１２３４５６"} {
+		if err := lt.verify(code); !errors.Is(err, types.ErrInvalidLoginCode) {
+			t.Errorf("code %q: error = %v, want %v", code, err, types.ErrInvalidLoginCode)
+		}
+	}
+	if claims := lt.claims(); len(claims) != 0 {
+		t.Errorf("claimed %d attempts, want malformed codes not to count", len(claims))
+	}
+}
+
+func TestVerifyReauthCodeRejectsCodesForOtherPurposes(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	lt.send(models.LoginCodePurposeLogin, "123456")
+
+	if err := lt.verify("123456"); !errors.Is(err, types.ErrInvalidLoginCode) {
+		t.Errorf("sign-in code used to change the email: error = %v, want %v", err, types.ErrInvalidLoginCode)
+	}
+	if err := lt.loginCodes.VerifyReauthCode(context.Background(), lt.user.ID.String(), "delete_account", "123456"); err == nil {
+		t.Error("code accepted for an unknown action")
+	}
+}
+
+func TestSendReauthCodeRequiresKnownAction(t *testing.T) {
+	lt := newLoginCodeTest(t)
+	for _, action := range []string{"", models.LoginCodePurposeLogin, "delete_account"} {
+		if _, err := lt.loginCodes.SendReauthCode(context.Background(), lt.user.ID.String(), action); !errors.Is(err, types.ErrInvalidRequest) {
+			t.Errorf("action %q: error = %v, want %v", action, err, types.ErrInvalidRequest)
+		}
+	}
+}
+
+func TestSendLoginCodeToUnknownAddress(t *testing.T) {
+	lt := newLoginCodeTest(t)
+
+	message, err := lt.loginCodes.SendLoginCode(context.Background(), "nobody@example.com")
+	if err != nil || message != loginCodeSent {
+		t.Errorf("SendLoginCode = %q, %v, want the response for registered addresses", message, err)
+	}
+	if saved := lt.db.calls("INSERT INTO login_codes"); len(saved) != 0 {
+		t.Errorf("saved %d codes, want none for an address without an account", len(saved))
+	}
+}
@@ -0,0 +1,14 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kraftzpepe/auth-service/internal/utils"
+)
+
+func TestMain(m *testing.M) {
+	// The server sets the secret from its configuration at startup
+	utils.SetJWTSecret([]byte("service-tests-secret-of-32-bytes"))
+	os.Exit(m.Run())
+}
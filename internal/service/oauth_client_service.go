@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// clientSecretBytes is the entropy of generated client secrets
+const clientSecretBytes = 32
+
+// Client fields that can be named in an update mask
+const (
+	ClientFieldName            = "name"
+	ClientFieldRedirectURIs    = "redirect_uris"
+	ClientFieldGrantTypes      = "grant_types"
+	ClientFieldScopes          = "scopes"
+	ClientFieldAccessTokenTTL  = "access_token_ttl_seconds"
+	ClientFieldRefreshTokenTTL = "refresh_token_ttl_seconds"
+	ClientFieldPublicKey       = "public_key_pem"
+)
+
+var clientFields = []string{
+	ClientFieldName, ClientFieldRedirectURIs, ClientFieldGrantTypes,
+	ClientFieldScopes, ClientFieldAccessTokenTTL, ClientFieldRefreshTokenTTL,
+	ClientFieldPublicKey,
+}
+
+// OAuthClientParams holds the client settings an administrator controls
+type OAuthClientParams struct {
+	Name            string
+	RedirectURIs    []string
+	GrantTypes      []string
+	Scopes          []string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	PublicKey       string // PEM public key for private_key_jwt client authentication
+}
+
+// OAuthClientService manages the registry of OAuth clients
+type OAuthClientService struct {
+	ClientRepo *repositories.OAuthClientRepository
+}
+
+func NewOAuthClientService(clientRepo *repositories.OAuthClientRepository) *OAuthClientService {
+	return &OAuthClientService{ClientRepo: clientRepo}
+}
+
+// CreateClient registers a client and returns it with its plaintext secret, which is not stored.
+// Public clients and clients authenticating with private_key_jwt get no secret.
+func (s *OAuthClientService) CreateClient(ctx context.Context, params OAuthClientParams, public bool) (*models.OAuthClient, string, error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.CreateClient")
+	defer span.End()
+
+	if len(params.GrantTypes) == 0 {
+		params.GrantTypes = []string{models.GrantAuthorizationCode, models.GrantRefreshToken}
+	}
+
+	now := time.Now()
+	client := &models.OAuthClient{ID: uuid.NewString(), CreatedAt: now, UpdatedAt: now}
+	applyClientParams(client, params, clientFields)
+
+	if public && client.PublicKey != "" {
+		return nil, "", types.ErrInvalidClientMetadata.WithMessage("public clients cannot have a public key").WithField(ClientFieldPublicKey)
+	}
+
+	var secret string
+	if !public && client.PublicKey == "" {
+		var err error
+		secret, client.SecretHash, err = newClientSecret(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := validateClient(client); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.ClientRepo.CreateClient(ctx, client); err != nil {
+		return nil, "", types.ErrInternalError.WithMessage("failed to save client").Wrap(err)
+	}
+	return client, secret, nil
+}
+
+// ListClients returns every registered client
+func (s *OAuthClientService) ListClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.ListClients")
+	defer span.End()
+
+	clients, err := s.ClientRepo.ListClients(ctx)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to list clients").Wrap(err)
+	}
+	return clients, nil
+}
+
+// UpdateClient changes the fields of a client named in fields, or all of them when fields is empty
+func (s *OAuthClientService) UpdateClient(ctx context.Context, clientID string, params OAuthClientParams, fields []string) (*models.OAuthClient, error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.UpdateClient")
+	defer span.End()
+
+	if len(fields) == 0 {
+		fields = clientFields
+	}
+	for _, field := range fields {
+		if !slices.Contains(clientFields, field) {
+			return nil, types.ErrInvalidRequest.WithMessage("unknown field in update_mask: " + field).WithField("update_mask")
+		}
+	}
+
+	client, err := s.getClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	wasPublic := client.IsPublic()
+	applyClientParams(client, params, fields)
+	client.UpdatedAt = time.Now()
+	if !wasPublic && client.IsPublic() {
+		return nil, types.ErrInvalidClientMetadata.WithMessage("cannot remove the only credential of a confidential client").WithField(ClientFieldPublicKey)
+	}
+	if err := validateClient(client); err != nil {
+		return nil, err
+	}
+
+	found, err := s.ClientRepo.UpdateClient(ctx, client)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to update client").Wrap(err)
+	}
+	if !found {
+		return nil, types.ErrClientNotFound
+	}
+	return client, nil
+}
+
+// RotateSecret replaces the secret of a confidential client and returns the new plaintext secret.
+// The previous secret stops working immediately.
+func (s *OAuthClientService) RotateSecret(ctx context.Context, clientID string) (string, error) {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.RotateSecret")
+	defer span.End()
+
+	client, err := s.getClient(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	if client.IsPublic() {
+		return "", types.ErrInvalidClientMetadata.WithMessage("public clients have no secret").WithField("client_id")
+	}
+
+	secret, secretHash, err := newClientSecret(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	found, err := s.ClientRepo.UpdateSecret(ctx, clientID, secretHash)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to update client secret").Wrap(err)
+	}
+	if !found {
+		return "", types.ErrClientNotFound
+	}
+	return secret, nil
+}
+
+// DeleteClient removes a client. Tokens already issued to it stay valid until they expire.
+func (s *OAuthClientService) DeleteClient(ctx context.Context, clientID string) error {
+	ctx, span := tracer.Start(ctx, "OAuthClientService.DeleteClient")
+	defer span.End()
+
+	found, err := s.ClientRepo.DeleteClient(ctx, clientID)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to delete client").Wrap(err)
+	}
+	if !found {
+		return types.ErrClientNotFound
+	}
+	return nil
+}
+
+func (s *OAuthClientService) getClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	client, err := s.ClientRepo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load client").Wrap(err)
+	}
+	if client == nil {
+		return nil, types.ErrClientNotFound
+	}
+	return client, nil
+}
+
+// applyClientParams copies the named fields from params onto the client
+func applyClientParams(client *models.OAuthClient, params OAuthClientParams, fields []string) {
+	for _, field := range fields {
+		switch field {
+		case ClientFieldName:
+			client.Name = strings.TrimSpace(params.Name)
+		case ClientFieldRedirectURIs:
+			client.RedirectURIs = params.RedirectURIs
+		case ClientFieldGrantTypes:
+			client.GrantTypes = params.GrantTypes
+		case ClientFieldScopes:
+			client.Scopes = params.Scopes
+		case ClientFieldAccessTokenTTL:
+			client.AccessTokenTTL = params.AccessTokenTTL
+		case ClientFieldRefreshTokenTTL:
+			client.RefreshTokenTTL = params.RefreshTokenTTL
+		case ClientFieldPublicKey:
+			client.PublicKey = strings.TrimSpace(params.PublicKey)
+		}
+	}
+}
+
+// validateClient checks the settings of a client before it is saved
+func validateClient(client *models.OAuthClient) error {
+	invalid := func(field, message string) error {
+		return types.ErrInvalidClientMetadata.WithMessage(message).WithField(field)
+	}
+
+	if client.Name == "" || len(client.Name) > 255 {
+		return invalid(ClientFieldName, "name is required and must be at most 255 characters")
+	}
+	if len(client.GrantTypes) == 0 {
+		return invalid(ClientFieldGrantTypes, "at least one grant type is required")
+	}
+	for _, grantType := range client.GrantTypes {
+		if !slices.Contains(models.GrantTypes, grantType) {
+			return invalid(ClientFieldGrantTypes, "unsupported grant type "+grantType)
+		}
+	}
+	if client.IsPublic() && client.AllowsGrant(models.GrantClientCredentials) {
+		return invalid(ClientFieldGrantTypes, "public clients cannot use the client_credentials grant")
+	}
+	if client.AllowsGrant(models.GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return invalid(ClientFieldRedirectURIs, "the authorization_code grant requires a redirect URI")
+	}
+	for _, uri := range client.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return invalid(ClientFieldRedirectURIs, err.Error())
+		}
+	}
+	for _, scope := range client.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n\"\\") {
+			return invalid(ClientFieldScopes, "invalid scope "+scope)
+		}
+	}
+	if client.PublicKey != "" {
+		if _, err := utils.ParsePublicKeyPEM(client.PublicKey); err != nil {
+			return invalid(ClientFieldPublicKey, "invalid public key: "+err.Error())
+		}
+	}
+	if client.AccessTokenTTL < 0 {
+		return invalid(ClientFieldAccessTokenTTL, "token lifetimes must not be negative")
+	}
+	if client.RefreshTokenTTL < 0 {
+		return invalid(ClientFieldRefreshTokenTTL, "token lifetimes must not be negative")
+	}
+	return nil
+}
+
+// validateRedirectURI accepts absolute URIs without a fragment. Plain HTTP is only allowed
+// for loopback addresses used by native apps during development.
+func validateRedirectURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() {
+		return fmt.Errorf("redirect URI must be absolute: %s", uri)
+	}
+	if parsed.Fragment != "" || strings.Contains(uri, "#") {
+		return fmt.Errorf("redirect URI must not contain a fragment: %s", uri)
+	}
+	if parsed.Scheme == "http" {
+		host := parsed.Hostname()
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("redirect URI must use https: %s", uri)
+		}
+	}
+	return nil
+}
+
+// newClientSecret generates a client secret and its bcrypt hash
+func newClientSecret(ctx context.Context) (string, string, error) {
+	secret := utils.GenerateSecureToken(clientSecretBytes)
+	hash, err := hashPassword(ctx, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, hash, nil
+}
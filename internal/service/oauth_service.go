@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/tracing"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	// These paths locate the OAuth and OpenID Connect endpoints relative to the issuer URL
+	AuthorizePath           = "/oauth/authorize"
+	TokenPath               = "/oauth/token"
+	UserInfoPath            = "/oauth/userinfo"
+	IntrospectionPath       = "/oauth/introspect"
+	JWKSPath                = "/.well-known/jwks.json"
+	DiscoveryPath           = "/.well-known/openid-configuration"
+	FederationCallbackPath  = "/oauth/federation/callback"
+	DeviceAuthorizationPath = "/oauth/device_authorization"
+	DevicePath              = "/oauth/device" // Where users enter the code shown on their device
+
+	authorizationCodeTTL = 5 * time.Minute
+
+	// PKCEMethodS256 is the only supported code challenge method; "plain" is rejected
+	PKCEMethodS256 = "S256"
+)
+
+// codeVerifierPattern is the RFC 7636 syntax for code verifiers
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+type OAuthService struct {
+	AuthService   *AuthService
+	ClientRepo    *repositories.OAuthClientRepository
+	CodeRepo      *repositories.AuthorizationCodeRepository
+	AssertionRepo *repositories.ClientAssertionRepository
+	DeviceRepo    *repositories.DeviceAuthorizationRepository
+	SigningKey    *utils.SigningKey // Signs OpenID Connect ID tokens
+	Issuer        string            // Public base URL of the authorization server
+}
+
+func NewOAuthService(
+	authService *AuthService,
+	clientRepo *repositories.OAuthClientRepository,
+	codeRepo *repositories.AuthorizationCodeRepository,
+	assertionRepo *repositories.ClientAssertionRepository,
+	deviceRepo *repositories.DeviceAuthorizationRepository,
+	signingKey *utils.SigningKey,
+	issuer string,
+) *OAuthService {
+	return &OAuthService{
+		AuthService:   authService,
+		ClientRepo:    clientRepo,
+		CodeRepo:      codeRepo,
+		AssertionRepo: assertionRepo,
+		DeviceRepo:    deviceRepo,
+		SigningKey:    signingKey,
+		Issuer:        strings.TrimSuffix(issuer, "/"),
+	}
+}
+
+// AuthorizationRequest holds the parameters of an /authorize request
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// ClientCredentials holds what a client presented to authenticate at the token endpoint:
+// a secret, a private_key_jwt assertion, or only its ID for public clients
+type ClientCredentials struct {
+	ClientID      string
+	ClientSecret  string
+	AssertionType string
+	Assertion     string
+}
+
+// TokenResponse is the result of a successful token request
+type TokenResponse struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	ExpiresIn    int64
+	Scope        string
+	IDToken      string // Set when the openid scope was granted
+}
+
+// ValidateClient checks the client and redirect URI of an authorization request. Until both are
+// known to be valid, errors must be shown to the user instead of being sent to the redirect URI.
+func (s *OAuthService) ValidateClient(ctx context.Context, req *AuthorizationRequest) (*models.OAuthClient, error) {
+	client, err := s.lookupClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, types.ErrInvalidRedirectURI
+	}
+	return client, nil
+}
+
+// ValidateAuthorizationRequest checks the remaining parameters of an authorization request
+func (s *OAuthService) ValidateAuthorizationRequest(client *models.OAuthClient, req *AuthorizationRequest) error {
+	if req.ResponseType != "code" {
+		return types.ErrUnsupportedResponseType
+	}
+	if !client.AllowsGrant(models.GrantAuthorizationCode) {
+		return types.ErrUnauthorizedClient
+	}
+	if req.CodeChallenge == "" {
+		return types.ErrInvalidRequest.WithMessage("code_challenge is required")
+	}
+	if req.CodeChallengeMethod != PKCEMethodS256 {
+		return types.ErrInvalidRequest.WithMessage("code_challenge_method must be S256")
+	}
+	if !client.AllowsScopes(strings.Fields(req.Scope)) {
+		return types.ErrInvalidScope
+	}
+	return nil
+}
+
+// Authorize authenticates the user on behalf of the client and issues a single-use authorization code
+func (s *OAuthService) Authorize(ctx context.Context, req *AuthorizationRequest, email, password string) (string, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.Authorize")
+	defer span.End()
+
+	client, err := s.ValidateClient(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if err := s.ValidateAuthorizationRequest(client, req); err != nil {
+		return "", err
+	}
+
+	user, err := s.AuthService.Authenticate(ctx, email, password)
+	if err != nil {
+		return "", err
+	}
+
+	return s.issueCode(ctx, client, req, user.ID, time.Now(), []string{"pwd"})
+}
+
+// issueCode stores a single-use authorization code for a user who authenticated at authTime using the given methods
+func (s *OAuthService) issueCode(ctx context.Context, client *models.OAuthClient, req *AuthorizationRequest, userID uuid.UUID, authTime time.Time, amr []string) (string, error) {
+	code, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to generate authorization code").Wrap(err)
+	}
+
+	now := time.Now()
+	err = s.CodeRepo.SaveCode(ctx, &models.AuthorizationCode{
+		CodeHash:            utils.HashToken(code),
+		ClientID:            client.ID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            authTime,
+		AMR:                 amr,
+		ExpiresAt:           now.Add(authorizationCodeTTL),
+		CreatedAt:           now,
+	})
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to save authorization code").Wrap(err)
+	}
+
+	return code, nil
+}
+
+// AuthenticateClient verifies the credentials a client presents at the token endpoint.
+// Public clients identify themselves by client ID alone and rely on PKCE instead.
+func (s *OAuthService) AuthenticateClient(ctx context.Context, creds ClientCredentials) (*models.OAuthClient, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.AuthenticateClient")
+	defer span.End()
+
+	if creds.Assertion != "" {
+		return s.authenticateAssertion(ctx, creds)
+	}
+
+	client, err := s.lookupClient(ctx, creds.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		if creds.ClientSecret != "" {
+			return nil, types.ErrInvalidClient
+		}
+		return client, nil
+	}
+	if creds.ClientSecret == "" || client.SecretHash == "" || !checkPassword(ctx, creds.ClientSecret, client.SecretHash) {
+		return nil, types.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// authenticateAssertion verifies private_key_jwt client authentication and rejects replayed assertions
+func (s *OAuthService) authenticateAssertion(ctx context.Context, creds ClientCredentials) (*models.OAuthClient, error) {
+	if creds.AssertionType != ClientAssertionType {
+		return nil, types.ErrInvalidClient.WithMessage("unsupported client_assertion_type")
+	}
+	clientID := assertionClientID(creds.Assertion)
+	if creds.ClientID != "" && creds.ClientID != clientID {
+		return nil, types.ErrInvalidClient.WithMessage("client_id does not match the client assertion")
+	}
+
+	client, err := s.lookupClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.PublicKey == "" {
+		return nil, types.ErrInvalidClient.WithMessage("client has no registered public key")
+	}
+
+	claims, err := verifyClientAssertion(creds.Assertion, client, []string{s.Issuer, s.Issuer + TokenPath})
+	if err != nil {
+		utils.LoggerFromContext(ctx).InfoContext(ctx, "client assertion rejected", "client_id", client.ID, "error", err)
+		return nil, types.ErrInvalidClient.WithMessage("invalid client assertion")
+	}
+
+	fresh, err := s.AssertionRepo.SaveAssertionID(ctx, client.ID, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to record client assertion").Wrap(err)
+	}
+	if !fresh {
+		return nil, types.ErrInvalidClient.WithMessage("client assertion has already been used")
+	}
+	return client, nil
+}
+
+// ClientCredentialsGrant issues a short-lived access token whose subject is the client itself.
+// The token carries the requested scopes, or all scopes granted to the client when none are requested.
+func (s *OAuthService) ClientCredentialsGrant(ctx context.Context, client *models.OAuthClient, scope string) (*TokenResponse, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.ClientCredentialsGrant")
+	defer span.End()
+
+	if client.IsPublic() || !client.AllowsGrant(models.GrantClientCredentials) {
+		return nil, types.ErrUnauthorizedClient
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.AllowsScopes(scopes) {
+		return nil, types.ErrInvalidScope
+	}
+	scope = strings.Join(scopes, " ")
+
+	ttl := utils.ClientTokenTTL
+	if client.AccessTokenTTL > 0 {
+		ttl = client.AccessTokenTTL
+	}
+
+	_, tokenSpan := tracer.Start(ctx, "GenerateClientToken")
+	accessToken, err := utils.GenerateClientJWT(client.ID, scope, ttl)
+	tracing.EndSpan(tokenSpan, err)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to generate access token").Wrap(err)
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// ExchangeAuthorizationCode redeems an authorization code for an access token, and a refresh token
+// when the client may use the refresh_token grant
+func (s *OAuthService) ExchangeAuthorizationCode(ctx context.Context, client *models.OAuthClient, code, redirectURI, codeVerifier string) (*TokenResponse, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.ExchangeAuthorizationCode")
+	defer span.End()
+
+	if code == "" {
+		return nil, types.ErrInvalidRequest.WithMessage("code is required")
+	}
+	if !codeVerifierPattern.MatchString(codeVerifier) {
+		return nil, types.ErrInvalidRequest.WithMessage("code_verifier is missing or malformed")
+	}
+
+	authCode, err := s.CodeRepo.ConsumeCode(ctx, utils.HashToken(code))
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load authorization code").Wrap(err)
+	}
+	if authCode == nil || authCode.ExpiresAt.Before(time.Now()) {
+		return nil, types.ErrInvalidGrant
+	}
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI {
+		return nil, types.ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(codeVerifier, authCode.CodeChallenge) {
+		return nil, types.ErrInvalidGrant.WithMessage("code_verifier does not match the code challenge")
+	}
+
+	lifetimes := clientLifetimes(client)
+	resp := &TokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int64(lifetimes.access.Seconds()),
+		Scope:     authCode.Scope,
+	}
+	if client.AllowsGrant(models.GrantRefreshToken) {
+		resp.AccessToken, resp.RefreshToken, err = s.AuthService.issueTokens(ctx, authCode.UserID, uuid.NullUUID{}, tokenGrant{clientID: client.ID, scope: authCode.Scope}, lifetimes)
+	} else {
+		resp.AccessToken, err = s.AuthService.issueAccessToken(ctx, authCode.UserID, tokenGrant{clientID: client.ID, scope: authCode.Scope}, lifetimes.access)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(strings.Fields(authCode.Scope), ScopeOpenID) {
+		resp.IDToken, err = s.issueIDToken(ctx, client, authCode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// RefreshToken rotates a refresh token the client obtained through the authorization code or device
+// flow. Refresh tokens issued to other clients, or to the user's own sessions, fail with invalid_grant.
+func (s *OAuthService) RefreshToken(ctx context.Context, client *models.OAuthClient, refreshToken string) (*TokenResponse, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.RefreshToken")
+	defer span.End()
+
+	if !client.AllowsGrant(models.GrantRefreshToken) {
+		return nil, types.ErrUnauthorizedClient
+	}
+	if refreshToken == "" {
+		return nil, types.ErrInvalidRequest.WithMessage("refresh_token is required")
+	}
+
+	lifetimes := clientLifetimes(client)
+	accessToken, newRefreshToken, err := s.AuthService.refreshTokens(ctx, refreshToken, tokenGrant{clientID: client.ID}, lifetimes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(lifetimes.access.Seconds()),
+	}, nil
+}
+
+func (s *OAuthService) lookupClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, types.ErrInvalidClient.WithMessage("client_id is required")
+	}
+	client, err := s.ClientRepo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load client").Wrap(err)
+	}
+	if client == nil {
+		return nil, types.ErrInvalidClient.WithMessage("unknown client")
+	}
+	return client, nil
+}
+
+// verifyCodeChallenge checks an S256 PKCE code verifier against the stored challenge
+func verifyCodeChallenge(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
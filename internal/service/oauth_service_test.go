@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// The example of RFC 7636 appendix B
+const (
+	pkceVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	pkceChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+var (
+	oauthTestClient = &models.OAuthClient{
+		ID:           "app",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+		GrantTypes:   []string{models.GrantAuthorizationCode, models.GrantRefreshToken},
+		Scopes:       []string{"email", "profile"},
+	}
+	oauthTestOtherClient = &models.OAuthClient{
+		ID:           "other",
+		RedirectURIs: []string{"https://other.example.com/callback"},
+		GrantTypes:   []string{models.GrantAuthorizationCode, models.GrantRefreshToken},
+		Scopes:       []string{"email", "profile"},
+	}
+)
+
+// oauthTest issues and redeems authorization codes and refresh tokens, kept in memory by their hash
+// and token
+type oauthTest struct {
+	*testEnv
+	user *models.User
+
+	mu            sync.Mutex
+	codes         map[string][]driver.Value       // Stored authorization codes by hash
+	refreshTokens map[string]*models.RefreshToken // By token
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	ot := &oauthTest{
+		testEnv:       newTestEnv(t),
+		codes:         map[string][]driver.Value{},
+		refreshTokens: map[string]*models.RefreshToken{},
+	}
+	ot.user = ot.addUser("jane", "")
+	ot.addClient(oauthTestClient)
+	ot.addClient(oauthTestOtherClient)
+
+	ot.db.on("INSERT INTO oauth_authorization_codes", func(args []driver.Value) fakeResult {
+		ot.mu.Lock()
+		defer ot.mu.Unlock()
+		ot.codes[args[0].(string)] = slices.Clone(args)
+		return fakeResult{affected: 1}
+	})
+	ot.db.on("DELETE FROM oauth_authorization_codes WHERE code_hash = $1", func(args []driver.Value) fakeResult {
+		ot.mu.Lock()
+		defer ot.mu.Unlock()
+		row, ok := ot.codes[args[0].(string)]
+		if !ok {
+			return fakeResult{}
+		}
+		delete(ot.codes, args[0].(string))
+		return fakeResult{rows: [][]driver.Value{row}}
+	})
+	ot.db.on("INSERT INTO refresh_tokens", func(args []driver.Value) fakeResult {
+		ot.mu.Lock()
+		defer ot.mu.Unlock()
+		token := &models.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    uuid.MustParse(args[0].(string)),
+			Scope:     args[3].(string),
+			Token:     args[4].(string),
+			ExpiresAt: args[5].(time.Time),
+			CreatedAt: time.Now(),
+		}
+		if clientID, ok := args[2].(string); ok {
+			token.ClientID.String, token.ClientID.Valid = clientID, true
+		}
+		ot.refreshTokens[token.Token] = token
+		return fakeResult{affected: 1}
+	})
+	ot.db.on("FROM refresh_tokens WHERE token = $1", func(args []driver.Value) fakeResult {
+		ot.mu.Lock()
+		defer ot.mu.Unlock()
+		token, ok := ot.refreshTokens[args[0].(string)]
+		if !ok {
+			return fakeResult{}
+		}
+		var clientID driver.Value
+		if token.ClientID.Valid {
+			clientID = token.ClientID.String
+		}
+		return fakeResult{rows: [][]driver.Value{{token.ID.String(), token.UserID.String(), nil, clientID,
+			token.Scope, token.Token, token.ExpiresAt, token.CreatedAt}}}
+	})
+	ot.db.on("UPDATE refresh_tokens", func(args []driver.Value) fakeResult {
+		ot.mu.Lock()
+		defer ot.mu.Unlock()
+		for old, token := range ot.refreshTokens {
+			if token.ID.String() == args[2] {
+				delete(ot.refreshTokens, old)
+				token.Token, token.ExpiresAt = args[0].(string), args[1].(time.Time)
+				ot.refreshTokens[token.Token] = token
+				return fakeResult{affected: 1}
+			}
+		}
+		return fakeResult{}
+	})
+	return ot
+}
+
+// issueCode issues an authorization code for the user to oauthTestClient, with the PKCE challenge of pkceVerifier
+func (ot *oauthTest) issueCode() string {
+	ot.t.Helper()
+	code, err := ot.oauth.issueCode(context.Background(), oauthTestClient, &AuthorizationRequest{
+		ClientID:            oauthTestClient.ID,
+		RedirectURI:         oauthTestClient.RedirectURIs[0],
+		ResponseType:        "code",
+		Scope:               "email",
+		CodeChallenge:       pkceChallenge,
+		CodeChallengeMethod: PKCEMethodS256,
+	}, ot.user.ID, time.Now(), []string{"pwd"})
+	if err != nil {
+		ot.t.Fatal(err)
+	}
+	return code
+}
+
+func (ot *oauthTest) exchange(client *models.OAuthClient, code, redirectURI, verifier string) (*TokenResponse, error) {
+	return ot.oauth.ExchangeAuthorizationCode(context.Background(), client, code, redirectURI, verifier)
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	if !verifyCodeChallenge(pkceVerifier, pkceChallenge) {
+		t.Error("RFC 7636 example rejected")
+	}
+	for _, verifier := range []string{"", pkceVerifier + "x", strings.ToUpper(pkceVerifier), pkceChallenge} {
+		if verifyCodeChallenge(verifier, pkceChallenge) {
+			t.Errorf("verifier %q accepted", verifier)
+		}
+	}
+	// A plain challenge, equal to its verifier, does not verify as S256
+	if verifyCodeChallenge(pkceVerifier, pkceVerifier) {
+		t.Error("plain challenge accepted")
+	}
+}
+
+func TestExchangeAuthorizationCode(t *testing.T) {
+	ot := newOAuthTest(t)
+	code := ot.issueCode()
+
+	resp, err := ot.exchange(oauthTestClient, code, oauthTestClient.RedirectURIs[0], pkceVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RefreshToken == "" || resp.Scope != "email" {
+		t.Errorf("token response = %+v, want a refresh token and the email scope", *resp)
+	}
+	claims, err := utils.ValidateJWT(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != ot.user.ID.String() || claims.ClientID != oauthTestClient.ID || claims.Scope != "email" {
+		t.Errorf("access token claims = %+v, want the user, client and scope of the code", *claims)
+	}
+
+	if _, err := ot.exchange(oauthTestClient, code, oauthTestClient.RedirectURIs[0], pkceVerifier); !errors.Is(err, types.ErrInvalidGrant) {
+		t.Errorf("second exchange: error = %v, want %v", err, types.ErrInvalidGrant)
+	}
+}
+
+func TestExchangeAuthorizationCodeRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *models.OAuthClient
+		redirectURI string
+		verifier    string
+		want        error
+	}{
+		{name: "wrong verifier", verifier: strings.Repeat("a", 43), want: types.ErrInvalidGrant},
+		{name: "challenge as verifier", verifier: pkceChallenge, want: types.ErrInvalidGrant},
+		{name: "missing verifier", verifier: "", want: types.ErrInvalidRequest},
+		{name: "short verifier", verifier: "too-short", want: types.ErrInvalidRequest},
+		{name: "verifier with invalid characters", verifier: pkceVerifier + "/+", want: types.ErrInvalidRequest},
+		{name: "other client", client: oauthTestOtherClient, verifier: pkceVerifier, want: types.ErrInvalidGrant},
+		{name: "other redirect URI", redirectURI: "https://app.example.com/other", verifier: pkceVerifier, want: types.ErrInvalidGrant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ot := newOAuthTest(t)
+			code := ot.issueCode()
+			client, redirectURI := oauthTestClient, oauthTestClient.RedirectURIs[0]
+			if tt.client != nil {
+				client = tt.client
+			}
+			if tt.redirectURI != "" {
+				redirectURI = tt.redirectURI
+			}
+
+			resp, err := ot.exchange(client, code, redirectURI, tt.verifier)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			if resp != nil {
+				t.Errorf("tokens issued: %+v", *resp)
+			}
+			if errors.Is(tt.want, types.ErrInvalidGrant) && len(ot.codes) != 0 {
+				t.Error("code still usable after a failed redemption")
+			}
+		})
+	}
+}
+
+func TestRefreshTokenIsBoundToClient(t *testing.T) {
+	ot := newOAuthTest(t)
+	resp, err := ot.exchange(oauthTestClient, ot.issueCode(), oauthTestClient.RedirectURIs[0], pkceVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ot.oauth.RefreshToken(context.Background(), oauthTestOtherClient, resp.RefreshToken); !errors.Is(err, types.ErrInvalidRefreshToken) {
+		t.Errorf("refresh by another client: error = %v, want %v", err, types.ErrInvalidRefreshToken)
+	}
+
+	_, sessionToken, err := ot.oauth.AuthService.issueTokens(context.Background(), ot.user.ID, uuid.NullUUID{}, tokenGrant{}, defaultLifetimes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ot.oauth.RefreshToken(context.Background(), oauthTestClient, sessionToken); !errors.Is(err, types.ErrInvalidRefreshToken) {
+		t.Errorf("refresh of the user's own session by a client: error = %v, want %v", err, types.ErrInvalidRefreshToken)
+	}
+
+	refreshed, err := ot.oauth.RefreshToken(context.Background(), oauthTestClient, resp.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.ValidateJWT(refreshed.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ClientID != oauthTestClient.ID || claims.Scope != "email" {
+		t.Errorf("refreshed access token claims = %+v, want the client and scope of the original grant", *claims)
+	}
+	if _, err := ot.oauth.RefreshToken(context.Background(), oauthTestClient, resp.RefreshToken); !errors.Is(err, types.ErrInvalidRefreshToken) {
+		t.Errorf("reuse of a rotated refresh token: error = %v, want %v", err, types.ErrInvalidRefreshToken)
+	}
+}
+
+func TestClientTokensCarryNoAdminPermissions(t *testing.T) {
+	ot := newOAuthTest(t)
+	ot.user = ot.addAdmin("root", "")
+
+	resp, err := ot.exchange(oauthTestClient, ot.issueCode(), oauthTestClient.RedirectURIs[0], pkceVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := ot.oauth.RefreshToken(context.Background(), oauthTestClient, resp.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"exchanged": resp.AccessToken, "refreshed": refreshed.AccessToken} {
+		claims, err := utils.ValidateJWT(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.UserID != ot.user.ID.String() || len(claims.Roles) != 0 || len(claims.Permissions) != 0 {
+			t.Errorf("%s access token claims = %+v, want the admin's user without roles or permissions", name, *claims)
+		}
+	}
+
+	// The admin's own session still carries them
+	own, _, err := ot.oauth.AuthService.issueTokens(context.Background(), ot.user.ID, uuid.NullUUID{}, tokenGrant{}, defaultLifetimes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := utils.ValidateJWT(own); err != nil || !slices.Equal(claims.Permissions, []string{"*"}) {
+		t.Errorf("own access token claims = %+v, %v, want every permission", claims, err)
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/tracing"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// OpenID Connect scopes
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+const idTokenTTL = time.Hour
+
+// UserInfo holds the standard claims returned by the UserInfo endpoint
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+}
+
+// issueIDToken signs an ID token for the user an authorization code was issued to.
+// Email and profile claims are only included when the matching scope was granted.
+func (s *OAuthService) issueIDToken(ctx context.Context, client *models.OAuthClient, code *models.AuthorizationCode) (string, error) {
+	user, err := s.AuthService.UserRepo.GetUserByUUID(ctx, code.UserID.String())
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil {
+		return "", types.ErrInvalidGrant.WithMessage("user no longer exists")
+	}
+
+	now := time.Now()
+	claims := utils.IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: jwt.NewNumericDate(code.AuthTime),
+		AMR:      code.AMR,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer,
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(idTokenTTL)),
+		},
+	}
+	scopes := strings.Fields(code.Scope)
+	if slices.Contains(scopes, ScopeEmail) {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims.PreferredUsername = user.Username
+		claims.Name = user.DisplayName
+		claims.Picture = user.AvatarURL
+	}
+
+	_, tokenSpan := tracer.Start(ctx, "GenerateIDToken")
+	idToken, err := utils.GenerateIDToken(s.SigningKey, claims)
+	tracing.EndSpan(tokenSpan, err)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to generate ID token").Wrap(err)
+	}
+	return idToken, nil
+}
+
+// UserInfo returns the claims about the user an access token was issued to. For tokens issued to an
+// OAuth client, email and profile claims are only included when the matching scope was granted, as in
+// ID tokens. Tokens issued to clients through the client_credentials grant have no user and are rejected.
+func (s *OAuthService) UserInfo(ctx context.Context, accessToken string) (*UserInfo, error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.UserInfo")
+	defer span.End()
+
+	claims, err := utils.ValidateJWT(accessToken)
+	if err != nil || claims.UserID == "" {
+		return nil, types.ErrUnauthenticated.WithMessage("invalid access token")
+	}
+
+	user, err := s.AuthService.UserRepo.GetUserByUUID(ctx, claims.UserID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil {
+		return nil, types.ErrUnauthenticated.WithMessage("invalid access token")
+	}
+
+	// The user's own sessions are not limited to a scope
+	scopes := []string{ScopeEmail, ScopeProfile}
+	if claims.ClientID != "" {
+		scopes = strings.Fields(claims.Scope)
+	}
+
+	info := &UserInfo{Subject: user.ID.String()}
+	if slices.Contains(scopes, ScopeEmail) {
+		info.Email = user.Email
+		info.EmailVerified = &user.EmailVerified
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		info.PreferredUsername = user.Username
+		info.Name = user.DisplayName
+		info.Picture = user.AvatarURL
+	}
+	return info, nil
+}
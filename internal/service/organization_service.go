@@ -0,0 +1,451 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// invitationTTL bounds how long an emailed invitation can be accepted
+const invitationTTL = 7 * 24 * time.Hour
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// OrganizationService manages organizations, their members and tokens scoped to an organization
+type OrganizationService struct {
+	AuthService *AuthService
+	OrgRepo     *repositories.OrganizationRepository
+}
+
+func NewOrganizationService(authService *AuthService, orgRepo *repositories.OrganizationRepository) *OrganizationService {
+	return &OrganizationService{AuthService: authService, OrgRepo: orgRepo}
+}
+
+// CreateOrganization creates an organization. With isolatedAccounts its members get accounts of
+// their own, whose usernames and emails only need to be unique inside the organization.
+func (s *OrganizationService) CreateOrganization(ctx context.Context, slug, name string, isolatedAccounts bool) (*models.Organization, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.CreateOrganization")
+	defer span.End()
+
+	if !orgSlugPattern.MatchString(slug) {
+		return nil, types.ErrInvalidOrganization.WithMessage("slugs use 2 to 63 lowercase letters, digits and '-'").WithField("slug")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, types.ErrInvalidOrganization.WithMessage("name is required").WithField("name")
+	}
+
+	now := time.Now()
+	org := &models.Organization{
+		ID:               uuid.New(),
+		Slug:             slug,
+		Name:             name,
+		IsolatedAccounts: isolatedAccounts,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := s.OrgRepo.CreateOrganization(ctx, org); err != nil {
+		if errors.Is(err, types.ErrOrganizationExists) {
+			return nil, err
+		}
+		return nil, types.ErrInternalError.WithMessage("failed to save organization").Wrap(err)
+	}
+	return org, nil
+}
+
+// ListOrganizations returns every organization
+func (s *OrganizationService) ListOrganizations(ctx context.Context) ([]*models.Organization, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.ListOrganizations")
+	defer span.End()
+
+	orgs, err := s.OrgRepo.ListOrganizations(ctx)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to list organizations").Wrap(err)
+	}
+	return orgs, nil
+}
+
+// InviteMember emails an invitation to join an organization with the given roles.
+// invitedBy is the ID of the inviting user, or empty when an administrator invites.
+func (s *OrganizationService) InviteMember(ctx context.Context, orgID, email string, roles []string, invitedBy string) (*models.OrganizationInvitation, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.InviteMember")
+	defer span.End()
+
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+	if roles, err = s.checkRoles(ctx, roles); err != nil {
+		return nil, err
+	}
+
+	token := utils.GenerateSecureToken(32)
+	now := time.Now()
+	invitation := &models.OrganizationInvitation{
+		ID:        uuid.New(),
+		OrgID:     org.ID,
+		Email:     email,
+		Roles:     roles,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(invitationTTL),
+		CreatedAt: now,
+	}
+	if inviter, err := uuid.Parse(invitedBy); err == nil {
+		invitation.InvitedBy = uuid.NullUUID{UUID: inviter, Valid: true}
+	}
+	if err := s.OrgRepo.CreateInvitation(ctx, invitation); err != nil {
+		if errors.Is(err, types.ErrOrganizationNotFound) {
+			return nil, err
+		}
+		return nil, types.ErrInternalError.WithMessage("failed to save invitation").Wrap(err)
+	}
+
+	if err := utils.SendInvitationEmail(ctx, email, org.Name, token); err != nil {
+		return nil, types.ErrEmailDeliveryFailed.WithMessage("failed to send invitation email").Wrap(err)
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation redeems an invitation and returns the new member's ID with tokens scoped to the
+// organization. In organizations with isolated accounts it creates the member's account from username
+// and password; otherwise the invitation is accepted by the global user of accessToken.
+func (s *OrganizationService) AcceptInvitation(ctx context.Context, token, accessToken, username, password string) (*models.Organization, uuid.UUID, string, string, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.AcceptInvitation")
+	defer span.End()
+
+	invitation, err := s.OrgRepo.GetInvitation(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, uuid.Nil, "", "", types.ErrInternalError.WithMessage("failed to load invitation").Wrap(err)
+	}
+	if invitation == nil || invitation.ExpiresAt.Before(time.Now()) {
+		return nil, uuid.Nil, "", "", types.ErrInvalidInvitation
+	}
+	org, err := s.getOrganization(ctx, invitation.OrgID.String())
+	if err != nil {
+		return nil, uuid.Nil, "", "", err
+	}
+
+	var userID uuid.UUID
+	if org.IsolatedAccounts {
+		userID, err = s.createMemberAccount(ctx, org, invitation, username, password)
+	} else {
+		userID, err = s.addExistingUser(ctx, invitation, accessToken)
+	}
+	if err != nil {
+		return nil, uuid.Nil, "", "", err
+	}
+
+	if _, err := s.OrgRepo.DeleteInvitation(ctx, invitation.ID.String()); err != nil {
+		return nil, uuid.Nil, "", "", types.ErrInternalError.WithMessage("failed to delete invitation").Wrap(err)
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "invitation accepted", "org_id", org.ID, "user_id", userID)
+
+	newAccessToken, refreshToken, err := s.AuthService.issueTokens(ctx, userID, uuid.NullUUID{UUID: org.ID, Valid: true}, tokenGrant{}, defaultLifetimes)
+	if err != nil {
+		return nil, uuid.Nil, "", "", err
+	}
+	return org, userID, newAccessToken, refreshToken, nil
+}
+
+// createMemberAccount creates the account of an invitee of an organization with isolated accounts.
+// The invitation was delivered by email, so the address counts as verified.
+func (s *OrganizationService) createMemberAccount(ctx context.Context, org *models.Organization, invitation *models.OrganizationInvitation, username, password string) (uuid.UUID, error) {
+	if username == "" {
+		return uuid.Nil, types.ErrInvalidUsername.WithMessage("username is required")
+	}
+	if err := utils.ValidatePassword(password); err != nil {
+		return uuid.Nil, err
+	}
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:            uuid.New(),
+		OrgID:         uuid.NullUUID{UUID: org.ID, Valid: true},
+		Username:      username,
+		Email:         invitation.Email,
+		EmailVerified: true,
+		Password:      hashedPassword,
+		Status:        models.UserStatusActive,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.OrgRepo.CreateUserWithMembership(ctx, user, invitation.Roles); err != nil {
+		var domainErr *types.Error
+		if errors.As(err, &domainErr) {
+			return uuid.Nil, err
+		}
+		return uuid.Nil, types.ErrInternalError.WithMessage("failed to save user").Wrap(err)
+	}
+	s.AuthService.Webhooks.PublishUserEvent(ctx, models.WebhookUserCreated, user, "", false)
+	return user.ID, nil
+}
+
+// addExistingUser adds the global user of an access token to the invitation's organization
+func (s *OrganizationService) addExistingUser(ctx context.Context, invitation *models.OrganizationInvitation, accessToken string) (uuid.UUID, error) {
+	claims, err := utils.ValidateJWT(accessToken)
+	if err != nil || claims.UserID == "" {
+		return uuid.Nil, types.ErrUnauthenticated.WithMessage("sign in to accept the invitation")
+	}
+	user, err := s.AuthService.GetUserByUUID(ctx, claims.UserID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if user.OrgID.Valid {
+		return uuid.Nil, types.ErrPermissionDenied.WithMessage("accounts of an organization with isolated accounts cannot join other organizations")
+	}
+
+	err = s.OrgRepo.AddMember(ctx, &models.Membership{
+		OrgID:     invitation.OrgID,
+		UserID:    user.ID,
+		Roles:     invitation.Roles,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, types.ErrOrganizationNotFound) || errors.Is(err, types.ErrRoleNotFound) {
+			return uuid.Nil, err
+		}
+		return uuid.Nil, types.ErrInternalError.WithMessage("failed to add member").Wrap(err)
+	}
+	return user.ID, nil
+}
+
+// Login authenticates a member of an organization and issues tokens scoped to it. Members of
+// organizations with isolated accounts can only sign in this way.
+func (s *OrganizationService) Login(ctx context.Context, orgID, email, password string) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.Login")
+	defer span.End()
+
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return "", "", err
+	}
+	user, err := s.findUserByEmail(ctx, org, email)
+	if err != nil {
+		return "", "", err
+	}
+	if user, err = s.AuthService.checkLogin(ctx, user, email, password, org.ID.String()); err != nil {
+		return "", "", err
+	}
+
+	return s.AuthService.issueTokens(ctx, user.ID, uuid.NullUUID{UUID: org.ID, Valid: true}, tokenGrant{}, defaultLifetimes)
+}
+
+// RequestPasswordReset emails a reset token to an account of an organization with isolated
+// accounts, or to the global account with that email for other organizations
+func (s *OrganizationService) RequestPasswordReset(ctx context.Context, orgID, email string) (string, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.RequestPasswordReset")
+	defer span.End()
+
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return "", err
+	}
+	user, err := s.findUserByEmail(ctx, org, email)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", types.ErrUserNotFound
+	}
+	return s.AuthService.sendPasswordReset(ctx, user)
+}
+
+// SwitchOrganization exchanges a user access token for tokens scoped to another organization the
+// user belongs to, or to no organization when orgID is empty
+func (s *OrganizationService) SwitchOrganization(ctx context.Context, accessToken, orgID string) (string, string, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.SwitchOrganization")
+	defer span.End()
+
+	claims, err := utils.ValidateJWT(accessToken)
+	if err != nil {
+		return "", "", types.ErrUnauthenticated.WithMessage("invalid access token")
+	}
+	if claims.UserID == "" {
+		return "", "", types.ErrUnauthenticated.WithMessage("a user access token is required")
+	}
+	user, err := s.AuthService.GetUserByUUID(ctx, claims.UserID)
+	if err != nil {
+		return "", "", err
+	}
+
+	var org uuid.NullUUID
+	if orgID != "" {
+		id, err := uuid.Parse(orgID)
+		if err != nil {
+			return "", "", types.ErrInvalidIdentifier.WithMessage("org_id must be a UUID").WithField("org_id")
+		}
+		org = uuid.NullUUID{UUID: id, Valid: true}
+	} else if user.OrgID.Valid {
+		return "", "", types.ErrPermissionDenied.WithMessage("this account can only be used inside its organization")
+	}
+
+	return s.AuthService.issueTokens(ctx, user.ID, org, tokenGrant{}, defaultLifetimes)
+}
+
+// ListMembers returns the members of an organization
+func (s *OrganizationService) ListMembers(ctx context.Context, orgID string) ([]*models.Membership, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.ListMembers")
+	defer span.End()
+
+	org, err := s.getOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.OrgRepo.ListMembers(ctx, org.ID.String())
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to list members").Wrap(err)
+	}
+	return members, nil
+}
+
+// ListUserMemberships returns the organizations a user belongs to
+func (s *OrganizationService) ListUserMemberships(ctx context.Context, userID string) ([]*models.Membership, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.ListUserMemberships")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	memberships, err := s.OrgRepo.ListUserMemberships(ctx, userID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to list memberships").Wrap(err)
+	}
+	return memberships, nil
+}
+
+// UpdateMemberRoles replaces the roles a member holds in an organization. It takes effect in
+// the member's next access token.
+func (s *OrganizationService) UpdateMemberRoles(ctx context.Context, orgID, userID string, roles []string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.UpdateMemberRoles")
+	defer span.End()
+
+	if err := validateMemberIDs(orgID, userID); err != nil {
+		return nil, err
+	}
+	roles, err := normalizeRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := s.OrgRepo.SetMemberRoles(ctx, orgID, userID, roles)
+	if err != nil {
+		if errors.Is(err, types.ErrRoleNotFound) {
+			return nil, err
+		}
+		return nil, types.ErrInternalError.WithMessage("failed to update member roles").Wrap(err)
+	}
+	if !found {
+		return nil, types.ErrMembershipNotFound
+	}
+	s.AuthService.Audit.Record(ctx, &models.AuditEvent{
+		Type:      models.AuditMemberRolesUpdated,
+		SubjectID: userID,
+		Metadata:  map[string]string{"org_id": orgID, "roles": strings.Join(roles, ",")},
+	})
+	return roles, nil
+}
+
+// RemoveMember removes a user from an organization. Accounts that exist only inside the
+// organization are deleted.
+func (s *OrganizationService) RemoveMember(ctx context.Context, orgID, userID string) error {
+	ctx, span := tracer.Start(ctx, "OrganizationService.RemoveMember")
+	defer span.End()
+
+	if err := validateMemberIDs(orgID, userID); err != nil {
+		return err
+	}
+	found, err := s.OrgRepo.RemoveMember(ctx, orgID, userID)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to remove member").Wrap(err)
+	}
+	if !found {
+		return types.ErrMembershipNotFound
+	}
+	return nil
+}
+
+// getOrganization loads an organization by ID, failing if it does not exist
+func (s *OrganizationService) getOrganization(ctx context.Context, orgID string) (*models.Organization, error) {
+	if _, err := uuid.Parse(orgID); err != nil {
+		return nil, types.ErrInvalidIdentifier.WithMessage("org_id must be a UUID").WithField("org_id")
+	}
+	org, err := s.OrgRepo.GetOrganization(ctx, orgID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load organization").Wrap(err)
+	}
+	if org == nil {
+		return nil, types.ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// findUserByEmail looks up the account a member of an organization signs in with, or nil
+func (s *OrganizationService) findUserByEmail(ctx context.Context, org *models.Organization, email string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if org.IsolatedAccounts {
+		user, err = s.AuthService.UserRepo.GetOrgUserByEmail(ctx, org.ID.String(), email)
+	} else {
+		user, err = s.AuthService.UserRepo.GetUserByEmail(ctx, email)
+	}
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	return user, nil
+}
+
+// checkRoles validates role names and verifies that the roles exist
+func (s *OrganizationService) checkRoles(ctx context.Context, roles []string) ([]string, error) {
+	roles, err := normalizeRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range roles {
+		role, err := s.AuthService.RoleRepo.GetRole(ctx, name)
+		if err != nil {
+			return nil, types.ErrInternalError.WithMessage("failed to load role").Wrap(err)
+		}
+		if role == nil {
+			return nil, types.ErrRoleNotFound.WithMessage("role " + name + " not found").WithField("roles")
+		}
+	}
+	return roles, nil
+}
+
+func validateMemberIDs(orgID, userID string) error {
+	if _, err := uuid.Parse(orgID); err != nil {
+		return types.ErrInvalidIdentifier.WithMessage("org_id must be a UUID").WithField("org_id")
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	return nil
+}
+
+// normalizeRoles validates role names and returns them sorted without duplicates
+func normalizeRoles(roles []string) ([]string, error) {
+	for _, role := range roles {
+		if !roleNamePattern.MatchString(role) {
+			return nil, types.ErrInvalidRole.WithMessage("invalid role name " + role).WithField("roles")
+		}
+	}
+	normalized := append([]string{}, roles...) // Never nil: a NULL array would match no rows when replacing roles
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
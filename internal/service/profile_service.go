@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// Profile fields that can be named in an update mask
+const (
+	ProfileFieldUsername    = "username"
+	ProfileFieldDisplayName = "display_name"
+	ProfileFieldAvatarURL   = "avatar_url"
+)
+
+var profileFields = []string{ProfileFieldUsername, ProfileFieldDisplayName, ProfileFieldAvatarURL}
+
+const (
+	emailChangeTTL       = 24 * time.Hour     // How long the link sent to the new address works
+	emailChangeRevertTTL = 7 * 24 * time.Hour // How long the link sent to the old address works
+	maxDisplayNameLength = 100
+	maxAvatarURLLength   = 2048
+)
+
+// ProfileParams holds the profile fields users edit themselves
+type ProfileParams struct {
+	Username    string
+	DisplayName string
+	AvatarURL   string
+}
+
+// ProfileService lets users change their own username, display attributes and email address
+type ProfileService struct {
+	UserRepo        *repositories.UserRepository
+	EmailChangeRepo *repositories.EmailChangeRepository
+	Webhooks        *WebhookService
+	LoginCodes      *LoginCodeService
+}
+
+func NewProfileService(
+	userRepo *repositories.UserRepository,
+	emailChangeRepo *repositories.EmailChangeRepository,
+	webhooks *WebhookService,
+	loginCodes *LoginCodeService,
+) *ProfileService {
+	return &ProfileService{UserRepo: userRepo, EmailChangeRepo: emailChangeRepo, Webhooks: webhooks, LoginCodes: loginCodes}
+}
+
+// UpdateProfile changes the fields of a user's profile named in fields, or all of them when fields is empty
+func (s *ProfileService) UpdateProfile(ctx context.Context, userID string, params ProfileParams, fields []string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "ProfileService.UpdateProfile")
+	defer span.End()
+
+	if len(fields) == 0 {
+		fields = profileFields
+	}
+	for _, field := range fields {
+		if !slices.Contains(profileFields, field) {
+			return nil, types.ErrInvalidRequest.WithMessage("unknown field in update_mask: " + field).WithField("update_mask")
+		}
+	}
+
+	user, err := s.activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(fields, ProfileFieldUsername) {
+		username := strings.TrimSpace(params.Username)
+		if username == "" || len(username) > maxUsernameLength {
+			return nil, types.ErrInvalidUsername.WithMessage("username must be 1 to 50 characters")
+		}
+		user.Username = username
+	}
+	if slices.Contains(fields, ProfileFieldDisplayName) {
+		displayName := strings.TrimSpace(params.DisplayName)
+		if len(displayName) > maxDisplayNameLength {
+			return nil, types.ErrInvalidRequest.WithMessage("display_name must be at most 100 characters").WithField(ProfileFieldDisplayName)
+		}
+		user.DisplayName = displayName
+	}
+	if slices.Contains(fields, ProfileFieldAvatarURL) {
+		if err := validateAvatarURL(params.AvatarURL); err != nil {
+			return nil, err
+		}
+		user.AvatarURL = params.AvatarURL
+	}
+	user.UpdatedAt = time.Now()
+
+	found, err := s.UserRepo.UpdateProfile(ctx, user)
+	if errors.Is(err, types.ErrUsernameTaken) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to update profile").Wrap(err)
+	}
+	if !found {
+		return nil, types.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// validateAvatarURL accepts an empty URL, which removes the picture, or an absolute HTTPS URL
+func validateAvatarURL(avatarURL string) error {
+	if avatarURL == "" {
+		return nil
+	}
+	u, err := url.Parse(avatarURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" || len(avatarURL) > maxAvatarURLLength {
+		return types.ErrInvalidRequest.WithMessage("avatar_url must be an https URL").WithField(ProfileFieldAvatarURL)
+	}
+	return nil
+}
+
+// ChangeEmail starts changing a user's email address after checking their current password, or, when
+// reauthCode is set instead, a code that LoginCodeService.SendReauthCode sent for the change_email action. A confirmation link is sent to
+// the new address and a link that undoes the change to the old one; the address only changes once
+// the confirmation link is followed.
+func (s *ProfileService) ChangeEmail(ctx context.Context, userID, newEmail, password, reauthCode string) (string, error) {
+	ctx, span := tracer.Start(ctx, "ProfileService.ChangeEmail")
+	defer span.End()
+
+	if err := utils.ValidateEmail(newEmail); err != nil {
+		return "", types.ErrInvalidEmail.WithMessage("invalid email address").WithField("new_email")
+	}
+	user, err := s.activeUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case password != "" && reauthCode != "":
+		return "", types.ErrInvalidRequest.WithMessage("send either current_password or reauth_code, not both")
+	case reauthCode != "":
+		// Only a code sent for this action is accepted, so a code requested for anything else cannot move the account
+		if err := s.LoginCodes.VerifyReauthCode(ctx, userID, models.LoginCodePurposeChangeEmail, reauthCode); err != nil {
+			return "", err
+		}
+	case !checkPassword(ctx, password, user.Password):
+		return "", types.ErrInvalidCredentials.WithMessage("current password is incorrect")
+	}
+	if newEmail == user.Email {
+		return "", types.ErrInvalidEmail.WithMessage("new email is the current email").WithField("new_email")
+	}
+
+	var existing *models.User
+	if user.OrgID.Valid {
+		existing, err = s.UserRepo.GetOrgUserByEmail(ctx, user.OrgID.UUID.String(), newEmail)
+	} else {
+		existing, err = s.UserRepo.GetUserByEmail(ctx, newEmail)
+	}
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if existing != nil {
+		return "", types.ErrEmailTaken.WithField("new_email")
+	}
+
+	confirmToken := utils.GenerateSecureToken(32)
+	revertToken := utils.GenerateSecureToken(32)
+	now := time.Now()
+	change := &models.EmailChange{
+		ID:               uuid.New(),
+		UserID:           user.ID,
+		OldEmail:         user.Email,
+		NewEmail:         newEmail,
+		ConfirmTokenHash: utils.HashToken(confirmToken),
+		RevertTokenHash:  utils.HashToken(revertToken),
+		ExpiresAt:        now.Add(emailChangeTTL),
+		RevertExpiresAt:  now.Add(emailChangeRevertTTL),
+		CreatedAt:        now,
+	}
+	if err := s.EmailChangeRepo.CreateEmailChange(ctx, change); err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to save email change").Wrap(err)
+	}
+
+	if err := utils.SendEmailChangeConfirmation(ctx, newEmail, confirmToken); err != nil {
+		return "", types.ErrEmailDeliveryFailed.WithMessage("failed to send confirmation email").Wrap(err)
+	}
+	if err := utils.SendEmailChangeNotice(ctx, user.Email, newEmail, revertToken); err != nil {
+		return "", types.ErrEmailDeliveryFailed.WithMessage("failed to send email change notice").Wrap(err)
+	}
+	return "Follow the link sent to " + newEmail + " to confirm the change.", nil
+}
+
+// ConfirmEmailChange swaps a user's email for the address the token was sent to, and returns it
+func (s *ProfileService) ConfirmEmailChange(ctx context.Context, token string) (string, error) {
+	ctx, span := tracer.Start(ctx, "ProfileService.ConfirmEmailChange")
+	defer span.End()
+
+	change, err := s.EmailChangeRepo.GetByConfirmToken(ctx, utils.HashToken(token))
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to load email change").Wrap(err)
+	}
+	if change == nil || change.ConfirmedAt.Valid || time.Now().After(change.ExpiresAt) {
+		return "", types.ErrInvalidEmailChange
+	}
+
+	swapped, err := s.EmailChangeRepo.ConfirmEmailChange(ctx, change)
+	if errors.Is(err, types.ErrEmailTaken) {
+		return "", err
+	}
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to change email").Wrap(err)
+	}
+	if !swapped {
+		return "", types.ErrInvalidEmailChange // Confirmed concurrently, or the email changed another way
+	}
+	s.Webhooks.PublishUserChange(ctx, models.WebhookUserEmailChanged, change.UserID.String(), change.OldEmail)
+	return change.NewEmail, nil
+}
+
+// RevertEmailChange undoes an email change with the token sent to the old address. A pending change
+// is cancelled; a confirmed one is rolled back and all of the user's sessions are ended, in case the
+// change was made by someone who took over the account. It reports whether the old address was restored.
+func (s *ProfileService) RevertEmailChange(ctx context.Context, token string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "ProfileService.RevertEmailChange")
+	defer span.End()
+
+	change, err := s.EmailChangeRepo.GetByRevertToken(ctx, utils.HashToken(token))
+	if err != nil {
+		return false, types.ErrInternalError.WithMessage("failed to load email change").Wrap(err)
+	}
+	if change == nil || time.Now().After(change.RevertExpiresAt) {
+		return false, types.ErrInvalidEmailChange
+	}
+
+	restored, err := s.EmailChangeRepo.RevertEmailChange(ctx, change)
+	if errors.Is(err, types.ErrEmailTaken) {
+		return false, types.ErrEmailTaken.WithMessage("the old email address has been registered by another account")
+	}
+	if err != nil {
+		return false, types.ErrInternalError.WithMessage("failed to revert email change").Wrap(err)
+	}
+	if restored {
+		utils.LoggerFromContext(ctx).InfoContext(ctx, "email change reverted", "user_id", change.UserID)
+		s.Webhooks.PublishUserChange(ctx, models.WebhookUserEmailChanged, change.UserID.String(), change.NewEmail)
+	}
+	return restored, nil
+}
+
+// activeUser loads the user of a self-service call, who must still be active
+func (s *ProfileService) activeUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.UserRepo.GetUserByUUID(ctx, userID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil {
+		return nil, types.ErrUserNotFound
+	}
+	if err := accountStatusError(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+// Role fields that can be named in an update mask
+const (
+	RoleFieldDescription = "description"
+	RoleFieldPermissions = "permissions"
+)
+
+var roleFields = []string{RoleFieldDescription, RoleFieldPermissions}
+
+var (
+	roleNamePattern   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+	permissionPattern = regexp.MustCompile(`^(\*|[a-z0-9_.-]+(:[a-z0-9_.-]+)*(:\*)?)$`)
+)
+
+// maxPermissionLength matches the role_permissions.permission column
+const maxPermissionLength = 128
+
+// PermissionCheck is the result of CheckPermission
+type PermissionCheck struct {
+	Allowed bool
+	UserID  string
+	Roles   []string
+}
+
+// RoleService manages roles, their permissions and their assignment to users
+type RoleService struct {
+	RoleRepo *repositories.RoleRepository
+	Audit    *AuditService
+}
+
+func NewRoleService(roleRepo *repositories.RoleRepository, audit *AuditService) *RoleService {
+	return &RoleService{RoleRepo: roleRepo, Audit: audit}
+}
+
+// CreateRole defines a new role
+func (s *RoleService) CreateRole(ctx context.Context, name, description string, permissions []string) (*models.Role, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.CreateRole")
+	defer span.End()
+
+	if !roleNamePattern.MatchString(name) {
+		return nil, types.ErrInvalidRole.WithMessage("role names use lowercase letters, digits, '-' and '_'").WithField("name")
+	}
+	permissions, err := normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	role := &models.Role{Name: name, Description: description, Permissions: permissions, CreatedAt: now, UpdatedAt: now}
+	if err := s.RoleRepo.CreateRole(ctx, role); err != nil {
+		if errors.Is(err, types.ErrRoleExists) {
+			return nil, err
+		}
+		return nil, types.ErrInternalError.WithMessage("failed to save role").Wrap(err)
+	}
+	return role, nil
+}
+
+// ListRoles returns every role
+func (s *RoleService) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.ListRoles")
+	defer span.End()
+
+	roles, err := s.RoleRepo.ListRoles(ctx)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to list roles").Wrap(err)
+	}
+	return roles, nil
+}
+
+// UpdateRole changes the fields of a role named in fields, or all of them when fields is empty.
+// Tokens issued before the update keep the old permissions until they expire.
+func (s *RoleService) UpdateRole(ctx context.Context, name, description string, permissions []string, fields []string) (*models.Role, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.UpdateRole")
+	defer span.End()
+
+	if len(fields) == 0 {
+		fields = roleFields
+	}
+	for _, field := range fields {
+		if !slices.Contains(roleFields, field) {
+			return nil, types.ErrInvalidRequest.WithMessage("unknown field in update_mask: " + field).WithField("update_mask")
+		}
+	}
+
+	role, err := s.RoleRepo.GetRole(ctx, name)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load role").Wrap(err)
+	}
+	if role == nil {
+		return nil, types.ErrRoleNotFound
+	}
+
+	if slices.Contains(fields, RoleFieldDescription) {
+		role.Description = description
+	}
+	if slices.Contains(fields, RoleFieldPermissions) {
+		if role.Permissions, err = normalizePermissions(permissions); err != nil {
+			return nil, err
+		}
+	}
+	role.UpdatedAt = time.Now()
+
+	found, err := s.RoleRepo.UpdateRole(ctx, role)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to update role").Wrap(err)
+	}
+	if !found {
+		return nil, types.ErrRoleNotFound
+	}
+	return role, nil
+}
+
+// DeleteRole removes a role and all its assignments
+func (s *RoleService) DeleteRole(ctx context.Context, name string) error {
+	ctx, span := tracer.Start(ctx, "RoleService.DeleteRole")
+	defer span.End()
+
+	found, err := s.RoleRepo.DeleteRole(ctx, name)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to delete role").Wrap(err)
+	}
+	if !found {
+		return types.ErrRoleNotFound
+	}
+	return nil
+}
+
+// AssignRole grants a role to a user. It takes effect in the user's next access token.
+func (s *RoleService) AssignRole(ctx context.Context, userID, role string) error {
+	ctx, span := tracer.Start(ctx, "RoleService.AssignRole")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	if err := s.RoleRepo.AssignRole(ctx, userID, role); err != nil {
+		if errors.Is(err, types.ErrUserNotFound) || errors.Is(err, types.ErrRoleNotFound) {
+			return err
+		}
+		return types.ErrInternalError.WithMessage("failed to assign role").Wrap(err)
+	}
+	s.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditRoleAssigned, SubjectID: userID, Metadata: map[string]string{"role": role}})
+	return nil
+}
+
+// UnassignRole removes a role from a user
+func (s *RoleService) UnassignRole(ctx context.Context, userID, role string) error {
+	ctx, span := tracer.Start(ctx, "RoleService.UnassignRole")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	found, err := s.RoleRepo.UnassignRole(ctx, userID, role)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to unassign role").Wrap(err)
+	}
+	if !found {
+		return types.ErrRoleNotFound.WithMessage("the user does not hold this role")
+	}
+	s.Audit.Record(ctx, &models.AuditEvent{Type: models.AuditRoleUnassigned, SubjectID: userID, Metadata: map[string]string{"role": role}})
+	return nil
+}
+
+// ListUserRoles returns the roles of a user and the permissions they grant
+func (s *RoleService) ListUserRoles(ctx context.Context, userID string) ([]string, []string, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.ListUserRoles")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, nil, types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	roles, permissions, err := s.RoleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, types.ErrInternalError.WithMessage("failed to load roles").Wrap(err)
+	}
+	return roles, permissions, nil
+}
+
+// CheckPermission reports whether the user of an access token holds a permission. Roles are read
+// from the database rather than the token, so revoked roles stop counting immediately. For tokens
+// scoped to an organization the roles the user holds there count.
+// Tokens issued to OAuth clients have no user and hold no permissions.
+func (s *RoleService) CheckPermission(ctx context.Context, accessToken, permission string) (*PermissionCheck, error) {
+	ctx, span := tracer.Start(ctx, "RoleService.CheckPermission")
+	defer span.End()
+
+	if permission == "" {
+		return nil, types.ErrInvalidRequest.WithMessage("permission is required").WithField("permission")
+	}
+	claims, err := utils.ValidateJWT(accessToken)
+	if err != nil {
+		return nil, types.ErrUnauthenticated.WithMessage("invalid access token")
+	}
+	if claims.UserID == "" {
+		return &PermissionCheck{}, nil
+	}
+
+	var roles, permissions []string
+	if claims.OrgID != "" {
+		roles, permissions, err = s.RoleRepo.GetMemberRoles(ctx, claims.OrgID, claims.UserID)
+		if errors.Is(err, types.ErrNotMember) {
+			return &PermissionCheck{UserID: claims.UserID}, nil
+		}
+	} else {
+		roles, permissions, err = s.RoleRepo.GetUserRoles(ctx, claims.UserID)
+	}
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load roles").Wrap(err)
+	}
+	return &PermissionCheck{
+		Allowed: models.HasPermission(permissions, permission),
+		UserID:  claims.UserID,
+		Roles:   roles,
+	}, nil
+}
+
+// normalizePermissions validates permissions and returns them sorted without duplicates
+func normalizePermissions(permissions []string) ([]string, error) {
+	for _, permission := range permissions {
+		if len(permission) > maxPermissionLength || !permissionPattern.MatchString(permission) {
+			return nil, types.ErrInvalidRole.WithMessage("invalid permission " + permission).WithField("permissions")
+		}
+	}
+	normalized := append([]string{}, permissions...) // Never nil: a NULL array would match no rows when replacing permissions
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/tracing"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	refreshTokenTTL  = 7 * 24 * time.Hour
+	passwordResetTTL = 15 * time.Minute
+	magicLinkTTL     = 10 * time.Minute
+
+	minDeviceNonceLength = 16
+	maxDeviceNonceLength = 256
+)
+
+// hashPassword hashes a password in its own span so bcrypt cost is visible in traces
+func hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracer.Start(ctx, "bcrypt.Hash")
+	hashed, err := utils.HashPassword(password)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to hash password").Wrap(err)
+	}
+	return hashed, nil
+}
+
+// checkPassword compares a password against its bcrypt hash in its own span
+func checkPassword(ctx context.Context, password, hash string) bool {
+	_, span := tracer.Start(ctx, "bcrypt.Compare")
+	defer span.End()
+	return utils.CheckPasswordHash(password, hash)
+}
+
+// tokenLifetimes controls how long issued access and refresh tokens stay valid
+type tokenLifetimes struct {
+	access  time.Duration
+	refresh time.Duration
+}
+
+// tokenGrant identifies the OAuth client tokens are issued to and the scope granted to it, which
+// access tokens carry. The zero value is for the user's own sessions, started through the login RPCs
+// of this service.
+type tokenGrant struct {
+	clientID string
+	scope    string
+}
+
+// apply records the grant in access token claims. Tokens issued to a client carry none of the
+// user's roles, and only those of the user's permissions that the granted scope names, so a client
+// never acts with more than the user consented to.
+func (g tokenGrant) apply(claims *utils.Claims) {
+	claims.ClientID = g.clientID
+	claims.Scope = g.scope
+	if g.clientID != "" {
+		claims.Roles = nil
+		claims.Permissions = scopePermissions(claims.Permissions, permissionScopes(g.scope))
+	}
+}
+
+// permissionScopes returns the scopes of a grant that name permissions, such as reports:read.
+// OpenID Connect scopes only select UserInfo claims.
+func permissionScopes(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if strings.Contains(s, ":") {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// storedClientID returns the client of the grant as stored with refresh tokens
+func (g tokenGrant) storedClientID() sql.NullString {
+	return sql.NullString{String: g.clientID, Valid: g.clientID != ""}
+}
+
+var defaultLifetimes = tokenLifetimes{access: utils.AccessTokenTTL, refresh: refreshTokenTTL}
+
+// clientLifetimes returns the token lifetimes configured for an OAuth client, falling back to the defaults
+func clientLifetimes(client *models.OAuthClient) tokenLifetimes {
+	lifetimes := defaultLifetimes
+	if client.AccessTokenTTL > 0 {
+		lifetimes.access = client.AccessTokenTTL
+	}
+	if client.RefreshTokenTTL > 0 {
+		lifetimes.refresh = client.RefreshTokenTTL
+	}
+	return lifetimes
+}
+
+// generateAccessToken creates an access token carrying the given claims
+func generateAccessToken(ctx context.Context, claims utils.Claims, ttl time.Duration) (string, error) {
+	_, span := tracer.Start(ctx, "GenerateAccessToken")
+	accessToken, err := utils.GenerateJWTWithClaims(claims, ttl)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to generate access token").Wrap(err)
+	}
+	return accessToken, nil
+}
+
+// generateTokens creates an access token carrying the given claims and a refresh token
+func generateTokens(ctx context.Context, claims utils.Claims, accessTTL time.Duration) (string, string, error) {
+	_, span := tracer.Start(ctx, "GenerateTokens")
+
+	accessToken, err := utils.GenerateJWTWithClaims(claims, accessTTL)
+	if err != nil {
+		tracing.EndSpan(span, err)
+		return "", "", types.ErrInternalError.WithMessage("failed to generate access token").Wrap(err)
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		tracing.EndSpan(span, err)
+		return "", "", types.ErrInternalError.WithMessage("failed to generate refresh token").Wrap(err)
+	}
+
+	span.End()
+	return accessToken, refreshToken, nil
+}
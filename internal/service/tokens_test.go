@@ -0,0 +1,40 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/kraftzpepe/auth-service/internal/utils"
+)
+
+func TestTokenGrantNarrowsClientPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		grant       tokenGrant
+		permissions []string
+		roles       []string
+	}{
+		{name: "own session", grant: tokenGrant{}, permissions: []string{"*"}, roles: []string{"admin"}},
+		{name: "OpenID Connect scopes", grant: tokenGrant{clientID: "app", scope: "openid email profile"}, permissions: []string{}},
+		{name: "permission scope", grant: tokenGrant{clientID: "app", scope: "openid reports:read"}, permissions: []string{"reports:read"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := utils.Claims{UserID: "user", Roles: []string{"admin"}, Permissions: []string{"*"}}
+			tt.grant.apply(&claims)
+			if !slices.Equal(claims.Permissions, tt.permissions) || !slices.Equal(claims.Roles, tt.roles) {
+				t.Errorf("claims = %+v, want permissions %v and roles %v", claims, tt.permissions, tt.roles)
+			}
+			if claims.ClientID != tt.grant.clientID || claims.Scope != tt.grant.scope {
+				t.Errorf("claims = %+v, want the grant recorded", claims)
+			}
+		})
+	}
+
+	// A scope only narrows what the user holds
+	claims := utils.Claims{UserID: "user", Permissions: []string{"reports:read"}}
+	tokenGrant{clientID: "app", scope: "users:manage reports:*"}.apply(&claims)
+	if !slices.Equal(claims.Permissions, []string{"reports:read"}) {
+		t.Errorf("permissions = %v, want [reports:read]", claims.Permissions)
+	}
+}
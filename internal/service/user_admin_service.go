@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	defaultUserPageSize   = 50
+	maxUserPageSize       = 500
+	maxStatusReasonLength = 500
+)
+
+// Email statuses ListUsers can filter by
+const (
+	EmailStatusVerified   = "verified"   // The user has proven control of their email address
+	EmailStatusUnverified = "unverified" // The user has not verified their email address yet
+)
+
+var userSortColumns = []string{repositories.UserSortCreatedAt, repositories.UserSortEmail, repositories.UserSortUsername}
+
+// UserQuery holds the filters, sort order and page of a ListUsers call as clients send them.
+// Empty fields do not filter.
+type UserQuery struct {
+	PageSize       int
+	PageToken      string
+	SortBy         string // created_at (default), email or username
+	Descending     bool
+	EmailPrefix    string
+	UsernamePrefix string
+	EmailDomain    string
+	Search         string // Prefix of the email or the username
+	CreatedAfter   string // RFC 3339, inclusive
+	CreatedBefore  string // RFC 3339, exclusive
+	Status         string // Account status, such as active or suspended
+	EmailStatus    string // verified or unverified
+	Role           string
+}
+
+// userCursor is the position encoded in a page token: the sort key of the last user of a page.
+// The sort order is included so a token cannot be replayed against another order.
+type userCursor struct {
+	SortBy     string    `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	ID         uuid.UUID `json:"i"`
+	CreatedAt  time.Time `json:"c"`
+	Email      string    `json:"e,omitempty"`
+	Username   string    `json:"u,omitempty"`
+}
+
+// UserAdminService serves the user administration RPCs used by support staff
+type UserAdminService struct {
+	AuthService *AuthService
+	UserRepo    *repositories.UserRepository
+	Webhooks    *WebhookService
+}
+
+func NewUserAdminService(authService *AuthService, userRepo *repositories.UserRepository, webhooks *WebhookService) *UserAdminService {
+	return &UserAdminService{AuthService: authService, UserRepo: userRepo, Webhooks: webhooks}
+}
+
+// ListUsers returns a page of users matching the query and the token of the next page, which is
+// empty on the last page
+func (s *UserAdminService) ListUsers(ctx context.Context, q UserQuery) ([]*models.User, string, error) {
+	ctx, span := tracer.Start(ctx, "UserAdminService.ListUsers")
+	defer span.End()
+
+	opts, err := userListOptions(q)
+	if err != nil {
+		return nil, "", err
+	}
+	pageSize := opts.Limit
+	opts.Limit++ // One extra row tells whether there is a next page
+
+	users, err := s.UserRepo.ListUsers(ctx, opts)
+	if err != nil {
+		return nil, "", types.ErrInternalError.WithMessage("failed to list users").Wrap(err)
+	}
+	if len(users) <= pageSize {
+		return users, "", nil
+	}
+	users = users[:pageSize]
+	return users, encodeUserCursor(opts.SortBy, opts.Descending, users[pageSize-1]), nil
+}
+
+// SuspendUser blocks a user from signing in and obtaining tokens, and ends their sessions by revoking
+// their refresh tokens. Access tokens already issued stay valid until they expire.
+func (s *UserAdminService) SuspendUser(ctx context.Context, userID, reason string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserAdminService.SuspendUser")
+	defer span.End()
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > maxStatusReasonLength {
+		return nil, types.ErrInvalidRequest.WithMessage("reason must be 1 to 500 characters").WithField("reason")
+	}
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == models.UserStatusDeleted {
+		return nil, types.ErrInvalidStatusChange.WithMessage("deleted accounts cannot be suspended")
+	}
+	return s.setStatus(ctx, user, models.UserStatusSuspended, reason)
+}
+
+// ReactivateUser makes a suspended, pending or deleted user active again
+func (s *UserAdminService) ReactivateUser(ctx context.Context, userID string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "UserAdminService.ReactivateUser")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == models.UserStatusActive {
+		return user, nil
+	}
+	return s.setStatus(ctx, user, models.UserStatusActive, "")
+}
+
+// DeleteUser deletes a user. A soft delete marks the account deleted and ends its sessions, keeping
+// the row so it can be reactivated; a hard delete removes the user along with all of their tokens,
+// API keys, roles and memberships.
+func (s *UserAdminService) DeleteUser(ctx context.Context, userID string, hard bool) error {
+	ctx, span := tracer.Start(ctx, "UserAdminService.DeleteUser")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !hard {
+		if user.Status == models.UserStatusDeleted {
+			return nil
+		}
+		if user, err = s.setStatus(ctx, user, models.UserStatusDeleted, ""); err != nil {
+			return err
+		}
+		s.Webhooks.PublishUserEvent(ctx, models.WebhookUserDeleted, user, "", false)
+		return nil
+	}
+
+	found, err := s.UserRepo.DeleteUser(ctx, userID)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to delete user").Wrap(err)
+	}
+	if !found {
+		return types.ErrUserNotFound
+	}
+	s.Webhooks.PublishUserEvent(ctx, models.WebhookUserDeleted, user, "", true)
+	return nil
+}
+
+// ForcePasswordReset makes a user choose a new password: their password is replaced with an unusable
+// one, their sessions end and they are emailed a password reset link. Access tokens already issued
+// stay valid until they expire.
+func (s *UserAdminService) ForcePasswordReset(ctx context.Context, userID string) (string, error) {
+	ctx, span := tracer.Start(ctx, "UserAdminService.ForcePasswordReset")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.Status == models.UserStatusDeleted {
+		return "", types.ErrInvalidStatusChange.WithMessage("deleted accounts cannot reset their password")
+	}
+
+	hashedPassword, err := hashPassword(ctx, utils.GenerateSecureToken(32))
+	if err != nil {
+		return "", err
+	}
+	found, err := s.UserRepo.ReplacePassword(ctx, userID, hashedPassword)
+	if err != nil {
+		return "", types.ErrInternalError.WithMessage("failed to replace password").Wrap(err)
+	}
+	if !found {
+		return "", types.ErrUserNotFound
+	}
+	if _, err := s.AuthService.sendPasswordReset(ctx, user); err != nil {
+		return "", err
+	}
+	return "Password reset email sent to " + user.Email + ".", nil
+}
+
+// RevokeSessions signs a user out everywhere by revoking their refresh tokens, and returns how many
+// were revoked. Access tokens already issued stay valid until they expire.
+func (s *UserAdminService) RevokeSessions(ctx context.Context, userID string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "UserAdminService.RevokeSessions")
+	defer span.End()
+
+	if _, err := s.getUser(ctx, userID); err != nil {
+		return 0, err
+	}
+	revoked, err := s.AuthService.RefreshTokenRepo.DeleteUserTokens(ctx, userID)
+	if err != nil {
+		return 0, types.ErrInternalError.WithMessage("failed to revoke sessions").Wrap(err)
+	}
+	return revoked, nil
+}
+
+func (s *UserAdminService) getUser(ctx context.Context, userID string) (*models.User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, types.ErrInvalidIdentifier.WithMessage("user_id must be a UUID").WithField("user_id")
+	}
+	user, err := s.UserRepo.GetUserByUUID(ctx, userID)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load user").Wrap(err)
+	}
+	if user == nil {
+		return nil, types.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *UserAdminService) setStatus(ctx context.Context, user *models.User, status, reason string) (*models.User, error) {
+	found, err := s.UserRepo.SetStatus(ctx, user.ID.String(), status, reason)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to update user status").Wrap(err)
+	}
+	if !found {
+		return nil, types.ErrUserNotFound
+	}
+	user.Status = status
+	user.StatusReason = reason
+	return user, nil
+}
+
+// userListOptions validates a query and converts it into repository options
+func userListOptions(q UserQuery) (repositories.UserListOptions, error) {
+	opts := repositories.UserListOptions{
+		EmailPrefix:    strings.TrimSpace(q.EmailPrefix),
+		UsernamePrefix: strings.TrimSpace(q.UsernamePrefix),
+		EmailDomain:    strings.TrimPrefix(strings.TrimSpace(q.EmailDomain), "@"),
+		Search:         strings.TrimSpace(q.Search),
+		Role:           q.Role,
+		SortBy:         q.SortBy,
+		Descending:     q.Descending,
+		Limit:          q.PageSize,
+	}
+
+	switch {
+	case q.PageSize < 0 || q.PageSize > maxUserPageSize:
+		return opts, types.ErrInvalidRequest.WithMessage("page_size must be between 1 and 500").WithField("page_size")
+	case q.PageSize == 0:
+		opts.Limit = defaultUserPageSize
+	}
+	if opts.SortBy == "" {
+		opts.SortBy = repositories.UserSortCreatedAt
+	}
+	if !slices.Contains(userSortColumns, opts.SortBy) {
+		return opts, types.ErrInvalidRequest.WithMessage("sort_by must be one of " + strings.Join(userSortColumns, ", ")).WithField("sort_by")
+	}
+
+	var err error
+	if opts.CreatedAfter, err = parseUserTime(q.CreatedAfter, "created_after"); err != nil {
+		return opts, err
+	}
+	if opts.CreatedBefore, err = parseUserTime(q.CreatedBefore, "created_before"); err != nil {
+		return opts, err
+	}
+
+	if q.Status != "" && !slices.Contains(models.UserStatuses, q.Status) {
+		return opts, types.ErrInvalidRequest.WithMessage("status must be one of " + strings.Join(models.UserStatuses, ", ")).WithField("status")
+	}
+	opts.Status = q.Status
+
+	switch q.EmailStatus {
+	case "":
+	case EmailStatusVerified, EmailStatusUnverified:
+		verified := q.EmailStatus == EmailStatusVerified
+		opts.EmailVerified = &verified
+	default:
+		return opts, types.ErrInvalidRequest.WithMessage("email_status must be verified or unverified").WithField("email_status")
+	}
+
+	if q.PageToken != "" {
+		if opts.After, err = decodeUserCursor(q.PageToken, opts.SortBy, opts.Descending); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func parseUserTime(value, field string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, types.ErrInvalidRequest.WithMessage(field + " must be an RFC 3339 timestamp").WithField(field)
+	}
+	return t, nil
+}
+
+func encodeUserCursor(sortBy string, descending bool, last *models.User) string {
+	cursor := userCursor{SortBy: sortBy, Descending: descending, ID: last.ID}
+	switch sortBy {
+	case repositories.UserSortEmail:
+		cursor.Email = last.Email
+	case repositories.UserSortUsername:
+		cursor.Username = last.Username
+	default:
+		cursor.CreatedAt = last.CreatedAt
+	}
+	data, _ := json.Marshal(cursor) // Cannot fail for this struct
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeUserCursor returns the user to continue after, rejecting tokens issued for another sort order
+func decodeUserCursor(token, sortBy string, descending bool) (*models.User, error) {
+	invalid := types.ErrInvalidRequest.WithMessage("invalid page_token").WithField("page_token")
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor userCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, invalid
+	}
+	if cursor.SortBy != sortBy || cursor.Descending != descending {
+		return nil, types.ErrInvalidRequest.WithMessage("page_token was issued for another sort order").WithField("page_token")
+	}
+	return &models.User{ID: cursor.ID, CreatedAt: cursor.CreatedAt, Email: cursor.Email, Username: cursor.Username}, nil
+}
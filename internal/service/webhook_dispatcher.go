@@ -0,0 +1,211 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/metrics"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookIDHeader        = "X-Webhook-Id"        // ID of the event, the same on every attempt; receivers use it to drop duplicates
+	WebhookEventHeader     = "X-Webhook-Event"     // Event type
+	WebhookTimestampHeader = "X-Webhook-Timestamp" // Unix time of the attempt, covered by the signature
+	WebhookSignatureHeader = "X-Webhook-Signature" // v1=<hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret>
+)
+
+const (
+	webhookBatchSize      = 20
+	webhookMaxAttempts    = 10
+	webhookBaseBackoff    = 30 * time.Second
+	webhookMaxBackoff     = 6 * time.Hour
+	webhookLeaseMargin    = time.Minute // Added to the timeout to keep claimed deliveries from being picked up twice
+	maxWebhookErrorLength = 500
+)
+
+// WebhookSignature signs a delivery body sent at timestamp with a subscription secret
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher sends queued webhook deliveries in the background. Deliveries live in the
+// database, so they survive restarts, and several instances can dispatch side by side.
+type WebhookDispatcher struct {
+	WebhookRepo *repositories.WebhookRepository
+	Client      *http.Client
+
+	interval time.Duration
+	timeout  time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewWebhookDispatcher creates a dispatcher that looks for due deliveries every interval and gives
+// endpoints timeout to answer
+func NewWebhookDispatcher(webhookRepo *repositories.WebhookRepository, interval, timeout time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		WebhookRepo: webhookRepo,
+		Client: &http.Client{
+			Timeout: timeout,
+			// A redirect could point the signed payload anywhere; endpoints must answer themselves
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		interval: interval,
+		timeout:  timeout,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start sends due deliveries in the background until Shutdown
+func (d *WebhookDispatcher) Start() {
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			// Keep going while full batches come back, so a backlog drains without waiting
+			for d.dispatch() == webhookBatchSize {
+				select {
+				case <-d.stop:
+					return
+				default:
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops dispatching and waits for the deliveries in flight
+func (d *WebhookDispatcher) Shutdown() {
+	close(d.stop)
+	<-d.done
+}
+
+// dispatch claims a batch of due deliveries, sends them concurrently and returns how many it claimed
+func (d *WebhookDispatcher) dispatch() int {
+	ctx, span := tracer.Start(context.Background(), "WebhookDispatcher.dispatch")
+	defer span.End()
+
+	now := time.Now()
+	claimed, err := d.WebhookRepo.ClaimDueDeliveries(ctx, now, now.Add(d.timeout+webhookLeaseMargin), webhookBatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to claim webhook deliveries", "error", err)
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range claimed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, c)
+		}()
+	}
+	wg.Wait()
+	return len(claimed)
+}
+
+// deliver makes one attempt at a delivery and records its outcome, scheduling a retry with
+// exponential back-off after a failure until the attempts run out
+func (d *WebhookDispatcher) deliver(ctx context.Context, c *repositories.ClaimedDelivery) {
+	delivery := c.Delivery
+	status, err := d.send(ctx, c)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = sql.NullTime{Time: now, Valid: true}
+	delivery.ResponseStatus = sql.NullInt32{Int32: int32(status), Valid: status != 0}
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+		metrics.WebhookDeliveries.WithLabelValues(delivery.EventType, metrics.ResultSuccess).Inc()
+	case delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.LastError = truncate(err.Error(), maxWebhookErrorLength)
+		metrics.WebhookDeliveries.WithLabelValues(delivery.EventType, metrics.ResultFailure).Inc()
+	default:
+		delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+		delivery.LastError = truncate(err.Error(), maxWebhookErrorLength)
+		metrics.WebhookDeliveries.WithLabelValues(delivery.EventType, metrics.ResultFailure).Inc()
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "webhook delivery failed", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID,
+			"event_type", delivery.EventType, "attempt", delivery.Attempts, "status", delivery.Status, "error", err)
+	}
+
+	if err := d.WebhookRepo.RecordAttempt(ctx, delivery); err != nil {
+		slog.ErrorContext(ctx, "failed to record webhook delivery attempt", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// send posts the signed payload and returns the response status, if the endpoint answered, and an
+// error unless it answered with a 2xx status
+func (d *WebhookDispatcher) send(ctx context.Context, c *repositories.ClaimedDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(c.Delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "auth-service-webhooks")
+	req.Header.Set(WebhookIDHeader, c.Delivery.EventID.String())
+	req.Header.Set(WebhookEventHeader, c.Delivery.EventType)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, WebhookSignature(c.Secret, timestamp, c.Delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16)) // Lets the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff returns the delay before the attempt following attempt number n: 30s doubling up
+// to 6h, with up to 10% jitter so retries of many deliveries spread out
+func webhookBackoff(n int) time.Duration {
+	delay := webhookMaxBackoff
+	if n <= 15 {
+		delay = min(webhookBaseBackoff<<(n-1), webhookMaxBackoff)
+	}
+	return delay + rand.N(delay/10)
+}
+
+// truncate shortens s to at most limit bytes without splitting a character
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "")
+}
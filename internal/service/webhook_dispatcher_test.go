@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	// HMAC-SHA256 of `1700000000.{"id":"evt_1"}` keyed with whsec_test, computed with openssl
+	want := "v1=c89214b5b5da833daed6f0b8c5bb6bd58cea9022bd80ccc78230f3942d632925"
+	if got := WebhookSignature("whsec_test", 1700000000, body); got != want {
+		t.Errorf("WebhookSignature = %s, want %s", got, want)
+	}
+
+	for name, got := range map[string]string{
+		"secret":    WebhookSignature("whsec_other", 1700000000, body),
+		"timestamp": WebhookSignature("whsec_test", 1700000001, body),
+		"body":      WebhookSignature("whsec_test", 1700000000, []byte(`{"id":"evt_2"}`)),
+	} {
+		if got == want {
+			t.Errorf("signature does not cover the %s", name)
+		}
+	}
+}
+
+// verifyWebhook checks a delivery as a receiver would: it recomputes the signature over the
+// timestamp header and the raw body with the shared secret
+func verifyWebhook(r *http.Request, body []byte, secret string) bool {
+	timestamp := r.Header.Get(WebhookTimestampHeader)
+	signature, ok := strings.CutPrefix(r.Header.Get(WebhookSignatureHeader), "v1=")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	expected, err := hex.DecodeString(signature)
+	return err == nil && hmac.Equal(mac.Sum(nil), expected)
+}
+
+func newTestWebhookDispatcher(t *testing.T) *WebhookDispatcher {
+	env := newTestEnv(t)
+	env.db.on("UPDATE webhook_deliveries", func([]driver.Value) fakeResult { return fakeResult{affected: 1} })
+	return NewWebhookDispatcher(repositories.NewWebhookRepository(env.sqlDB), time.Minute, 5*time.Second)
+}
+
+func newClaimedDelivery(url string) *repositories.ClaimedDelivery {
+	return &repositories.ClaimedDelivery{
+		Delivery: &models.WebhookDelivery{
+			ID:        1,
+			EventID:   uuid.New(),
+			EventType: models.WebhookUserCreated,
+			Payload:   []byte(`{"type":"user.created"}`),
+			Status:    models.WebhookDeliveryPending,
+		},
+		URL:    url,
+		Secret: "whsec_test",
+	}
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if verifyWebhook(r, body, "whsec_test") {
+			received <- r
+		}
+	}))
+	defer endpoint.Close()
+
+	c := newClaimedDelivery(endpoint.URL)
+	start := time.Now().Unix()
+	newTestWebhookDispatcher(t).deliver(context.Background(), c)
+
+	var headers http.Header
+	select {
+	case r := <-received:
+		headers = r.Header
+	default:
+		t.Fatal("endpoint could not verify the signature")
+	}
+	timestamp, err := strconv.ParseInt(headers.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil || timestamp < start || timestamp > time.Now().Unix() {
+		t.Errorf("timestamp header = %q, want the time of the attempt", headers.Get(WebhookTimestampHeader))
+	}
+	if headers.Get(WebhookIDHeader) != c.Delivery.EventID.String() || headers.Get(WebhookEventHeader) != models.WebhookUserCreated {
+		t.Errorf("headers = %v, want the event's ID and type", headers)
+	}
+	if c.Delivery.Status != models.WebhookDeliverySucceeded || c.Delivery.Attempts != 1 {
+		t.Errorf("delivery = %+v, want it succeeded after one attempt", *c.Delivery)
+	}
+}
+
+func TestWebhookSignatureFailsWithAnotherSecret(t *testing.T) {
+	verified := make(chan bool, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified <- verifyWebhook(r, body, "whsec_other")
+	}))
+	defer endpoint.Close()
+
+	newTestWebhookDispatcher(t).deliver(context.Background(), newClaimedDelivery(endpoint.URL))
+	if <-verified {
+		t.Error("signature verified with the wrong secret")
+	}
+}
+
+func TestWebhookDeliveryRetriesFailures(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusFound} {
+		endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// A redirect must not be followed, since it could send the signed payload elsewhere
+			w.Header().Set("Location", "https://elsewhere.example.com/")
+			w.WriteHeader(status)
+		}))
+
+		c := newClaimedDelivery(endpoint.URL)
+		start := time.Now()
+		newTestWebhookDispatcher(t).deliver(context.Background(), c)
+		endpoint.Close()
+
+		d := c.Delivery
+		if d.Status != models.WebhookDeliveryPending || d.Attempts != 1 || d.ResponseStatus.Int32 != int32(status) || d.LastError == "" {
+			t.Errorf("status %d: delivery = %+v, want it pending with the failure recorded", status, *d)
+		}
+		if wait := d.NextAttemptAt.Sub(start); wait < webhookBaseBackoff || wait > webhookBaseBackoff*11/10+time.Second {
+			t.Errorf("status %d: next attempt in %v, want about %v", status, wait, webhookBaseBackoff)
+		}
+	}
+}
+
+func TestWebhookDeliveryGivesUpAfterMaxAttempts(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer endpoint.Close()
+
+	c := newClaimedDelivery(endpoint.URL)
+	c.Delivery.Attempts = webhookMaxAttempts - 1
+	newTestWebhookDispatcher(t).deliver(context.Background(), c)
+	if c.Delivery.Status != models.WebhookDeliveryFailed {
+		t.Errorf("delivery = %+v, want it failed", *c.Delivery)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 5: 8 * time.Minute, 12: webhookMaxBackoff, 40: webhookMaxBackoff} {
+		if got := webhookBackoff(n); got < want || got >= want+want/10 {
+			t.Errorf("webhookBackoff(%d) = %v, want %v plus up to 10%% jitter", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kraftzpepe/auth-service/internal/models"
+	"github.com/kraftzpepe/auth-service/internal/repositories"
+	"github.com/kraftzpepe/auth-service/internal/utils"
+	"github.com/kraftzpepe/auth-service/types"
+)
+
+const (
+	webhookSecretBytes          = 32
+	maxWebhookURLLength         = 2048
+	maxWebhookDescriptionLength = 200
+	defaultDeliveryPageSize     = 50
+	maxDeliveryPageSize         = 500
+)
+
+// Webhook subscription fields that can be named in an update mask
+const (
+	WebhookFieldURL         = "url"
+	WebhookFieldEventTypes  = "event_types"
+	WebhookFieldDescription = "description"
+	WebhookFieldActive      = "active"
+)
+
+var webhookFields = []string{WebhookFieldURL, WebhookFieldEventTypes, WebhookFieldDescription, WebhookFieldActive}
+
+// WebhookParams holds the subscription settings an administrator controls
+type WebhookParams struct {
+	URL         string
+	EventTypes  []string
+	Description string
+	Active      bool
+}
+
+// WebhookDeliveryQuery holds the filters and page of a ListWebhookDeliveries call as clients send them.
+// Empty fields do not filter.
+type WebhookDeliveryQuery struct {
+	SubscriptionID string
+	Status         string
+	EventType      string
+	PageSize       int
+	PageToken      string
+}
+
+// webhookEvent is the JSON body of a webhook delivery
+type webhookEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      webhookEventData `json:"data"`
+}
+
+type webhookEventData struct {
+	User          webhookUser `json:"user"`
+	PreviousEmail string      `json:"previous_email,omitempty"` // Set for user.email_changed
+	Hard          bool        `json:"hard,omitempty"`           // Set for user.deleted when the account was removed
+}
+
+// webhookUser is the user an event is about, without credentials
+type webhookUser struct {
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	OrgID         string    `json:"org_id,omitempty"`
+	Status        string    `json:"status"`
+	DisplayName   string    `json:"display_name,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// WebhookService manages webhook subscriptions and queues user lifecycle events for delivery.
+// A WebhookDispatcher sends the queued deliveries.
+type WebhookService struct {
+	WebhookRepo *repositories.WebhookRepository
+	UserRepo    *repositories.UserRepository
+}
+
+func NewWebhookService(webhookRepo *repositories.WebhookRepository, userRepo *repositories.UserRepository) *WebhookService {
+	return &WebhookService{WebhookRepo: webhookRepo, UserRepo: userRepo}
+}
+
+// CreateSubscription registers an endpoint for the given event types and returns the subscription
+// with the secret that signs its deliveries
+func (s *WebhookService) CreateSubscription(ctx context.Context, params WebhookParams) (*models.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.CreateSubscription")
+	defer span.End()
+
+	now := time.Now()
+	sub := &models.WebhookSubscription{
+		ID:          uuid.New(),
+		URL:         params.URL,
+		EventTypes:  params.EventTypes,
+		Description: strings.TrimSpace(params.Description),
+		Secret:      models.WebhookSecretPrefix + utils.GenerateSecureToken(webhookSecretBytes),
+		Active:      true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := validateWebhook(sub); err != nil {
+		return nil, err
+	}
+	if err := s.WebhookRepo.CreateSubscription(ctx, sub); err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to save webhook subscription").Wrap(err)
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns every webhook subscription
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ListSubscriptions")
+	defer span.End()
+
+	subs, err := s.WebhookRepo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to list webhook subscriptions").Wrap(err)
+	}
+	return subs, nil
+}
+
+// UpdateSubscription changes the fields of a subscription named in fields, or all of them when fields
+// is empty. Deliveries already queued are sent to the new URL.
+func (s *WebhookService) UpdateSubscription(ctx context.Context, id string, params WebhookParams, fields []string) (*models.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.UpdateSubscription")
+	defer span.End()
+
+	if len(fields) == 0 {
+		fields = webhookFields
+	}
+	for _, field := range fields {
+		if !slices.Contains(webhookFields, field) {
+			return nil, types.ErrInvalidRequest.WithMessage("unknown field in update_mask: " + field).WithField("update_mask")
+		}
+	}
+
+	sub, err := s.getSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(fields, WebhookFieldURL) {
+		sub.URL = params.URL
+	}
+	if slices.Contains(fields, WebhookFieldEventTypes) {
+		sub.EventTypes = params.EventTypes
+	}
+	if slices.Contains(fields, WebhookFieldDescription) {
+		sub.Description = strings.TrimSpace(params.Description)
+	}
+	if slices.Contains(fields, WebhookFieldActive) {
+		sub.Active = params.Active
+	}
+	if err := validateWebhook(sub); err != nil {
+		return nil, err
+	}
+	sub.UpdatedAt = time.Now()
+
+	found, err := s.WebhookRepo.UpdateSubscription(ctx, sub)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to update webhook subscription").Wrap(err)
+	}
+	if !found {
+		return nil, types.ErrWebhookNotFound
+	}
+	return sub, nil
+}
+
+// DeleteSubscription removes a subscription and its queued and past deliveries
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.DeleteSubscription")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return types.ErrInvalidIdentifier.WithMessage("id must be a UUID").WithField("id")
+	}
+	found, err := s.WebhookRepo.DeleteSubscription(ctx, id)
+	if err != nil {
+		return types.ErrInternalError.WithMessage("failed to delete webhook subscription").Wrap(err)
+	}
+	if !found {
+		return types.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListDeliveries returns a page of deliveries matching the query, newest first, and the token of the
+// next page, which is empty on the last page
+func (s *WebhookService) ListDeliveries(ctx context.Context, q WebhookDeliveryQuery) ([]*models.WebhookDelivery, string, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ListDeliveries")
+	defer span.End()
+
+	opts := repositories.WebhookDeliveryListOptions{
+		SubscriptionID: q.SubscriptionID,
+		Status:         q.Status,
+		EventType:      q.EventType,
+		Limit:          q.PageSize,
+	}
+	switch {
+	case q.PageSize < 0 || q.PageSize > maxDeliveryPageSize:
+		return nil, "", types.ErrInvalidRequest.WithMessage("page_size must be between 1 and 500").WithField("page_size")
+	case q.PageSize == 0:
+		opts.Limit = defaultDeliveryPageSize
+	}
+	if q.SubscriptionID != "" {
+		if _, err := uuid.Parse(q.SubscriptionID); err != nil {
+			return nil, "", types.ErrInvalidIdentifier.WithMessage("subscription_id must be a UUID").WithField("subscription_id")
+		}
+	}
+	if q.Status != "" && !slices.Contains(models.WebhookDeliveryStatuses, q.Status) {
+		return nil, "", types.ErrInvalidRequest.WithMessage("status must be one of " + strings.Join(models.WebhookDeliveryStatuses, ", ")).WithField("status")
+	}
+	if q.PageToken != "" {
+		// Deliveries are ordered by ID alone, so the token is the ID of the last delivery of the previous page
+		var err error
+		if opts.BeforeID, err = strconv.ParseInt(q.PageToken, 10, 64); err != nil || opts.BeforeID <= 0 {
+			return nil, "", types.ErrInvalidRequest.WithMessage("invalid page_token").WithField("page_token")
+		}
+	}
+
+	pageSize := opts.Limit
+	opts.Limit++ // One extra row tells whether there is a next page
+	deliveries, err := s.WebhookRepo.ListDeliveries(ctx, opts)
+	if err != nil {
+		return nil, "", types.ErrInternalError.WithMessage("failed to list webhook deliveries").Wrap(err)
+	}
+	if len(deliveries) <= pageSize {
+		return deliveries, "", nil
+	}
+	deliveries = deliveries[:pageSize]
+	return deliveries, strconv.FormatInt(deliveries[pageSize-1].ID, 10), nil
+}
+
+// ReplayDeliveries queues failed deliveries again, each with a fresh set of attempts: the delivery
+// with deliveryID when it is set, or else every failed delivery of subscriptionID. It returns the
+// number of deliveries queued.
+func (s *WebhookService) ReplayDeliveries(ctx context.Context, deliveryID int64, subscriptionID string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ReplayDeliveries")
+	defer span.End()
+
+	switch {
+	case deliveryID < 0:
+		return 0, types.ErrInvalidIdentifier.WithMessage("delivery_id must be positive").WithField("delivery_id")
+	case deliveryID == 0 && subscriptionID == "":
+		return 0, types.ErrInvalidRequest.WithMessage("delivery_id or subscription_id is required")
+	case subscriptionID != "":
+		if _, err := s.getSubscription(ctx, subscriptionID); err != nil {
+			return 0, err
+		}
+	}
+
+	replayed, err := s.WebhookRepo.ReplayDeliveries(ctx, deliveryID, subscriptionID, time.Now())
+	if err != nil {
+		return 0, types.ErrInternalError.WithMessage("failed to replay webhook deliveries").Wrap(err)
+	}
+	if deliveryID != 0 && replayed == 0 {
+		return 0, types.ErrDeliveryNotFound.WithMessage("no failed webhook delivery with this delivery_id")
+	}
+	return replayed, nil
+}
+
+// PublishUserEvent queues an event about a user for every subscription to its type. previousEmail
+// is set for user.email_changed events, and hard for user.deleted events that removed the account.
+// Failures are logged rather than returned so that the operation that caused the event stands.
+func (s *WebhookService) PublishUserEvent(ctx context.Context, eventType string, user *models.User, previousEmail string, hard bool) {
+	// The event is queued even if the caller gives up on the request
+	ctx, span := tracer.Start(context.WithoutCancel(ctx), "WebhookService.PublishUserEvent")
+	defer span.End()
+
+	now := time.Now().UTC()
+	event := webhookEvent{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		CreatedAt: now,
+		Data: webhookEventData{
+			User: webhookUser{
+				ID:            user.ID.String(),
+				Username:      user.Username,
+				Email:         user.Email,
+				EmailVerified: user.EmailVerified,
+				Status:        user.Status,
+				DisplayName:   user.DisplayName,
+				CreatedAt:     user.CreatedAt.UTC(),
+			},
+			PreviousEmail: previousEmail,
+			Hard:          hard,
+		},
+	}
+	if user.OrgID.Valid {
+		event.Data.User.OrgID = user.OrgID.UUID.String()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.logFailure(ctx, eventType, user.ID.String(), err)
+		return
+	}
+
+	if _, err := s.WebhookRepo.EnqueueDeliveries(ctx, &models.WebhookDelivery{
+		EventID:   uuid.MustParse(event.ID),
+		EventType: eventType,
+		Payload:   payload,
+		CreatedAt: now,
+	}); err != nil {
+		s.logFailure(ctx, eventType, user.ID.String(), err)
+	}
+}
+
+// PublishUserChange loads the current state of a user that was just changed and queues an event
+// about it, like PublishUserEvent
+func (s *WebhookService) PublishUserChange(ctx context.Context, eventType, userID, previousEmail string) {
+	user, err := s.UserRepo.GetUserByUUID(context.WithoutCancel(ctx), userID)
+	if err == nil && user == nil {
+		err = types.ErrUserNotFound
+	}
+	if err != nil {
+		s.logFailure(ctx, eventType, userID, err)
+		return
+	}
+	s.PublishUserEvent(ctx, eventType, user, previousEmail, false)
+}
+
+func (s *WebhookService) logFailure(ctx context.Context, eventType, userID string, err error) {
+	utils.LoggerFromContext(ctx).ErrorContext(ctx, "failed to queue webhook event", "type", eventType, "user_id", userID, "error", err)
+}
+
+func (s *WebhookService) getSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, types.ErrInvalidIdentifier.WithMessage("id must be a UUID").WithField("id")
+	}
+	sub, err := s.WebhookRepo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, types.ErrInternalError.WithMessage("failed to load webhook subscription").Wrap(err)
+	}
+	if sub == nil {
+		return nil, types.ErrWebhookNotFound
+	}
+	return sub, nil
+}
+
+// validateWebhook checks the settings of a subscription and normalizes its event types
+func validateWebhook(sub *models.WebhookSubscription) error {
+	if err := validateWebhookURL(sub.URL); err != nil {
+		return err
+	}
+	if len(sub.Description) > maxWebhookDescriptionLength {
+		return types.ErrInvalidWebhook.WithMessage("description must be at most 200 characters").WithField(WebhookFieldDescription)
+	}
+	if len(sub.EventTypes) == 0 {
+		return types.ErrInvalidWebhook.WithMessage("at least one event type is required").WithField(WebhookFieldEventTypes)
+	}
+	for _, eventType := range sub.EventTypes {
+		if !slices.Contains(models.WebhookEventTypes, eventType) {
+			return types.ErrInvalidWebhook.WithMessage("event types must be among " + strings.Join(models.WebhookEventTypes, ", ")).WithField(WebhookFieldEventTypes)
+		}
+	}
+	sub.EventTypes = slices.Compact(slices.Sorted(slices.Values(sub.EventTypes)))
+	return nil
+}
+
+// validateWebhookURL accepts absolute HTTPS URLs without credentials or a fragment. Plain HTTP is
+// only allowed for loopback addresses, for receivers under development.
+func validateWebhookURL(rawURL string) error {
+	invalid := func(message string) error {
+		return types.ErrInvalidWebhook.WithMessage(message).WithField(WebhookFieldURL)
+	}
+	if len(rawURL) > maxWebhookURLLength {
+		return invalid("url is too long")
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return invalid("url must be an absolute URL")
+	}
+	if parsed.User != nil || parsed.Fragment != "" {
+		return invalid("url must not contain credentials or a fragment")
+	}
+	if parsed.Scheme == "http" {
+		host := parsed.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	if parsed.Scheme != "https" {
+		return invalid("url must use https")
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate verification modes for ServerOptions.ClientAuth
+const (
+	ClientAuthNone     = "none"     // never ask for a client certificate
+	ClientAuthOptional = "optional" // verify a client certificate when one is presented
+	ClientAuthRequire  = "require"  // reject connections without a valid client certificate
+)
+
+// ServerOptions describes the server certificate and client verification policy
+type ServerOptions struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ClientAuth     string
+	ReloadInterval time.Duration
+}
+
+// Reloader serves a TLS configuration built from files on disk and rebuilds it when they change,
+// so certificates can be rotated without restarting the server
+type Reloader struct {
+	opts ServerOptions
+
+	mu      sync.RWMutex
+	current *tls.Config
+	modTime map[string]time.Time
+
+	stop chan struct{}
+}
+
+// NewReloader loads the configured files and starts watching them for changes
+func NewReloader(opts ServerOptions) (*Reloader, error) {
+	if opts.ClientAuth == "" {
+		opts.ClientAuth = ClientAuthNone
+	}
+	if opts.ClientAuth != ClientAuthNone && opts.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth %q requires a client CA file", opts.ClientAuth)
+	}
+
+	r := &Reloader{opts: opts, stop: make(chan struct{})}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	if opts.ReloadInterval > 0 {
+		go r.watch()
+	}
+	return r, nil
+}
+
+// Config returns a tls.Config that always hands out the most recently loaded certificates
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.current, nil
+		},
+	}
+}
+
+// Close stops watching the files
+func (r *Reloader) Close() {
+	close(r.stop)
+}
+
+func (r *Reloader) watch() {
+	ticker := time.NewTicker(r.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				slog.Error("failed to reload TLS certificates, keeping previous ones", "error", err)
+				continue
+			}
+			slog.Info("reloaded TLS certificates")
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(r.modTime[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) reload() error {
+	modTime := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTime[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.NoClientCert,
+	}
+
+	if r.opts.ClientCAFile != "" {
+		pool, err := loadCertPool(r.opts.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = pool
+	}
+
+	switch r.opts.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("unknown client auth mode %q", r.opts.ClientAuth)
+	}
+
+	r.mu.Lock()
+	r.current = config
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+	callerKey
+)
+
+// Caller describes who made the current request, for the audit log
+type Caller struct {
+	ActorID   string // User or "client:<id>" of the bearer token, "admin" for the admin token, or empty
+	APIKeyID  string // Set when the bearer token was an API key
+	IP        string
+	UserAgent string
+}
+
+// ContextWithRequestID stores the correlation ID of the current request
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the correlation ID of the current request, or "" outside a request
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// ContextWithLogger stores a request-scoped logger
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// LoggerFromContext returns the request-scoped logger, falling back to the default logger
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// ContextWithCaller stores who made the current request
+func ContextWithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// CallerFromContext returns who made the current request; it is empty outside a request
+func CallerFromContext(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey).(Caller)
+	return caller
+}
@@ -1,32 +1,113 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/smtp"
 	"os"
+
+	"github.com/kraftzpepe/auth-service/internal/metrics"
+	"github.com/kraftzpepe/auth-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func SendPasswordResetEmail(email, token string) error {
+var tracer = tracing.Tracer("github.com/kraftzpepe/auth-service/internal/utils")
+
+func SendPasswordResetEmail(ctx context.Context, email, token string) error {
+	body := fmt.Sprintf("Click the link below to reset your password:\n\nhttps://example.com/reset-password?token=%s", token)
+	return sendEmail(ctx, "password_reset", email, "Password Reset Request", body)
+}
+
+// SendMagicLinkEmail sends a link that signs the user in without a password
+func SendMagicLinkEmail(ctx context.Context, email, token string) error {
+	body := fmt.Sprintf("Click the link below to sign in. It works once and expires in 10 minutes:\n\nhttps://example.com/magic-link?token=%s\n\nIf you did not ask to sign in, you can ignore this email.", token)
+	return sendEmail(ctx, "magic_link", email, "Your sign-in link", body)
+}
+
+// SendLoginCodeEmail sends a one-time code that signs the user in
+func SendLoginCodeEmail(ctx context.Context, email, code string) error {
+	body := fmt.Sprintf("Your sign-in code is %s. It expires in 10 minutes.\n\nIf you did not ask to sign in, you can ignore this email.", code)
+	return sendEmail(ctx, "login_code", email, "Your sign-in code: "+code, body)
+}
+
+// SendReauthCodeEmail sends a one-time code that confirms a sensitive action of a signed-in user
+func SendReauthCodeEmail(ctx context.Context, email, action, code string) error {
+	body := fmt.Sprintf("Your code to %s is %s. It expires in 10 minutes.\n\nIf you did not just try to %s, change your password now.", action, code, action)
+	return sendEmail(ctx, "reauth_code", email, "Your confirmation code: "+code, body)
+}
+
+// SendInvitationEmail sends an invitation to join an organization
+func SendInvitationEmail(ctx context.Context, email, orgName, token string) error {
+	body := fmt.Sprintf("You have been invited to join %s. Click the link below to accept the invitation:\n\nhttps://example.com/accept-invitation?token=%s", orgName, token)
+	return sendEmail(ctx, "invitation", email, "Invitation to join "+orgName, body)
+}
+
+// SendEmailChangeConfirmation sends the link that confirms a new email address
+func SendEmailChangeConfirmation(ctx context.Context, newEmail, token string) error {
+	body := fmt.Sprintf("Click the link below to confirm %s as the new email address of your account:\n\nhttps://example.com/confirm-email-change?token=%s", newEmail, token)
+	return sendEmail(ctx, "email_change_confirmation", newEmail, "Confirm your new email address", body)
+}
+
+// SendEmailChangeNotice tells the old address of an account about an email change, with a link that undoes it
+func SendEmailChangeNotice(ctx context.Context, oldEmail, newEmail, token string) error {
+	body := fmt.Sprintf("A change of your account's email address to %s was requested. If this was not you, click the link below to keep %s and sign out everywhere:\n\nhttps://example.com/revert-email-change?token=%s", newEmail, oldEmail, token)
+	return sendEmail(ctx, "email_change_notice", oldEmail, "Your email address is being changed", body)
+}
+
+// sendEmail delivers a plain text message through the configured SMTP server. kind labels
+// the message in traces, metrics and logs.
+func sendEmail(ctx context.Context, kind, email, subject, body string) error {
 	// Load SMTP settings from environment variables
 	smtpServer := os.Getenv("SMTP_SERVER")
 	smtpPort := os.Getenv("SMTP_PORT")
 	smtpUser := os.Getenv("SMTP_USER")
 	smtpPass := os.Getenv("SMTP_PASS")
 
-	// Email content
-	subject := "Password Reset Request"
-	body := fmt.Sprintf("Click the link below to reset your password:\n\nhttps://example.com/reset-password?token=%s", token)
 	message := fmt.Sprintf("Subject: %s\n\n%s", subject, body)
 
 	// SMTP authentication
 	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpServer)
 
 	// Sending email
+	_, span := tracer.Start(ctx, "smtp.SendMail", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("server.address", smtpServer),
+		attribute.String("email.type", kind),
+	))
 	err := smtp.SendMail(smtpServer+":"+smtpPort, auth, smtpUser, []string{email}, []byte(message))
+	tracing.EndSpan(span, err)
 	if err != nil {
+		metrics.EmailsSent.WithLabelValues(kind, metrics.ResultFailure).Inc()
 		return fmt.Errorf("failed to send email: %v", err)
 	}
+	metrics.EmailsSent.WithLabelValues(kind, metrics.ResultSuccess).Inc()
 
-	fmt.Printf("Password reset email sent to %s\n", email)
+	LoggerFromContext(ctx).InfoContext(ctx, "email sent", "type", kind, "email", email)
 	return nil
 }
+
+// CheckMailTransport verifies that the configured SMTP server accepts connections
+func CheckMailTransport(ctx context.Context) error {
+	addr := os.Getenv("SMTP_SERVER") + ":" + os.Getenv("SMTP_PORT")
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, os.Getenv("SMTP_SERVER"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if err := client.Noop(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
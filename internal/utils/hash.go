@@ -1,15 +1,24 @@
 package utils
 
 import (
+	"time"
+
+	"github.com/kraftzpepe/auth-service/internal/metrics"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func HashPassword(password string) (string, error) {
+	defer observeHash("hash", time.Now())
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
 }
 
 func CheckPasswordHash(password, hash string) bool {
+	defer observeHash("compare", time.Now())
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+func observeHash(operation string, start time.Time) {
+	metrics.PasswordHashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
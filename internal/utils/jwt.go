@@ -1,37 +1,96 @@
 package utils
 
 import (
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("your_jwt_secret_key_here") // Replace with a secure secret
+// jwtSecret signs and verifies access tokens. It is set at startup by SetJWTSecret.
+var jwtSecret []byte
 
+// MinJWTSecretLength is the minimum length in bytes of the secret signing access tokens
+const MinJWTSecretLength = 32
+
+var errJWTSecretNotSet = errors.New("JWT secret is not configured")
+
+// SetJWTSecret sets the secret that signs and verifies access tokens
+func SetJWTSecret(secret []byte) {
+	jwtSecret = secret
+}
+
+// AccessTokenTTL is the default lifetime of access tokens
+const AccessTokenTTL = 24 * time.Hour
+
+// ClientTokenTTL is the default lifetime of access tokens issued to OAuth clients for themselves
+const ClientTokenTTL = 15 * time.Minute
+
+// Claims are carried by access tokens. User tokens set UserID along with the user's roles and
+// permissions; tokens issued through the client credentials grant set ClientID instead, and their
+// subject is the client. Tokens scoped to an organization set OrgID, and their roles and
+// permissions are the ones the user holds in that organization. Claims resolved from an API key
+// rather than a JWT set APIKeyID.
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID      string   `json:"user_id,omitempty"`
+	OrgID       string   `json:"org_id,omitempty"`
+	APIKeyID    string   `json:"api_key_id,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // GenerateJWT generates a new JWT token for a user
 func GenerateJWT(userID string) (string, error) {
+	return GenerateJWTWithTTL(userID, AccessTokenTTL)
+}
+
+// GenerateJWTWithTTL generates a JWT token for a user that expires after ttl
+func GenerateJWTWithTTL(userID string, ttl time.Duration) (string, error) {
+	return GenerateJWTWithClaims(Claims{UserID: userID}, ttl)
+}
+
+// GenerateJWTWithClaims signs the given claims, setting the issue and expiry times from ttl
+func GenerateJWTWithClaims(claims Claims, ttl time.Duration) (string, error) {
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	if len(jwtSecret) == 0 {
+		return "", errJWTSecretNotSet
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+// GenerateClientJWT generates an access token whose subject is an OAuth client, limited to scope
+func GenerateClientJWT(clientID, scope string, ttl time.Duration) (string, error) {
 	claims := Claims{
-		UserID: userID,
+		ClientID: clientID,
+		Scope:    scope,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24 hours expiry
+			Subject:   clientID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	if len(jwtSecret) == 0 {
+		return "", errJWTSecretNotSet
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
 }
 
 // ValidateJWT validates a JWT token and returns the claims if valid
 func ValidateJWT(tokenString string) (*Claims, error) {
+	if len(jwtSecret) == 0 {
+		return nil, errJWTSecretNotSet
+	}
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -44,3 +103,23 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// IDTokenClaims are the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	Email             string           `json:"email,omitempty"`
+	EmailVerified     *bool            `json:"email_verified,omitempty"`
+	PreferredUsername string           `json:"preferred_username,omitempty"`
+	Name              string           `json:"name,omitempty"`
+	Picture           string           `json:"picture,omitempty"`
+	Nonce             string           `json:"nonce,omitempty"`
+	AuthTime          *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR               []string         `json:"amr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken signs an ID token with RS256 so relying parties can verify it against the published JWKS
+func GenerateIDToken(key *SigningKey, claims IDTokenClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Key)
+}
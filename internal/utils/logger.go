@@ -1,16 +1,158 @@
 package utils
 
 import (
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"regexp"
+	"strings"
 )
 
-var logger = log.New(os.Stdout, "LOG: ", log.Ldate|log.Ltime|log.Lshortfile)
+// RedactMode controls how a log attribute matching a redaction rule is rewritten
+type RedactMode string
 
-func LogInfo(msg string) {
-	logger.Println("INFO:", msg)
+const (
+	RedactFull RedactMode = "full" // replace the value entirely
+	RedactMask RedactMode = "mask" // keep just enough of the value to recognise it
+	RedactHash RedactMode = "hash" // replace with a short digest so equal values can be correlated
+)
+
+const redactedValue = "[REDACTED]"
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// RedactionRule redacts every attribute whose key contains Key (case-insensitive)
+type RedactionRule struct {
+	Key  string
+	Mode RedactMode
+}
+
+// DefaultRedactionRules are applied when LOG_REDACT_RULES is not set. The code rule covers sign-in codes,
+// authorization codes, device and user codes and PKCE verifiers alike.
+const DefaultRedactionRules = "password=full,token=full,secret=full,authorization=full,code=full,nonce=full,assertion=full,email=mask"
+
+// ParseRedactionRules parses a comma-separated list of key=mode pairs. A bare key means full redaction.
+func ParseRedactionRules(spec string) ([]RedactionRule, error) {
+	var rules []RedactionRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, mode, found := strings.Cut(part, "=")
+		rule := RedactionRule{Key: strings.ToLower(strings.TrimSpace(key)), Mode: RedactFull}
+		if rule.Key == "" {
+			return nil, fmt.Errorf("redaction rule %q has no key", part)
+		}
+		if found {
+			rule.Mode = RedactMode(strings.ToLower(strings.TrimSpace(mode)))
+		}
+		switch rule.Mode {
+		case RedactFull, RedactMask, RedactHash:
+		default:
+			return nil, fmt.Errorf("unknown redaction mode %q for key %q", rule.Mode, rule.Key)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// LoggerOptions configures NewLogger
+type LoggerOptions struct {
+	Level  string // debug, info, warn or error
+	Format string // json or text
+	Rules  []RedactionRule
+	Output io.Writer
+}
+
+// NewLogger builds a leveled structured logger that redacts sensitive attributes before they are written
+func NewLogger(opts LoggerOptions) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", opts.Level, err)
+	}
+
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	handlerOpts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: newRedactor(opts.Rules),
+	}
+
+	switch opts.Format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, handlerOpts)), nil
+	case "text", "":
+		return slog.New(slog.NewTextHandler(out, handlerOpts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", opts.Format)
+}
+
+// newRedactor returns a slog ReplaceAttr hook applying the rules by attribute key.
+// If any rule's key contains "email", addresses embedded in messages and other strings are scrubbed too,
+// with the mode of the last such rule.
+func newRedactor(rules []RedactionRule) func(groups []string, a slog.Attr) slog.Attr {
+	var emailMode RedactMode
+	for _, rule := range rules {
+		if strings.Contains(rule.Key, "email") {
+			emailMode = rule.Mode
+		}
+	}
+
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.SourceKey) {
+			return a
+		}
+
+		key := strings.ToLower(a.Key)
+		for _, rule := range rules {
+			if strings.Contains(key, rule.Key) {
+				return slog.String(a.Key, redact(a.Value.String(), rule.Mode))
+			}
+		}
+
+		if emailMode == "" {
+			return a
+		}
+		switch a.Value.Kind() {
+		case slog.KindString:
+			return slog.String(a.Key, scrubEmails(a.Value.String(), emailMode))
+		case slog.KindAny:
+			if err, ok := a.Value.Any().(error); ok {
+				return slog.String(a.Key, scrubEmails(err.Error(), emailMode))
+			}
+		}
+		return a
+	}
+}
+
+func scrubEmails(s string, mode RedactMode) string {
+	return emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		return redact(email, mode)
+	})
 }
 
-func LogError(msg string) {
-	logger.Println("ERROR:", msg)
+func redact(value string, mode RedactMode) string {
+	if value == "" {
+		return value
+	}
+	switch mode {
+	case RedactHash:
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	case RedactMask:
+		if local, domain, ok := strings.Cut(value, "@"); ok && local != "" {
+			return local[:1] + "***@" + domain
+		}
+		if len(value) > 8 {
+			return value[:2] + "***"
+		}
+	}
+	return redactedValue
 }
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRedactionRules(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []RedactionRule
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "Password", want: []RedactionRule{{Key: "password", Mode: RedactFull}}},
+		{
+			spec: " token=full , user_email=HASH,,phone=mask",
+			want: []RedactionRule{{Key: "token", Mode: RedactFull}, {Key: "user_email", Mode: RedactHash}, {Key: "phone", Mode: RedactMask}},
+		},
+		{spec: "password=blur", wantErr: true},
+		{spec: "=full", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRedactionRules(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRedactionRules(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRedactionRules(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	if _, err := ParseRedactionRules(DefaultRedactionRules); err != nil {
+		t.Errorf("DefaultRedactionRules do not parse: %v", err)
+	}
+}
+
+// logLine logs one message with a logger using the given rules and returns the decoded JSON line
+func logLine(t *testing.T, spec, msg string, args ...any) map[string]any {
+	t.Helper()
+	rules, err := ParseRedactionRules(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger, err := NewLogger(LoggerOptions{Level: "info", Format: "json", Rules: rules, Output: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info(msg, args...)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	return line
+}
+
+func TestRedactorRedactsByKey(t *testing.T) {
+	line := logLine(t, DefaultRedactionRules, "login",
+		"password", "hunter2", "refresh_token", "abc", "user_email", "jane@example.com", "user_id", "42")
+
+	if line["password"] != redactedValue || line["refresh_token"] != redactedValue {
+		t.Errorf("secrets not redacted: %v", line)
+	}
+	if line["user_email"] != "j***@example.com" {
+		t.Errorf("user_email = %v, want it masked", line["user_email"])
+	}
+	if line["user_id"] != "42" {
+		t.Errorf("user_id = %v, want it untouched", line["user_id"])
+	}
+}
+
+func TestRedactorRedactsCodesByDefault(t *testing.T) {
+	keys := []string{"code", "user_code", "device_code", "code_verifier", "device_nonce", "client_assertion"}
+	var args []any
+	for _, key := range keys {
+		args = append(args, key, "s3cr3t")
+	}
+	line := logLine(t, DefaultRedactionRules, "request received", args...)
+
+	for _, key := range keys {
+		if line[key] != redactedValue {
+			t.Errorf("%s = %v, want it redacted", key, line[key])
+		}
+	}
+}
+
+func TestRedactorScrubsEmailsInMessagesAndErrors(t *testing.T) {
+	for _, spec := range []string{"email=mask", "user_email=hash"} {
+		line := logLine(t, spec, "sent reset link to jane@example.com",
+			"error", errors.New("smtp: rejected bob@example.org"), "note", "cc alice@example.net")
+
+		for _, key := range []string{"msg", "error", "note"} {
+			value, _ := line[key].(string)
+			for _, email := range []string{"jane@example.com", "bob@example.org", "alice@example.net"} {
+				if strings.Contains(value, email) {
+					t.Errorf("rules %q: %s still holds %s: %q", spec, key, email, value)
+				}
+			}
+		}
+	}
+}
+
+func TestRedactorLeavesEmailsWithoutEmailRule(t *testing.T) {
+	for _, spec := range []string{"password=full", "mail=full", "e=hash"} {
+		line := logLine(t, spec, "sent reset link to jane@example.com")
+		if line["msg"] != "sent reset link to jane@example.com" {
+			t.Errorf("rules %q: msg = %q, want it untouched", spec, line["msg"])
+		}
+	}
+}
+
+func TestRedactModes(t *testing.T) {
+	if got := redact("jane@example.com", RedactMask); got != "j***@example.com" {
+		t.Errorf("mask email = %q", got)
+	}
+	if got := redact("abcdefghij", RedactMask); got != "ab***" {
+		t.Errorf("mask long value = %q", got)
+	}
+	if got := redact("short", RedactMask); got != redactedValue {
+		t.Errorf("mask short value = %q", got)
+	}
+	hashed := redact("jane@example.com", RedactHash)
+	if !strings.HasPrefix(hashed, "sha256:") || hashed != redact("jane@example.com", RedactHash) {
+		t.Errorf("hash = %q, want a stable sha256 digest", hashed)
+	}
+	if got := redact("", RedactFull); got != "" {
+		t.Errorf("empty value = %q, want it kept empty", got)
+	}
+}
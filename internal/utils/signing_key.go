@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// SigningKey is the RSA key that signs OpenID Connect ID tokens, published through the JWKS endpoint
+type SigningKey struct {
+	Key *rsa.PrivateKey
+	ID  string // RFC 7638 thumbprint, sent as the kid header
+}
+
+// LoadSigningKey reads an RSA private key in PKCS#1 or PKCS#8 PEM form.
+// An empty path generates a key that lives only as long as the process.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	if path == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(key), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in signing key file")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(key), nil
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing key must be an RSA key, got %T", parsed)
+		}
+		return newSigningKey(key), nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q in signing key file", block.Type)
+}
+
+func newSigningKey(key *rsa.PrivateKey) *SigningKey {
+	n, e := jwkModulus(&key.PublicKey), jwkExponent(&key.PublicKey)
+	thumbprint := sha256.Sum256([]byte(`{"e":"` + e + `","kty":"RSA","n":"` + n + `"}`))
+	return &SigningKey{Key: key, ID: base64.RawURLEncoding.EncodeToString(thumbprint[:])}
+}
+
+// JWK returns the public half of the key as a JSON Web Key
+func (k *SigningKey) JWK() map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": k.ID,
+		"n":   jwkModulus(&k.Key.PublicKey),
+		"e":   jwkExponent(&k.Key.PublicKey),
+	}
+}
+
+func jwkModulus(key *rsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+}
+
+func jwkExponent(key *rsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
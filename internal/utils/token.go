@@ -2,7 +2,9 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 )
 
 // GenerateRefreshToken generates a secure random token for refresh tokens
@@ -21,3 +23,10 @@ func GenerateSecureToken(length int) string {
 	_, _ = rand.Read(bytes) // Ignoring error since it is minimal in this use case
 	return base64.URLEncoding.EncodeToString(bytes)
 }
+
+// HashToken returns the SHA-256 digest of a high-entropy token for storage and lookup.
+// Unlike passwords, random tokens do not need a slow hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
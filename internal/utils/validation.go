@@ -1,29 +1,30 @@
 package utils
 
 import (
-	"errors"
 	"regexp"
+
+	"github.com/kraftzpepe/auth-service/types"
 )
 
 func ValidateEmail(email string) error {
 	if len(email) < 3 || !regexp.MustCompile(`^[^@]+@[^@]+\.(com)$`).MatchString(email) {
-		return errors.New("invalid email address")
+		return types.ErrInvalidEmail.WithMessage("invalid email address")
 	}
 	return nil
 }
 
 func ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters long")
+	if len(password) < types.MinPasswordLength {
+		return types.ErrWeakPassword.WithMessage("password must be at least 8 characters long")
 	}
 	if !regexp.MustCompile(`[A-Z]`).MatchString(password) {
-		return errors.New("password must contain at least one uppercase letter")
+		return types.ErrWeakPassword.WithMessage("password must contain at least one uppercase letter")
 	}
 	if !regexp.MustCompile(`[0-9]`).MatchString(password) {
-		return errors.New("password must contain at least one number")
+		return types.ErrWeakPassword.WithMessage("password must contain at least one number")
 	}
 	if !regexp.MustCompile(`[!@#$%^&*(),.?":{}|<>]`).MatchString(password) {
-		return errors.New("password must contain at least one special character")
+		return types.ErrWeakPassword.WithMessage("password must contain at least one special character")
 	}
 	return nil
 }
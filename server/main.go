@@ -1,22 +1,42 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/kraftzpepe/auth-service/config"
 	"github.com/kraftzpepe/auth-service/db"
+	"github.com/kraftzpepe/auth-service/internal/federation"
+	"github.com/kraftzpepe/auth-service/internal/gateway"
 	"github.com/kraftzpepe/auth-service/internal/handler"
+	"github.com/kraftzpepe/auth-service/internal/health"
+	"github.com/kraftzpepe/auth-service/internal/metrics"
+	"github.com/kraftzpepe/auth-service/internal/middleware"
+	"github.com/kraftzpepe/auth-service/internal/oauth"
 	"github.com/kraftzpepe/auth-service/internal/repositories"
 	"github.com/kraftzpepe/auth-service/internal/service"
+	"github.com/kraftzpepe/auth-service/internal/tlsconfig"
+	"github.com/kraftzpepe/auth-service/internal/tracing"
+	"github.com/kraftzpepe/auth-service/internal/utils"
 
 	pb "github.com/kraftzpepe/auth-service/proto/generated"
 
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 func main() {
@@ -26,53 +46,271 @@ func main() {
 		log.Println("No .env file found, using system environment variables")
 	}
 
+	cfg := config.LoadConfig()
+	utils.SetJWTSecret([]byte(cfg.JWTSecret))
+
+	// Set up structured logging
+	redactionRules, err := utils.ParseRedactionRules(cfg.LogRedactRules)
+	if err != nil {
+		log.Fatalf("Invalid LOG_REDACT_RULES: %v", err)
+	}
+	logger, err := utils.NewLogger(utils.LoggerOptions{
+		Level:  cfg.LogLevel,
+		Format: cfg.LogFormat,
+		Rules:  redactionRules,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter, cfg.TracingSampleRatio)
+	if err != nil {
+		fatal("failed to initialize tracing", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("error flushing traces", "error", err)
+		}
+	}()
+
 	// Load database connection
 	database, err := db.ConnectDB()
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("failed to connect to database", err)
 	}
 	defer func() {
 		if err := database.Close(); err != nil {
-			log.Printf("Error closing database connection: %v", err)
+			logger.Error("error closing database connection", "error", err)
 		}
 	}()
 
+	metrics.RegisterDBStats(database)
+
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(database)
 	refreshTokenRepo := repositories.NewRefreshTokenRepository(database)
 	passwordResetTokenRepo := repositories.NewPasswordResetTokenRepository(database)
+	authorizationCodeRepo := repositories.NewAuthorizationCodeRepository(database)
+	oauthClientRepo := repositories.NewOAuthClientRepository(database)
+	clientAssertionRepo := repositories.NewClientAssertionRepository(database)
+	externalIdentityRepo := repositories.NewExternalIdentityRepository(database)
+	federatedLoginStateRepo := repositories.NewFederatedLoginStateRepository(database)
+	roleRepo := repositories.NewRoleRepository(database)
+	organizationRepo := repositories.NewOrganizationRepository(database)
+	apiKeyRepo := repositories.NewAPIKeyRepository(database)
+	emailChangeRepo := repositories.NewEmailChangeRepository(database)
+	auditRepo := repositories.NewAuditRepository(database)
+	webhookRepo := repositories.NewWebhookRepository(database)
+	loginCodeRepo := repositories.NewLoginCodeRepository(database)
+	deviceAuthorizationRepo := repositories.NewDeviceAuthorizationRepository(database)
+
+	// Load the key that signs ID tokens
+	signingKey, err := utils.LoadSigningKey(cfg.OIDCSigningKeyFile)
+	if err != nil {
+		fatal("failed to load OIDC signing key", err)
+	}
+	if cfg.OIDCSigningKeyFile == "" {
+		logger.Warn("OIDC_SIGNING_KEY_FILE is not set, ID tokens are signed with a temporary key", "kid", signingKey.ID)
+	}
 
 	// Initialize services
-	authService := service.NewAuthService(userRepo, refreshTokenRepo, passwordResetTokenRepo)
+	auditService := service.NewAuditService(auditRepo)
+	webhookService := service.NewWebhookService(webhookRepo, userRepo)
+	authService := service.NewAuthService(userRepo, refreshTokenRepo, passwordResetTokenRepo, roleRepo, auditService, webhookService)
+	oauthService := service.NewOAuthService(authService, oauthClientRepo, authorizationCodeRepo, clientAssertionRepo, deviceAuthorizationRepo, signingKey, cfg.OAuthIssuer)
+	oauthClientService := service.NewOAuthClientService(oauthClientRepo)
+	roleService := service.NewRoleService(roleRepo, auditService)
+	organizationService := service.NewOrganizationService(authService, organizationRepo)
+	apiKeyService := service.NewAPIKeyService(authService, apiKeyRepo)
+	userAdminService := service.NewUserAdminService(authService, userRepo, webhookService)
+	loginCodeService := service.NewLoginCodeService(authService, loginCodeRepo)
+	profileService := service.NewProfileService(userRepo, emailChangeRepo, webhookService, loginCodeService)
+
+	// Upstream identity providers users can sign in with
+	var providers []*federation.Provider
+	for _, p := range cfg.FederationProviders {
+		providers = append(providers, &federation.Provider{
+			Name:         p.Name,
+			DisplayName:  p.DisplayName,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Scopes:       p.Scopes,
+			RedirectURL:  oauthService.Issuer + service.FederationCallbackPath,
+		})
+		logger.Info("federated login enabled", "provider", p.Name, "issuer", p.Issuer)
+	}
+	federationService := service.NewFederationService(oauthService, externalIdentityRepo, federatedLoginStateRepo, providers)
 
 	// Initialize handlers
-	authHandler := handler.NewAuthHandler(authService)
+	authHandler := handler.NewAuthHandler(authService, oauthClientService, roleService, organizationService, apiKeyService, userAdminService, profileService, auditService, webhookService, loginCodeService)
 
 	// Start gRPC server
-	grpcPort := config.LoadConfig().GRPCPort
+	grpcPort := cfg.GRPCPort
 	listener, err := net.Listen("tcp", ":"+grpcPort)
 	if err != nil {
-		log.Fatalf("Failed to listen on port %s: %v", grpcPort, err)
+		fatal("failed to listen", err, "port", grpcPort)
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			middleware.UnaryLoggingInterceptor(logger, cfg.LogPayloads),
+			middleware.UnaryMetricsInterceptor(),
+			middleware.UnaryErrorInterceptor(),
+			middleware.UnaryAdminAuthInterceptor(cfg.AdminToken, apiKeyService, authService),
+			middleware.UnaryAuditInterceptor(auditService),
+		),
+	}
+
+	// Serve TLS when a certificate is configured, reloading it when the files change
+	var serverTLS *tls.Config
+	if cfg.TLSCertFile != "" {
+		reloader, err := tlsconfig.NewReloader(tlsconfig.ServerOptions{
+			CertFile:       cfg.TLSCertFile,
+			KeyFile:        cfg.TLSKeyFile,
+			ClientCAFile:   cfg.TLSClientCAFile,
+			ClientAuth:     cfg.TLSClientAuth,
+			ReloadInterval: cfg.TLSReloadInterval,
+		})
+		if err != nil {
+			fatal("failed to load TLS configuration", err)
+		}
+		defer reloader.Close()
+		serverTLS = reloader.Config()
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(serverTLS)))
+		logger.Info("TLS enabled", "client_auth", cfg.TLSClientAuth)
+	} else {
+		logger.Warn("TLS is disabled, credentials are sent in plaintext")
 	}
 
-	grpcServer := grpc.NewServer()
+	if cfg.AdminToken == "" {
+		logger.Warn("ADMIN_TOKEN is not set, admin RPCs require an access token with the matching permission")
+	}
+
+	grpcServer := grpc.NewServer(serverOpts...)
 	pb.RegisterAuthServiceServer(grpcServer, authHandler) // Ensure the AuthServiceServer is registered
 
+	// Health checks driven by database and mail transport reachability
+	healthChecker := health.NewChecker(cfg.HealthCheckInterval, []string{pb.AuthService_ServiceDesc.ServiceName},
+		health.Check{Name: "database", Critical: true, Probe: database.PingContext},
+		health.Check{Name: "mail", Critical: cfg.HealthMailRequired, Probe: utils.CheckMailTransport},
+	)
+	healthpb.RegisterHealthServer(grpcServer, healthChecker.Server)
+	healthChecker.Start()
+
+	// Send queued webhook deliveries in the background
+	webhookDispatcher := service.NewWebhookDispatcher(webhookRepo, cfg.WebhookPollInterval, cfg.WebhookTimeout)
+	webhookDispatcher.Start()
+
+	if cfg.GRPCReflection {
+		reflection.Register(grpcServer)
+	}
+	metrics.InitializeGRPC(grpcServer)
+
+	// The HTTP/JSON gateway reaches the gRPC server over an in-process listener,
+	// so gateway traffic goes through the same interceptors as direct gRPC calls
+	gatewayListener := bufconn.Listen(1 << 20)
+	gatewayConn, err := grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return gatewayListener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		fatal("failed to create gateway connection", err)
+	}
+	defer gatewayConn.Close()
+
+	gatewayHandler, err := gateway.New(gatewayConn)
+	if err != nil {
+		fatal("failed to build HTTP gateway", err)
+	}
+
+	// The public HTTP listener serves the gateway and the OAuth and OpenID Connect endpoints
+	publicMux := http.NewServeMux()
+	publicMux.Handle("/", gatewayHandler)
+	oauthHandler := oauth.New(oauthService, federationService, apiKeyService)
+	publicMux.Handle("/oauth/", oauthHandler)
+	publicMux.Handle("/.well-known/", oauthHandler)
+	publicHandler := gateway.WithCORS(gateway.CORSOptions{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}, publicMux)
+	httpServer := &http.Server{Addr: cfg.HTTPAddr, Handler: publicHandler, TLSConfig: serverTLS}
+
+	// Admin HTTP listener for operational endpoints
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/metrics", metrics.Handler())
+	adminServer := &http.Server{Addr: cfg.AdminHTTPAddr, Handler: adminMux}
+
 	// Graceful shutdown setup
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("Starting gRPC server on port %s", grpcPort)
+		logger.Info("starting gRPC server", "port", grpcPort)
 		if err := grpcServer.Serve(listener); err != nil {
-			log.Fatalf("Failed to serve gRPC server: %v", err)
+			fatal("failed to serve gRPC server", err)
+		}
+	}()
+
+	go func() {
+		if err := grpcServer.Serve(gatewayListener); err != nil {
+			fatal("failed to serve gateway listener", err)
+		}
+	}()
+
+	go func() {
+		logger.Info("starting HTTP gateway", "addr", cfg.HTTPAddr)
+		if err := serveHTTP(httpServer); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("failed to serve HTTP gateway", err)
+		}
+	}()
+
+	go func() {
+		logger.Info("starting admin HTTP server", "addr", cfg.AdminHTTPAddr)
+		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("failed to serve admin HTTP server", err)
 		}
 	}()
 
 	<-stopChan // Wait for termination signal
-	log.Println("Shutting down gracefully...")
+	logger.Info("shutting down gracefully")
+
+	// Report NOT_SERVING first so probes stop routing traffic while in-flight calls drain
+	healthChecker.Shutdown()
+
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		logger.Error("error stopping HTTP gateway", "error", err)
+	}
 
 	grpcServer.GracefulStop()
-	log.Println("gRPC server stopped")
-	log.Println("Service shutdown complete")
+	logger.Info("gRPC server stopped")
+
+	webhookDispatcher.Shutdown()
+
+	if err := adminServer.Shutdown(context.Background()); err != nil {
+		logger.Error("error stopping admin HTTP server", "error", err)
+	}
+	logger.Info("service shutdown complete")
+}
+
+// serveHTTP serves the public HTTP listener, sharing the gRPC server certificate when TLS is configured
+func serveHTTP(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// fatal logs an error with the structured logger and exits
+func fatal(msg string, err error, attrs ...any) {
+	slog.Error(msg, append(attrs, "error", err)...)
+	os.Exit(1)
 }
@@ -1,11 +1,183 @@
 package types
 
-import "errors"
+// ErrorDomain identifies this service in machine-readable error details
+const ErrorDomain = "auth-service"
+
+// Kind classifies a domain error independently of the transport it is returned over
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalidArgument
+	KindNotFound
+	KindAlreadyExists
+	KindUnauthenticated
+	KindPermissionDenied
+	KindFailedPrecondition
+	KindResourceExhausted
+	KindUnavailable
+)
+
+// Stable machine-readable reason codes. Clients may switch on these, so never rename them.
+const (
+	ReasonInternal            = "INTERNAL"
+	ReasonInvalidEmail        = "INVALID_EMAIL"
+	ReasonWeakPassword        = "WEAK_PASSWORD"
+	ReasonInvalidUsername     = "INVALID_USERNAME"
+	ReasonInvalidIdentifier   = "INVALID_IDENTIFIER"
+	ReasonUserNotFound        = "USER_NOT_FOUND"
+	ReasonUserExists          = "USER_EXISTS"
+	ReasonUsernameTaken       = "USERNAME_TAKEN"
+	ReasonEmailTaken          = "EMAIL_TAKEN"
+	ReasonInvalidCredentials  = "INVALID_CREDENTIALS"
+	ReasonInvalidResetToken   = "INVALID_RESET_TOKEN"
+	ReasonInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	ReasonEmailDelivery       = "EMAIL_DELIVERY_FAILED"
+
+	// OAuth 2.0 reasons; the OAuth endpoints translate them into RFC 6749 error codes
+	ReasonInvalidRequest          = "INVALID_REQUEST"
+	ReasonInvalidClient           = "INVALID_CLIENT"
+	ReasonInvalidRedirectURI      = "INVALID_REDIRECT_URI"
+	ReasonInvalidGrant            = "INVALID_GRANT"
+	ReasonInvalidScope            = "INVALID_SCOPE"
+	ReasonUnauthorizedClient      = "UNAUTHORIZED_CLIENT"
+	ReasonUnsupportedGrantType    = "UNSUPPORTED_GRANT_TYPE"
+	ReasonUnsupportedResponseType = "UNSUPPORTED_RESPONSE_TYPE"
+	ReasonAccessDenied            = "ACCESS_DENIED"
+
+	ReasonUnauthenticated       = "UNAUTHENTICATED"
+	ReasonPermissionDenied      = "PERMISSION_DENIED"
+	ReasonClientNotFound        = "CLIENT_NOT_FOUND"
+	ReasonInvalidClientMetadata = "INVALID_CLIENT_METADATA"
+	ReasonFederatedLoginFailed  = "FEDERATED_LOGIN_FAILED"
+	ReasonRoleNotFound          = "ROLE_NOT_FOUND"
+	ReasonRoleExists            = "ROLE_EXISTS"
+	ReasonInvalidRole           = "INVALID_ROLE"
+	ReasonOrganizationNotFound  = "ORGANIZATION_NOT_FOUND"
+	ReasonOrganizationExists    = "ORGANIZATION_EXISTS"
+	ReasonInvalidOrganization   = "INVALID_ORGANIZATION"
+	ReasonMembershipNotFound    = "MEMBERSHIP_NOT_FOUND"
+	ReasonNotMember             = "NOT_A_MEMBER"
+	ReasonInvalidInvitation     = "INVALID_INVITATION"
+	ReasonAPIKeyNotFound        = "API_KEY_NOT_FOUND"
+	ReasonInvalidAPIKey         = "INVALID_API_KEY"
+	ReasonAccountSuspended      = "ACCOUNT_SUSPENDED"
+	ReasonAccountPending        = "ACCOUNT_PENDING"
+	ReasonInvalidStatusChange   = "INVALID_STATUS_CHANGE"
+	ReasonInvalidEmailChange    = "INVALID_EMAIL_CHANGE"
+	ReasonWebhookNotFound       = "WEBHOOK_NOT_FOUND"
+	ReasonInvalidWebhook        = "INVALID_WEBHOOK"
+	ReasonDeliveryNotFound      = "WEBHOOK_DELIVERY_NOT_FOUND"
+	ReasonInvalidMagicLink      = "INVALID_MAGIC_LINK"
+	ReasonInvalidLoginCode      = "INVALID_LOGIN_CODE"
+	ReasonLoginCodeThrottled    = "LOGIN_CODE_THROTTLED"
+	ReasonAuthorizationPending  = "AUTHORIZATION_PENDING"
+	ReasonSlowDown              = "SLOW_DOWN"
+	ReasonExpiredDeviceCode     = "EXPIRED_DEVICE_CODE"
+	ReasonInvalidUserCode       = "INVALID_USER_CODE"
+	ReasonTooManyAttempts       = "TOO_MANY_ATTEMPTS"
+)
+
+// Error is the domain error returned by services. The transport layer maps Kind to a
+// status code and exposes Reason and Field to clients; Err is kept for logs only.
+type Error struct {
+	Kind    Kind
+	Reason  string
+	Message string
+	Field   string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any *Error carrying the same reason, so errors.Is works on copies made by WithMessage and Wrap
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Reason == e.Reason
+}
+
+// WithMessage returns a copy of the error with a more specific client-facing message
+func (e *Error) WithMessage(message string) *Error {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// WithField returns a copy of the error attributed to a specific request field
+func (e *Error) WithField(field string) *Error {
+	c := *e
+	c.Field = field
+	return &c
+}
+
+// Wrap returns a copy of the error that records the underlying cause
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
 
 var (
-	ErrInvalidEmail  = errors.New("invalid email format")
-	ErrWeakPassword  = errors.New("password does not meet security requirements")
-	ErrUserNotFound  = errors.New("user not found")
-	ErrUserExists    = errors.New("user already exists")
-	ErrInternalError = errors.New("internal server error")
+	ErrInvalidEmail            = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidEmail, Field: "email", Message: "invalid email format"}
+	ErrWeakPassword            = &Error{Kind: KindInvalidArgument, Reason: ReasonWeakPassword, Field: "password", Message: "password does not meet security requirements"}
+	ErrInvalidUsername         = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidUsername, Field: "username", Message: "invalid username"}
+	ErrInvalidIdentifier       = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidIdentifier, Field: "identifier", Message: "invalid identifier"}
+	ErrUserNotFound            = &Error{Kind: KindNotFound, Reason: ReasonUserNotFound, Message: "user not found"}
+	ErrUserExists              = &Error{Kind: KindAlreadyExists, Reason: ReasonUserExists, Message: "user already exists"}
+	ErrUsernameTaken           = &Error{Kind: KindAlreadyExists, Reason: ReasonUsernameTaken, Field: "username", Message: "username is already taken"}
+	ErrEmailTaken              = &Error{Kind: KindAlreadyExists, Reason: ReasonEmailTaken, Field: "email", Message: "email is already registered"}
+	ErrInvalidCredentials      = &Error{Kind: KindUnauthenticated, Reason: ReasonInvalidCredentials, Message: "invalid email or password"}
+	ErrInvalidResetToken       = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidResetToken, Field: "token", Message: "invalid or expired token"}
+	ErrInvalidRefreshToken     = &Error{Kind: KindUnauthenticated, Reason: ReasonInvalidRefreshToken, Message: "invalid or expired refresh token"}
+	ErrEmailDeliveryFailed     = &Error{Kind: KindUnavailable, Reason: ReasonEmailDelivery, Message: "failed to send email"}
+	ErrInvalidRequest          = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidRequest, Message: "invalid request"}
+	ErrInvalidClient           = &Error{Kind: KindUnauthenticated, Reason: ReasonInvalidClient, Message: "client authentication failed"}
+	ErrInvalidRedirectURI      = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidRedirectURI, Field: "redirect_uri", Message: "redirect_uri is not registered for this client"}
+	ErrInvalidGrant            = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidGrant, Message: "invalid, expired or already used grant"}
+	ErrInvalidScope            = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidScope, Field: "scope", Message: "requested scope is not allowed for this client"}
+	ErrUnauthorizedClient      = &Error{Kind: KindPermissionDenied, Reason: ReasonUnauthorizedClient, Message: "client is not allowed to use this grant type"}
+	ErrUnsupportedGrantType    = &Error{Kind: KindInvalidArgument, Reason: ReasonUnsupportedGrantType, Field: "grant_type", Message: "unsupported grant type"}
+	ErrUnsupportedResponseType = &Error{Kind: KindInvalidArgument, Reason: ReasonUnsupportedResponseType, Field: "response_type", Message: "unsupported response type"}
+	ErrAccessDenied            = &Error{Kind: KindPermissionDenied, Reason: ReasonAccessDenied, Message: "the user denied the request"}
+	ErrUnauthenticated         = &Error{Kind: KindUnauthenticated, Reason: ReasonUnauthenticated, Message: "missing or invalid credentials"}
+	ErrPermissionDenied        = &Error{Kind: KindPermissionDenied, Reason: ReasonPermissionDenied, Message: "permission denied"}
+	ErrClientNotFound          = &Error{Kind: KindNotFound, Reason: ReasonClientNotFound, Message: "OAuth client not found"}
+	ErrInvalidClientMetadata   = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidClientMetadata, Message: "invalid client settings"}
+	ErrFederatedLoginFailed    = &Error{Kind: KindUnauthenticated, Reason: ReasonFederatedLoginFailed, Message: "sign-in with the identity provider failed"}
+	ErrRoleNotFound            = &Error{Kind: KindNotFound, Reason: ReasonRoleNotFound, Field: "role", Message: "role not found"}
+	ErrRoleExists              = &Error{Kind: KindAlreadyExists, Reason: ReasonRoleExists, Field: "name", Message: "role already exists"}
+	ErrInvalidRole             = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidRole, Message: "invalid role"}
+	ErrOrganizationNotFound    = &Error{Kind: KindNotFound, Reason: ReasonOrganizationNotFound, Field: "org_id", Message: "organization not found"}
+	ErrOrganizationExists      = &Error{Kind: KindAlreadyExists, Reason: ReasonOrganizationExists, Field: "slug", Message: "an organization with this slug already exists"}
+	ErrInvalidOrganization     = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidOrganization, Message: "invalid organization"}
+	ErrMembershipNotFound      = &Error{Kind: KindNotFound, Reason: ReasonMembershipNotFound, Field: "user_id", Message: "the user is not a member of this organization"}
+	ErrNotMember               = &Error{Kind: KindPermissionDenied, Reason: ReasonNotMember, Field: "org_id", Message: "you are not a member of this organization"}
+	ErrInvalidInvitation       = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidInvitation, Field: "token", Message: "invalid or expired invitation"}
+	ErrAPIKeyNotFound          = &Error{Kind: KindNotFound, Reason: ReasonAPIKeyNotFound, Field: "id", Message: "API key not found"}
+	ErrInvalidAPIKey           = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidAPIKey, Message: "invalid API key"}
+	ErrAccountSuspended        = &Error{Kind: KindPermissionDenied, Reason: ReasonAccountSuspended, Message: "this account has been suspended"}
+	ErrAccountPending          = &Error{Kind: KindPermissionDenied, Reason: ReasonAccountPending, Message: "this account has not been activated yet"}
+	ErrInvalidStatusChange     = &Error{Kind: KindFailedPrecondition, Reason: ReasonInvalidStatusChange, Message: "the account cannot change to this status"}
+	ErrInvalidEmailChange      = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidEmailChange, Field: "token", Message: "invalid or expired email change link"}
+	ErrWebhookNotFound         = &Error{Kind: KindNotFound, Reason: ReasonWebhookNotFound, Field: "id", Message: "webhook subscription not found"}
+	ErrInvalidWebhook          = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidWebhook, Message: "invalid webhook subscription"}
+	ErrDeliveryNotFound        = &Error{Kind: KindNotFound, Reason: ReasonDeliveryNotFound, Field: "delivery_id", Message: "webhook delivery not found"}
+	ErrInvalidMagicLink        = &Error{Kind: KindUnauthenticated, Reason: ReasonInvalidMagicLink, Field: "token", Message: "invalid, expired or already used sign-in link"}
+	ErrInvalidLoginCode        = &Error{Kind: KindUnauthenticated, Reason: ReasonInvalidLoginCode, Field: "code", Message: "invalid or expired code"}
+	ErrLoginCodeThrottled      = &Error{Kind: KindResourceExhausted, Reason: ReasonLoginCodeThrottled, Message: "too many codes requested, try again later"}
+	ErrAuthorizationPending    = &Error{Kind: KindFailedPrecondition, Reason: ReasonAuthorizationPending, Message: "the user has not approved the device yet"}
+	ErrSlowDown                = &Error{Kind: KindResourceExhausted, Reason: ReasonSlowDown, Message: "polling too fast, wait longer between requests"}
+	ErrExpiredDeviceCode       = &Error{Kind: KindInvalidArgument, Reason: ReasonExpiredDeviceCode, Field: "device_code", Message: "the device code has expired"}
+	ErrInvalidUserCode         = &Error{Kind: KindInvalidArgument, Reason: ReasonInvalidUserCode, Field: "user_code", Message: "invalid or expired code"}
+	ErrTooManyAttempts         = &Error{Kind: KindResourceExhausted, Reason: ReasonTooManyAttempts, Message: "too many attempts, try again later"}
+	ErrInternalError           = &Error{Kind: KindInternal, Reason: ReasonInternal, Message: "internal server error"}
 )